@@ -15,6 +15,7 @@
 package access
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -25,23 +26,29 @@ type BaseClaim struct {
 	jwt.StandardClaims
 }
 
-// Valid is copy from source code, and changed c.VerifyExpiresAt parameter.
+// Valid validates the time based claims without the leeway.
 func (c *BaseClaim) Valid() error {
+	return c.ValidWithLeeway(0)
+}
+
+// ValidWithLeeway is copy from source code, and changed c.VerifyExpiresAt parameter, allowing the clock skew of the leeway.
+func (c *BaseClaim) ValidWithLeeway(leeway time.Duration) error {
 	vErr := new(jwt.ValidationError)
 	now := jwt.TimeFunc().Unix()
+	skew := int64(leeway.Seconds())
 
-	if !c.VerifyExpiresAt(now, true) {
+	if !c.VerifyExpiresAt(now-skew, true) {
 		delta := time.Unix(now, 0).Sub(time.Unix(c.ExpiresAt, 0))
 		vErr.Inner = fmt.Errorf("token is expired by %v", delta)
 		vErr.Errors |= jwt.ValidationErrorExpired
 	}
 
-	if !c.VerifyIssuedAt(now, false) {
+	if !c.VerifyIssuedAt(now+skew, false) {
 		vErr.Inner = fmt.Errorf("Token used before issued")
 		vErr.Errors |= jwt.ValidationErrorIssuedAt
 	}
 
-	if !c.VerifyNotBefore(now, false) {
+	if !c.VerifyNotBefore(now+skew, false) {
 		vErr.Inner = fmt.Errorf("token is not valid yet")
 		vErr.Errors |= jwt.ValidationErrorNotValidYet
 	}
@@ -63,5 +70,29 @@ type OAuth2AccessTokenClaim struct {
 	ProxyPrincipal string                 `json:"proxy,omitempty"`
 	Scope          []string               `json:"scp"`
 	Confirm        map[string]interface{} `json:"cnf"`
+	// Audiences are the audiences of the aud claim, which is either a string or an array of strings.
+	// The Audience of the StandardClaims is set only if the aud claim has a single audience.
+	Audiences []string `json:"-"`
+	// Domain is the Athenz domain of the policies to authorize the access token, resolved from the audiences by the issuer config.
+	// It is set by ParseAndValidateOAuth2AccessToken.
+	Domain string `json:"-"`
 	BaseClaim
 }
+
+// UnmarshalJSON decodes the access token claim, accepting both a string and an array of strings as the aud claim.
+func (c *OAuth2AccessTokenClaim) UnmarshalJSON(b []byte) error {
+	type claim OAuth2AccessTokenClaim // without the UnmarshalJSON method
+	v := struct {
+		*claim
+		Audience jwt.ClaimStrings `json:"aud"`
+	}{claim: (*claim)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	c.Audiences = []string(v.Audience)
+	c.Audience = ""
+	if len(v.Audience) == 1 {
+		c.Audience = v.Audience[0]
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// discoveryPath is the path of the OpenID Provider configuration under the issuer
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// discoveryTimeout is the timeout of the OIDC discovery, which blocks the access token validation
+	discoveryTimeout = 5 * time.Second
+
+	// discoveryRetryInterval is the interval to retry the failed OIDC discovery of an issuer
+	discoveryRetryInterval = 10 * time.Second
+)
+
+// IssuerConfig represent the validation config of the access tokens of an issuer, selected by the iss claim.
+type IssuerConfig struct {
+	// Issuer is the expected iss claim, e.g. https://zts.athenz.io/zts/v1
+	Issuer string
+	// JWKSURL is the JWK set URL of the issuer, discovered from <Issuer>/.well-known/openid-configuration if empty
+	JWKSURL string
+	// Audiences are the accepted aud claims, the token is accepted if any of its audiences is accepted, all audiences are accepted if empty
+	Audiences []string
+	// AudienceDomains maps the aud claims to the Athenz domains of the policies to authorize the access tokens, e.g. for the non-Athenz issuer.
+	// If set, the access token without any mapped audience is rejected.
+	// If empty, the aud claim is the Athenz domain as the access tokens issued by ZTS, unless the token has multiple audiences.
+	AudienceDomains map[string]string
+	// Algorithms are the accepted signing algorithms, e.g. RS256 and ES256, all algorithms of the keys are accepted if empty
+	Algorithms []string
+	// ClockSkew is the leeway of the exp, nbf and iat claims
+	ClockSkew time.Duration
+}
+
+// issuer represent the issuer config with the JWK set URL resolved by the OIDC discovery
+type issuer struct {
+	cfg IssuerConfig
+
+	mu       sync.Mutex // guards jwksURL, lastErr and lastTry, not held during the discovery
+	jwksURL  string
+	lastErr  error
+	lastTry  time.Time
+	register func(jwksURL string)
+
+	discovery singleflight.Group // coalesces the concurrent discoveries
+}
+
+// openIDConfiguration represent the fields of the OpenID Provider configuration used for the discovery
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// validate returns error if the issuer config is invalid
+func (c *IssuerConfig) validate() error {
+	if c.Issuer == "" {
+		return errors.New("issuer is empty")
+	}
+	u := c.JWKSURL
+	if u == "" {
+		u = c.Issuer
+	}
+	if err := validateHTTPSURL(u); err != nil {
+		return errors.Wrapf(err, "invalid issuer config of %s", c.Issuer)
+	}
+	if c.ClockSkew < 0 {
+		return errors.Errorf("invalid issuer config of %s: negative clock skew", c.Issuer)
+	}
+	for aud, domain := range c.AudienceDomains {
+		if domain == "" {
+			return errors.Errorf("invalid issuer config of %s: empty domain of audience %s", c.Issuer, aud)
+		}
+	}
+	return nil
+}
+
+// resolveJWKSURL returns the JWK set URL of the issuer, discovered on first use if not configured.
+// The concurrent discoveries are coalesced, and the failed discovery is not retried within the discovery retry interval.
+func (is *issuer) resolveJWKSURL(cl *http.Client) (string, error) {
+	if u, ok, err := is.cachedJWKSURL(); ok {
+		return u, err
+	}
+	u, err, _ := is.discovery.Do("", func() (interface{}, error) {
+		// the discovery may be completed just before joining
+		if u, ok, err := is.cachedJWKSURL(); ok {
+			return u, err
+		}
+		return is.discover(cl)
+	})
+	if err != nil {
+		return "", err
+	}
+	return u.(string), nil
+}
+
+// cachedJWKSURL returns the discovered JWK set URL, or the last error within the discovery retry interval
+func (is *issuer) cachedJWKSURL() (string, bool, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if is.jwksURL != "" {
+		return is.jwksURL, true, nil
+	}
+	if is.lastErr != nil && fastime.Now().Sub(is.lastTry) < discoveryRetryInterval {
+		return "", true, is.lastErr
+	}
+	return "", false, nil
+}
+
+// discover discovers the JWK set URL of the issuer and caches the result
+func (is *issuer) discover(cl *http.Client) (string, error) {
+	now := fastime.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	u, err := discoverJWKSURL(ctx, cl, is.cfg.Issuer)
+
+	is.mu.Lock()
+	is.lastTry = now
+	if err != nil {
+		is.lastErr = err
+		is.mu.Unlock()
+		glg.Warnf("OIDC discovery error, issuer: %s, error: %v", is.cfg.Issuer, err)
+		return "", err
+	}
+	is.jwksURL, is.lastErr = u, nil
+	is.mu.Unlock()
+
+	glg.Infof("OIDC discovery success, issuer: %s, jwks_uri: %s", is.cfg.Issuer, u)
+	if is.register != nil {
+		is.register(u)
+	}
+	return u, nil
+}
+
+// isAlgorithmAllowed reports whether the signing algorithm is accepted for the issuer
+func (is *issuer) isAlgorithmAllowed(alg string) bool {
+	return len(is.cfg.Algorithms) == 0 || contains(is.cfg.Algorithms, alg)
+}
+
+// isAudienceAllowed reports whether any of the audiences is accepted for the issuer
+func (is *issuer) isAudienceAllowed(auds []string) bool {
+	if len(is.cfg.Audiences) == 0 {
+		return true
+	}
+	for _, aud := range auds {
+		if contains(is.cfg.Audiences, aud) {
+			return true
+		}
+	}
+	return false
+}
+
+// audienceDomain returns the Athenz domain of the audiences, mapped by the AudienceDomains of the issuer if configured.
+// Otherwise, the single audience is the Athenz domain, and the domain is empty if the token has multiple audiences.
+func audienceDomain(is *issuer, auds []string) (string, error) {
+	if is != nil && len(is.cfg.AudienceDomains) > 0 {
+		for _, aud := range auds {
+			if domain, ok := is.cfg.AudienceDomains[aud]; ok {
+				return domain, nil
+			}
+		}
+		return "", errors.Errorf("error audience %v is not mapped to any domain for issuer %s", auds, is.cfg.Issuer)
+	}
+	if len(auds) != 1 {
+		return "", nil
+	}
+	return auds[0], nil
+}
+
+// discoverJWKSURL returns the jwks_uri of the OpenID Provider configuration of the issuer
+func discoverJWKSURL(ctx context.Context, cl *http.Client, iss string) (string, error) {
+	if cl == nil {
+		cl = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(iss, "/")+discoveryPath, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating OIDC discovery request")
+	}
+	r, err := cl.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error make http request")
+	}
+	defer func() {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			glg.Warn(errors.Wrap(err, "error io.copy"))
+		}
+		if err := r.Body.Close(); err != nil {
+			glg.Warn(errors.Wrap(err, "error body.close"))
+		}
+	}()
+	if r.StatusCode != http.StatusOK {
+		return "", errors.Errorf("OIDC discovery http return status %d", r.StatusCode)
+	}
+
+	var oc openIDConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&oc); err != nil {
+		return "", errors.Wrap(err, "OIDC discovery json format not correct")
+	}
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if oc.Issuer != iss {
+		return "", errors.Errorf("OIDC discovery issuer mismatch: %s", oc.Issuer)
+	}
+	if err := validateHTTPSURL(oc.JWKSURI); err != nil {
+		return "", errors.Wrap(err, "invalid OIDC discovery jwks_uri")
+	}
+	return oc.JWKSURI, nil
+}
+
+func validateHTTPSURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("not an https URL: %s", s)
+	}
+	return nil
+}
+
+func contains(vs []string, v string) bool {
+	for _, s := range vs {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,502 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestIssuerConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     IssuerConfig
+		wantErr bool
+	}{
+		{
+			name: "JWKS URL",
+			cfg:  IssuerConfig{Issuer: "issuer", JWKSURL: "https://athenz.io/oauth2/keys"},
+		},
+		{
+			name: "discovery",
+			cfg:  IssuerConfig{Issuer: "https://athenz.io", ClockSkew: time.Minute},
+		},
+		{
+			name:    "empty issuer",
+			cfg:     IssuerConfig{JWKSURL: "https://athenz.io/oauth2/keys"},
+			wantErr: true,
+		},
+		{
+			name:    "http JWKS URL",
+			cfg:     IssuerConfig{Issuer: "https://athenz.io", JWKSURL: "http://athenz.io/oauth2/keys"},
+			wantErr: true,
+		},
+		{
+			name:    "discovery of http issuer",
+			cfg:     IssuerConfig{Issuer: "http://athenz.io"},
+			wantErr: true,
+		},
+		{
+			name:    "empty domain of audience",
+			cfg:     IssuerConfig{Issuer: "https://accounts.example.com", AudienceDomains: map[string]string{"https://api.athenz.io": ""}},
+			wantErr: true,
+		},
+		{
+			name:    "negative clock skew",
+			cfg:     IssuerConfig{Issuer: "https://athenz.io", ClockSkew: -time.Second},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("IssuerConfig.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_issuer_resolveJWKSURL(t *testing.T) {
+	var (
+		calls  int32
+		body   atomic.Value
+		status int32 = http.StatusOK
+		// blocks the response until closed if set
+		release atomic.Pointer[chan struct{}]
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if ch := release.Load(); ch != nil {
+			<-*ch
+		}
+		if r.URL.Path != discoveryPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		fmt.Fprint(w, body.Load().(string))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "discovery success",
+			body: `{"issuer":"%s","jwks_uri":"https://athenz.io/oauth2/keys"}`,
+			want: "https://athenz.io/oauth2/keys",
+		},
+		{
+			name:    "issuer mismatch",
+			body:    `{"issuer":"https://other.athenz.io","jwks_uri":"https://athenz.io/oauth2/keys"}`,
+			wantErr: true,
+		},
+		{
+			name:    "http jwks_uri",
+			body:    `{"issuer":"%s","jwks_uri":"http://athenz.io/oauth2/keys"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			body:    `{`,
+			wantErr: true,
+		},
+		{
+			name:    "http error",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body.Store(strings.ReplaceAll(tt.body, "%s", srv.URL))
+			if tt.status == 0 {
+				tt.status = http.StatusOK
+			}
+			atomic.StoreInt32(&status, int32(tt.status))
+
+			var registered string
+			is := &issuer{
+				cfg:      IssuerConfig{Issuer: srv.URL},
+				register: func(u string) { registered = u },
+			}
+			got, err := is.resolveJWKSURL(srv.Client())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("issuer.resolveJWKSURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("issuer.resolveJWKSURL() = %v, want %v", got, tt.want)
+			}
+			if registered != tt.want {
+				t.Errorf("registered = %v, want %v", registered, tt.want)
+			}
+		})
+	}
+
+	t.Run("discovered URL is cached", func(t *testing.T) {
+		body.Store(fmt.Sprintf(`{"issuer":"%s","jwks_uri":"https://athenz.io/oauth2/keys"}`, srv.URL))
+		atomic.StoreInt32(&status, http.StatusOK)
+		is := &issuer{cfg: IssuerConfig{Issuer: srv.URL}}
+		before := atomic.LoadInt32(&calls)
+		for i := 0; i < 3; i++ {
+			if _, err := is.resolveJWKSURL(srv.Client()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := atomic.LoadInt32(&calls) - before; got != 1 {
+			t.Errorf("discovery calls = %d, want 1", got)
+		}
+	})
+
+	t.Run("concurrent discoveries are coalesced without holding the lock", func(t *testing.T) {
+		body.Store(fmt.Sprintf(`{"issuer":"%s","jwks_uri":"https://athenz.io/oauth2/keys"}`, srv.URL))
+		atomic.StoreInt32(&status, http.StatusOK)
+		ch := make(chan struct{})
+		release.Store(&ch)
+		defer release.Store(nil)
+
+		is := &issuer{cfg: IssuerConfig{Issuer: srv.URL}}
+		before := atomic.LoadInt32(&calls)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got, err := is.resolveJWKSURL(srv.Client()); err != nil || got != "https://athenz.io/oauth2/keys" {
+					t.Errorf("issuer.resolveJWKSURL() = %v, %v", got, err)
+				}
+			}()
+		}
+		for atomic.LoadInt32(&calls) == before {
+			time.Sleep(time.Millisecond)
+		}
+		if !is.mu.TryLock() {
+			t.Error("issuer lock is held during the discovery")
+		} else {
+			is.mu.Unlock()
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(ch)
+		wg.Wait()
+		if got := atomic.LoadInt32(&calls) - before; got != 1 {
+			t.Errorf("discovery calls = %d, want 1", got)
+		}
+	})
+
+	t.Run("failed discovery is not retried within the retry interval", func(t *testing.T) {
+		atomic.StoreInt32(&status, http.StatusInternalServerError)
+		is := &issuer{cfg: IssuerConfig{Issuer: srv.URL}}
+		before := atomic.LoadInt32(&calls)
+		for i := 0; i < 3; i++ {
+			if _, err := is.resolveJWKSURL(srv.Client()); err == nil {
+				t.Fatal("issuer.resolveJWKSURL() error = nil")
+			}
+		}
+		if got := atomic.LoadInt32(&calls) - before; got != 1 {
+			t.Errorf("discovery calls = %d, want 1", got)
+		}
+
+		// retried after the retry interval
+		atomic.StoreInt32(&status, http.StatusOK)
+		is.lastTry = is.lastTry.Add(-discoveryRetryInterval)
+		if got, err := is.resolveJWKSURL(srv.Client()); err != nil || got != "https://athenz.io/oauth2/keys" {
+			t.Errorf("issuer.resolveJWKSURL() = %v, %v", got, err)
+		}
+	})
+}
+
+func Test_atp_issuerJWKSURL(t *testing.T) {
+	newToken := func(iss, alg string) *jwt.Token {
+		return &jwt.Token{
+			Method: jwt.GetSigningMethod(alg),
+			Claims: &OAuth2AccessTokenClaim{
+				BaseClaim: BaseClaim{StandardClaims: jwt.StandardClaims{Issuer: iss}},
+			},
+		}
+	}
+	a := &atp{}
+	if err := WithIssuers(nil, IssuerConfig{
+		Issuer:     "https://athenz.io",
+		JWKSURL:    "https://athenz.io/oauth2/keys",
+		Algorithms: []string{"ES256"},
+	})(a); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		token   *jwt.Token
+		jku     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "JWK set URL of the issuer",
+			token: newToken("https://athenz.io", "ES256"),
+			want:  "https://athenz.io/oauth2/keys",
+		},
+		{
+			name:  "jku of the issuer",
+			token: newToken("https://athenz.io", "ES256"),
+			jku:   "https://athenz.io/oauth2/keys",
+			want:  "https://athenz.io/oauth2/keys",
+		},
+		{
+			name:    "jku of the other issuer",
+			token:   newToken("https://athenz.io", "ES256"),
+			jku:     "https://evil.example.com/keys",
+			wantErr: true,
+		},
+		{
+			name:    "unknown issuer",
+			token:   newToken("https://evil.example.com", "ES256"),
+			wantErr: true,
+		},
+		{
+			name:    "algorithm not accepted",
+			token:   newToken("https://athenz.io", "RS256"),
+			wantErr: true,
+		},
+		{
+			name:    "claims not set",
+			token:   &jwt.Token{Method: jwt.SigningMethodES256},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.issuerJWKSURL(tt.token, tt.jku)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("atp.issuerJWKSURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("atp.issuerJWKSURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseClaim_ValidWithLeeway(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		claim   BaseClaim
+		leeway  time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			claim: BaseClaim{StandardClaims: jwt.StandardClaims{IssuedAt: now, ExpiresAt: now + 60}},
+		},
+		{
+			name:    "expired",
+			claim:   BaseClaim{StandardClaims: jwt.StandardClaims{IssuedAt: now - 120, ExpiresAt: now - 30}},
+			wantErr: true,
+		},
+		{
+			name:   "expired within the leeway",
+			claim:  BaseClaim{StandardClaims: jwt.StandardClaims{IssuedAt: now - 120, ExpiresAt: now - 30}},
+			leeway: time.Minute,
+		},
+		{
+			name:    "issued in the future",
+			claim:   BaseClaim{StandardClaims: jwt.StandardClaims{IssuedAt: now + 30, ExpiresAt: now + 120}},
+			wantErr: true,
+		},
+		{
+			name:   "issued in the future within the leeway",
+			claim:  BaseClaim{StandardClaims: jwt.StandardClaims{IssuedAt: now + 30, NotBefore: now + 30, ExpiresAt: now + 120}},
+			leeway: time.Minute,
+		},
+		{
+			name:    "not valid yet",
+			claim:   BaseClaim{StandardClaims: jwt.StandardClaims{NotBefore: now + 30, ExpiresAt: now + 120}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.claim.ValidWithLeeway(tt.leeway); (err != nil) != tt.wantErr {
+				t.Errorf("BaseClaim.ValidWithLeeway() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOAuth2AccessTokenClaim_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantAudience  string
+		wantAudiences []string
+		wantErr       bool
+	}{
+		{
+			name:          "string audience",
+			data:          `{"sub":"domain.tenant.service","aud":"domain.provider","scp":["admin"]}`,
+			wantAudience:  "domain.provider",
+			wantAudiences: []string{"domain.provider"},
+		},
+		{
+			name:          "single audience array",
+			data:          `{"sub":"domain.tenant.service","aud":["domain.provider"],"scp":["admin"]}`,
+			wantAudience:  "domain.provider",
+			wantAudiences: []string{"domain.provider"},
+		},
+		{
+			name:          "multiple audiences",
+			data:          `{"sub":"domain.tenant.service","aud":["domain.provider","https://api.athenz.io"],"scp":["admin"]}`,
+			wantAudiences: []string{"domain.provider", "https://api.athenz.io"},
+		},
+		{
+			name: "no audience",
+			data: `{"sub":"domain.tenant.service","scp":["admin"]}`,
+		},
+		{
+			name:    "invalid audience",
+			data:    `{"sub":"domain.tenant.service","aud":1}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c OAuth2AccessTokenClaim
+			err := json.Unmarshal([]byte(tt.data), &c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OAuth2AccessTokenClaim.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if c.Audience != tt.wantAudience || !reflect.DeepEqual(c.Audiences, tt.wantAudiences) {
+				t.Errorf("OAuth2AccessTokenClaim.UnmarshalJSON() audience = %v, %v, want %v, %v", c.Audience, c.Audiences, tt.wantAudience, tt.wantAudiences)
+			}
+			if c.Subject != "domain.tenant.service" || !reflect.DeepEqual(c.Scope, []string{"admin"}) {
+				t.Errorf("OAuth2AccessTokenClaim.UnmarshalJSON() = %+v, other claims not decoded", c)
+			}
+		})
+	}
+}
+
+func Test_issuer_isAudienceAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		audiences []string
+		auds      []string
+		want      bool
+	}{
+		{
+			name: "all audiences accepted",
+			auds: []string{"any"},
+			want: true,
+		},
+		{
+			name:      "any of the audiences accepted",
+			audiences: []string{"domain.provider"},
+			auds:      []string{"https://api.athenz.io", "domain.provider"},
+			want:      true,
+		},
+		{
+			name:      "audience not accepted",
+			audiences: []string{"domain.provider"},
+			auds:      []string{"https://api.athenz.io"},
+			want:      false,
+		},
+		{
+			name:      "no audience",
+			audiences: []string{"domain.provider"},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := &issuer{cfg: IssuerConfig{Audiences: tt.audiences}}
+			if got := is.isAudienceAllowed(tt.auds); got != tt.want {
+				t.Errorf("issuer.isAudienceAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_audienceDomain(t *testing.T) {
+	mapped := &issuer{cfg: IssuerConfig{
+		Issuer:          "https://accounts.example.com",
+		AudienceDomains: map[string]string{"https://api.athenz.io": "domain.provider"},
+	}}
+	tests := []struct {
+		name    string
+		is      *issuer
+		auds    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "audience of Athenz",
+			auds: []string{"domain.provider"},
+			want: "domain.provider",
+		},
+		{
+			name: "audience of the issuer without mapping",
+			is:   &issuer{cfg: IssuerConfig{Issuer: "https://zts.athenz.io"}},
+			auds: []string{"domain.provider"},
+			want: "domain.provider",
+		},
+		{
+			name: "multiple audiences without mapping",
+			auds: []string{"domain.provider", "https://api.athenz.io"},
+			want: "",
+		},
+		{
+			name: "mapped audience",
+			is:   mapped,
+			auds: []string{"other", "https://api.athenz.io"},
+			want: "domain.provider",
+		},
+		{
+			name:    "audience not mapped",
+			is:      mapped,
+			auds:    []string{"domain.provider"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := audienceDomain(tt.is, tt.auds)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("audienceDomain() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("audienceDomain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
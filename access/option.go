@@ -15,6 +15,7 @@
 package access
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/AthenZ/athenz-authorizer/v5/jwk"
@@ -89,3 +90,37 @@ func WithClientCertificateOffsetSeconds(t string) Option {
 		return nil
 	}
 }
+
+// WithIssuers represents set issuers functional option.
+// The access tokens are validated by the config of the iss claim, and the access token of the other issuers is rejected.
+// The register is called with the JWK set URL of each issuer, including the discovered one, to let the JWK provider fetch it.
+func WithIssuers(register func(jwksURL string), cfgs ...IssuerConfig) Option {
+	return func(r *atp) error {
+		if len(cfgs) == 0 {
+			return nil
+		}
+		r.issuers = make(map[string]*issuer, len(cfgs))
+		for _, cfg := range cfgs {
+			if err := cfg.validate(); err != nil {
+				return err
+			}
+			if _, ok := r.issuers[cfg.Issuer]; ok {
+				return errors.Errorf("duplicated issuer config of %s", cfg.Issuer)
+			}
+			is := &issuer{cfg: cfg, jwksURL: cfg.JWKSURL, register: register}
+			if is.jwksURL != "" && register != nil {
+				register(is.jwksURL)
+			}
+			r.issuers[cfg.Issuer] = is
+		}
+		return nil
+	}
+}
+
+// WithHTTPClient represents set HTTP client functional option, used for the OIDC discovery
+func WithHTTPClient(cl *http.Client) Option {
+	return func(r *atp) error {
+		r.client = cl
+		return nil
+	}
+}
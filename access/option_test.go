@@ -16,7 +16,9 @@ package access
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/AthenZ/athenz-authorizer/v5/jwk"
@@ -359,3 +361,86 @@ func TestWithClientCertificateOffsetSeconds(t *testing.T) {
 		})
 	}
 }
+
+func TestWithIssuers(t *testing.T) {
+	type args struct {
+		cfgs []IssuerConfig
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantIssuers    []string
+		wantRegistered []string
+		wantErr        bool
+	}{
+		{
+			name: "set success",
+			args: args{
+				cfgs: []IssuerConfig{
+					{Issuer: "https://zts.athenz.io", JWKSURL: "https://zts.athenz.io/oauth2/keys"},
+					{Issuer: "https://idp.example.com"},
+				},
+			},
+			wantIssuers:    []string{"https://idp.example.com", "https://zts.athenz.io"},
+			wantRegistered: []string{"https://zts.athenz.io/oauth2/keys"},
+		},
+		{
+			name: "empty value",
+		},
+		{
+			name: "duplicated issuer",
+			args: args{
+				cfgs: []IssuerConfig{
+					{Issuer: "https://idp.example.com"},
+					{Issuer: "https://idp.example.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config",
+			args: args{
+				cfgs: []IssuerConfig{
+					{Issuer: "https://idp.example.com", JWKSURL: "http://idp.example.com/keys"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var registered []string
+			r := &atp{}
+			err := WithIssuers(func(u string) { registered = append(registered, u) }, tt.args.cfgs...)(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithIssuers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []string
+			for iss := range r.issuers {
+				got = append(got, iss)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantIssuers) {
+				t.Errorf("WithIssuers() issuers = %v, want %v", got, tt.wantIssuers)
+			}
+			if !reflect.DeepEqual(registered, tt.wantRegistered) {
+				t.Errorf("WithIssuers() registered = %v, want %v", registered, tt.wantRegistered)
+			}
+		})
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	cl := &http.Client{}
+	r := &atp{}
+	if err := WithHTTPClient(cl)(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.client != cl {
+		t.Errorf("WithHTTPClient() client = %v, want %v", r.client, cl)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"net/http"
+	"time"
 
 	"github.com/AthenZ/athenz-authorizer/v5/jwk"
 	"github.com/golang-jwt/jwt/v4"
@@ -39,6 +41,9 @@ var errKeyNotFoundInHeader = errors.New("key not written in header")
 // errHeaderValueNotString is "header value not written as string"
 var errHeaderValueNotString = errors.New("header value not written as string")
 
+// parser validates the claims after the signature, with the leeway of the issuer
+var parser = &jwt.Parser{SkipClaimsValidation: true}
+
 // Processor represents the access token parser interface.
 type Processor interface {
 	ParseAndValidateOAuth2AccessToken(cred string, cert *x509.Certificate) (*OAuth2AccessTokenClaim, error)
@@ -53,6 +58,10 @@ type atp struct {
 	clientCertificateOffsetSeconds int64
 	enableVerifyClientID           bool
 	authorizedClientIDs            map[string][]string
+	// the access tokens are validated by the config of the iss claim if not empty, map[<iss>]*issuer
+	issuers map[string]*issuer
+	// used for the OIDC discovery
+	client *http.Client
 }
 
 // New returns the Processor instance.
@@ -68,7 +77,7 @@ func New(opts ...Option) (Processor, error) {
 
 func (a *atp) ParseAndValidateOAuth2AccessToken(cred string, cert *x509.Certificate) (*OAuth2AccessTokenClaim, error) {
 
-	tok, err := jwt.ParseWithClaims(cred, &OAuth2AccessTokenClaim{}, a.keyFunc)
+	tok, err := parser.ParseWithClaims(cred, &OAuth2AccessTokenClaim{}, a.keyFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +86,21 @@ func (a *atp) ParseAndValidateOAuth2AccessToken(cred string, cert *x509.Certific
 		return nil, errors.New("error invalid access token")
 	}
 
+	var leeway time.Duration
+	is := a.issuers[claims.Issuer]
+	if is != nil {
+		leeway = is.cfg.ClockSkew
+	}
+	if err := claims.ValidWithLeeway(leeway); err != nil {
+		return nil, err
+	}
+	if is != nil && !is.isAudienceAllowed(claims.Audiences) {
+		return nil, errors.Errorf("error audience %v is not accepted for issuer %s", claims.Audiences, claims.Issuer)
+	}
+	if claims.Domain, err = audienceDomain(is, claims.Audiences); err != nil {
+		return nil, err
+	}
+
 	// validate client_id of AccessToken
 	if a.enableVerifyClientID {
 		err := a.validateClientID(cert, claims)
@@ -201,6 +225,13 @@ func (a *atp) keyFunc(token *jwt.Token) (interface{}, error) {
 		return nil, errors.New(err.Error() + ":" + jws.JWKSetURLKey)
 	}
 
+	// the keys are selected by the issuer if the issuers are configured
+	if len(a.issuers) > 0 {
+		if jwkSetURL, err = a.issuerJWKSURL(token, jwkSetURL); err != nil {
+			return nil, err
+		}
+	}
+
 	key := a.jwkp(keyID, jwkSetURL)
 
 	if key == nil {
@@ -210,6 +241,29 @@ func (a *atp) keyFunc(token *jwt.Token) (interface{}, error) {
 	return key, nil
 }
 
+// issuerJWKSURL returns the JWK set URL of the issuer of the token, and validates the signing algorithm and the jku of the token
+func (a *atp) issuerJWKSURL(token *jwt.Token, jku string) (string, error) {
+	claims, ok := token.Claims.(*OAuth2AccessTokenClaim)
+	if !ok || claims == nil {
+		return "", errors.New("error claim of access token is nil")
+	}
+	is, ok := a.issuers[claims.Issuer]
+	if !ok {
+		return "", errors.Errorf("error issuer %s is not accepted", claims.Issuer)
+	}
+	if token.Method == nil || !is.isAlgorithmAllowed(token.Method.Alg()) {
+		return "", errors.Errorf("error signing algorithm is not accepted for issuer %s", claims.Issuer)
+	}
+	u, err := is.resolveJWKSURL(a.client)
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolve JWK set URL of issuer %s", claims.Issuer)
+	}
+	if jku != "" && jku != u {
+		return "", errors.Errorf("error jku %s is not the JWK set URL of issuer %s", jku, claims.Issuer)
+	}
+	return u, nil
+}
+
 // getAsStringFromHeader return string header value and error.
 // return error is not found or not string cases.
 func getAsStringFromHeader(header *map[string]interface{}, key string) (string, error) {
@@ -55,6 +55,8 @@ func TestNew(t *testing.T) {
 				0,
 				false,
 				nil,
+				nil,
+				nil,
 			},
 			wantErr: false,
 		},
@@ -72,6 +74,8 @@ func TestNew(t *testing.T) {
 				0,
 				false,
 				nil,
+				nil,
+				nil,
 			},
 			wantErr: false,
 		},
@@ -317,11 +321,13 @@ func Test_rtp_ParseAndValidateOAuth2AccessToken(t *testing.T) {
 								Audience:  "domain.provider",
 							},
 						},
-						AuthTime: 1584513441,
-						Version:  1,
-						ClientID: "domain.tenant.service",
-						UserID:   "domain.tenant.service",
-						Scope:    []string{"admin", "user"},
+						AuthTime:  1584513441,
+						Version:   1,
+						ClientID:  "domain.tenant.service",
+						UserID:    "domain.tenant.service",
+						Scope:     []string{"admin", "user"},
+						Audiences: []string{"domain.provider"},
+						Domain:    "domain.provider",
 					}
 					return &c
 				}(),
@@ -359,11 +365,13 @@ func Test_rtp_ParseAndValidateOAuth2AccessToken(t *testing.T) {
 								Audience:  "domain.provider",
 							},
 						},
-						AuthTime: 1585122381,
-						Version:  1,
-						ClientID: "domain.tenant.service",
-						UserID:   "domain.tenant.service",
-						Scope:    []string{"admin", "user"},
+						AuthTime:  1585122381,
+						Version:   1,
+						ClientID:  "domain.tenant.service",
+						UserID:    "domain.tenant.service",
+						Scope:     []string{"admin", "user"},
+						Audiences: []string{"domain.provider"},
+						Domain:    "domain.provider",
 					}
 					return &c
 				}(),
@@ -396,12 +404,14 @@ func Test_rtp_ParseAndValidateOAuth2AccessToken(t *testing.T) {
 								Audience:  "domain.provider",
 							},
 						},
-						AuthTime: 1585122381,
-						Version:  1,
-						ClientID: "domain.tenant.service",
-						UserID:   "domain.tenant.service",
-						Scope:    []string{"admin", "user"},
-						Confirm:  map[string]interface{}{"x5t#S256": "2jt82f2uM8jE2LMcb4erhhTc-uy1yB1iEyp5MnI5uF4"},
+						AuthTime:  1585122381,
+						Version:   1,
+						ClientID:  "domain.tenant.service",
+						UserID:    "domain.tenant.service",
+						Scope:     []string{"admin", "user"},
+						Audiences: []string{"domain.provider"},
+						Domain:    "domain.provider",
+						Confirm:   map[string]interface{}{"x5t#S256": "2jt82f2uM8jE2LMcb4erhhTc-uy1yB1iEyp5MnI5uF4"},
 					}
 					return &c
 				}(),
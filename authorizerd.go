@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -53,6 +54,13 @@ type Authorizerd interface {
 	VerifyRoleCert(ctx context.Context, peerCerts []*x509.Certificate, act, res string) error
 	AuthorizeRoleCert(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (Principal, error)
 	GetPolicyCache(ctx context.Context) map[string][]*policy.Assertion
+	ExportPolicies(ctx context.Context) *policy.PolicyExport
+	AddLocalAssertions(ctx context.Context, las ...*policy.LocalAssertion) error
+	DeleteLocalAssertions(ctx context.Context, domain, role string) int
+	DeleteLocalPrincipalAssertions(ctx context.Context, domain, principal string) int
+	GetAccessRoles(ctx context.Context, domain, act, res string) *policy.AccessRoles
+	GetRolePermissions(ctx context.Context, domain string, roles []string) []*policy.Permission
+	Refresh(ctx context.Context, domains ...string) error
 	GetPrincipalCacheLen() int
 	GetPrincipalCacheSize() int64
 }
@@ -81,30 +89,65 @@ type authority struct {
 	roleCertURIPrefix string
 
 	// pubkeyd parameters
-	disablePubkeyd        bool
-	pubkeyRefreshPeriod   string
-	pubkeyRetryDelay      string
-	pubkeySysAuthDomain   string
-	pubkeyETagExpiry      string
-	pubkeyETagPurgePeriod string
+	disablePubkeyd         bool
+	pubkeyRefreshPeriod    string
+	pubkeyRetryDelay       string
+	pubkeyGracePeriod      string
+	pubkeySysAuthDomain    string
+	pubkeyETagExpiry       string
+	pubkeyETagPurgePeriod  string
+	pubkeyDirs             map[pubkey.AthenzEnv]string
+	pubkeyFiles            map[pubkey.AthenzEnv]map[string]string
+	pubkeyStaticKeys       map[pubkey.AthenzEnv]map[string][]byte
+	pubkeyMergeFetchedKeys bool
+	pubkeyFileWatchPeriod  string
+	pubkeyZTSFromJwks      bool
+	pubkeyAllowedKeyIDs    map[pubkey.AthenzEnv][]string
+	pubkeyKeyPins          map[pubkey.AthenzEnv]map[string]string
 
 	// policyd parameters
-	disablePolicyd      bool
-	athenzDomains       []string
-	policyExpiryMargin  string
-	policyRefreshPeriod string
-	policyPurgePeriod   string
-	policyRetryDelay    string
-	policyRetryAttempts int
+	disablePolicyd            bool
+	athenzDomains             []string
+	policyExpiryMargin        string
+	policyRefreshPeriod       string
+	policyPurgePeriod         string
+	policyRetryDelay          string
+	policyRetryAttempts       int
+	policyDir                 string
+	policyFiles               map[string]string
+	policyFileWatchPeriod     string
+	policyFetcherFactory      policy.FetcherFactory
+	policyLocalAssertionsFile string
+	policyExportFile          string
+	crossDomainResource       bool
+	policyCombiningAlg        policy.CombiningAlgorithm
+	policyDomainCombiningAlgs map[string]policy.CombiningAlgorithm
+	policyCaseSensitive       bool
+	policyDetectCaseSensitive bool
+	policyResourceHierarchy   bool
+	policyStaleGracePeriod    string
+	policyStaleFailOpen       bool
+	policyFetchConcurrency    int
+	policyRefreshJitter       string
+	policyRefreshSpread       string
 
 	// jwkd parameters
-	disableJwkd      bool
-	jwkRefreshPeriod string
-	jwkRetryDelay    string
-	jwkURLs          []string
+	disableJwkd             bool
+	jwkRefreshPeriod        string
+	jwkRetryDelay           string
+	jwkURLs                 []string
+	jwkAllowedKeyIDs        map[string][]string
+	jwkKeyPins              map[string]map[string]string
+	jwkRefreshOnMiss        bool
+	jwkMissRefreshInterval  string
+	jwkUnknownKeyIDCacheTTL string
+	jwkJkuPatterns          []string
+	jwkJkuCacheTTL          string
+	jwkJkuCacheSize         int
 
 	// accessTokenProcessor parameters
-	accessTokenParam AccessTokenParam
+	accessTokenParam   AccessTokenParam
+	accessTokenIssuers []access.IssuerConfig
 
 	// roleTokenProcessor parameters
 	enableRoleToken bool
@@ -155,20 +198,77 @@ func New(opts ...Option) (Authorizerd, error) {
 		SetExpiredHook(prov.cacheExpiredHook)
 
 	if !prov.disablePubkeyd {
-		if prov.pubkeyd, err = pubkey.New(
+		pkOpts := []pubkey.Option{
 			pubkey.WithAthenzURL(prov.athenzURL),
 			pubkey.WithSysAuthDomain(prov.pubkeySysAuthDomain),
 			pubkey.WithETagExpiry(prov.pubkeyETagExpiry),
 			pubkey.WithETagPurgePeriod(prov.pubkeyETagPurgePeriod),
 			pubkey.WithRefreshPeriod(prov.pubkeyRefreshPeriod),
 			pubkey.WithRetryDelay(prov.pubkeyRetryDelay),
+			pubkey.WithKeyGracePeriod(prov.pubkeyGracePeriod),
+			pubkey.WithMergeFetchedKeys(prov.pubkeyMergeFetchedKeys),
+			pubkey.WithKeyFileWatchPeriod(prov.pubkeyFileWatchPeriod),
 			pubkey.WithHTTPClient(prov.client),
-		); err != nil {
+		}
+		if prov.pubkeyZTSFromJwks {
+			// the ZTS public keys are provided by jwkd
+			pkOpts = append(pkOpts, pubkey.WithEnvs(pubkey.EnvZMS))
+		}
+		for env, dir := range prov.pubkeyDirs {
+			pkOpts = append(pkOpts, pubkey.WithKeyDir(env, dir))
+		}
+		for env, files := range prov.pubkeyFiles {
+			pkOpts = append(pkOpts, pubkey.WithKeyFiles(env, files))
+		}
+		for env, keys := range prov.pubkeyStaticKeys {
+			pkOpts = append(pkOpts, pubkey.WithStaticKeys(env, keys))
+		}
+		for env, ids := range prov.pubkeyAllowedKeyIDs {
+			pkOpts = append(pkOpts, pubkey.WithAllowedKeyIDs(env, ids...))
+		}
+		for env, pins := range prov.pubkeyKeyPins {
+			pkOpts = append(pkOpts, pubkey.WithKeyPins(env, pins))
+		}
+		if prov.pubkeyd, err = pubkey.New(pkOpts...); err != nil {
 			return nil, err
 		}
 		pkPro = prov.pubkeyd.GetProvider()
 	}
 
+	if !prov.disableJwkd {
+		jwkOpts := []jwk.Option{
+			jwk.WithAthenzJwksURL(prov.athenzURL),
+			jwk.WithRefreshPeriod(prov.jwkRefreshPeriod),
+			jwk.WithRetryDelay(prov.jwkRetryDelay),
+			jwk.WithURLs(prov.jwkURLs),
+			jwk.WithRefreshOnMiss(prov.jwkRefreshOnMiss),
+			jwk.WithMissRefreshInterval(prov.jwkMissRefreshInterval),
+			jwk.WithUnknownKeyIDCacheTTL(prov.jwkUnknownKeyIDCacheTTL),
+			jwk.WithJkuPatterns(prov.jwkJkuPatterns...),
+			jwk.WithJkuCacheTTL(prov.jwkJkuCacheTTL),
+			jwk.WithJkuCacheSize(prov.jwkJkuCacheSize),
+			jwk.WithHTTPClient(prov.client),
+		}
+		for url, ids := range prov.jwkAllowedKeyIDs {
+			jwkOpts = append(jwkOpts, jwk.WithAllowedKeyIDs(url, ids...))
+		}
+		for url, pins := range prov.jwkKeyPins {
+			jwkOpts = append(jwkOpts, jwk.WithKeyPins(url, pins))
+		}
+		if prov.jwkd, err = jwk.New(jwkOpts...); err != nil {
+			return nil, err
+		}
+		jwkPro = prov.jwkd.GetProvider()
+	}
+
+	// the provider is wrapped before policyd is created, since policyd verifies the signed policies by the ZTS public keys
+	if prov.pubkeyZTSFromJwks {
+		if prov.disableJwkd {
+			return nil, errors.New("jwkd must be enabled to provide the ZTS public keys from the JWK set")
+		}
+		pkPro = pubkey.NewJWKProvider(jwkPro, pkPro)
+	}
+
 	if !prov.disablePolicyd {
 		if prov.policyd, err = policy.New(
 			policy.WithAthenzURL(prov.athenzURL),
@@ -178,6 +278,23 @@ func New(opts ...Option) (Authorizerd, error) {
 			policy.WithPurgePeriod(prov.policyPurgePeriod),
 			policy.WithRetryDelay(prov.policyRetryDelay),
 			policy.WithRetryAttempts(prov.policyRetryAttempts),
+			policy.WithPolicyDir(prov.policyDir),
+			policy.WithPolicyFiles(prov.policyFiles),
+			policy.WithPolicyFileWatchPeriod(prov.policyFileWatchPeriod),
+			policy.WithFetcherFactory(prov.policyFetcherFactory),
+			policy.WithLocalAssertionsFile(prov.policyLocalAssertionsFile),
+			policy.WithPolicyExportFile(prov.policyExportFile),
+			policy.WithCrossDomainResource(prov.crossDomainResource),
+			policy.WithCombiningAlgorithm(prov.policyCombiningAlg),
+			policy.WithDomainCombiningAlgorithms(prov.policyDomainCombiningAlgs),
+			policy.WithCaseSensitive(prov.policyCaseSensitive),
+			policy.WithDetectCaseSensitive(prov.policyDetectCaseSensitive),
+			policy.WithResourceHierarchy(prov.policyResourceHierarchy),
+			policy.WithStalePolicyGracePeriod(prov.policyStaleGracePeriod),
+			policy.WithStalePolicyFailOpen(prov.policyStaleFailOpen),
+			policy.WithFetchConcurrency(prov.policyFetchConcurrency),
+			policy.WithRefreshJitter(prov.policyRefreshJitter),
+			policy.WithRefreshSpread(prov.policyRefreshSpread),
 			policy.WithHTTPClient(prov.client),
 			policy.WithPubKeyProvider(pkPro),
 		); err != nil {
@@ -185,19 +302,6 @@ func New(opts ...Option) (Authorizerd, error) {
 		}
 	}
 
-	if !prov.disableJwkd {
-		if prov.jwkd, err = jwk.New(
-			jwk.WithAthenzJwksURL(prov.athenzURL),
-			jwk.WithRefreshPeriod(prov.jwkRefreshPeriod),
-			jwk.WithRetryDelay(prov.jwkRetryDelay),
-			jwk.WithURLs(prov.jwkURLs),
-			jwk.WithHTTPClient(prov.client),
-		); err != nil {
-			return nil, err
-		}
-		jwkPro = prov.jwkd.GetProvider()
-	}
-
 	if prov.enableRoleToken {
 		if prov.roleProcessor, err = role.New(
 			role.WithPubkeyProvider(pkPro),
@@ -207,14 +311,23 @@ func New(opts ...Option) (Authorizerd, error) {
 	}
 
 	if prov.accessTokenParam.enable {
-		if prov.accessProcessor, err = access.New(
+		atOpts := []access.Option{
 			access.WithJWKProvider(jwkPro),
 			access.WithEnableMTLSCertificateBoundAccessToken(prov.accessTokenParam.verifyCertThumbprint),
 			access.WithEnableVerifyClientID(prov.accessTokenParam.verifyClientID),
 			access.WithAuthorizedClientIDs(prov.accessTokenParam.authorizedClientIDs),
 			access.WithClientCertificateGoBackSeconds(prov.accessTokenParam.certBackdateDur),
 			access.WithClientCertificateOffsetSeconds(prov.accessTokenParam.certOffsetDur),
-		); err != nil {
+			access.WithHTTPClient(prov.client),
+		}
+		if len(prov.accessTokenIssuers) > 0 {
+			if prov.disableJwkd {
+				return nil, errors.New("jwkd must be enabled to validate the access tokens of the issuers")
+			}
+			// the JWK sets of the issuers are fetched by jwkd on first use
+			atOpts = append(atOpts, access.WithIssuers(prov.jwkd.AllowURL, prov.accessTokenIssuers...))
+		}
+		if prov.accessProcessor, err = access.New(atOpts...); err != nil {
 			return nil, err
 		}
 	}
@@ -294,6 +407,8 @@ func (a *authority) initAuthorizers() error {
 
 // Init initializes child daemons synchronously.
 func (a *authority) Init(ctx context.Context) error {
+	// the ZTS public keys verifying the signed policies are provided by jwkd
+	jwkdFirst := a.pubkeyZTSFromJwks && !a.disableJwkd && !a.disablePolicyd
 	eg, egCtx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
 		select {
@@ -303,16 +418,25 @@ func (a *authority) Init(ctx context.Context) error {
 			if !a.disablePubkeyd {
 				err := a.pubkeyd.Update(egCtx)
 				if err != nil {
-					return err
+					if !errors.Is(err, pubkey.ErrInvalidPubkey) {
+						return err
+					}
+					// the valid public keys are installed, the invalid ones are skipped
+					glg.Warn(err)
 				}
 			}
 			if !a.disablePolicyd {
+				if jwkdFirst {
+					if err := a.jwkd.Update(egCtx); err != nil {
+						return err
+					}
+				}
 				return a.policyd.Update(egCtx)
 			}
 			return nil
 		}
 	})
-	if !a.disableJwkd {
+	if !a.disableJwkd && !jwkdFirst {
 		eg.Go(func() error {
 			select {
 			case <-egCtx.Done():
@@ -460,17 +584,18 @@ func (a *authority) authorize(ctx context.Context, m mode, tok, act, res, query
 			glg.Infof("error parse and validate access token, err: %v", err)
 			return nil, errors.Wrap(err, "error authorize access token")
 		}
-		domain = ac.Audience
+		domain = ac.Domain
 		roles = ac.Scope
 		p = &oAuthAccessToken{
 			principal: principal{
 				name:       ac.Subject,
 				roles:      ac.Scope,
-				domain:     ac.Audience,
+				domain:     ac.Domain,
 				issueTime:  ac.IssuedAt,
 				expiryTime: ac.ExpiresAt,
 			},
 			clientID: ac.ClientID,
+			issuer:   ac.Issuer,
 		}
 	}
 
@@ -484,8 +609,8 @@ func (a *authority) authorize(ctx context.Context, m mode, tok, act, res, query
 			}
 		}
 
-		res = a.resourcePrefix + res
-		authorizedRoles, err := a.policyd.CheckPolicyRoles(ctx, domain, roles, act, res)
+		res = a.prefixResource(res)
+		authorizedRoles, err := a.policyd.CheckPolicyRoles(policy.WithPrincipal(ctx, p.Name()), domain, roles, act, res)
 		if err != nil {
 			glg.Infof("check policy error, err: %v, principal: %s, action: %s, resource: %s", err, p.Name(), act, res)
 			return nil, errors.Wrap(err, "token unauthorized")
@@ -516,6 +641,20 @@ func (a *authority) authorize(ctx context.Context, m mode, tok, act, res, query
 	return p, nil
 }
 
+// prefixResource adds the resource prefix to the resource.
+// If cross domain resource is enabled, the prefix is added after the domain qualifier, i.e. <domain>:<prefix><resource>.
+func (a *authority) prefixResource(res string) string {
+	if a.resourcePrefix == "" {
+		return res
+	}
+	if a.crossDomainResource {
+		if dr := strings.SplitN(res, ":", 2); len(dr) == 2 {
+			return dr[0] + ":" + a.resourcePrefix + dr[1]
+		}
+	}
+	return a.resourcePrefix + res
+}
+
 // principalCacheMemoryUsage returns memory usage of principal
 func principalCacheMemoryUsage(key string, p Principal) int64 {
 	structSize := int64(unsafe.Sizeof(p))
@@ -647,3 +786,114 @@ func (a *authority) GetPolicyCache(ctx context.Context) map[string][]*policy.Ass
 		return make(map[string][]*policy.Assertion)
 	}
 }
+
+// ExportPolicies returns the evaluated policy state, which can be encoded by policy.EncodePolicyExport
+func (a *authority) ExportPolicies(ctx context.Context) *policy.PolicyExport {
+	if a.disablePolicyd {
+		return &policy.PolicyExport{
+			Version: policy.PolicyExportVersion,
+			Domains: make([]*policy.DomainPolicyExport, 0),
+		}
+	}
+	return a.policyd.ExportPolicies(ctx)
+}
+
+// GetAccessRoles returns the roles of the domain allowed or explicitly denied to do the action on the resource
+func (a *authority) GetAccessRoles(ctx context.Context, domain, act, res string) *policy.AccessRoles {
+	if a.disablePolicyd {
+		return &policy.AccessRoles{
+			AllowedRoles: make([]string, 0),
+			DeniedRoles:  make([]string, 0),
+		}
+	}
+	return a.policyd.GetAccessRoles(ctx, domain, act, a.prefixResource(res))
+}
+
+// GetRolePermissions returns the action and resource patterns allowed to the roles of the domain
+func (a *authority) GetRolePermissions(ctx context.Context, domain string, roles []string) []*policy.Permission {
+	if a.disablePolicyd {
+		return make([]*policy.Permission, 0)
+	}
+	return a.policyd.GetRolePermissions(ctx, domain, roles)
+}
+
+// AddLocalAssertions adds the local assertions to policyd, and clears the principal cache to take effect immediately.
+func (a *authority) AddLocalAssertions(ctx context.Context, las ...*policy.LocalAssertion) error {
+	if a.disablePolicyd {
+		return errors.New("policyd is disabled")
+	}
+	if err := a.policyd.AddLocalAssertions(ctx, las...); err != nil {
+		return err
+	}
+	a.clearPrincipalCache()
+	return nil
+}
+
+// DeleteLocalAssertions deletes the local assertions of the domain role from policyd, and clears the principal cache to take effect immediately.
+func (a *authority) DeleteLocalAssertions(ctx context.Context, domain, role string) int {
+	if a.disablePolicyd {
+		return 0
+	}
+	n := a.policyd.DeleteLocalAssertions(ctx, domain, role)
+	a.clearPrincipalCache()
+	return n
+}
+
+// DeleteLocalPrincipalAssertions deletes the local assertions of the domain principal from policyd, and clears the principal cache to take effect immediately.
+func (a *authority) DeleteLocalPrincipalAssertions(ctx context.Context, domain, principal string) int {
+	if a.disablePolicyd {
+		return 0
+	}
+	n := a.policyd.DeleteLocalPrincipalAssertions(ctx, domain, principal)
+	a.clearPrincipalCache()
+	return n
+}
+
+// clearPrincipalCache clears the cached principals and their memory usage
+func (a *authority) clearPrincipalCache() {
+	a.cache.Clear()
+	a.cacheMemoryUsage.Store(0)
+}
+
+// Refresh fetches the policies of the domains immediately, all the domains if no domain is given,
+// and invalidates the cached principals of the domains to take effect immediately. Use policy.BypassCache on the context to ignore the ETag.
+func (a *authority) Refresh(ctx context.Context, domains ...string) error {
+	if a.disablePolicyd {
+		return errors.New("policyd is disabled")
+	}
+	if err := a.policyd.Refresh(ctx, domains...); err != nil {
+		return err
+	}
+	a.invalidatePrincipalCache(ctx, domains...)
+	return nil
+}
+
+// invalidatePrincipalCache deletes the cached principals of the domains and their memory usage, or clears all of them if no domain is given
+func (a *authority) invalidatePrincipalCache(ctx context.Context, domains ...string) {
+	if len(domains) == 0 {
+		a.clearPrincipalCache()
+		return
+	}
+	ds := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		ds[domain] = struct{}{}
+	}
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	// the callback is called concurrently, delete the keys after the iteration
+	a.cache.Range(ctx, func(key string, p Principal, _ int64) bool {
+		if _, ok := ds[p.Domain()]; ok {
+			mu.Lock()
+			keys = append(keys, key)
+			mu.Unlock()
+		}
+		return true
+	})
+	for _, key := range keys {
+		if p, ok := a.cache.Delete(key); ok {
+			a.cacheMemoryUsage.Add(-principalCacheMemoryUsage(key, p))
+		}
+	}
+}
@@ -42,9 +42,11 @@ func (cm *ConfdMock) Start(ctx context.Context) <-chan error {
 }
 
 type PubkeydMock struct {
-	StartFunc       func(context.Context) <-chan error
-	UpdateFunc      func(context.Context) error
-	GetProviderFunc func() pubkey.Provider
+	StartFunc        func(context.Context) <-chan error
+	UpdateFunc       func(context.Context) error
+	GetProviderFunc  func() pubkey.Provider
+	GetKeyStatusFunc func(pubkey.AthenzEnv) *pubkey.KeyStatus
+	SubscribeFunc    func(context.Context) <-chan *pubkey.KeyEvent
 }
 
 func (pm *PubkeydMock) Start(ctx context.Context) <-chan error {
@@ -68,11 +70,32 @@ func (pm *PubkeydMock) GetProvider() pubkey.Provider {
 	return nil
 }
 
+func (pm *PubkeydMock) GetKeyStatus(env pubkey.AthenzEnv) *pubkey.KeyStatus {
+	if pm.GetKeyStatusFunc != nil {
+		return pm.GetKeyStatusFunc(env)
+	}
+	return nil
+}
+
+func (pm *PubkeydMock) Subscribe(ctx context.Context) <-chan *pubkey.KeyEvent {
+	if pm.SubscribeFunc != nil {
+		return pm.SubscribeFunc(ctx)
+	}
+	return nil
+}
+
 type PolicydMock struct {
-	UpdateFunc                func(context.Context) error
-	CheckPolicyRoleFunc       func(ctx context.Context, domain string, roles []string, action, resource string) ([]string, error)
-	GetPrincipalCacheLenFunc  func() int
-	GetPrincipalCacheSizeFunc func() int64
+	UpdateFunc                         func(context.Context) error
+	CheckPolicyRoleFunc                func(ctx context.Context, domain string, roles []string, action, resource string) ([]string, error)
+	GetPrincipalCacheLenFunc           func() int
+	GetPrincipalCacheSizeFunc          func() int64
+	AddLocalAssertionsFunc             func(ctx context.Context, las ...*policy.LocalAssertion) error
+	DeleteLocalAssertionsFunc          func(ctx context.Context, domain, role string) int
+	DeleteLocalPrincipalAssertionsFunc func(ctx context.Context, domain, principal string) int
+	GetAccessRolesFunc                 func(ctx context.Context, domain, action, resource string) *policy.AccessRoles
+	GetRolePermissionsFunc             func(ctx context.Context, domain string, roles []string) []*policy.Permission
+	RefreshFunc                        func(ctx context.Context, domains ...string) error
+	ExportPoliciesFunc                 func(ctx context.Context) *policy.PolicyExport
 
 	policydExp  time.Duration
 	policyCache map[string][]*policy.Assertion
@@ -113,6 +136,79 @@ func (pdm *PolicydMock) GetPolicyCache(ctx context.Context) map[string][]*policy
 	return pdm.policyCache
 }
 
+func (pdm *PolicydMock) AddLocalAssertions(ctx context.Context, las ...*policy.LocalAssertion) error {
+	if pdm.AddLocalAssertionsFunc != nil {
+		return pdm.AddLocalAssertionsFunc(ctx, las...)
+	}
+	return nil
+}
+
+func (pdm *PolicydMock) DeleteLocalAssertions(ctx context.Context, domain, role string) int {
+	if pdm.DeleteLocalAssertionsFunc != nil {
+		return pdm.DeleteLocalAssertionsFunc(ctx, domain, role)
+	}
+	return 0
+}
+
+func (pdm *PolicydMock) DeleteLocalPrincipalAssertions(ctx context.Context, domain, principal string) int {
+	if pdm.DeleteLocalPrincipalAssertionsFunc != nil {
+		return pdm.DeleteLocalPrincipalAssertionsFunc(ctx, domain, principal)
+	}
+	return 0
+}
+
+func (pdm *PolicydMock) GetLocalAssertions(context.Context) []*policy.LocalAssertion {
+	return nil
+}
+
+func (pdm *PolicydMock) LoadLocalAssertions(ctx context.Context, path string) error {
+	return nil
+}
+
+func (pdm *PolicydMock) GetAccessRoles(ctx context.Context, domain, action, resource string) *policy.AccessRoles {
+	if pdm.GetAccessRolesFunc != nil {
+		return pdm.GetAccessRolesFunc(ctx, domain, action, resource)
+	}
+	return nil
+}
+
+func (pdm *PolicydMock) GetRolePermissions(ctx context.Context, domain string, roles []string) []*policy.Permission {
+	if pdm.GetRolePermissionsFunc != nil {
+		return pdm.GetRolePermissionsFunc(ctx, domain, roles)
+	}
+	return nil
+}
+
+func (pdm *PolicydMock) Simulate(ctx context.Context, candidates []*policy.SignedPolicy, reqs []*policy.SimulationRequest) (*policy.SimulationReport, error) {
+	return nil, nil
+}
+
+func (pdm *PolicydMock) Refresh(ctx context.Context, domains ...string) error {
+	if pdm.RefreshFunc != nil {
+		return pdm.RefreshFunc(ctx, domains...)
+	}
+	return nil
+}
+
+func (pdm *PolicydMock) Subscribe(ctx context.Context) <-chan *policy.PolicyEvent {
+	return nil
+}
+
+func (pdm *PolicydMock) ExportPolicies(ctx context.Context) *policy.PolicyExport {
+	if pdm.ExportPoliciesFunc != nil {
+		return pdm.ExportPoliciesFunc(ctx)
+	}
+	return nil
+}
+
+func (pdm *PolicydMock) ImportPolicies(ctx context.Context, e *policy.PolicyExport) error {
+	return nil
+}
+
+func (pdm *PolicydMock) GetPolicyExpiries(ctx context.Context) map[string]time.Time {
+	return nil
+}
+
 func (pdm *PolicydMock) GetPrincipalCacheLen() int {
 	return pdm.principalCacheLen
 }
@@ -145,6 +241,8 @@ type JwkdMock struct {
 	StartFunc       func(context.Context) <-chan error
 	UpdateFunc      func(context.Context) error
 	GetProviderFunc func() jwk.Provider
+	SubscribeFunc   func(context.Context) <-chan *jwk.KeyEvent
+	AllowURLFunc    func(string)
 }
 
 func (jm *JwkdMock) Start(ctx context.Context) <-chan error {
@@ -167,3 +265,16 @@ func (jm *JwkdMock) GetProvider() jwk.Provider {
 	}
 	return nil
 }
+
+func (jm *JwkdMock) Subscribe(ctx context.Context) <-chan *jwk.KeyEvent {
+	if jm.SubscribeFunc != nil {
+		return jm.SubscribeFunc(ctx)
+	}
+	return nil
+}
+
+func (jm *JwkdMock) AllowURL(url string) {
+	if jm.AllowURLFunc != nil {
+		jm.AllowURLFunc(url)
+	}
+}
@@ -17,12 +17,19 @@ package authorizerd
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -33,6 +40,9 @@ import (
 	"github.com/AthenZ/athenz-authorizer/v5/policy"
 	"github.com/AthenZ/athenz-authorizer/v5/pubkey"
 	"github.com/AthenZ/athenz-authorizer/v5/role"
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/kpango/fastime"
 	"github.com/kpango/gache/v2"
@@ -70,6 +80,9 @@ func TestNew(t *testing.T) {
 				if prov.(*authority).jwkd == nil {
 					return errors.New("cannot new jwkd")
 				}
+				if prov.(*authority).jwkRefreshOnMiss {
+					return errors.New("jwk refresh on miss is enabled by default")
+				}
 				return nil
 			},
 		},
@@ -97,6 +110,83 @@ func TestNew(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "test New success, ZTS public keys from JWK set",
+			args: args{
+				[]Option{WithEnablePubkeyZTSFromJwks(), WithEnableRoleToken()},
+			},
+			checkFunc: func(prov Authorizerd, err error) error {
+				if err != nil {
+					return errors.Wrap(err, "unexpected error")
+				}
+				if prov.(*authority).pubkeyd == nil {
+					return errors.New("cannot new pubkeyd")
+				}
+				if prov.(*authority).jwkd == nil {
+					return errors.New("cannot new jwkd")
+				}
+				if prov.(*authority).roleProcessor == nil {
+					return errors.New("cannot new role processor")
+				}
+				return nil
+			},
+		},
+		{
+			name: "test New fail, ZTS public keys from JWK set without jwkd",
+			args: args{
+				[]Option{WithEnablePubkeyZTSFromJwks(), WithDisableJwkd()},
+			},
+			checkFunc: func(prov Authorizerd, err error) error {
+				want := "jwkd must be enabled to provide the ZTS public keys from the JWK set"
+				if err == nil || err.Error() != want {
+					return errors.Errorf("got error: %v, want: %s", err, want)
+				}
+				return nil
+			},
+		},
+		{
+			name: "test New success, access token issuers",
+			args: args{
+				[]Option{WithAccessTokenIssuers(access.IssuerConfig{
+					Issuer:  "https://zts.athenz.io",
+					JWKSURL: "https://zts.athenz.io/oauth2/keys",
+				})},
+			},
+			checkFunc: func(prov Authorizerd, err error) error {
+				if err != nil {
+					return errors.Wrap(err, "unexpected error")
+				}
+				if prov.(*authority).accessProcessor == nil {
+					return errors.New("cannot new access token processor")
+				}
+				return nil
+			},
+		},
+		{
+			name: "test New fail, access token issuers without jwkd",
+			args: args{
+				[]Option{WithAccessTokenIssuers(access.IssuerConfig{Issuer: "https://zts.athenz.io"}), WithDisableJwkd()},
+			},
+			checkFunc: func(prov Authorizerd, err error) error {
+				want := "jwkd must be enabled to validate the access tokens of the issuers"
+				if err == nil || err.Error() != want {
+					return errors.Errorf("got error: %v, want: %s", err, want)
+				}
+				return nil
+			},
+		},
+		{
+			name: "test New fail, invalid access token issuer",
+			args: args{
+				[]Option{WithAccessTokenIssuers(access.IssuerConfig{Issuer: "http://zts.athenz.io"})},
+			},
+			checkFunc: func(prov Authorizerd, err error) error {
+				if err == nil {
+					return errors.New("expected error, but not return")
+				}
+				return nil
+			},
+		},
 		{
 			name: "test New success with options",
 			args: args{
@@ -318,12 +408,13 @@ func Test_authorizer_initAuthorizers(t *testing.T) {
 }
 func Test_authorizer_Init(t *testing.T) {
 	type fields struct {
-		pubkeyd        pubkey.Daemon
-		policyd        policy.Daemon
-		jwkd           jwk.Daemon
-		disablePubkeyd bool
-		disablePolicyd bool
-		disableJwkd    bool
+		pubkeyd           pubkey.Daemon
+		policyd           policy.Daemon
+		jwkd              jwk.Daemon
+		disablePubkeyd    bool
+		disablePolicyd    bool
+		disableJwkd       bool
+		pubkeyZTSFromJwks bool
 	}
 	type args struct {
 		ctx context.Context
@@ -433,6 +524,65 @@ func Test_authorizer_Init(t *testing.T) {
 			},
 			wantErrStr: "",
 		},
+		{
+			name: "policyd is blocked by jwkd providing the ZTS public keys",
+			fields: *(func() *fields {
+				var jwkdDone atomic.Bool
+				return &fields{
+					pubkeyd: &PubkeydMock{
+						UpdateFunc: func(context.Context) error {
+							return nil
+						},
+					},
+					policyd: &PolicydMock{
+						UpdateFunc: func(context.Context) error {
+							if jwkdDone.Load() {
+								return nil
+							}
+							return errors.New("policyd error")
+						},
+					},
+					jwkd: &JwkdMock{
+						UpdateFunc: func(context.Context) error {
+							time.Sleep(10 * time.Millisecond)
+							jwkdDone.Store(true)
+							return nil
+						},
+					},
+					disablePubkeyd:    false,
+					disablePolicyd:    false,
+					disableJwkd:       false,
+					pubkeyZTSFromJwks: true,
+				}
+			}()),
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "",
+		},
+		{
+			name: "invalid public keys do not block policyd",
+			fields: fields{
+				pubkeyd: &PubkeydMock{
+					UpdateFunc: func(context.Context) error {
+						return errors.Wrap(pubkey.KeyErrors{{Env: pubkey.EnvZTS, KeyID: "0", Err: errors.New("error decoding key")}}, "error when processing pubkey")
+					},
+				},
+				policyd: &PolicydMock{
+					UpdateFunc: func(context.Context) error {
+						return nil
+					},
+				},
+				jwkd:           nil,
+				disablePubkeyd: false,
+				disablePolicyd: false,
+				disableJwkd:    true,
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "",
+		},
 		{
 			name: "all daemons init success",
 			fields: fields{
@@ -464,12 +614,13 @@ func Test_authorizer_Init(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := &authority{
-				pubkeyd:        tt.fields.pubkeyd,
-				policyd:        tt.fields.policyd,
-				jwkd:           tt.fields.jwkd,
-				disablePubkeyd: tt.fields.disablePubkeyd,
-				disablePolicyd: tt.fields.disablePolicyd,
-				disableJwkd:    tt.fields.disableJwkd,
+				pubkeyd:           tt.fields.pubkeyd,
+				policyd:           tt.fields.policyd,
+				jwkd:              tt.fields.jwkd,
+				disablePubkeyd:    tt.fields.disablePubkeyd,
+				disablePolicyd:    tt.fields.disablePolicyd,
+				disableJwkd:       tt.fields.disableJwkd,
+				pubkeyZTSFromJwks: tt.fields.pubkeyZTSFromJwks,
 			}
 			err := a.Init(tt.args.ctx)
 			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
@@ -480,6 +631,99 @@ func Test_authorizer_Init(t *testing.T) {
 	}
 }
 
+func Test_authorizer_Init_pubkeyZTSFromJwks(t *testing.T) {
+	ztsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zmsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key *rsa.PrivateKey, v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := authcore.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := s.Sign(string(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	// the policy signed by the ZTS key of the JWK set
+	spd := &util.SignedPolicyData{
+		PolicyData: &util.PolicyData{
+			Domain: "dom",
+			Policies: []*util.Policy{
+				{
+					Name: "dom:policy.reader",
+					Assertions: []*util.Assertion{
+						{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+					},
+				},
+			},
+		},
+		ZmsKeyId: "0",
+		Expires:  &rdl.Timestamp{Time: fastime.Now().Add(24 * time.Hour).UTC()},
+		Modified: &rdl.Timestamp{Time: fastime.Now().UTC()},
+	}
+	spd.ZmsSignature = sign(zmsKey, spd.PolicyData)
+	sp := &util.DomainSignedPolicyData{
+		SignedPolicyData: spd,
+		KeyId:            "zts.0",
+		Signature:        sign(ztsKey, spd),
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"zts.0","alg":"RS256","use":"sig","n":"%s","e":"%s"}]}`,
+		b64(ztsKey.N.Bytes()), b64(big.NewInt(int64(ztsKey.E)).Bytes()))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth2/keys":
+			fmt.Fprint(w, jwks)
+		case "/domain/sys.auth/service/zms":
+			fmt.Fprint(w, `{"name":"sys.auth.zms","publicKeys":[]}`)
+		case "/domain/dom/signed_policy_data":
+			if err := json.NewEncoder(w).Encode(sp); err != nil {
+				t.Error(err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	zmsDER, err := x509.MarshalPKIXPublicKey(&zmsKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov, err := New(
+		WithAthenzURL(strings.TrimPrefix(srv.URL, "https://")),
+		WithAthenzDomains("dom"),
+		WithHTTPClient(srv.Client()),
+		WithEnablePubkeyZTSFromJwks(),
+		WithPubkeyStaticKeys(pubkey.EnvZMS, map[string][]byte{
+			"0": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: zmsDER}),
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := prov.Init(context.Background()); err != nil {
+		t.Fatalf("authority.Init() error = %v", err)
+	}
+	if _, ok := prov.GetPolicyCache(context.Background())["dom:role.reader"]; !ok {
+		t.Errorf("authority.GetPolicyCache() = %v, want dom:role.reader", prov.GetPolicyCache(context.Background()))
+	}
+}
+
 func Test_authorizer_Start(t *testing.T) {
 	type fields struct {
 		pubkeyd  pubkey.Daemon
@@ -1233,6 +1477,54 @@ func Test_authorizer_authorize(t *testing.T) {
 				},
 			}
 		}(),
+		func() test {
+			c := gache.New[Principal]()
+			pdm := &PolicydMock{
+				CheckPolicyRoleFunc: func(ctx context.Context, domain string, roles []string, action, resource string) ([]string, error) {
+					if got := policy.PrincipalFromContext(ctx); got != "user.alice" {
+						return nil, errors.New("unexpected principal, got: " + got)
+					}
+					return roles, nil
+				},
+			}
+			rt := &role.Token{
+				Domain:    "domain",
+				Principal: "user.alice",
+			}
+			p := &principal{
+				name:       rt.Principal,
+				roles:      rt.Roles,
+				domain:     rt.Domain,
+				issueTime:  rt.TimeStamp.Unix(),
+				expiryTime: rt.ExpiryTime.Unix(),
+			}
+			rpm := &RoleProcessorMock{
+				rt:      rt,
+				wantErr: nil,
+			}
+			return test{
+				name: "test principal on the context of policyd",
+				fields: fields{
+					cache:            c,
+					policyd:          pdm,
+					disablePolicyd:   false,
+					roleProcessor:    rpm,
+					cacheMemoryUsage: &atomic.Int64{},
+				},
+				args: args{
+					m:   roleToken,
+					ctx: context.Background(),
+					tok: "dummyTok",
+					act: "get",
+					res: "/path",
+				},
+				wantErr:    false,
+				wantResult: p,
+				checkFunc: func(prov *authority, buf *bytes.Buffer) error {
+					return nil
+				},
+			}
+		}(),
 		func() test {
 			c := gache.New[Principal]()
 			pdm := &PolicydMock{
@@ -1426,6 +1718,73 @@ func Test_authorizer_authorize(t *testing.T) {
 	}
 }
 
+func Test_authorizer_prefixResource(t *testing.T) {
+	type fields struct {
+		resourcePrefix      string
+		crossDomainResource bool
+	}
+	type args struct {
+		res string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   string
+	}{
+		{
+			name: "no prefix",
+			args: args{
+				res: "dom:res",
+			},
+			want: "dom:res",
+		},
+		{
+			name: "prefix",
+			fields: fields{
+				resourcePrefix: "/api",
+			},
+			args: args{
+				res: "dom:res",
+			},
+			want: "/apidom:res",
+		},
+		{
+			name: "prefix after the domain qualifier",
+			fields: fields{
+				resourcePrefix:      "/api",
+				crossDomainResource: true,
+			},
+			args: args{
+				res: "dom:/res",
+			},
+			want: "dom:/api/res",
+		},
+		{
+			name: "prefix unqualified resource",
+			fields: fields{
+				resourcePrefix:      "/api",
+				crossDomainResource: true,
+			},
+			args: args{
+				res: "/res",
+			},
+			want: "/api/res",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				resourcePrefix:      tt.fields.resourcePrefix,
+				crossDomainResource: tt.fields.crossDomainResource,
+			}
+			if got := a.prefixResource(tt.args.res); got != tt.want {
+				t.Errorf("authority.prefixResource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_authorizer_principalCacheMemoryUsage(t *testing.T) {
 	type args struct {
 		key string
@@ -1463,7 +1822,8 @@ func Test_authorizer_principalCacheMemoryUsage(t *testing.T) {
 		}(),
 		func() test {
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -1865,6 +2225,462 @@ func Test_authorizer_GetPolicyCache(t *testing.T) {
 	}
 }
 
+func Test_authorizer_GetAccessRoles(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+		resourcePrefix string
+	}
+	type args struct {
+		ctx    context.Context
+		domain string
+		act    string
+		res    string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   *policy.AccessRoles
+	}{
+		{
+			name: "GetAccessRoles success with resource prefix",
+			fields: fields{
+				policyd: &PolicydMock{
+					GetAccessRolesFunc: func(ctx context.Context, domain, action, resource string) *policy.AccessRoles {
+						if domain != "dom" || action != "read" || resource != "/api/res" {
+							return nil
+						}
+						return &policy.AccessRoles{
+							AllowedRoles: []string{"reader"},
+							DeniedRoles:  []string{"blocked"},
+						}
+					},
+				},
+				resourcePrefix: "/api",
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				act:    "read",
+				res:    "/res",
+			},
+			want: &policy.AccessRoles{
+				AllowedRoles: []string{"reader"},
+				DeniedRoles:  []string{"blocked"},
+			},
+		},
+		{
+			name: "GetAccessRoles success disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: &policy.AccessRoles{
+				AllowedRoles: []string{},
+				DeniedRoles:  []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:        tt.fields.policyd,
+				disablePolicyd: tt.fields.disablePolicyd,
+				resourcePrefix: tt.fields.resourcePrefix,
+			}
+			if got := a.GetAccessRoles(tt.args.ctx, tt.args.domain, tt.args.act, tt.args.res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("authority.GetAccessRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_authorizer_GetRolePermissions(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+	}
+	type args struct {
+		ctx    context.Context
+		domain string
+		roles  []string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   []*policy.Permission
+	}{
+		{
+			name: "GetRolePermissions success",
+			fields: fields{
+				policyd: &PolicydMock{
+					GetRolePermissionsFunc: func(ctx context.Context, domain string, roles []string) []*policy.Permission {
+						return []*policy.Permission{
+							{Role: roles[0], Action: "read", Resource: domain + ":*"},
+						}
+					},
+				},
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader"},
+			},
+			want: []*policy.Permission{
+				{Role: "reader", Action: "read", Resource: "dom:*"},
+			},
+		},
+		{
+			name: "GetRolePermissions success disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: []*policy.Permission{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:        tt.fields.policyd,
+				disablePolicyd: tt.fields.disablePolicyd,
+			}
+			if got := a.GetRolePermissions(tt.args.ctx, tt.args.domain, tt.args.roles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("authority.GetRolePermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_authorizer_AddLocalAssertions(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+	}
+	type args struct {
+		ctx context.Context
+		las []*policy.LocalAssertion
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		wantErr      string
+		wantCacheLen int
+	}{
+		{
+			name: "AddLocalAssertions success, clear principal cache",
+			fields: fields{
+				policyd: &PolicydMock{
+					AddLocalAssertionsFunc: func(ctx context.Context, las ...*policy.LocalAssertion) error {
+						if len(las) != 1 || las[0].Role != "role" {
+							return errors.New("invalid local assertions")
+						}
+						return nil
+					},
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+				las: []*policy.LocalAssertion{
+					{Domain: "dom", Role: "role", Action: "*", Resource: "dom:*", Effect: "deny"},
+				},
+			},
+			wantCacheLen: 0,
+		},
+		{
+			name: "AddLocalAssertions fail, keep principal cache",
+			fields: fields{
+				policyd: &PolicydMock{
+					AddLocalAssertionsFunc: func(ctx context.Context, las ...*policy.LocalAssertion) error {
+						return errors.New("add error")
+					},
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErr:      "add error",
+			wantCacheLen: 1,
+		},
+		{
+			name: "AddLocalAssertions fail, disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErr:      "policyd is disabled",
+			wantCacheLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:          tt.fields.policyd,
+				disablePolicyd:   tt.fields.disablePolicyd,
+				cache:            gache.New[Principal](),
+				cacheMemoryUsage: &atomic.Int64{},
+			}
+			a.cache.Set("dummyTok:dummyAct:dummyRes", &principal{})
+			a.cacheMemoryUsage.Store(100)
+			err := a.AddLocalAssertions(tt.args.ctx, tt.args.las...)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("authority.AddLocalAssertions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := a.GetPrincipalCacheLen(); got != tt.wantCacheLen {
+				t.Errorf("authority.GetPrincipalCacheLen() = %v, want %v", got, tt.wantCacheLen)
+			}
+			if tt.wantCacheLen == 0 && a.cacheMemoryUsage.Load() != 0 {
+				t.Errorf("authority.cacheMemoryUsage = %v, want 0", a.cacheMemoryUsage.Load())
+			}
+		})
+	}
+}
+
+func Test_authorizer_DeleteLocalAssertions(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+	}
+	type args struct {
+		ctx    context.Context
+		domain string
+		role   string
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		want         int
+		wantCacheLen int
+	}{
+		{
+			name: "DeleteLocalAssertions success, clear principal cache",
+			fields: fields{
+				policyd: &PolicydMock{
+					DeleteLocalAssertionsFunc: func(ctx context.Context, domain, role string) int {
+						if domain == "dom" && role == "role" {
+							return 2
+						}
+						return 0
+					},
+				},
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				role:   "role",
+			},
+			want:         2,
+			wantCacheLen: 0,
+		},
+		{
+			name: "DeleteLocalAssertions disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				role:   "role",
+			},
+			want:         0,
+			wantCacheLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:          tt.fields.policyd,
+				disablePolicyd:   tt.fields.disablePolicyd,
+				cache:            gache.New[Principal](),
+				cacheMemoryUsage: &atomic.Int64{},
+			}
+			a.cache.Set("dummyTok:dummyAct:dummyRes", &principal{})
+			if got := a.DeleteLocalAssertions(tt.args.ctx, tt.args.domain, tt.args.role); got != tt.want {
+				t.Errorf("authority.DeleteLocalAssertions() = %v, want %v", got, tt.want)
+			}
+			if got := a.GetPrincipalCacheLen(); got != tt.wantCacheLen {
+				t.Errorf("authority.GetPrincipalCacheLen() = %v, want %v", got, tt.wantCacheLen)
+			}
+		})
+	}
+}
+
+func Test_authorizer_DeleteLocalPrincipalAssertions(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+	}
+	type args struct {
+		ctx       context.Context
+		domain    string
+		principal string
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		args         args
+		want         int
+		wantCacheLen int
+	}{
+		{
+			name: "DeleteLocalPrincipalAssertions success, clear principal cache",
+			fields: fields{
+				policyd: &PolicydMock{
+					DeleteLocalPrincipalAssertionsFunc: func(ctx context.Context, domain, principal string) int {
+						if domain == "dom" && principal == "user.alice" {
+							return 1
+						}
+						return 0
+					},
+				},
+			},
+			args: args{
+				ctx:       context.Background(),
+				domain:    "dom",
+				principal: "user.alice",
+			},
+			want:         1,
+			wantCacheLen: 0,
+		},
+		{
+			name: "DeleteLocalPrincipalAssertions disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			args: args{
+				ctx:       context.Background(),
+				domain:    "dom",
+				principal: "user.alice",
+			},
+			want:         0,
+			wantCacheLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:          tt.fields.policyd,
+				disablePolicyd:   tt.fields.disablePolicyd,
+				cache:            gache.New[Principal](),
+				cacheMemoryUsage: &atomic.Int64{},
+			}
+			a.cache.Set("dummyTok:dummyAct:dummyRes", &principal{})
+			if got := a.DeleteLocalPrincipalAssertions(tt.args.ctx, tt.args.domain, tt.args.principal); got != tt.want {
+				t.Errorf("authority.DeleteLocalPrincipalAssertions() = %v, want %v", got, tt.want)
+			}
+			if got := a.GetPrincipalCacheLen(); got != tt.wantCacheLen {
+				t.Errorf("authority.GetPrincipalCacheLen() = %v, want %v", got, tt.wantCacheLen)
+			}
+		})
+	}
+}
+
+func Test_authorizer_Refresh(t *testing.T) {
+	type fields struct {
+		policyd        policy.Daemon
+		disablePolicyd bool
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		domains      []string
+		wantErr      string
+		wantCacheKey []string
+	}{
+		{
+			name: "Refresh success, invalidate principal cache of the domain",
+			fields: fields{
+				policyd: &PolicydMock{
+					RefreshFunc: func(ctx context.Context, domains ...string) error {
+						if len(domains) != 1 || domains[0] != "dom1" {
+							return errors.New("invalid domains")
+						}
+						return nil
+					},
+				},
+			},
+			domains:      []string{"dom1"},
+			wantCacheKey: []string{"tok2:act:res"},
+		},
+		{
+			name: "Refresh all success, clear principal cache",
+			fields: fields{
+				policyd: &PolicydMock{},
+			},
+			wantCacheKey: []string{},
+		},
+		{
+			name: "Refresh fail, keep principal cache",
+			fields: fields{
+				policyd: &PolicydMock{
+					RefreshFunc: func(ctx context.Context, domains ...string) error {
+						return errors.New("refresh error")
+					},
+				},
+			},
+			domains:      []string{"dom1"},
+			wantErr:      "refresh error",
+			wantCacheKey: []string{"tok1:act:res", "tok2:act:res"},
+		},
+		{
+			name: "Refresh fail, disable policyd",
+			fields: fields{
+				disablePolicyd: true,
+			},
+			wantErr:      "policyd is disabled",
+			wantCacheKey: []string{"tok1:act:res", "tok2:act:res"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authority{
+				policyd:          tt.fields.policyd,
+				disablePolicyd:   tt.fields.disablePolicyd,
+				cache:            gache.New[Principal](),
+				cacheMemoryUsage: &atomic.Int64{},
+			}
+			p1 := &principal{name: "user1", domain: "dom1"}
+			p2 := &principal{name: "user2", domain: "dom2"}
+			a.cache.Set("tok1:act:res", p1)
+			a.cache.Set("tok2:act:res", p2)
+			a.cacheMemoryUsage.Store(principalCacheMemoryUsage("tok1:act:res", p1) + principalCacheMemoryUsage("tok2:act:res", p2))
+
+			err := a.Refresh(context.Background(), tt.domains...)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("authority.Refresh() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			keys := a.cache.Keys(context.Background())
+			sort.Strings(keys)
+			if len(keys) == 0 {
+				keys = []string{}
+			}
+			if !reflect.DeepEqual(keys, tt.wantCacheKey) {
+				t.Errorf("authority.Refresh() principal cache = %v, want %v", keys, tt.wantCacheKey)
+			}
+			var wantUsage int64
+			for _, key := range keys {
+				p, _ := a.cache.Get(key)
+				wantUsage += principalCacheMemoryUsage(key, p)
+			}
+			if got := a.cacheMemoryUsage.Load(); got != wantUsage {
+				t.Errorf("authority.cacheMemoryUsage = %v, want %v", got, wantUsage)
+			}
+		})
+	}
+}
+
 func Test_authorizer_GetPrincipalCacheLen(t *testing.T) {
 	type fields struct {
 		cache gache.Gache[Principal]
@@ -2113,7 +2929,8 @@ func Test_authorizer_CustomAuthHeader(t *testing.T) {
 		func() test {
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2167,7 +2984,8 @@ func Test_authorizer_CustomAuthHeader(t *testing.T) {
 		func() test {
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2221,7 +3039,8 @@ func Test_authorizer_CustomAuthHeader(t *testing.T) {
 		func() test {
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2356,7 +3175,8 @@ func Test_authorizer_CustomAuthHeader(t *testing.T) {
 		func() test {
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2472,7 +3292,8 @@ func Test_authorizer_AuthorizeAccessToken(t *testing.T) {
 			now := fastime.Now()
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2536,7 +3357,8 @@ func Test_authorizer_AuthorizeAccessToken(t *testing.T) {
 			now := fastime.Now()
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
@@ -2838,7 +3660,8 @@ func Test_authorizer_AuthorizeAccessToken(t *testing.T) {
 			}
 			c := gache.New[Principal]()
 			at := &access.OAuth2AccessTokenClaim{
-				Scope: []string{"role"},
+				Scope:  []string{"role"},
+				Domain: "domain",
 				BaseClaim: access.BaseClaim{
 					StandardClaims: jwt.StandardClaims{
 						Audience: "domain",
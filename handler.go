@@ -0,0 +1,79 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorizerd
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/AthenZ/athenz-authorizer/v5/policy"
+)
+
+const (
+	// refreshDomainParam is the repeated query parameter of the domains to refresh
+	refreshDomainParam = "domain"
+	// refreshBypassCacheParam is the query parameter to ignore the ETag on refresh
+	refreshBypassCacheParam = "bypass_cache"
+)
+
+// NewRefreshHandler returns the HTTP handler invoking Authorizerd.Refresh, e.g. for the change notification pipeline.
+// The request is authorized by Authorizerd.Authorize, i.e. the caller needs the credential allowed to do the action on the resource.
+// Only POST is accepted. The domains are given by the repeated "domain" query parameters, all the domains if none,
+// and "bypass_cache=true" ignores the ETag. It responds 204 No Content on success.
+func NewRefreshHandler(a Authorizerd, act, res string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		p, err := a.Authorize(r, act, res)
+		if err != nil {
+			glg.Warnf("refresh request unauthorized, remote: %s, error: %v", r.RemoteAddr, err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		ctx := r.Context()
+		if v := q.Get(refreshBypassCacheParam); v != "" {
+			bypass, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "invalid "+refreshBypassCacheParam, http.StatusBadRequest)
+				return
+			}
+			if bypass {
+				ctx = policy.BypassCache(ctx)
+			}
+		}
+
+		domains := q[refreshDomainParam]
+		glg.Infof("refresh requested, principal: %s, domains: %v", p.Name(), domains)
+		if err := a.Refresh(ctx, domains...); err != nil {
+			glg.Errorf("refresh fail, domains: %v, error: %v", domains, err)
+			if errors.Is(err, ErrDomainNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorizerd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+
+	"github.com/AthenZ/athenz-authorizer/v5/policy"
+)
+
+func TestNewRefreshHandler(t *testing.T) {
+	type want struct {
+		status  int
+		domains []string
+		bypass  bool
+		called  bool
+	}
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		authorized bool
+		refreshErr error
+		want       want
+	}{
+		{
+			name:       "refresh the domains",
+			method:     http.MethodPost,
+			target:     "/refresh?domain=dom1&domain=dom2",
+			authorized: true,
+			want:       want{status: http.StatusNoContent, domains: []string{"dom1", "dom2"}, called: true},
+		},
+		{
+			name:       "refresh all the domains bypassing the cache",
+			method:     http.MethodPost,
+			target:     "/refresh?bypass_cache=true",
+			authorized: true,
+			want:       want{status: http.StatusNoContent, bypass: true, called: true},
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodGet,
+			target:     "/refresh",
+			authorized: true,
+			want:       want{status: http.StatusMethodNotAllowed},
+		},
+		{
+			name:   "unauthorized",
+			method: http.MethodPost,
+			target: "/refresh",
+			want:   want{status: http.StatusUnauthorized},
+		},
+		{
+			name:       "invalid bypass_cache",
+			method:     http.MethodPost,
+			target:     "/refresh?bypass_cache=dummy",
+			authorized: true,
+			want:       want{status: http.StatusBadRequest},
+		},
+		{
+			name:       "unknown domain",
+			method:     http.MethodPost,
+			target:     "/refresh?domain=unknown",
+			authorized: true,
+			refreshErr: errors.Wrap(policy.ErrDomainNotFound, "refresh policy fail, domain: unknown"),
+			want:       want{status: http.StatusNotFound, domains: []string{"unknown"}, called: true},
+		},
+		{
+			name:       "refresh fail",
+			method:     http.MethodPost,
+			target:     "/refresh?domain=dom1",
+			authorized: true,
+			refreshErr: errors.New("fetch error"),
+			want:       want{status: http.StatusInternalServerError, domains: []string{"dom1"}, called: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got want
+			a := &authority{
+				policyd: &PolicydMock{
+					RefreshFunc: func(ctx context.Context, domains ...string) error {
+						got.called = true
+						got.domains = domains
+						got.bypass = policy.IsCacheBypassed(ctx)
+						return tt.refreshErr
+					},
+				},
+				authorizers: []authorizer{
+					func(r *http.Request, act, res string) (Principal, error) {
+						if !tt.authorized || act != "refresh" || res != "policy" {
+							return nil, errors.New("unauthorized")
+						}
+						return &principal{name: "refresher"}, nil
+					},
+				},
+				cache:            gache.New[Principal](),
+				cacheMemoryUsage: &atomic.Int64{},
+			}
+
+			w := httptest.NewRecorder()
+			NewRefreshHandler(a, "refresh", "policy").ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			got.status = w.Code
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewRefreshHandler() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keypin contains the fingerprint and the pin verification of the public keys shared by pubkeyd and jwkd
+package keypin
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns the hex encoded SHA-256 of the SPKI of the public key, or empty if the key is not supported by x509.MarshalPKIXPublicKey.
+func Fingerprint(pub interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// Normalize returns the lower case hex fingerprint without the colon separators.
+func Normalize(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
+
+// Mismatch returns the description of the pinned key IDs of which the fingerprint differs from the pin, sorted by the key ID,
+// or false if all of them match. Both pins and fingerprints have the format of map[<key ID>]<fingerprint>.
+func Mismatch(pins, fingerprints map[string]string) (string, bool) {
+	if len(pins) == 0 {
+		return "", false
+	}
+	ids := make([]string, 0, len(fingerprints))
+	for id := range fingerprints {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, 0)
+	for _, id := range ids {
+		pin, ok := pins[id]
+		if ok && pin != fingerprints[id] {
+			msgs = append(msgs, "keyID: "+id+", fingerprint: "+fingerprints[id])
+		}
+	}
+	return strings.Join(msgs, ", "), len(msgs) > 0
+}
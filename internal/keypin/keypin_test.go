@@ -0,0 +1,102 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keypin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+
+	tests := []struct {
+		name string
+		pub  interface{}
+		want string
+	}{
+		{
+			name: "public key",
+			pub:  &key.PublicKey,
+			want: hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "unsupported key",
+			pub:  []byte("symmetric key"),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fingerprint(tt.pub); got != tt.want {
+				t.Errorf("Fingerprint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got, want := Normalize("AB:cd:EF"), "abcdef"; got != want {
+		t.Errorf("Normalize() = %v, want %v", got, want)
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		pins         map[string]string
+		fingerprints map[string]string
+		want         string
+		wantOk       bool
+	}{
+		{
+			name:         "no pins",
+			fingerprints: map[string]string{"0": "aa"},
+		},
+		{
+			name:         "pins match",
+			pins:         map[string]string{"0": "aa", "2": "cc"},
+			fingerprints: map[string]string{"0": "aa", "1": "bb"},
+		},
+		{
+			name:         "pins mismatch",
+			pins:         map[string]string{"0": "aa", "1": "aa", "2": "aa"},
+			fingerprints: map[string]string{"2": "cc", "0": "aa", "1": "bb"},
+			want:         "keyID: 1, fingerprint: bb, keyID: 2, fingerprint: cc",
+			wantOk:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Mismatch(tt.pins, tt.fingerprints)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Mismatch() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub contains the subscriber registry delivering the events of the daemons
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// BufferSize is the buffer size of the subscriber channel, the events are dropped if the subscriber is slower
+const BufferSize = 100
+
+// Subscribers is the registry of the channels subscribing the events. The zero value is ready to use.
+type Subscribers[E any] struct {
+	mu  sync.Mutex
+	chs map[chan E]struct{}
+}
+
+// Subscribe returns the channel delivering the events, which is closed when the context is done.
+// The events are dropped if the channel buffer is full, so the subscriber should receive them without blocking.
+func (s *Subscribers[E]) Subscribe(ctx context.Context) <-chan E {
+	ch := make(chan E, BufferSize)
+	s.mu.Lock()
+	if s.chs == nil {
+		s.chs = make(map[chan E]struct{})
+	}
+	s.chs[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(s.chs, ch)
+		close(ch)
+		s.mu.Unlock()
+	}()
+	return ch
+}
+
+// Publish delivers the event to the subscribers without blocking, and returns the number of the subscribers which the event is dropped for.
+func (s *Subscribers[E]) Publish(ev E) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for ch := range s.chs {
+		select {
+		case ch <- ev:
+		default:
+			dropped++
+		}
+	}
+	return dropped
+}
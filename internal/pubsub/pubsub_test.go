@@ -0,0 +1,58 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscribers(t *testing.T) {
+	var s Subscribers[int]
+	ctx, cancel := context.WithCancel(context.Background())
+	ch1 := s.Subscribe(ctx)
+	ch2 := s.Subscribe(context.Background())
+
+	if got := s.Publish(1); got != 0 {
+		t.Errorf("Subscribers.Publish() = %d, want 0", got)
+	}
+	for i, ch := range []<-chan int{ch1, ch2} {
+		if got := <-ch; got != 1 {
+			t.Errorf("subscriber %d received %d, want 1", i, got)
+		}
+	}
+
+	// the channel is closed when the context is done
+	cancel()
+	select {
+	case _, ok := <-ch1:
+		if ok {
+			t.Errorf("subscriber channel is not closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscriber channel is not closed")
+	}
+
+	// the event is dropped for the subscriber of which the buffer is full
+	for i := 0; i < BufferSize; i++ {
+		if got := s.Publish(i); got != 0 {
+			t.Errorf("Subscribers.Publish() = %d, want 0", got)
+		}
+	}
+	if got := s.Publish(BufferSize); got != 1 {
+		t.Errorf("Subscribers.Publish() = %d, want 1", got)
+	}
+}
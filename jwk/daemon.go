@@ -17,12 +17,16 @@ package jwk
 import (
 	"context"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/internal/pubsub"
+	"github.com/kpango/fastime"
 	"github.com/kpango/glg"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 )
 
 // Daemon represents the daemon to retrieve jwk from Athenz.
@@ -30,6 +34,8 @@ type Daemon interface {
 	Start(ctx context.Context) <-chan error
 	Update(context.Context) error
 	GetProvider() Provider
+	Subscribe(ctx context.Context) <-chan *KeyEvent
+	AllowURL(url string)
 }
 
 type jwkd struct {
@@ -41,7 +47,34 @@ type jwkd struct {
 
 	client *http.Client
 
+	// accepted key IDs and pinned fingerprints, map[<JWK set URL>]...
+	allowedKeyIDs map[string]map[string]struct{}
+	keyPins       map[string]map[string]string
+
 	keys *sync.Map
+
+	// conditional request validators and next refresh time, map[<JWK set URL>]*fetchState
+	states sync.Map
+
+	// on-demand refresh on the lookup of an unknown key ID
+	refreshOnMissEnabled bool
+	missRefreshInterval  time.Duration
+	unknownKeyIDTTL      time.Duration
+	missGroup            singleflight.Group // coalesces the concurrent refreshes on miss of the same URL
+	lastMissRefresh      sync.Map           // map[<JWK set URL>]time.Time
+	unknownKeyIDs        sync.Map           // map[<JWK set URL>\x00<key ID>]time.Time, the expiry
+
+	// JWK sets of the allowed jku URLs fetched on first use
+	jkuPatterns  []*jkuPattern
+	allowedJkus  sync.Map // map[<jku URL>]struct{}, e.g. the JWK set URLs of the access token issuers
+	jkuCacheTTL  time.Duration
+	jkuCacheSize int
+	jkuGroup     singleflight.Group // coalesces the concurrent fetches of the same jku URL
+	jkuMu        sync.RWMutex
+	jkus         map[string]*jkuEntry
+
+	// key rotation event subscribers
+	subscribers pubsub.Subscribers[*KeyEvent]
 }
 
 // Provider represent the jwk provider to retrieve the json web key.
@@ -70,11 +103,15 @@ func (j *jwkd) Start(ctx context.Context) <-chan error {
 	go func() {
 		defer close(fch)
 		defer close(ech)
-		ticker := time.NewTicker(j.refreshPeriod)
+		// each JWK set URL is refreshed when it is due, adapted to the Cache-Control max-age
+		timer := time.NewTimer(j.nextRefresh(fastime.Now()))
 		ebuf := errors.New("")
 
-		update := func() {
-			if err := j.Update(ctx); err != nil {
+		update := func(dueOnly bool) {
+			defer func() {
+				timer.Reset(j.nextRefresh(fastime.Now()))
+			}()
+			if err := j.update(ctx, dueOnly); err != nil {
 				err = errors.Wrap(err, "error update athenz json web key")
 				time.Sleep(j.retryDelay)
 
@@ -97,7 +134,7 @@ func (j *jwkd) Start(ctx context.Context) <-chan error {
 			select {
 			case <-ctx.Done():
 				glg.Info("Stopping jwkd")
-				ticker.Stop()
+				timer.Stop()
 				if ebuf.Error() != "" {
 					ech <- errors.Wrap(ctx.Err(), ebuf.Error())
 				} else {
@@ -105,9 +142,9 @@ func (j *jwkd) Start(ctx context.Context) <-chan error {
 				}
 				return
 			case <-fch:
-				update()
-			case <-ticker.C:
-				update()
+				update(false)
+			case <-timer.C:
+				update(true)
 			}
 		}
 	}()
@@ -115,8 +152,16 @@ func (j *jwkd) Start(ctx context.Context) <-chan error {
 	return ech
 }
 
-func (j *jwkd) Update(ctx context.Context) (err error) {
+// Update fetches the JWK sets of all the URLs with the conditional requests
+func (j *jwkd) Update(ctx context.Context) error {
+	return j.update(ctx, false)
+}
+
+// update fetches the JWK sets, only the URLs due for the refresh if dueOnly is true.
+// The previous JWK set is kept if the JWK set is not modified or fetching fails.
+func (j *jwkd) update(ctx context.Context, dueOnly bool) error {
 	glg.Info("Fetching JWK Set")
+	now := fastime.Now()
 
 	var targets []string
 	if !isContain(j.urls, j.athenzJwksURL) {
@@ -125,22 +170,27 @@ func (j *jwkd) Update(ctx context.Context) (err error) {
 		targets = j.urls
 	}
 
-	var failedTargets []string
+	var failedTargets, pinErrs []string
 	for _, target := range targets {
-		glg.Debugf("Fetching JWK Set from %s", target)
-		keys, err := jwk.Fetch(ctx, target, jwk.WithHTTPClient(j.client))
-		if err != nil {
-			glg.Errorf("Fetch JWK Set error: %v", err)
-			failedTargets = append(failedTargets, target)
+		if dueOnly && !j.isDue(target, now) {
+			glg.Debugf("JWK Set of %s is not due for the refresh", target)
 			continue
 		}
-		j.keys.Store(target, keys)
-		glg.Debugf("Fetch JWK Set from %s success", target)
+		if err := j.refreshURL(ctx, target, now); err != nil {
+			if errors.Is(err, ErrKeyPinMismatch) {
+				pinErrs = append(pinErrs, err.Error())
+			} else {
+				failedTargets = append(failedTargets, target)
+			}
+		}
 	}
 
 	if len(failedTargets) > 0 {
 		return errors.Errorf("Failed to fetch the JWK Set from these URLs: %s", failedTargets)
 	}
+	if len(pinErrs) > 0 {
+		return errors.Wrap(ErrKeyPinMismatch, strings.Join(pinErrs, ", "))
+	}
 
 	glg.Info("Fetch JWK Set success")
 	return nil
@@ -155,20 +205,22 @@ func (j *jwkd) getKey(keyID string, jwkSetURL string) interface{} {
 		return nil
 	}
 
-	var keys interface{}
-	var ok bool
-	if jwkSetURL == "" {
-		keys, ok = j.keys.Load(j.athenzJwksURL)
-	} else {
-		keys, ok = j.keys.Load(jwkSetURL)
+	target := jwkSetURL
+	if target == "" {
+		target = j.athenzJwksURL
 	}
-
-	// Either jku specified in the token is not set in jwkd.urls or key cache is failing.
-	if !ok {
+	// the jku URL not configured in jwkd is fetched on first use if allowed
+	if !j.isTarget(target) && !j.loadJku(target) {
 		return nil
 	}
 
-	key, found := keys.(jwk.Set).LookupKeyID(keyID)
+	key, found := j.lookupKey(target, keyID)
+	// the signing key may be rotated after the last refresh
+	if !found && j.refreshOnMiss(target, keyID) {
+		if key, found = j.lookupKey(target, keyID); !found {
+			j.cacheUnknownKeyID(target, keyID)
+		}
+	}
 	if found {
 		var raw interface{}
 		if err := jwk.Export(key, &raw); err != nil {
@@ -178,10 +230,20 @@ func (j *jwkd) getKey(keyID string, jwkSetURL string) interface{} {
 		}
 	}
 
-	// Either key for the kid specified in the token was not found or invalid key
+	// Either jku specified in the token is not set in jwkd.urls, key cache is failing,
+	// or key for the kid specified in the token was not found or invalid key
 	return nil
 }
 
+// lookupKey returns the key of the key ID in the cached JWK set of the URL
+func (j *jwkd) lookupKey(target, keyID string) (jwk.Key, bool) {
+	keys, ok := j.keys.Load(target)
+	if !ok {
+		return nil, false
+	}
+	return keys.(jwk.Set).LookupKeyID(keyID)
+}
+
 func isContain(targets []string, key string) bool {
 	for _, target := range targets {
 		if target == key {
@@ -56,6 +56,11 @@ func TestNew(t *testing.T) {
 				retryDelay:    time.Minute,
 				client:        http.DefaultClient,
 				keys:          &sync.Map{},
+
+				missRefreshInterval: time.Second * 10,
+				unknownKeyIDTTL:     time.Minute,
+				jkuCacheTTL:         time.Hour,
+				jkuCacheSize:        100,
 			},
 		},
 		{
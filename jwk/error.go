@@ -19,4 +19,7 @@ import "github.com/pkg/errors"
 var (
 	// ErrFetchAthenzJWK "Fetch athenz json web key error"
 	ErrFetchAthenzJWK = errors.New("Fetch athenz json web key error")
+
+	// ErrKeyPinMismatch "JSON web key does not match the pinned fingerprint"
+	ErrKeyPinMismatch = errors.New("JSON web key does not match the pinned fingerprint")
 )
@@ -0,0 +1,156 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"sort"
+	"time"
+
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
+	"github.com/kpango/glg"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// KeyEventType represent the type of the key rotation event.
+type KeyEventType string
+
+const (
+	// KeyAdded represent the key ID is added to the JWK set.
+	KeyAdded KeyEventType = "added"
+
+	// KeyRemoved represent the key ID is removed from the JWK set.
+	KeyRemoved KeyEventType = "removed"
+)
+
+// KeyEvent represent the addition or removal of a key ID in a JWK set, delivered after the new JWK set becomes effective.
+// On the first fetch of the JWK set URL, all the keys are added.
+type KeyEvent struct {
+	Type        KeyEventType `json:"type"`
+	URL         string       `json:"url"`
+	KeyID       string       `json:"key_id"`
+	KeyType     string       `json:"key_type,omitempty"`
+	Fingerprint string       `json:"fingerprint,omitempty"`
+	Time        time.Time    `json:"time"`
+}
+
+// Subscribe returns the channel delivering the key rotation events, which is closed when the context is done.
+// The events are dropped if the channel buffer is full, so the subscriber should receive them without blocking.
+func (j *jwkd) Subscribe(ctx context.Context) <-chan *KeyEvent {
+	return j.subscribers.Subscribe(ctx)
+}
+
+func (j *jwkd) publish(evs []*KeyEvent) {
+	for _, ev := range evs {
+		glg.Infof("jwk %s, url: %s, keyID: %s, keyType: %s, fingerprint: %s", ev.Type, ev.URL, ev.KeyID, ev.KeyType, ev.Fingerprint)
+		if j.subscribers.Publish(ev) > 0 {
+			glg.Warnf("jwk event queue already full, event dropped, url: %s, keyID: %s", ev.URL, ev.KeyID)
+		}
+	}
+}
+
+// keyInfo represent the type and the fingerprint of a JWK
+type keyInfo struct {
+	keyType     string
+	fingerprint string
+}
+
+// keyInfos returns the infos of the keys in the JWK set, map[<key ID>]keyInfo
+func keyInfos(set jwk.Set) map[string]keyInfo {
+	infos := make(map[string]keyInfo)
+	if set == nil {
+		return infos
+	}
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if !ok {
+			continue
+		}
+		kid, _ := key.KeyID()
+		infos[kid] = keyInfo{
+			keyType:     key.KeyType().String(),
+			fingerprint: fingerprint(key),
+		}
+	}
+	return infos
+}
+
+// fingerprint returns the hex encoded SHA-256 of the SPKI of the public key, or empty if the key is not an asymmetric key
+func fingerprint(key jwk.Key) string {
+	var raw interface{}
+	if err := jwk.Export(key, &raw); err != nil {
+		return ""
+	}
+	var pub interface{}
+	switch k := raw.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		pub = k
+	case *rsa.PrivateKey:
+		pub = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &k.PublicKey
+	case ed25519.PrivateKey:
+		pub = k.Public()
+	default:
+		return ""
+	}
+	return keypin.Fingerprint(pub)
+}
+
+// diffKeySet returns the events of the key IDs added to or removed from the old JWK set.
+// The key with the same key ID but a different fingerprint is reported as removed and added.
+func diffKeySet(url string, old, cur jwk.Set, now time.Time) []*KeyEvent {
+	oldInfos, curInfos := keyInfos(old), keyInfos(cur)
+	ids := make([]string, 0, len(oldInfos)+len(curInfos))
+	for id := range curInfos {
+		ids = append(ids, id)
+	}
+	for id := range oldInfos {
+		if _, ok := curInfos[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	event := func(typ KeyEventType, id string, ki keyInfo) *KeyEvent {
+		return &KeyEvent{
+			Type:        typ,
+			URL:         url,
+			KeyID:       id,
+			KeyType:     ki.keyType,
+			Fingerprint: ki.fingerprint,
+			Time:        now,
+		}
+	}
+	var evs []*KeyEvent
+	for _, id := range ids {
+		oi, oldOk := oldInfos[id]
+		ci, curOk := curInfos[id]
+		switch {
+		case oldOk && curOk:
+			if oi != ci {
+				evs = append(evs, event(KeyRemoved, id, oi), event(KeyAdded, id, ci))
+			}
+		case oldOk:
+			evs = append(evs, event(KeyRemoved, id, oi))
+		case curOk:
+			evs = append(evs, event(KeyAdded, id, ci))
+		}
+	}
+	return evs
+}
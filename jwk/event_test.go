@@ -0,0 +1,190 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+type testKey struct {
+	kid         string
+	key         jwk.Key
+	fingerprint string
+}
+
+func newTestKey(t *testing.T, kid string) *testKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.Import(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	return &testKey{kid: kid, key: key, fingerprint: hex.EncodeToString(sum[:])}
+}
+
+func newTestSet(t *testing.T, keys ...*testKey) jwk.Set {
+	t.Helper()
+	set := jwk.NewSet()
+	for _, k := range keys {
+		if err := set.AddKey(k.key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return set
+}
+
+func Test_diffKeySet(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	k0, k1, k2 := newTestKey(t, "0"), newTestKey(t, "1"), newTestKey(t, "2")
+	k0new := newTestKey(t, "0")
+	type event struct {
+		typ         KeyEventType
+		kid         string
+		fingerprint string
+	}
+	tests := []struct {
+		name string
+		old  jwk.Set
+		cur  jwk.Set
+		want []event
+	}{
+		{
+			name: "first fetch",
+			old:  nil,
+			cur:  newTestSet(t, k1, k0),
+			want: []event{
+				{typ: KeyAdded, kid: "0", fingerprint: k0.fingerprint},
+				{typ: KeyAdded, kid: "1", fingerprint: k1.fingerprint},
+			},
+		},
+		{
+			name: "not changed",
+			old:  newTestSet(t, k0, k1),
+			cur:  newTestSet(t, k1, k0),
+			want: nil,
+		},
+		{
+			name: "added, removed and replaced",
+			old:  newTestSet(t, k0, k1),
+			cur:  newTestSet(t, k0new, k2),
+			want: []event{
+				{typ: KeyRemoved, kid: "0", fingerprint: k0.fingerprint},
+				{typ: KeyAdded, kid: "0", fingerprint: k0new.fingerprint},
+				{typ: KeyRemoved, kid: "1", fingerprint: k1.fingerprint},
+				{typ: KeyAdded, kid: "2", fingerprint: k2.fingerprint},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffKeySet("https://athenz.io/oauth2/keys", tt.old, tt.cur, now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("diffKeySet() = %d events, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.Type != w.typ || g.KeyID != w.kid || g.Fingerprint != w.fingerprint || g.KeyType != "EC" || g.URL != "https://athenz.io/oauth2/keys" || !g.Time.Equal(now) {
+					t.Errorf("diffKeySet()[%d] = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func Test_jwkd_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k0, k1 := newTestKey(t, "0"), newTestKey(t, "1")
+	var body atomic.Value
+	setBody := func(keys ...*testKey) {
+		b, err := json.Marshal(newTestSet(t, keys...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.Store(b)
+	}
+	setBody(k0)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	j := &jwkd{
+		athenzJwksURL: srv.URL,
+		client:        srv.Client(),
+		keys:          &sync.Map{},
+	}
+	ch := j.Subscribe(ctx)
+	receive := func(typ KeyEventType, k *testKey) {
+		t.Helper()
+		select {
+		case ev := <-ch:
+			if ev.Type != typ || ev.URL != srv.URL || ev.KeyID != k.kid || ev.Fingerprint != k.fingerprint {
+				t.Errorf("Subscribe() got event %+v, want %s %s", ev, typ, k.kid)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subscribe() event not received, want %s %s", typ, k.kid)
+		}
+	}
+
+	if err := j.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	receive(KeyAdded, k0)
+
+	setBody(k1)
+	if err := j.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	receive(KeyRemoved, k0)
+	receive(KeyAdded, k1)
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Subscribe() channel is not closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Subscribe() channel is not closed")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/pkg/errors"
+)
+
+// minRefreshPeriod is the lower bound of the refresh period adapted to the Cache-Control max-age, to protect the server from a too short max-age
+const minRefreshPeriod = 10 * time.Second
+
+// fetchState represent the validators of the conditional request and the next refresh time of a JWK set URL
+type fetchState struct {
+	eTag         string
+	lastModified string
+	next         time.Time
+}
+
+// fetch fetches the JWK set of the URL with a conditional request, and returns nil if the JWK set is not modified
+func (j *jwkd) fetch(ctx context.Context, target string, now time.Time) (jwk.Set, error) {
+	var last fetchState
+	if v, ok := j.states.Load(target); ok {
+		last = *v.(*fetchState)
+	}
+	// the failed URL is retried by the retry loop, not by the refresh timer
+	failed := &fetchState{eTag: last.eTag, lastModified: last.lastModified, next: now.Add(j.refreshPeriod)}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		j.states.Store(target, failed)
+		return nil, errors.Wrap(err, "error creating get JWK Set request")
+	}
+	if last.eTag != "" {
+		req.Header.Set("If-None-Match", last.eTag)
+	}
+	if last.lastModified != "" {
+		req.Header.Set("If-Modified-Since", last.lastModified)
+	}
+
+	r, err := j.client.Do(req)
+	if err != nil {
+		j.states.Store(target, failed)
+		return nil, errors.Wrap(err, "error make http request")
+	}
+	defer func() {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			glg.Warn(errors.Wrap(err, "error io.copy"))
+		}
+		if err := r.Body.Close(); err != nil {
+			glg.Warn(errors.Wrap(err, "error body.close"))
+		}
+	}()
+
+	st := &fetchState{
+		eTag:         r.Header.Get("ETag"),
+		lastModified: r.Header.Get("Last-Modified"),
+		next:         now.Add(j.refreshAfter(r.Header.Get("Cache-Control"))),
+	}
+	switch r.StatusCode {
+	case http.StatusNotModified:
+		// the validators may be omitted in the not modified response
+		if st.eTag == "" {
+			st.eTag = last.eTag
+		}
+		if st.lastModified == "" {
+			st.lastModified = last.lastModified
+		}
+		j.states.Store(target, st)
+		return nil, nil
+	case http.StatusOK:
+	default:
+		j.states.Store(target, failed)
+		return nil, errors.Wrapf(ErrFetchAthenzJWK, "http return status %d", r.StatusCode)
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		j.states.Store(target, failed)
+		return nil, errors.Wrap(err, "error read JWK Set")
+	}
+	keys, err := jwk.Parse(b)
+	if err != nil {
+		j.states.Store(target, failed)
+		return nil, errors.Wrap(err, "error parse JWK Set")
+	}
+	j.states.Store(target, st)
+	return keys, nil
+}
+
+// refreshAfter returns the period until the next refresh, the Cache-Control max-age within the refresh period, or the refresh period
+func (j *jwkd) refreshAfter(cacheControl string) time.Duration {
+	maxAge, ok := parseMaxAge(cacheControl)
+	if !ok || maxAge > j.refreshPeriod {
+		return j.refreshPeriod
+	}
+	if maxAge < minRefreshPeriod {
+		return min(minRefreshPeriod, j.refreshPeriod)
+	}
+	return maxAge
+}
+
+// isDue reports whether the JWK set of the URL should be refreshed, the URL never fetched is always due
+func (j *jwkd) isDue(target string, now time.Time) bool {
+	v, ok := j.states.Load(target)
+	return !ok || !now.Before(v.(*fetchState).next)
+}
+
+// nextRefresh returns the period until the earliest refresh of the fetched JWK set URLs, or the refresh period if none of them is fetched.
+// The jku URLs fetched on first use are not refreshed by the update, so they are excluded.
+func (j *jwkd) nextRefresh(now time.Time) time.Duration {
+	d := j.refreshPeriod
+	j.states.Range(func(k, v interface{}) bool {
+		if !j.isTarget(k.(string)) {
+			return true
+		}
+		if n := v.(*fetchState).next.Sub(now); n < d {
+			d = n
+		}
+		return true
+	})
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// parseMaxAge returns the max-age of the Cache-Control header, no-cache and no-store are treated as zero max-age
+func parseMaxAge(cacheControl string) (time.Duration, bool) {
+	var (
+		maxAge time.Duration
+		found  bool
+	)
+	for _, d := range strings.Split(cacheControl, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-cache" || d == "no-store":
+			return 0, true
+		case strings.HasPrefix(d, "max-age="):
+			s, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(d, "max-age="), `"`))
+			if err != nil || s < 0 {
+				continue
+			}
+			maxAge, found = time.Duration(s)*time.Second, true
+		}
+	}
+	return maxAge, found
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_parseMaxAge(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		want         time.Duration
+		wantOk       bool
+	}{
+		{
+			name: "empty header",
+		},
+		{
+			name:         "max-age",
+			cacheControl: "public, max-age=3600",
+			want:         time.Hour,
+			wantOk:       true,
+		},
+		{
+			name:         "quoted and upper case max-age",
+			cacheControl: `Max-Age="60"`,
+			want:         time.Minute,
+			wantOk:       true,
+		},
+		{
+			name:         "no-cache overrides max-age",
+			cacheControl: "max-age=3600, no-cache",
+			want:         0,
+			wantOk:       true,
+		},
+		{
+			name:         "no-store",
+			cacheControl: "no-store",
+			want:         0,
+			wantOk:       true,
+		},
+		{
+			name:         "invalid max-age is ignored",
+			cacheControl: "max-age=-1, max-age=dummy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMaxAge(tt.cacheControl)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseMaxAge() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_jwkd_refreshAfter(t *testing.T) {
+	tests := []struct {
+		name          string
+		refreshPeriod time.Duration
+		cacheControl  string
+		want          time.Duration
+	}{
+		{
+			name:          "no max-age",
+			refreshPeriod: 24 * time.Hour,
+			want:          24 * time.Hour,
+		},
+		{
+			name:          "max-age shorter than the refresh period",
+			refreshPeriod: 24 * time.Hour,
+			cacheControl:  "max-age=3600",
+			want:          time.Hour,
+		},
+		{
+			name:          "max-age longer than the refresh period",
+			refreshPeriod: time.Hour,
+			cacheControl:  "max-age=86400",
+			want:          time.Hour,
+		},
+		{
+			name:          "too short max-age",
+			refreshPeriod: time.Hour,
+			cacheControl:  "no-cache",
+			want:          minRefreshPeriod,
+		},
+		{
+			name:          "refresh period shorter than the minimum",
+			refreshPeriod: time.Second,
+			cacheControl:  "max-age=0",
+			want:          time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{refreshPeriod: tt.refreshPeriod}
+			if got := j.refreshAfter(tt.cacheControl); got != tt.want {
+				t.Errorf("refreshAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jwkd_nextRefresh(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	j := &jwkd{
+		athenzJwksURL: "https://athenz.io/jwks",
+		urls:          []string{"https://other.io/jwks"},
+		refreshPeriod: time.Hour,
+	}
+	if got := j.nextRefresh(now); got != time.Hour {
+		t.Errorf("nextRefresh() = %v, want %v", got, time.Hour)
+	}
+	if !j.isDue("https://athenz.io/jwks", now) {
+		t.Errorf("isDue() = false for the URL never fetched")
+	}
+
+	j.states.Store("https://athenz.io/jwks", &fetchState{next: now.Add(time.Minute)})
+	j.states.Store("https://other.io/jwks", &fetchState{next: now.Add(time.Minute * 2)})
+	// the jku URL is not refreshed by the update
+	j.states.Store("https://jku.athenz.io/jwks", &fetchState{next: now.Add(-time.Minute)})
+	if got := j.nextRefresh(now); got != time.Minute {
+		t.Errorf("nextRefresh() = %v, want %v", got, time.Minute)
+	}
+	if j.isDue("https://athenz.io/jwks", now) {
+		t.Errorf("isDue() = true before the next refresh")
+	}
+	if !j.isDue("https://athenz.io/jwks", now.Add(time.Minute)) {
+		t.Errorf("isDue() = false at the next refresh")
+	}
+	if got := j.nextRefresh(now.Add(time.Hour)); got != 0 {
+		t.Errorf("nextRefresh() = %v, want 0", got)
+	}
+}
+
+func Test_jwkd_Update_conditional(t *testing.T) {
+	ctx := context.Background()
+	k0 := newTestKey(t, "0")
+	b0, err := json.Marshal(newTestSet(t, k0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		status   atomic.Int32
+		requests atomic.Int32
+		mu       sync.Mutex
+		header   http.Header
+	)
+	status.Store(http.StatusOK)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		mu.Lock()
+		header = r.Header.Clone()
+		mu.Unlock()
+		if r.Header.Get("If-None-Match") == `"v0"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v0"`)
+		w.Header().Set("Last-Modified", "Tue, 14 Nov 2023 22:13:20 GMT")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write(b0)
+	}))
+	defer srv.Close()
+
+	j := &jwkd{
+		athenzJwksURL: srv.URL,
+		refreshPeriod: 24 * time.Hour,
+		client:        srv.Client(),
+		keys:          &sync.Map{},
+	}
+	if err := j.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if j.getKey("0", "") == nil {
+		t.Fatalf("getKey() key 0 is not loaded")
+	}
+	if got := j.nextRefresh(time.Now()); got > time.Hour || got < time.Hour-time.Minute {
+		t.Errorf("nextRefresh() = %v, want about 1h from the max-age", got)
+	}
+
+	// the not modified JWK set is kept
+	ch := j.Subscribe(ctx)
+	if err := j.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	mu.Lock()
+	if got := header.Get("If-None-Match"); got != `"v0"` {
+		t.Errorf("If-None-Match = %s, want %s", got, `"v0"`)
+	}
+	if got := header.Get("If-Modified-Since"); got != "Tue, 14 Nov 2023 22:13:20 GMT" {
+		t.Errorf("If-Modified-Since = %s", got)
+	}
+	mu.Unlock()
+	if j.getKey("0", "") == nil {
+		t.Errorf("getKey() the not modified JWK set is not kept")
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("Subscribe() got event %+v for the not modified JWK set", ev)
+	default:
+	}
+
+	// the URL not due is skipped on the refresh
+	before := requests.Load()
+	if err := j.update(ctx, true); err != nil {
+		t.Fatalf("update() error = %v", err)
+	}
+	if requests.Load() != before {
+		t.Errorf("update() fetched the URL not due for the refresh")
+	}
+
+	// the previous JWK set is kept on failure
+	j.states.Delete(srv.URL)
+	status.Store(http.StatusInternalServerError)
+	if err := j.Update(ctx); err == nil {
+		t.Fatalf("Update() error = nil")
+	}
+	if j.getKey("0", "") == nil {
+		t.Errorf("getKey() the previous JWK set is not kept on failure")
+	}
+	if j.isDue(srv.URL, time.Now()) {
+		t.Errorf("isDue() = true after failure, the retry loop retries the failed URL")
+	}
+}
+
+func Test_jwkd_fetch_invalidResponse(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not a JWK set"))
+	}))
+	defer srv.Close()
+
+	j := &jwkd{refreshPeriod: time.Hour, client: srv.Client()}
+	keys, err := j.fetch(context.Background(), srv.URL, time.Now())
+	if keys != nil || err == nil {
+		t.Errorf("fetch() = %v, %v, want parse error", keys, err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+// jkuPattern represent an allowed pattern of the jku URLs, https://<host glob>/<path prefix>
+type jkuPattern struct {
+	// host labels, "*" matches any single label, and the other labels are path.Match patterns
+	hostLabels []string
+	pathPrefix string
+}
+
+// jkuEntry represent the JWK set of a jku URL fetched on first use
+type jkuEntry struct {
+	// whether the JWK set is cached, false if the fetch failed
+	ok      bool
+	fetched time.Time
+	expiry  time.Time
+}
+
+// parseJkuPattern parses the jku URL pattern, e.g. https://*.athenz.io/oauth2/keys
+func parseJkuPattern(p string) (*jkuPattern, error) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid jku pattern: %s", p)
+	}
+	if u.Scheme != "https" {
+		return nil, errors.Errorf("invalid jku pattern: %s, only https is allowed", p)
+	}
+	if u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, errors.Errorf("invalid jku pattern: %s, only the host and the path are allowed", p)
+	}
+	labels := strings.Split(strings.ToLower(u.Host), ".")
+	for _, l := range labels {
+		if _, err := path.Match(l, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid jku pattern: %s", p)
+		}
+	}
+	return &jkuPattern{
+		hostLabels: labels,
+		pathPrefix: u.Path,
+	}, nil
+}
+
+// match reports whether the parsed jku URL matches the pattern
+func (p *jkuPattern) match(u *url.URL) bool {
+	labels := strings.Split(strings.ToLower(u.Host), ".")
+	if len(labels) != len(p.hostLabels) {
+		return false
+	}
+	for i, pl := range p.hostLabels {
+		if ok, _ := path.Match(pl, labels[i]); !ok {
+			return false
+		}
+	}
+	if p.pathPrefix == "" || p.pathPrefix == "/" || u.Path == p.pathPrefix {
+		return true
+	}
+	prefix := p.pathPrefix
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return strings.HasPrefix(u.Path, prefix)
+}
+
+// AllowURL allows the JWK set of the URL to be fetched on first use like the jku URL matching the jku patterns
+func (j *jwkd) AllowURL(url string) {
+	j.allowedJkus.Store(url, struct{}{})
+}
+
+// isJkuAllowed reports whether the jku URL is allowed or matches any of the allowed jku patterns
+func (j *jwkd) isJkuAllowed(jku string) bool {
+	if _, ok := j.allowedJkus.Load(jku); ok {
+		return true
+	}
+	if len(j.jkuPatterns) == 0 {
+		return false
+	}
+	u, err := url.Parse(jku)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Fragment != "" {
+		return false
+	}
+	// reject the path traversal out of the path prefix
+	for _, seg := range strings.Split(u.Path, "/") {
+		if seg == ".." {
+			return false
+		}
+	}
+	for _, p := range j.jkuPatterns {
+		if p.match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJkuCached reports whether the JWK set of the jku URL is cached
+func (j *jwkd) isJkuCached(jku string) bool {
+	j.jkuMu.RLock()
+	defer j.jkuMu.RUnlock()
+	e, ok := j.jkus[jku]
+	return ok && e.ok
+}
+
+// loadJku fetches the JWK set of the allowed jku URL on first use or after the expiry, and reports whether it is cached.
+// The JWK set already cached without being fetched as a jku is used as is.
+// The concurrent loads of the same jku URL share one fetch, and the failed jku URL is not fetched again within the miss refresh interval.
+func (j *jwkd) loadJku(jku string) bool {
+	now := fastime.Now()
+	j.jkuMu.RLock()
+	e, ok := j.jkus[jku]
+	j.jkuMu.RUnlock()
+	if ok && now.Before(e.expiry) {
+		return e.ok
+	}
+	if !ok {
+		if _, cached := j.keys.Load(jku); cached {
+			return true
+		}
+	}
+	if !j.isJkuAllowed(jku) {
+		glg.Debugf("jku is not allowed: %s", jku)
+		return false
+	}
+
+	cached, _, _ := j.jkuGroup.Do(jku, func() (interface{}, error) {
+		glg.Infof("Fetching JWK Set of jku %s", jku)
+		ctx, cancel := context.WithTimeout(context.Background(), refreshOnMissTimeout)
+		defer cancel()
+
+		e := &jkuEntry{fetched: now, expiry: now.Add(j.jkuCacheTTL)}
+		if err := j.refreshURL(ctx, jku, now); err != nil {
+			glg.Warnf("Fetch JWK Set of jku error: %v", errors.Wrap(err, jku))
+			e.expiry = now.Add(j.missRefreshInterval)
+		} else if st, ok := j.states.Load(jku); ok && st.(*fetchState).next.Before(e.expiry) {
+			// the Cache-Control max-age of the jku URL
+			e.expiry = st.(*fetchState).next
+		}
+		_, e.ok = j.keys.Load(jku)
+		j.storeJku(jku, e)
+		return e.ok, nil
+	})
+	return cached.(bool)
+}
+
+// storeJku stores the jku entry, and evicts the failed or the oldest fetched JWK sets over the cache size
+func (j *jwkd) storeJku(jku string, e *jkuEntry) {
+	j.jkuMu.Lock()
+	defer j.jkuMu.Unlock()
+	if j.jkus == nil {
+		j.jkus = make(map[string]*jkuEntry)
+	}
+	j.jkus[jku] = e
+	for len(j.jkus) > j.jkuCacheSize {
+		var (
+			oldest string
+			oe     *jkuEntry
+		)
+		for u, ce := range j.jkus {
+			// the failed jku URLs are evicted first, not to evict the valid JWK sets by the bogus jku URLs
+			if u != jku && (oe == nil || (!ce.ok && oe.ok) || (ce.ok == oe.ok && ce.fetched.Before(oe.fetched))) {
+				oldest, oe = u, ce
+			}
+		}
+		if oe == nil {
+			return
+		}
+		glg.Debugf("Evicting JWK Set of jku %s", oldest)
+		delete(j.jkus, oldest)
+		j.keys.Delete(oldest)
+		j.states.Delete(oldest)
+	}
+}
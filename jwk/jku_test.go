@@ -0,0 +1,297 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kpango/glg"
+)
+
+func Test_parseJkuPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    *jkuPattern
+		wantErr string
+	}{
+		{
+			name:    "host glob and path prefix",
+			pattern: "https://*.Athenz.io/oauth2/keys",
+			want: &jkuPattern{
+				hostLabels: []string{"*", "athenz", "io"},
+				pathPrefix: "/oauth2/keys",
+			},
+		},
+		{
+			name:    "host only",
+			pattern: "https://jwks.athenz.io",
+			want: &jkuPattern{
+				hostLabels: []string{"jwks", "athenz", "io"},
+			},
+		},
+		{
+			name:    "http is not allowed",
+			pattern: "http://*.athenz.io/oauth2/keys",
+			wantErr: "invalid jku pattern: http://*.athenz.io/oauth2/keys, only https is allowed",
+		},
+		{
+			name:    "query is not allowed",
+			pattern: "https://*.athenz.io/oauth2/keys?rfc=true",
+			wantErr: "invalid jku pattern: https://*.athenz.io/oauth2/keys?rfc=true, only the host and the path are allowed",
+		},
+		{
+			name:    "empty host",
+			pattern: "https:///oauth2/keys",
+			wantErr: "invalid jku pattern: https:///oauth2/keys, only the host and the path are allowed",
+		},
+		{
+			name:    "invalid host glob",
+			pattern: "https://[a.athenz.io/oauth2/keys",
+			wantErr: "invalid jku pattern: https://[a.athenz.io/oauth2/keys",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJkuPattern(tt.pattern)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("parseJkuPattern() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJkuPattern() error = %v", err)
+			}
+			if strings.Join(got.hostLabels, ".") != strings.Join(tt.want.hostLabels, ".") || got.pathPrefix != tt.want.pathPrefix {
+				t.Errorf("parseJkuPattern() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jwkd_isJkuAllowed(t *testing.T) {
+	j := &jwkd{}
+	if err := WithJkuPatterns("https://*.athenz.io/oauth2/keys", "https://jwks-*.example.com:4443")(j); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		jku  string
+		want bool
+	}{
+		{name: "host glob", jku: "https://zts.athenz.io/oauth2/keys", want: true},
+		{name: "host is case insensitive", jku: "https://ZTS.Athenz.io/oauth2/keys", want: true},
+		{name: "query is allowed", jku: "https://zts.athenz.io/oauth2/keys?rfc=true", want: true},
+		{name: "sub path", jku: "https://zts.athenz.io/oauth2/keys/v2", want: true},
+		{name: "glob matches a single label", jku: "https://a.zts.athenz.io/oauth2/keys", want: false},
+		{name: "glob does not match the parent domain", jku: "https://athenz.io/oauth2/keys", want: false},
+		{name: "suffix of the domain", jku: "https://zts.athenz.io.evil.com/oauth2/keys", want: false},
+		{name: "path prefix on the segment boundary", jku: "https://zts.athenz.io/oauth2/keysX", want: false},
+		{name: "other path", jku: "https://zts.athenz.io/other", want: false},
+		{name: "path traversal", jku: "https://zts.athenz.io/oauth2/keys/../../other", want: false},
+		{name: "encoded path traversal", jku: "https://zts.athenz.io/oauth2/keys/%2e%2e/other", want: false},
+		{name: "http", jku: "http://zts.athenz.io/oauth2/keys", want: false},
+		{name: "user info", jku: "https://user@zts.athenz.io/oauth2/keys", want: false},
+		{name: "host glob in a label with port", jku: "https://jwks-1.example.com:4443/any/path", want: true},
+		{name: "other port", jku: "https://jwks-1.example.com/any/path", want: false},
+		{name: "invalid URL", jku: "https://zts.athenz.io/%zz", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := j.isJkuAllowed(tt.jku); got != tt.want {
+				t.Errorf("isJkuAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if (&jwkd{}).isJkuAllowed("https://zts.athenz.io/oauth2/keys") {
+		t.Errorf("isJkuAllowed() = true without the jku patterns")
+	}
+
+	a := &jwkd{}
+	a.AllowURL("http://127.0.0.1/oauth2/keys")
+	if !a.isJkuAllowed("http://127.0.0.1/oauth2/keys") {
+		t.Errorf("isJkuAllowed() = false for the allowed URL")
+	}
+	if a.isJkuAllowed("http://127.0.0.1/oauth2/keys/v2") {
+		t.Errorf("isJkuAllowed() = true for the URL not allowed")
+	}
+}
+
+func Test_jwkd_getKey_jku(t *testing.T) {
+	k0 := newTestKey(t, "0")
+	b, err := json.Marshal(newTestSet(t, k0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		requests sync.Map // map[<path>]*atomic.Int32
+		failing  atomic.Bool
+	)
+	count := func(p string) int32 {
+		v, _ := requests.LoadOrStore(p, new(atomic.Int32))
+		return v.(*atomic.Int32).Load()
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, _ := requests.LoadOrStore(r.URL.Path, new(atomic.Int32))
+		v.(*atomic.Int32).Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	j := &jwkd{
+		athenzJwksURL:       srv.URL,
+		refreshPeriod:       time.Hour,
+		client:              srv.Client(),
+		keys:                &sync.Map{},
+		missRefreshInterval: time.Minute,
+		jkuCacheTTL:         time.Hour,
+		jkuCacheSize:        2,
+	}
+	if err := WithJkuPatterns(srv.URL + "/jwks")(j); err != nil {
+		t.Fatal(err)
+	}
+
+	// fetched on first use, and cached
+	for i := 0; i < 2; i++ {
+		if j.getKey("0", srv.URL+"/jwks/a") == nil {
+			t.Fatalf("getKey() the key of the allowed jku is not found")
+		}
+	}
+	if got := count("/jwks/a"); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+
+	// not allowed jku is not fetched
+	if j.getKey("0", srv.URL+"/other") != nil {
+		t.Errorf("getKey() the key of the not allowed jku is found")
+	}
+	if got := count("/other"); got != 0 {
+		t.Errorf("requests = %d, want 0", got)
+	}
+
+	// the failed jku is not fetched again within the miss refresh interval
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		if j.getKey("0", srv.URL+"/jwks/failed") != nil {
+			t.Errorf("getKey() the key of the failed jku is found")
+		}
+	}
+	if got := count("/jwks/failed"); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+	failing.Store(false)
+
+	// the failed jku is evicted first over the cache size
+	if j.getKey("0", srv.URL+"/jwks/b") == nil {
+		t.Fatalf("getKey() the key of the allowed jku is not found")
+	}
+	if _, ok := j.keys.Load(srv.URL + "/jwks/a"); !ok {
+		t.Errorf("the valid JWK set is evicted before the failed jku")
+	}
+
+	// the oldest fetched JWK set is evicted over the cache size
+	if j.getKey("0", srv.URL+"/jwks/c") == nil {
+		t.Fatalf("getKey() the key of the allowed jku is not found")
+	}
+	if _, ok := j.keys.Load(srv.URL + "/jwks/a"); ok {
+		t.Errorf("the oldest JWK set is not evicted")
+	}
+	if j.getKey("0", srv.URL+"/jwks/a") == nil {
+		t.Fatalf("getKey() the key of the evicted jku is not found")
+	}
+	if got := count("/jwks/a"); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// fetched again after the TTL
+	j.jkuMu.Lock()
+	j.jkus[srv.URL+"/jwks/a"].expiry = time.Now().Add(-time.Second)
+	j.jkuMu.Unlock()
+	if j.getKey("0", srv.URL+"/jwks/a") == nil {
+		t.Fatalf("getKey() the key of the expired jku is not found")
+	}
+	if got := count("/jwks/a"); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+// updateCounter counts the updates of jwkd by the log
+type updateCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *updateCounter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n += strings.Count(string(p), "Fetching JWK Set") - strings.Count(string(p), "Fetching JWK Set of")
+	return len(p), nil
+}
+
+func (c *updateCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+func Test_jwkd_Start_jku(t *testing.T) {
+	b, err := json.Marshal(newTestSet(t, newTestKey(t, "0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	j := &jwkd{
+		athenzJwksURL: srv.URL,
+		refreshPeriod: time.Hour,
+		retryDelay:    time.Millisecond,
+		client:        srv.Client(),
+		keys:          &sync.Map{},
+	}
+	if err := j.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the jku URL past the max-age, which is not refreshed by the update
+	j.states.Store(srv.URL+"/jwks/a", &fetchState{next: time.Now().Add(-time.Minute)})
+
+	c := new(updateCounter)
+	glg.Get().SetMode(glg.WRITER).SetWriter(c)
+	defer glg.Get().SetMode(glg.STD)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	for range j.Start(ctx) {
+	}
+	if got := c.count(); got != 0 {
+		t.Errorf("jwkd updated %d times before the refresh period, want 0", got)
+	}
+}
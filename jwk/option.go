@@ -15,11 +15,14 @@
 package jwk
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
 	urlutil "github.com/AthenZ/athenz-authorizer/v5/internal/url"
 	"github.com/pkg/errors"
 )
@@ -29,6 +32,10 @@ var (
 		WithRefreshPeriod("24h"),
 		WithRetryDelay("1m"),
 		WithHTTPClient(http.DefaultClient),
+		WithMissRefreshInterval("10s"),
+		WithUnknownKeyIDCacheTTL("1m"),
+		WithJkuCacheTTL("1h"),
+		WithJkuCacheSize(100),
 	}
 )
 
@@ -104,3 +111,134 @@ func WithHTTPClient(cl *http.Client) Option {
 		return nil
 	}
 }
+
+// WithAllowedKeyIDs returns an AllowedKeyIDs functional option.
+// Only the keys with the key IDs are accepted from the JWK set URL, the empty URL represents the Athenz JWK set URL.
+func WithAllowedKeyIDs(url string, ids ...string) Option {
+	return func(j *jwkd) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		if j.allowedKeyIDs == nil {
+			j.allowedKeyIDs = make(map[string]map[string]struct{})
+		}
+		j.allowedKeyIDs[url] = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			j.allowedKeyIDs[url][id] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithKeyPins returns a KeyPins functional option.
+// The pins map has the format of map[<key ID>]<hex encoded SHA-256 of the SPKI>, the empty URL represents the Athenz JWK set URL.
+// The fetched JWK set is rejected if the fingerprint of any pinned key ID does not match.
+func WithKeyPins(url string, pins map[string]string) Option {
+	return func(j *jwkd) error {
+		if len(pins) == 0 {
+			return nil
+		}
+		if j.keyPins == nil {
+			j.keyPins = make(map[string]map[string]string)
+		}
+		j.keyPins[url] = make(map[string]string, len(pins))
+		for id, fp := range pins {
+			fp = keypin.Normalize(fp)
+			if _, err := hex.DecodeString(fp); err != nil || len(fp) != sha256.Size*2 {
+				return errors.Errorf("invalid key pin of keyID %s: %s", id, fp)
+			}
+			j.keyPins[url][id] = fp
+		}
+		return nil
+	}
+}
+
+// WithRefreshOnMiss returns a RefreshOnMiss functional option.
+// If enabled, the lookup of an unknown key ID refreshes the JWK set of the URL immediately, for the signing key rotation. It is disabled by default.
+func WithRefreshOnMiss(b bool) Option {
+	return func(j *jwkd) error {
+		j.refreshOnMissEnabled = b
+		return nil
+	}
+}
+
+// WithMissRefreshInterval returns a MissRefreshInterval functional option.
+// The JWK set of a URL is refreshed on miss at most once in the interval.
+func WithMissRefreshInterval(i string) Option {
+	return func(j *jwkd) error {
+		if i == "" {
+			return nil
+		}
+		ri, err := time.ParseDuration(i)
+		if err != nil {
+			return errors.Wrap(err, "invalid miss refresh interval")
+		}
+		j.missRefreshInterval = ri
+		return nil
+	}
+}
+
+// WithUnknownKeyIDCacheTTL returns an UnknownKeyIDCacheTTL functional option.
+// The key ID not found in the JWK set refreshed on miss does not trigger the refresh again until the TTL passes.
+func WithUnknownKeyIDCacheTTL(t string) Option {
+	return func(j *jwkd) error {
+		if t == "" {
+			return nil
+		}
+		ttl, err := time.ParseDuration(t)
+		if err != nil {
+			return errors.Wrap(err, "invalid unknown key ID cache TTL")
+		}
+		j.unknownKeyIDTTL = ttl
+		return nil
+	}
+}
+
+// WithJkuPatterns returns a JkuPatterns functional option.
+// The JWK set of the jku URL matching any of the patterns is fetched on first use, even if it is not in the URLs.
+// The pattern is https://<host glob>/<path prefix>, e.g. https://*.athenz.io/oauth2/keys, and the "*" in the host matches a single label.
+func WithJkuPatterns(patterns ...string) Option {
+	return func(j *jwkd) error {
+		if len(patterns) == 0 {
+			return nil
+		}
+		jps := make([]*jkuPattern, 0, len(patterns))
+		for _, p := range patterns {
+			jp, err := parseJkuPattern(p)
+			if err != nil {
+				return err
+			}
+			jps = append(jps, jp)
+		}
+		j.jkuPatterns = jps
+		return nil
+	}
+}
+
+// WithJkuCacheTTL returns a JkuCacheTTL functional option.
+// The JWK set of the jku URL is fetched again after the TTL, or the Cache-Control max-age if shorter.
+func WithJkuCacheTTL(t string) Option {
+	return func(j *jwkd) error {
+		if t == "" {
+			return nil
+		}
+		ttl, err := time.ParseDuration(t)
+		if err != nil {
+			return errors.Wrap(err, "invalid jku cache TTL")
+		}
+		j.jkuCacheTTL = ttl
+		return nil
+	}
+}
+
+// WithJkuCacheSize returns a JkuCacheSize functional option.
+// The oldest fetched JWK sets of the jku URLs are evicted over the size.
+func WithJkuCacheSize(n int) Option {
+	return func(j *jwkd) error {
+		if n <= 0 {
+			return nil
+		}
+		j.jkuCacheSize = n
+		return nil
+	}
+}
@@ -364,3 +364,253 @@ func TestWithURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestWithAllowedKeyIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		ids  []string
+		want map[string]map[string]struct{}
+	}{
+		{
+			name: "set success",
+			url:  "https://athenz.io/jwks",
+			ids:  []string{"0", "1"},
+			want: map[string]map[string]struct{}{"https://athenz.io/jwks": {"0": {}, "1": {}}},
+		},
+		{
+			name: "empty value",
+			url:  "https://athenz.io/jwks",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{}
+			if err := WithAllowedKeyIDs(tt.url, tt.ids...)(j); err != nil {
+				t.Errorf("WithAllowedKeyIDs() error = %v", err)
+			}
+			if !reflect.DeepEqual(j.allowedKeyIDs, tt.want) {
+				t.Errorf("WithAllowedKeyIDs() = %v, want %v", j.allowedKeyIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithKeyPins(t *testing.T) {
+	fp := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		pins    map[string]string
+		want    map[string]map[string]string
+		wantErr string
+	}{
+		{
+			name: "set success",
+			pins: map[string]string{"0": fp},
+			want: map[string]map[string]string{"": {"0": fp}},
+		},
+		{
+			name: "upper case fingerprint with colons",
+			pins: map[string]string{"0": "01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF"},
+			want: map[string]map[string]string{"": {"0": fp}},
+		},
+		{
+			name: "empty value",
+			want: nil,
+		},
+		{
+			name:    "invalid fingerprint",
+			pins:    map[string]string{"0": "dummy"},
+			wantErr: "invalid key pin of keyID 0: dummy",
+		},
+		{
+			name:    "invalid fingerprint length",
+			pins:    map[string]string{"0": "0123"},
+			wantErr: "invalid key pin of keyID 0: 0123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{}
+			err := WithKeyPins("", tt.pins)(j)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("WithKeyPins() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("WithKeyPins() error = %v", err)
+			}
+			if !reflect.DeepEqual(j.keyPins, tt.want) {
+				t.Errorf("WithKeyPins() = %v, want %v", j.keyPins, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRefreshOnMiss(t *testing.T) {
+	for _, b := range []bool{true, false} {
+		t.Run(fmt.Sprint(b), func(t *testing.T) {
+			j := &jwkd{refreshOnMissEnabled: !b}
+			if err := WithRefreshOnMiss(b)(j); err != nil {
+				t.Errorf("WithRefreshOnMiss() error = %v", err)
+			}
+			if j.refreshOnMissEnabled != b {
+				t.Errorf("WithRefreshOnMiss() = %v, want %v", j.refreshOnMissEnabled, b)
+			}
+		})
+	}
+}
+
+func TestWithMissRefreshInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Duration
+		wantErr  string
+	}{
+		{
+			name:     "set success",
+			interval: "30s",
+			want:     30 * time.Second,
+		},
+		{
+			name:     "empty value",
+			interval: "",
+			want:     time.Second,
+		},
+		{
+			name:     "invalid value",
+			interval: "dummy",
+			want:     time.Second,
+			wantErr:  `invalid miss refresh interval: time: invalid duration "dummy"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{missRefreshInterval: time.Second}
+			err := WithMissRefreshInterval(tt.interval)(j)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("WithMissRefreshInterval() error = %v, want %v", err, tt.wantErr)
+			}
+			if j.missRefreshInterval != tt.want {
+				t.Errorf("WithMissRefreshInterval() = %v, want %v", j.missRefreshInterval, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithUnknownKeyIDCacheTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     string
+		want    time.Duration
+		wantErr string
+	}{
+		{
+			name: "set success",
+			ttl:  "5m",
+			want: 5 * time.Minute,
+		},
+		{
+			name: "empty value",
+			ttl:  "",
+			want: time.Second,
+		},
+		{
+			name:    "invalid value",
+			ttl:     "dummy",
+			want:    time.Second,
+			wantErr: `invalid unknown key ID cache TTL: time: invalid duration "dummy"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{unknownKeyIDTTL: time.Second}
+			err := WithUnknownKeyIDCacheTTL(tt.ttl)(j)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("WithUnknownKeyIDCacheTTL() error = %v, want %v", err, tt.wantErr)
+			}
+			if j.unknownKeyIDTTL != tt.want {
+				t.Errorf("WithUnknownKeyIDCacheTTL() = %v, want %v", j.unknownKeyIDTTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithJkuPatterns(t *testing.T) {
+	j := &jwkd{}
+	if err := WithJkuPatterns()(j); err != nil || j.jkuPatterns != nil {
+		t.Errorf("WithJkuPatterns() = %v, error = %v, want nil", j.jkuPatterns, err)
+	}
+	if err := WithJkuPatterns("https://*.athenz.io/oauth2/keys", "https://jwks.athenz.io")(j); err != nil {
+		t.Fatalf("WithJkuPatterns() error = %v", err)
+	}
+	if len(j.jkuPatterns) != 2 {
+		t.Errorf("WithJkuPatterns() = %v, want 2 patterns", j.jkuPatterns)
+	}
+	if err := WithJkuPatterns("http://*.athenz.io")(&jwkd{}); err == nil {
+		t.Errorf("WithJkuPatterns() error = nil for http")
+	}
+}
+
+func TestWithJkuCacheTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     string
+		want    time.Duration
+		wantErr string
+	}{
+		{
+			name: "set success",
+			ttl:  "30m",
+			want: 30 * time.Minute,
+		},
+		{
+			name: "empty value",
+			ttl:  "",
+			want: time.Hour,
+		},
+		{
+			name:    "invalid value",
+			ttl:     "dummy",
+			want:    time.Hour,
+			wantErr: `invalid jku cache TTL: time: invalid duration "dummy"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{jkuCacheTTL: time.Hour}
+			err := WithJkuCacheTTL(tt.ttl)(j)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("WithJkuCacheTTL() error = %v, want %v", err, tt.wantErr)
+			}
+			if j.jkuCacheTTL != tt.want {
+				t.Errorf("WithJkuCacheTTL() = %v, want %v", j.jkuCacheTTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithJkuCacheSize(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		want int
+	}{
+		{n: 10, want: 10},
+		{n: 0, want: 100},
+		{n: -1, want: 100},
+	} {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			j := &jwkd{jkuCacheSize: 100}
+			if err := WithJkuCacheSize(tt.n)(j); err != nil {
+				t.Errorf("WithJkuCacheSize() error = %v", err)
+			}
+			if j.jkuCacheSize != tt.want {
+				t.Errorf("WithJkuCacheSize() = %v, want %v", j.jkuCacheSize, tt.want)
+			}
+		})
+	}
+}
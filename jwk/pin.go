@@ -0,0 +1,87 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
+	"github.com/kpango/glg"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/pkg/errors"
+)
+
+// allowedKeyIDsOf returns the accepted key IDs of the JWK set URL, the empty URL represents the Athenz JWK set URL
+func (j *jwkd) allowedKeyIDsOf(url string) (map[string]struct{}, bool) {
+	if ids, ok := j.allowedKeyIDs[url]; ok {
+		return ids, true
+	}
+	if url == j.athenzJwksURL {
+		ids, ok := j.allowedKeyIDs[""]
+		return ids, ok
+	}
+	return nil, false
+}
+
+// keyPinsOf returns the pinned fingerprints of the JWK set URL, the empty URL represents the Athenz JWK set URL
+func (j *jwkd) keyPinsOf(url string) map[string]string {
+	if pins, ok := j.keyPins[url]; ok {
+		return pins
+	}
+	if url == j.athenzJwksURL {
+		return j.keyPins[""]
+	}
+	return nil
+}
+
+// filterKeyIDs removes the keys not in the allow-list of the JWK set URL from the fetched JWK set
+func (j *jwkd) filterKeyIDs(url string, set jwk.Set) {
+	ids, ok := j.allowedKeyIDsOf(url)
+	if !ok {
+		return
+	}
+	var removed []jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if !ok {
+			continue
+		}
+		kid, _ := key.KeyID()
+		if _, ok := ids[kid]; !ok {
+			glg.Warnf("Key ID is not allowed, url: %s, keyID: %s", url, kid)
+			removed = append(removed, key)
+		}
+	}
+	for _, key := range removed {
+		if err := set.RemoveKey(key); err != nil {
+			glg.Warnf("Remove key error, url: %s, error: %v", url, err)
+		}
+	}
+}
+
+// verifyKeyPins returns ErrKeyPinMismatch if the fingerprint of any pinned key ID differs from the pin
+func (j *jwkd) verifyKeyPins(url string, set jwk.Set) error {
+	pins := j.keyPinsOf(url)
+	if len(pins) == 0 {
+		return nil
+	}
+	infos := keyInfos(set)
+	fps := make(map[string]string, len(infos))
+	for id, ki := range infos {
+		fps[id] = ki.fingerprint
+	}
+	if msg, ok := keypin.Mismatch(pins, fps); ok {
+		return errors.Wrapf(ErrKeyPinMismatch, "url: %s, %s", url, msg)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_jwkd_filterKeyIDs(t *testing.T) {
+	k0, k1 := newTestKey(t, "0"), newTestKey(t, "1")
+	tests := []struct {
+		name string
+		j    *jwkd
+		url  string
+		want []string
+	}{
+		{
+			name: "no allow-list",
+			j:    &jwkd{},
+			url:  "https://athenz.io/jwks",
+			want: []string{"0", "1"},
+		},
+		{
+			name: "allow-list of the URL",
+			j: &jwkd{
+				allowedKeyIDs: map[string]map[string]struct{}{"https://athenz.io/jwks": {"1": {}}},
+			},
+			url:  "https://athenz.io/jwks",
+			want: []string{"1"},
+		},
+		{
+			name: "allow-list of the other URL",
+			j: &jwkd{
+				allowedKeyIDs: map[string]map[string]struct{}{"https://other.io/jwks": {"1": {}}},
+			},
+			url:  "https://athenz.io/jwks",
+			want: []string{"0", "1"},
+		},
+		{
+			name: "empty URL represents the Athenz JWK set URL",
+			j: &jwkd{
+				athenzJwksURL: "https://athenz.io/jwks",
+				allowedKeyIDs: map[string]map[string]struct{}{"": {"0": {}}},
+			},
+			url:  "https://athenz.io/jwks",
+			want: []string{"0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := newTestSet(t, k0, k1)
+			tt.j.filterKeyIDs(tt.url, set)
+			got := make([]string, 0, set.Len())
+			for id := range keyInfos(set) {
+				got = append(got, id)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("filterKeyIDs() = %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if _, ok := set.LookupKeyID(id); !ok {
+					t.Errorf("filterKeyIDs() removed the key %s", id)
+				}
+			}
+		})
+	}
+}
+
+func Test_jwkd_verifyKeyPins(t *testing.T) {
+	k0, k1 := newTestKey(t, "0"), newTestKey(t, "1")
+	url := "https://athenz.io/jwks"
+	tests := []struct {
+		name    string
+		pins    map[string]map[string]string
+		wantErr string
+	}{
+		{
+			name: "no pins",
+		},
+		{
+			name: "pins matched",
+			pins: map[string]map[string]string{url: {"0": k0.fingerprint, "1": k1.fingerprint}},
+		},
+		{
+			name: "pinned key ID not in the JWK set",
+			pins: map[string]map[string]string{url: {"2": k0.fingerprint}},
+		},
+		{
+			name:    "pin mismatched",
+			pins:    map[string]map[string]string{url: {"0": k0.fingerprint, "1": k0.fingerprint}},
+			wantErr: "url: " + url + ", keyID: 1, fingerprint: " + k1.fingerprint,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &jwkd{keyPins: tt.pins}
+			err := j.verifyKeyPins(url, newTestSet(t, k0, k1))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyKeyPins() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrKeyPinMismatch) || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("verifyKeyPins() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_jwkd_Update_keyPins(t *testing.T) {
+	ctx := context.Background()
+	k0, k1, k2 := newTestKey(t, "0"), newTestKey(t, "1"), newTestKey(t, "2")
+	var (
+		mu   sync.Mutex
+		body []byte
+	)
+	setBody := func(keys ...*testKey) {
+		b, err := json.Marshal(newTestSet(t, keys...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		body = b
+		mu.Unlock()
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	j := &jwkd{
+		athenzJwksURL: srv.URL,
+		client:        srv.Client(),
+		keys:          &sync.Map{},
+		allowedKeyIDs: map[string]map[string]struct{}{"": {"0": {}, "1": {}}},
+		keyPins:       map[string]map[string]string{"": {"0": k0.fingerprint}},
+	}
+	setBody(k0, k2)
+	if err := j.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if j.getKey("0", "") == nil {
+		t.Errorf("getKey() key 0 is not loaded")
+	}
+	if j.getKey("2", "") != nil {
+		t.Errorf("getKey() not allowed key 2 is loaded")
+	}
+
+	// the pinned key ID is replaced by the other key
+	setBody(newTestKey(t, "0"), k1)
+	if err := j.Update(ctx); !errors.Is(err, ErrKeyPinMismatch) {
+		t.Fatalf("Update() error = %v, want %v", err, ErrKeyPinMismatch)
+	}
+	if j.getKey("0", "") == nil {
+		t.Errorf("getKey() the last valid JWK set is not kept")
+	}
+	if j.getKey("1", "") != nil {
+		t.Errorf("getKey() the rejected JWK set is loaded")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/pkg/errors"
+)
+
+// refreshOnMissTimeout is the timeout of the on-demand refresh, which blocks the key lookup
+const refreshOnMissTimeout = 5 * time.Second
+
+// refreshURL fetches the JWK set of the URL and swaps it if modified.
+// The JWK set violating the key pins is rejected, and the last valid JWK set is kept.
+func (j *jwkd) refreshURL(ctx context.Context, target string, now time.Time) error {
+	glg.Debugf("Fetching JWK Set from %s", target)
+	keys, err := j.fetch(ctx, target, now)
+	if err != nil {
+		glg.Errorf("Fetch JWK Set error: %v", err)
+		return err
+	}
+	if keys == nil {
+		glg.Debugf("JWK Set of %s not modified", target)
+		return nil
+	}
+	j.filterKeyIDs(target, keys)
+	if err := j.verifyKeyPins(target, keys); err != nil {
+		glg.Errorf("Verify JWK Set key pins error: %v", err)
+		// fetch the whole JWK set again instead of the not modified response
+		j.states.Delete(target)
+		return err
+	}
+	prev, _ := j.keys.Swap(target, keys)
+	old, _ := prev.(jwk.Set)
+	j.publish(diffKeySet(target, old, keys, now))
+	glg.Debugf("Fetch JWK Set from %s success", target)
+	return nil
+}
+
+// refreshOnMiss refreshes the JWK set of the URL on the lookup of an unknown key ID, and reports whether it is refreshed.
+// The concurrent misses of the same URL share one refresh, the refresh of the URL is rate limited by the miss refresh interval,
+// and the key ID still unknown after the refresh is not refreshed again until the unknown key ID cache TTL passes.
+func (j *jwkd) refreshOnMiss(target, keyID string) bool {
+	if !j.refreshOnMissEnabled || (!j.isTarget(target) && !j.isJkuCached(target)) {
+		return false
+	}
+	now := fastime.Now()
+	if exp, ok := j.unknownKeyIDs.Load(unknownKeyID(target, keyID)); ok && now.Before(exp.(time.Time)) {
+		glg.Debugf("Unknown key ID is not refreshed, url: %s, keyID: %s", target, keyID)
+		return false
+	}
+
+	refreshed, _, _ := j.missGroup.Do(target, func() (interface{}, error) {
+		if last, ok := j.lastMissRefresh.Load(target); ok && now.Sub(last.(time.Time)) < j.missRefreshInterval {
+			glg.Debugf("JWK Set of %s was refreshed on miss recently, keyID: %s", target, keyID)
+			return false, nil
+		}
+		j.lastMissRefresh.Store(target, now)
+		j.purgeUnknownKeyIDs(now)
+
+		glg.Infof("Refreshing JWK Set of %s on miss, keyID: %s", target, keyID)
+		ctx, cancel := context.WithTimeout(context.Background(), refreshOnMissTimeout)
+		defer cancel()
+		if err := j.refreshURL(ctx, target, now); err != nil {
+			glg.Warnf("Refresh JWK Set on miss error: %v", errors.Wrap(err, target))
+			return false, nil
+		}
+		return true, nil
+	})
+	return refreshed.(bool)
+}
+
+// cacheUnknownKeyID caches the key ID not found in the refreshed JWK set, to ignore it until the TTL passes
+func (j *jwkd) cacheUnknownKeyID(target, keyID string) {
+	j.unknownKeyIDs.Store(unknownKeyID(target, keyID), fastime.Now().Add(j.unknownKeyIDTTL))
+}
+
+// purgeUnknownKeyIDs removes the expired unknown key IDs
+func (j *jwkd) purgeUnknownKeyIDs(now time.Time) {
+	j.unknownKeyIDs.Range(func(k, exp interface{}) bool {
+		if !now.Before(exp.(time.Time)) {
+			j.unknownKeyIDs.Delete(k)
+		}
+		return true
+	})
+}
+
+// isTarget reports whether the URL is one of the JWK set URLs updated by jwkd
+func (j *jwkd) isTarget(target string) bool {
+	return target == j.athenzJwksURL || isContain(j.urls, target)
+}
+
+func unknownKeyID(target, keyID string) string {
+	return target + "\x00" + keyID
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testJWKSServer struct {
+	*httptest.Server
+	body     atomic.Value
+	requests atomic.Int32
+}
+
+func newTestJWKSServer(t *testing.T, delay time.Duration, keys ...*testKey) *testJWKSServer {
+	t.Helper()
+	s := &testJWKSServer{}
+	s.setKeys(t, keys...)
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		time.Sleep(delay)
+		_, _ = w.Write(s.body.Load().([]byte))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) setKeys(t *testing.T, keys ...*testKey) {
+	t.Helper()
+	b, err := json.Marshal(newTestSet(t, keys...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.body.Store(b)
+}
+
+func newTestRefreshJwkd(t *testing.T, srv *testJWKSServer, interval time.Duration) *jwkd {
+	t.Helper()
+	j := &jwkd{
+		athenzJwksURL:        srv.URL,
+		refreshPeriod:        time.Hour,
+		client:               srv.Client(),
+		keys:                 &sync.Map{},
+		refreshOnMissEnabled: true,
+		missRefreshInterval:  interval,
+		unknownKeyIDTTL:      time.Minute,
+	}
+	if err := j.Update(context.Background()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	return j
+}
+
+func Test_jwkd_getKey_refreshOnMiss(t *testing.T) {
+	k0, k1 := newTestKey(t, "0"), newTestKey(t, "1")
+	srv := newTestJWKSServer(t, 0, k0)
+	j := newTestRefreshJwkd(t, srv, time.Minute)
+
+	// the signing key is rotated after the last refresh
+	srv.setKeys(t, k0, k1)
+	if j.getKey("1", "") == nil {
+		t.Fatalf("getKey() the rotated key is not found")
+	}
+	if got := srv.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// the refresh on miss is rate limited
+	srv.setKeys(t, k0, k1, newTestKey(t, "2"))
+	if j.getKey("2", "") != nil {
+		t.Errorf("getKey() the refresh on miss is not rate limited")
+	}
+	if got := srv.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// the known key does not trigger the refresh
+	if j.getKey("0", "") == nil {
+		t.Errorf("getKey() the known key is not found")
+	}
+	if got := srv.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func Test_jwkd_getKey_unknownKeyIDCache(t *testing.T) {
+	srv := newTestJWKSServer(t, 0, newTestKey(t, "0"))
+	j := newTestRefreshJwkd(t, srv, 0)
+
+	if j.getKey("bogus", "") != nil {
+		t.Fatalf("getKey() bogus key ID is found")
+	}
+	if got := srv.requests.Load(); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+	// the unknown key ID is cached, and does not trigger the refresh again
+	if j.getKey("bogus", "") != nil {
+		t.Fatalf("getKey() bogus key ID is found")
+	}
+	if got := srv.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+	// the other key ID still triggers the refresh
+	if j.getKey("bogus2", "") != nil {
+		t.Fatalf("getKey() bogus key ID is found")
+	}
+	if got := srv.requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+
+	// the expired unknown key ID is purged on the refresh
+	j.unknownKeyIDs.Store(unknownKeyID(srv.URL, "expired"), time.Now().Add(-time.Second))
+	j.getKey("bogus3", "")
+	if _, ok := j.unknownKeyIDs.Load(unknownKeyID(srv.URL, "expired")); ok {
+		t.Errorf("the expired unknown key ID is not purged")
+	}
+}
+
+func Test_jwkd_getKey_refreshOnMissSingleFlight(t *testing.T) {
+	k0, k1 := newTestKey(t, "0"), newTestKey(t, "1")
+	srv := newTestJWKSServer(t, 100*time.Millisecond, k0)
+	j := newTestRefreshJwkd(t, srv, time.Minute)
+
+	srv.setKeys(t, k0, k1)
+	var (
+		wg    sync.WaitGroup
+		found atomic.Int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if j.getKey("1", "") != nil {
+				found.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := srv.requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+	if found.Load() == 0 {
+		t.Errorf("getKey() the rotated key is not found")
+	}
+}
+
+func Test_jwkd_getKey_noRefreshOnMiss(t *testing.T) {
+	srv := newTestJWKSServer(t, 0, newTestKey(t, "0"))
+	tests := []struct {
+		name   string
+		modify func(*jwkd)
+		url    string
+	}{
+		{
+			name: "disabled",
+			modify: func(j *jwkd) {
+				j.refreshOnMissEnabled = false
+			},
+		},
+		{
+			name: "JWK set URL not configured",
+			url:  "https://attacker.example.com/jwks",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTestRefreshJwkd(t, srv, 0)
+			if tt.modify != nil {
+				tt.modify(j)
+			}
+			before := srv.requests.Load()
+			if j.getKey("1", tt.url) != nil {
+				t.Errorf("getKey() unknown key is found")
+			}
+			if got := srv.requests.Load(); got != before {
+				t.Errorf("requests = %d, want %d", got, before)
+			}
+		})
+	}
+}
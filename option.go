@@ -18,7 +18,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/access"
 	urlutil "github.com/AthenZ/athenz-authorizer/v5/internal/url"
+	"github.com/AthenZ/athenz-authorizer/v5/policy"
+	"github.com/AthenZ/athenz-authorizer/v5/pubkey"
 )
 
 const (
@@ -133,6 +136,116 @@ func WithPubkeyRetryDelay(i string) Option {
 	}
 }
 
+// WithPubkeyGracePeriod returns a PubkeyGracePeriod functional option
+func WithPubkeyGracePeriod(d string) Option {
+	return func(authz *authority) error {
+		authz.pubkeyGracePeriod = d
+		return nil
+	}
+}
+
+// WithPubkeyDir returns a PubkeyDir functional option.
+// The public keys of the env are read from the <dir>/<key ID>.pem files instead of fetching from Athenz.
+func WithPubkeyDir(env pubkey.AthenzEnv, dir string) Option {
+	return func(authz *authority) error {
+		if authz.pubkeyDirs == nil {
+			authz.pubkeyDirs = make(map[pubkey.AthenzEnv]string)
+		}
+		authz.pubkeyDirs[env] = dir
+		return nil
+	}
+}
+
+// WithPubkeyFiles returns a PubkeyFiles functional option.
+// The files map has the format of map[<key ID>]<PEM file path>.
+func WithPubkeyFiles(env pubkey.AthenzEnv, files map[string]string) Option {
+	return func(authz *authority) error {
+		if authz.pubkeyFiles == nil {
+			authz.pubkeyFiles = make(map[pubkey.AthenzEnv]map[string]string)
+		}
+		authz.pubkeyFiles[env] = files
+		return nil
+	}
+}
+
+// WithPubkeyStaticKeys returns a PubkeyStaticKeys functional option.
+// The keys map has the format of map[<key ID>]<PEM encoded public key>.
+func WithPubkeyStaticKeys(env pubkey.AthenzEnv, keys map[string][]byte) Option {
+	return func(authz *authority) error {
+		if authz.pubkeyStaticKeys == nil {
+			authz.pubkeyStaticKeys = make(map[pubkey.AthenzEnv]map[string][]byte)
+		}
+		authz.pubkeyStaticKeys[env] = keys
+		return nil
+	}
+}
+
+// WithPubkeyAllowedKeyIDs returns a PubkeyAllowedKeyIDs functional option.
+// Only the public keys of the env with the key IDs are accepted.
+func WithPubkeyAllowedKeyIDs(env pubkey.AthenzEnv, ids ...string) Option {
+	return func(authz *authority) error {
+		if authz.pubkeyAllowedKeyIDs == nil {
+			authz.pubkeyAllowedKeyIDs = make(map[pubkey.AthenzEnv][]string)
+		}
+		authz.pubkeyAllowedKeyIDs[env] = ids
+		return nil
+	}
+}
+
+// WithPubkeyKeyPins returns a PubkeyKeyPins functional option.
+// The pins map has the format of map[<key ID>]<hex encoded SHA-256 of the SPKI>, the public key set of the env violating the pins is rejected.
+func WithPubkeyKeyPins(env pubkey.AthenzEnv, pins map[string]string) Option {
+	return func(authz *authority) error {
+		if authz.pubkeyKeyPins == nil {
+			authz.pubkeyKeyPins = make(map[pubkey.AthenzEnv]map[string]string)
+		}
+		authz.pubkeyKeyPins[env] = pins
+		return nil
+	}
+}
+
+// WithEnablePubkeyMergeFetchedKeys returns an EnablePubkeyMergeFetchedKeys functional option.
+// The public keys are still fetched from Athenz for the env with the local public keys, and merged with them.
+func WithEnablePubkeyMergeFetchedKeys() Option {
+	return func(authz *authority) error {
+		authz.pubkeyMergeFetchedKeys = true
+		return nil
+	}
+}
+
+// WithDisablePubkeyMergeFetchedKeys returns a DisablePubkeyMergeFetchedKeys functional option
+func WithDisablePubkeyMergeFetchedKeys() Option {
+	return func(authz *authority) error {
+		authz.pubkeyMergeFetchedKeys = false
+		return nil
+	}
+}
+
+// WithPubkeyFileWatchPeriod returns a PubkeyFileWatchPeriod functional option
+func WithPubkeyFileWatchPeriod(t string) Option {
+	return func(authz *authority) error {
+		authz.pubkeyFileWatchPeriod = t
+		return nil
+	}
+}
+
+// WithEnablePubkeyZTSFromJwks returns an EnablePubkeyZTSFromJwks functional option.
+// The ZTS public keys to verify the role tokens are converted from the JWK set of ZTS held in jwkd, instead of fetching by pubkeyd.
+func WithEnablePubkeyZTSFromJwks() Option {
+	return func(authz *authority) error {
+		authz.pubkeyZTSFromJwks = true
+		return nil
+	}
+}
+
+// WithDisablePubkeyZTSFromJwks returns a DisablePubkeyZTSFromJwks functional option
+func WithDisablePubkeyZTSFromJwks() Option {
+	return func(authz *authority) error {
+		authz.pubkeyZTSFromJwks = false
+		return nil
+	}
+}
+
 // WithPubkeySysAuthDomain returns a PubkeySysAuthDomain functional option
 func WithPubkeySysAuthDomain(domain string) Option {
 	return func(authz *authority) error {
@@ -217,6 +330,194 @@ func WithPolicyRetryAttempts(c int) Option {
 	}
 }
 
+// WithPolicyDir returns a PolicyDir functional option
+func WithPolicyDir(dir string) Option {
+	return func(authz *authority) error {
+		authz.policyDir = dir
+		return nil
+	}
+}
+
+// WithPolicyFiles returns a PolicyFiles functional option
+func WithPolicyFiles(files map[string]string) Option {
+	return func(authz *authority) error {
+		authz.policyFiles = files
+		return nil
+	}
+}
+
+// WithPolicyFileWatchPeriod returns a PolicyFileWatchPeriod functional option
+func WithPolicyFileWatchPeriod(t string) Option {
+	return func(authz *authority) error {
+		authz.policyFileWatchPeriod = t
+		return nil
+	}
+}
+
+// WithPolicyFetcherFactory returns a PolicyFetcherFactory functional option
+func WithPolicyFetcherFactory(f policy.FetcherFactory) Option {
+	return func(authz *authority) error {
+		authz.policyFetcherFactory = f
+		return nil
+	}
+}
+
+// WithPolicyLocalAssertionsFile returns a PolicyLocalAssertionsFile functional option
+func WithPolicyLocalAssertionsFile(path string) Option {
+	return func(authz *authority) error {
+		authz.policyLocalAssertionsFile = path
+		return nil
+	}
+}
+
+// WithPolicyExportFile returns a PolicyExportFile functional option.
+// The policy cache is seeded by the policy export in JSON or YAML on creation.
+func WithPolicyExportFile(path string) Option {
+	return func(authz *authority) error {
+		authz.policyExportFile = path
+		return nil
+	}
+}
+
+// WithEnableCrossDomainResource returns an EnableCrossDomainResource functional option.
+// The resource may be qualified by the domain as <domain>:<resource> to check the access to the resource of the other domain.
+func WithEnableCrossDomainResource() Option {
+	return func(authz *authority) error {
+		authz.crossDomainResource = true
+		return nil
+	}
+}
+
+// WithDisableCrossDomainResource returns a DisableCrossDomainResource functional option
+func WithDisableCrossDomainResource() Option {
+	return func(authz *authority) error {
+		authz.crossDomainResource = false
+		return nil
+	}
+}
+
+// WithPolicyCombiningAlgorithm returns a PolicyCombiningAlgorithm functional option.
+// It combines the assertions of the roles in the token into the decision, see policy.CombiningAlgorithm.
+func WithPolicyCombiningAlgorithm(alg policy.CombiningAlgorithm) Option {
+	return func(authz *authority) error {
+		authz.policyCombiningAlg = alg
+		return nil
+	}
+}
+
+// WithPolicyDomainCombiningAlgorithms returns a PolicyDomainCombiningAlgorithms functional option
+func WithPolicyDomainCombiningAlgorithms(algs map[string]policy.CombiningAlgorithm) Option {
+	return func(authz *authority) error {
+		authz.policyDomainCombiningAlgs = algs
+		return nil
+	}
+}
+
+// WithEnablePolicyCaseSensitive returns an EnablePolicyCaseSensitive functional option.
+// The action and resource of all the signed assertions are matched in exact case.
+func WithEnablePolicyCaseSensitive() Option {
+	return func(authz *authority) error {
+		authz.policyCaseSensitive = true
+		return nil
+	}
+}
+
+// WithDisablePolicyCaseSensitive returns a DisablePolicyCaseSensitive functional option
+func WithDisablePolicyCaseSensitive() Option {
+	return func(authz *authority) error {
+		authz.policyCaseSensitive = false
+		return nil
+	}
+}
+
+// WithEnablePolicyDetectCaseSensitive returns an EnablePolicyDetectCaseSensitive functional option.
+// The signed assertions containing upper case characters in the action or resource are matched in exact case.
+func WithEnablePolicyDetectCaseSensitive() Option {
+	return func(authz *authority) error {
+		authz.policyDetectCaseSensitive = true
+		return nil
+	}
+}
+
+// WithDisablePolicyDetectCaseSensitive returns a DisablePolicyDetectCaseSensitive functional option
+func WithDisablePolicyDetectCaseSensitive() Option {
+	return func(authz *authority) error {
+		authz.policyDetectCaseSensitive = false
+		return nil
+	}
+}
+
+// WithEnablePolicyResourceHierarchy returns an EnablePolicyResourceHierarchy functional option.
+// The resources of the signed assertions are matched by the path segments, i.e. "*" matches within a segment and "**" across the segments.
+func WithEnablePolicyResourceHierarchy() Option {
+	return func(authz *authority) error {
+		authz.policyResourceHierarchy = true
+		return nil
+	}
+}
+
+// WithDisablePolicyResourceHierarchy returns a DisablePolicyResourceHierarchy functional option
+func WithDisablePolicyResourceHierarchy() Option {
+	return func(authz *authority) error {
+		authz.policyResourceHierarchy = false
+		return nil
+	}
+}
+
+// WithPolicyStaleGracePeriod returns a PolicyStaleGracePeriod functional option.
+// The expired policy is still served for the grace period.
+func WithPolicyStaleGracePeriod(t string) Option {
+	return func(authz *authority) error {
+		authz.policyStaleGracePeriod = t
+		return nil
+	}
+}
+
+// WithEnablePolicyStaleFailOpen returns an EnablePolicyStaleFailOpen functional option.
+// The policy expired beyond the grace period is still evaluated, and the requests are allowed only if no policy of the domain is available.
+func WithEnablePolicyStaleFailOpen() Option {
+	return func(authz *authority) error {
+		authz.policyStaleFailOpen = true
+		return nil
+	}
+}
+
+// WithDisablePolicyStaleFailOpen returns a DisablePolicyStaleFailOpen functional option.
+// The requests are denied with policy.ErrDomainExpired when the policy is expired beyond the grace period.
+func WithDisablePolicyStaleFailOpen() Option {
+	return func(authz *authority) error {
+		authz.policyStaleFailOpen = false
+		return nil
+	}
+}
+
+// WithPolicyFetchConcurrency returns a PolicyFetchConcurrency functional option.
+// At most the given number of the domains are fetched at once on the policy update, 0 for unlimited.
+func WithPolicyFetchConcurrency(c int) Option {
+	return func(authz *authority) error {
+		authz.policyFetchConcurrency = c
+		return nil
+	}
+}
+
+// WithPolicyRefreshJitter returns a PolicyRefreshJitter functional option.
+// A random delay up to the jitter is added to each policy refresh period.
+func WithPolicyRefreshJitter(t string) Option {
+	return func(authz *authority) error {
+		authz.policyRefreshJitter = t
+		return nil
+	}
+}
+
+// WithPolicyRefreshSpread returns a PolicyRefreshSpread functional option.
+// On the periodic refresh, the domains are fetched at random offsets within the spread.
+func WithPolicyRefreshSpread(t string) Option {
+	return func(authz *authority) error {
+		authz.policyRefreshSpread = t
+		return nil
+	}
+}
+
 /*
 	jwkd parameters
 */
@@ -261,6 +562,89 @@ func WithJwkURLs(urls []string) Option {
 	}
 }
 
+// WithEnableJwkRefreshOnMiss returns an EnableJwkRefreshOnMiss functional option.
+// The access token with an unknown key ID refreshes the JWK set immediately, for the signing key rotation. It is disabled by default.
+func WithEnableJwkRefreshOnMiss() Option {
+	return func(authz *authority) error {
+		authz.jwkRefreshOnMiss = true
+		return nil
+	}
+}
+
+// WithDisableJwkRefreshOnMiss returns a DisableJwkRefreshOnMiss functional option
+func WithDisableJwkRefreshOnMiss() Option {
+	return func(authz *authority) error {
+		authz.jwkRefreshOnMiss = false
+		return nil
+	}
+}
+
+// WithJwkMissRefreshInterval returns a JwkMissRefreshInterval functional option
+func WithJwkMissRefreshInterval(i string) Option {
+	return func(authz *authority) error {
+		authz.jwkMissRefreshInterval = i
+		return nil
+	}
+}
+
+// WithJwkUnknownKeyIDCacheTTL returns a JwkUnknownKeyIDCacheTTL functional option
+func WithJwkUnknownKeyIDCacheTTL(t string) Option {
+	return func(authz *authority) error {
+		authz.jwkUnknownKeyIDCacheTTL = t
+		return nil
+	}
+}
+
+// WithJwkJkuPatterns returns a JwkJkuPatterns functional option.
+// The JWK set of the jku URL matching any of the https://<host glob>/<path prefix> patterns is fetched on first use.
+func WithJwkJkuPatterns(patterns ...string) Option {
+	return func(authz *authority) error {
+		authz.jwkJkuPatterns = patterns
+		return nil
+	}
+}
+
+// WithJwkJkuCacheTTL returns a JwkJkuCacheTTL functional option
+func WithJwkJkuCacheTTL(t string) Option {
+	return func(authz *authority) error {
+		authz.jwkJkuCacheTTL = t
+		return nil
+	}
+}
+
+// WithJwkJkuCacheSize returns a JwkJkuCacheSize functional option
+func WithJwkJkuCacheSize(n int) Option {
+	return func(authz *authority) error {
+		authz.jwkJkuCacheSize = n
+		return nil
+	}
+}
+
+// WithJwkAllowedKeyIDs returns a JwkAllowedKeyIDs functional option.
+// Only the keys with the key IDs are accepted from the JWK set URL, the empty URL represents the Athenz JWK set URL.
+func WithJwkAllowedKeyIDs(url string, ids ...string) Option {
+	return func(authz *authority) error {
+		if authz.jwkAllowedKeyIDs == nil {
+			authz.jwkAllowedKeyIDs = make(map[string][]string)
+		}
+		authz.jwkAllowedKeyIDs[url] = ids
+		return nil
+	}
+}
+
+// WithJwkKeyPins returns a JwkKeyPins functional option.
+// The pins map has the format of map[<key ID>]<hex encoded SHA-256 of the SPKI>, the JWK set violating the pins is rejected.
+// The empty URL represents the Athenz JWK set URL.
+func WithJwkKeyPins(url string, pins map[string]string) Option {
+	return func(authz *authority) error {
+		if authz.jwkKeyPins == nil {
+			authz.jwkKeyPins = make(map[string]map[string]string)
+		}
+		authz.jwkKeyPins[url] = pins
+		return nil
+	}
+}
+
 /*
 	access token parameters
 */
@@ -293,6 +677,15 @@ func WithAccessTokenParam(accessTokenParam AccessTokenParam) Option {
 	}
 }
 
+// WithAccessTokenIssuers returns an AccessTokenIssuers functional option.
+// The access tokens are validated by the config of the iss claim, and the access tokens of the other issuers are rejected.
+func WithAccessTokenIssuers(issuers ...access.IssuerConfig) Option {
+	return func(authz *authority) error {
+		authz.accessTokenIssuers = issuers
+		return nil
+	}
+}
+
 /*
 	role token parameters
 */
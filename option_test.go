@@ -21,7 +21,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/access"
 	urlutil "github.com/AthenZ/athenz-authorizer/v5/internal/url"
+	"github.com/AthenZ/athenz-authorizer/v5/policy"
+	"github.com/AthenZ/athenz-authorizer/v5/pubkey"
 	"github.com/kpango/gache/v2"
 )
 
@@ -155,6 +158,174 @@ func TestWithPubkeyRetryDelay(t *testing.T) {
 	}
 }
 
+func TestWithPubkeyFileWatchPeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyFileWatchPeriod != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPubkeyFileWatchPeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPubkeyFileWatchPeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPubkeyDir(t *testing.T) {
+	authz := &authority{}
+	if err := WithPubkeyDir(pubkey.EnvZTS, "/etc/athenz/zts")(authz); err != nil {
+		t.Fatalf("WithPubkeyDir() error = %v", err)
+	}
+	if err := WithPubkeyDir(pubkey.EnvZMS, "/etc/athenz/zms")(authz); err != nil {
+		t.Fatalf("WithPubkeyDir() error = %v", err)
+	}
+	want := map[pubkey.AthenzEnv]string{pubkey.EnvZTS: "/etc/athenz/zts", pubkey.EnvZMS: "/etc/athenz/zms"}
+	if !reflect.DeepEqual(authz.pubkeyDirs, want) {
+		t.Errorf("WithPubkeyDir() = %v, want %v", authz.pubkeyDirs, want)
+	}
+}
+
+func TestWithPubkeyFiles(t *testing.T) {
+	authz := &authority{}
+	files := map[string]string{"0": "/etc/athenz/zts.0.pem"}
+	if err := WithPubkeyFiles(pubkey.EnvZTS, files)(authz); err != nil {
+		t.Fatalf("WithPubkeyFiles() error = %v", err)
+	}
+	want := map[pubkey.AthenzEnv]map[string]string{pubkey.EnvZTS: files}
+	if !reflect.DeepEqual(authz.pubkeyFiles, want) {
+		t.Errorf("WithPubkeyFiles() = %v, want %v", authz.pubkeyFiles, want)
+	}
+}
+
+func TestWithPubkeyStaticKeys(t *testing.T) {
+	authz := &authority{}
+	keys := map[string][]byte{"0": []byte("dummy")}
+	if err := WithPubkeyStaticKeys(pubkey.EnvZMS, keys)(authz); err != nil {
+		t.Fatalf("WithPubkeyStaticKeys() error = %v", err)
+	}
+	want := map[pubkey.AthenzEnv]map[string][]byte{pubkey.EnvZMS: keys}
+	if !reflect.DeepEqual(authz.pubkeyStaticKeys, want) {
+		t.Errorf("WithPubkeyStaticKeys() = %v, want %v", authz.pubkeyStaticKeys, want)
+	}
+}
+
+func TestWithEnablePubkeyMergeFetchedKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyMergeFetchedKeys != true {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithEnablePubkeyMergeFetchedKeys()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithEnablePubkeyMergeFetchedKeys() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDisablePubkeyMergeFetchedKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{pubkeyMergeFetchedKeys: true}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyMergeFetchedKeys != false {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDisablePubkeyMergeFetchedKeys()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDisablePubkeyMergeFetchedKeys() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPubkeyGracePeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyGracePeriod != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPubkeyGracePeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPubkeyGracePeriod() error = %v", err)
+			}
+		})
+	}
+}
+
 func TestWithAthenzURL(t *testing.T) {
 	type args struct {
 		url string
@@ -208,22 +379,813 @@ func TestWithAthenzURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := &authority{}
-			err := WithAthenzURL(tt.args.url)(got)
-			if err != tt.wantErr {
-				t.Errorf("WithAthenzURL() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("WithAthenzURL() = %v, want %v", got, tt.want)
+			got := &authority{}
+			err := WithAthenzURL(tt.args.url)(got)
+			if err != tt.wantErr {
+				t.Errorf("WithAthenzURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithAthenzURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAthenzDomains(t *testing.T) {
+	type args struct {
+		t []string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: []string{"dummy1", "dummy2"},
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(authz.athenzDomains, []string{"dummy1", "dummy2"}) {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithAthenzDomains(tt.args.t...)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithAthenzDomains() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPubkeySysAuthDomain(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeySysAuthDomain != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPubkeySysAuthDomain(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPubkeySysAuthDomain() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPubkeyETagExpiry(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyETagExpiry != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPubkeyETagExpiry(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPubkeyETagExpiry() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPubkeyETagPurgePeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyETagPurgePeriod != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPubkeyETagPurgePeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPubkeyETagPurgePeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithEnablePolicyd(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.disablePolicyd != false {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithEnablePolicyd()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithEnablePolicyd() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDisablePolicyd(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.disablePolicyd != true {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDisablePolicyd()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDisablePolicyd() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyExpiryMargin(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyExpiryMargin != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyExpiryMargin(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyExpiryMargin() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyRefreshPeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyRefreshPeriod != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyRefreshPeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyRefreshPeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyPurgePeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyPurgePeriod != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyPurgePeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyPurgePeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyRetryDelay(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyRetryDelay != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyRetryDelay(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyRetryDelay() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyRetryAttempts(t *testing.T) {
+	type args struct {
+		c int
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				c: 2,
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyRetryAttempts != 2 {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyRetryAttempts(tt.args.c)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyRetryAttempts() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyDir(t *testing.T) {
+	type args struct {
+		dir string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				dir: "/var/zpe",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyDir != "/var/zpe" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyDir(tt.args.dir)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyDir() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyFiles(t *testing.T) {
+	type args struct {
+		files map[string]string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				files: map[string]string{"dom": "/tmp/dom.pol"},
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(authz.policyFiles, map[string]string{"dom": "/tmp/dom.pol"}) {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyFiles(tt.args.files)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyFiles() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyFileWatchPeriod(t *testing.T) {
+	type args struct {
+		t string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				t: "10s",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyFileWatchPeriod != "10s" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyFileWatchPeriod(tt.args.t)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyFileWatchPeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyFetcherFactory(t *testing.T) {
+	type args struct {
+		f policy.FetcherFactory
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}
+	tests := []test{
+		func() test {
+			f := policy.FetcherFactory(func(domain string) policy.Fetcher {
+				return nil
+			})
+			return test{
+				name: "set success",
+				args: args{
+					f: f,
+				},
+				checkFunc: func(opt Option) error {
+					authz := &authority{}
+					if err := opt(authz); err != nil {
+						return err
+					}
+					if reflect.ValueOf(authz.policyFetcherFactory) != reflect.ValueOf(f) {
+						return fmt.Errorf("invalid param was set")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyFetcherFactory(tt.args.f)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyFetcherFactory() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyLocalAssertionsFile(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				path: "/etc/athenz/local_assertions.json",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyLocalAssertionsFile != "/etc/athenz/local_assertions.json" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyLocalAssertionsFile(tt.args.path)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyLocalAssertionsFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyExportFile(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				path: "/tmp/policies.yaml",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyExportFile != "/tmp/policies.yaml" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyExportFile(tt.args.path)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyExportFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithEnableCrossDomainResource(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.crossDomainResource != true {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithEnableCrossDomainResource()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithEnableCrossDomainResource() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDisableCrossDomainResource(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{crossDomainResource: true}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.crossDomainResource != false {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDisableCrossDomainResource()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDisableCrossDomainResource() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithCacheExp(t *testing.T) {
+	type args struct {
+		d time.Duration
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				d: time.Duration(time.Hour * 2),
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{
+					cache: gache.New[Principal](),
+				}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.cacheExp != time.Duration(time.Hour*2) {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithCacheExp(tt.args.d)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithCacheExp() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithRoleCertURIPrefix(t *testing.T) {
+	type args struct {
+		p string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				p: "dummy",
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.roleCertURIPrefix != "dummy" {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithRoleCertURIPrefix(tt.args.p)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithRoleCertURIPrefix() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	type args struct {
+		c *http.Client
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				c: http.DefaultClient,
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(authz.client, http.DefaultClient) {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+		{
+			name: "set nil",
+			args: args{
+				c: nil,
+			},
+			checkFunc: func(opt Option) error {
+				authz := &authority{}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				want := &http.Client{
+					Timeout: 30 * time.Second,
+				}
+				if !reflect.DeepEqual(authz.client, want) {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithHTTPClient(tt.args.c)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithHTTPClient() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithAthenzDomains(t *testing.T) {
+func TestWithPolicyCombiningAlgorithm(t *testing.T) {
 	type args struct {
-		t []string
+		alg policy.CombiningAlgorithm
 	}
 	tests := []struct {
 		name      string
@@ -233,14 +1195,14 @@ func TestWithAthenzDomains(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				t: []string{"dummy1", "dummy2"},
+				alg: policy.PermitOverrides,
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if !reflect.DeepEqual(authz.athenzDomains, []string{"dummy1", "dummy2"}) {
+				if authz.policyCombiningAlg != policy.PermitOverrides {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -249,17 +1211,17 @@ func TestWithAthenzDomains(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithAthenzDomains(tt.args.t...)
+			got := WithPolicyCombiningAlgorithm(tt.args.alg)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithAthenzDomains() error = %v", err)
+				t.Errorf("WithPolicyCombiningAlgorithm() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPubkeySysAuthDomain(t *testing.T) {
+func TestWithPolicyDomainCombiningAlgorithms(t *testing.T) {
 	type args struct {
-		t string
+		algs map[string]policy.CombiningAlgorithm
 	}
 	tests := []struct {
 		name      string
@@ -269,14 +1231,14 @@ func TestWithPubkeySysAuthDomain(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				t: "dummy",
+				algs: map[string]policy.CombiningAlgorithm{"dom": policy.FirstApplicable},
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.pubkeySysAuthDomain != "dummy" {
+				if !reflect.DeepEqual(authz.policyDomainCombiningAlgs, map[string]policy.CombiningAlgorithm{"dom": policy.FirstApplicable}) {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -285,34 +1247,27 @@ func TestWithPubkeySysAuthDomain(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPubkeySysAuthDomain(tt.args.t)
+			got := WithPolicyDomainCombiningAlgorithms(tt.args.algs)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPubkeySysAuthDomain() error = %v", err)
+				t.Errorf("WithPolicyDomainCombiningAlgorithms() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPubkeyETagExpiry(t *testing.T) {
-	type args struct {
-		t string
-	}
+func TestWithEnablePolicyCaseSensitive(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				t: "dummy",
-			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.pubkeyETagExpiry != "dummy" {
+				if authz.policyCaseSensitive != true {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -321,34 +1276,27 @@ func TestWithPubkeyETagExpiry(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPubkeyETagExpiry(tt.args.t)
+			got := WithEnablePolicyCaseSensitive()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPubkeyETagExpiry() error = %v", err)
+				t.Errorf("WithEnablePolicyCaseSensitive() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPubkeyETagPurgePeriod(t *testing.T) {
-	type args struct {
-		t string
-	}
+func TestWithDisablePolicyCaseSensitive(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				t: "dummy",
-			},
 			checkFunc: func(opt Option) error {
-				authz := &authority{}
+				authz := &authority{policyCaseSensitive: true}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.pubkeyETagPurgePeriod != "dummy" {
+				if authz.policyCaseSensitive != false {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -357,15 +1305,15 @@ func TestWithPubkeyETagPurgePeriod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPubkeyETagPurgePeriod(tt.args.t)
+			got := WithDisablePolicyCaseSensitive()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPubkeyETagPurgePeriod() error = %v", err)
+				t.Errorf("WithDisablePolicyCaseSensitive() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithEnablePolicyd(t *testing.T) {
+func TestWithEnablePolicyDetectCaseSensitive(t *testing.T) {
 	tests := []struct {
 		name      string
 		checkFunc func(Option) error
@@ -377,7 +1325,7 @@ func TestWithEnablePolicyd(t *testing.T) {
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.disablePolicyd != false {
+				if authz.policyDetectCaseSensitive != true {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -386,15 +1334,15 @@ func TestWithEnablePolicyd(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithEnablePolicyd()
+			got := WithEnablePolicyDetectCaseSensitive()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithEnablePolicyd() error = %v", err)
+				t.Errorf("WithEnablePolicyDetectCaseSensitive() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithDisablePolicyd(t *testing.T) {
+func TestWithDisablePolicyDetectCaseSensitive(t *testing.T) {
 	tests := []struct {
 		name      string
 		checkFunc func(Option) error
@@ -402,11 +1350,11 @@ func TestWithDisablePolicyd(t *testing.T) {
 		{
 			name: "set success",
 			checkFunc: func(opt Option) error {
-				authz := &authority{}
+				authz := &authority{policyDetectCaseSensitive: true}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.disablePolicyd != true {
+				if authz.policyDetectCaseSensitive != false {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -415,15 +1363,15 @@ func TestWithDisablePolicyd(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithDisablePolicyd()
+			got := WithDisablePolicyDetectCaseSensitive()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithDisablePolicyd() error = %v", err)
+				t.Errorf("WithDisablePolicyDetectCaseSensitive() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPolicyExpiryMargin(t *testing.T) {
+func TestWithPolicyStaleGracePeriod(t *testing.T) {
 	type args struct {
 		t string
 	}
@@ -435,14 +1383,14 @@ func TestWithPolicyExpiryMargin(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				t: "dummy",
+				t: "6h",
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.policyExpiryMargin != "dummy" {
+				if authz.policyStaleGracePeriod != "6h" {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -451,34 +1399,27 @@ func TestWithPolicyExpiryMargin(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPolicyExpiryMargin(tt.args.t)
+			got := WithPolicyStaleGracePeriod(tt.args.t)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPolicyExpiryMargin() error = %v", err)
+				t.Errorf("WithPolicyStaleGracePeriod() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPolicyRefreshPeriod(t *testing.T) {
-	type args struct {
-		t string
-	}
+func TestWithEnablePolicyStaleFailOpen(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				t: "dummy",
-			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.policyRefreshPeriod != "dummy" {
+				if authz.policyStaleFailOpen != true {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -487,15 +1428,44 @@ func TestWithPolicyRefreshPeriod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPolicyRefreshPeriod(tt.args.t)
+			got := WithEnablePolicyStaleFailOpen()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPolicyRefreshPeriod() error = %v", err)
+				t.Errorf("WithEnablePolicyStaleFailOpen() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPolicyPurgePeriod(t *testing.T) {
+func TestWithDisablePolicyStaleFailOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{policyStaleFailOpen: true}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.policyStaleFailOpen != false {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDisablePolicyStaleFailOpen()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDisablePolicyStaleFailOpen() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyRefreshJitter(t *testing.T) {
 	type args struct {
 		t string
 	}
@@ -507,14 +1477,14 @@ func TestWithPolicyPurgePeriod(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				t: "dummy",
+				t: "5m",
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.policyPurgePeriod != "dummy" {
+				if authz.policyRefreshJitter != "5m" {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -523,15 +1493,15 @@ func TestWithPolicyPurgePeriod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPolicyPurgePeriod(tt.args.t)
+			got := WithPolicyRefreshJitter(tt.args.t)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPolicyPurgePeriod() error = %v", err)
+				t.Errorf("WithPolicyRefreshJitter() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPolicyRetryDelay(t *testing.T) {
+func TestWithPolicyRefreshSpread(t *testing.T) {
 	type args struct {
 		t string
 	}
@@ -543,14 +1513,14 @@ func TestWithPolicyRetryDelay(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				t: "dummy",
+				t: "10m",
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.policyRetryDelay != "dummy" {
+				if authz.policyRefreshSpread != "10m" {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -559,15 +1529,15 @@ func TestWithPolicyRetryDelay(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPolicyRetryDelay(tt.args.t)
+			got := WithPolicyRefreshSpread(tt.args.t)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPolicyRetryDelay() error = %v", err)
+				t.Errorf("WithPolicyRefreshSpread() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithPolicyRetryAttempts(t *testing.T) {
+func TestWithPolicyFetchConcurrency(t *testing.T) {
 	type args struct {
 		c int
 	}
@@ -579,14 +1549,14 @@ func TestWithPolicyRetryAttempts(t *testing.T) {
 		{
 			name: "set success",
 			args: args{
-				c: 2,
+				c: 10,
 			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.policyRetryAttempts != 2 {
+				if authz.policyFetchConcurrency != 10 {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -595,36 +1565,27 @@ func TestWithPolicyRetryAttempts(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithPolicyRetryAttempts(tt.args.c)
+			got := WithPolicyFetchConcurrency(tt.args.c)
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithPolicyRetryAttempts() error = %v", err)
+				t.Errorf("WithPolicyFetchConcurrency() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithCacheExp(t *testing.T) {
-	type args struct {
-		d time.Duration
-	}
+func TestWithEnablePolicyResourceHierarchy(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				d: time.Duration(time.Hour * 2),
-			},
 			checkFunc: func(opt Option) error {
-				authz := &authority{
-					cache: gache.New[Principal](),
-				}
+				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.cacheExp != time.Duration(time.Hour*2) {
+				if authz.policyResourceHierarchy != true {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -633,34 +1594,27 @@ func TestWithCacheExp(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithCacheExp(tt.args.d)
+			got := WithEnablePolicyResourceHierarchy()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithCacheExp() error = %v", err)
+				t.Errorf("WithEnablePolicyResourceHierarchy() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithRoleCertURIPrefix(t *testing.T) {
-	type args struct {
-		p string
-	}
+func TestWithDisablePolicyResourceHierarchy(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				p: "dummy",
-			},
 			checkFunc: func(opt Option) error {
-				authz := &authority{}
+				authz := &authority{policyResourceHierarchy: true}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if authz.roleCertURIPrefix != "dummy" {
+				if authz.policyResourceHierarchy != false {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -669,53 +1623,114 @@ func TestWithRoleCertURIPrefix(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithRoleCertURIPrefix(tt.args.p)
+			got := WithDisablePolicyResourceHierarchy()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithRoleCertURIPrefix() error = %v", err)
+				t.Errorf("WithDisablePolicyResourceHierarchy() error = %v", err)
 			}
 		})
 	}
 }
 
-func TestWithHTTPClient(t *testing.T) {
-	type args struct {
-		c *http.Client
-	}
+func TestWithEnablePubkeyZTSFromJwks(t *testing.T) {
 	tests := []struct {
 		name      string
-		args      args
 		checkFunc func(Option) error
 	}{
 		{
 			name: "set success",
-			args: args{
-				c: http.DefaultClient,
-			},
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				if !reflect.DeepEqual(authz.client, http.DefaultClient) {
+				if authz.pubkeyZTSFromJwks != true {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
 			},
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithEnablePubkeyZTSFromJwks()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithEnablePubkeyZTSFromJwks() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDisablePubkeyZTSFromJwks(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
 		{
-			name: "set nil",
-			args: args{
-				c: nil,
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{pubkeyZTSFromJwks: true}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.pubkeyZTSFromJwks != false {
+					return fmt.Errorf("invalid param was set")
+				}
+				return nil
 			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDisablePubkeyZTSFromJwks()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDisablePubkeyZTSFromJwks() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithEnableJwkRefreshOnMiss(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
 			checkFunc: func(opt Option) error {
 				authz := &authority{}
 				if err := opt(authz); err != nil {
 					return err
 				}
-				want := &http.Client{
-					Timeout: 30 * time.Second,
+				if authz.jwkRefreshOnMiss != true {
+					return fmt.Errorf("invalid param was set")
 				}
-				if !reflect.DeepEqual(authz.client, want) {
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithEnableJwkRefreshOnMiss()
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithEnableJwkRefreshOnMiss() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDisableJwkRefreshOnMiss(t *testing.T) {
+	tests := []struct {
+		name      string
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			checkFunc: func(opt Option) error {
+				authz := &authority{jwkRefreshOnMiss: true}
+				if err := opt(authz); err != nil {
+					return err
+				}
+				if authz.jwkRefreshOnMiss != false {
 					return fmt.Errorf("invalid param was set")
 				}
 				return nil
@@ -724,9 +1739,9 @@ func TestWithHTTPClient(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := WithHTTPClient(tt.args.c)
+			got := WithDisableJwkRefreshOnMiss()
 			if err := tt.checkFunc(got); err != nil {
-				t.Errorf("WithHTTPClient() error = %v", err)
+				t.Errorf("WithDisableJwkRefreshOnMiss() error = %v", err)
 			}
 		})
 	}
@@ -1315,3 +2330,114 @@ func TestWithOutputAuthorizedPrincipalLog(t *testing.T) {
 		})
 	}
 }
+
+func TestWithPubkeyAllowedKeyIDs(t *testing.T) {
+	authz := &authority{}
+	if err := WithPubkeyAllowedKeyIDs(pubkey.EnvZTS, "0", "1")(authz); err != nil {
+		t.Fatalf("WithPubkeyAllowedKeyIDs() error = %v", err)
+	}
+	want := map[pubkey.AthenzEnv][]string{pubkey.EnvZTS: {"0", "1"}}
+	if !reflect.DeepEqual(authz.pubkeyAllowedKeyIDs, want) {
+		t.Errorf("WithPubkeyAllowedKeyIDs() = %v, want %v", authz.pubkeyAllowedKeyIDs, want)
+	}
+}
+
+func TestWithPubkeyKeyPins(t *testing.T) {
+	authz := &authority{}
+	pins := map[string]string{"0": "dummy"}
+	if err := WithPubkeyKeyPins(pubkey.EnvZMS, pins)(authz); err != nil {
+		t.Fatalf("WithPubkeyKeyPins() error = %v", err)
+	}
+	want := map[pubkey.AthenzEnv]map[string]string{pubkey.EnvZMS: pins}
+	if !reflect.DeepEqual(authz.pubkeyKeyPins, want) {
+		t.Errorf("WithPubkeyKeyPins() = %v, want %v", authz.pubkeyKeyPins, want)
+	}
+}
+
+func TestWithJwkAllowedKeyIDs(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkAllowedKeyIDs("https://athenz.io/jwks", "0")(authz); err != nil {
+		t.Fatalf("WithJwkAllowedKeyIDs() error = %v", err)
+	}
+	want := map[string][]string{"https://athenz.io/jwks": {"0"}}
+	if !reflect.DeepEqual(authz.jwkAllowedKeyIDs, want) {
+		t.Errorf("WithJwkAllowedKeyIDs() = %v, want %v", authz.jwkAllowedKeyIDs, want)
+	}
+}
+
+func TestWithJwkKeyPins(t *testing.T) {
+	authz := &authority{}
+	pins := map[string]string{"0": "dummy"}
+	if err := WithJwkKeyPins("", pins)(authz); err != nil {
+		t.Fatalf("WithJwkKeyPins() error = %v", err)
+	}
+	want := map[string]map[string]string{"": pins}
+	if !reflect.DeepEqual(authz.jwkKeyPins, want) {
+		t.Errorf("WithJwkKeyPins() = %v, want %v", authz.jwkKeyPins, want)
+	}
+}
+
+func TestWithJwkMissRefreshInterval(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkMissRefreshInterval("30s")(authz); err != nil {
+		t.Fatalf("WithJwkMissRefreshInterval() error = %v", err)
+	}
+	if authz.jwkMissRefreshInterval != "30s" {
+		t.Errorf("WithJwkMissRefreshInterval() = %v, want %v", authz.jwkMissRefreshInterval, "30s")
+	}
+}
+
+func TestWithJwkUnknownKeyIDCacheTTL(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkUnknownKeyIDCacheTTL("5m")(authz); err != nil {
+		t.Fatalf("WithJwkUnknownKeyIDCacheTTL() error = %v", err)
+	}
+	if authz.jwkUnknownKeyIDCacheTTL != "5m" {
+		t.Errorf("WithJwkUnknownKeyIDCacheTTL() = %v, want %v", authz.jwkUnknownKeyIDCacheTTL, "5m")
+	}
+}
+
+func TestWithJwkJkuPatterns(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkJkuPatterns("https://*.athenz.io/oauth2/keys")(authz); err != nil {
+		t.Fatalf("WithJwkJkuPatterns() error = %v", err)
+	}
+	want := []string{"https://*.athenz.io/oauth2/keys"}
+	if !reflect.DeepEqual(authz.jwkJkuPatterns, want) {
+		t.Errorf("WithJwkJkuPatterns() = %v, want %v", authz.jwkJkuPatterns, want)
+	}
+}
+
+func TestWithJwkJkuCacheTTL(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkJkuCacheTTL("30m")(authz); err != nil {
+		t.Fatalf("WithJwkJkuCacheTTL() error = %v", err)
+	}
+	if authz.jwkJkuCacheTTL != "30m" {
+		t.Errorf("WithJwkJkuCacheTTL() = %v, want %v", authz.jwkJkuCacheTTL, "30m")
+	}
+}
+
+func TestWithJwkJkuCacheSize(t *testing.T) {
+	authz := &authority{}
+	if err := WithJwkJkuCacheSize(10)(authz); err != nil {
+		t.Fatalf("WithJwkJkuCacheSize() error = %v", err)
+	}
+	if authz.jwkJkuCacheSize != 10 {
+		t.Errorf("WithJwkJkuCacheSize() = %v, want %v", authz.jwkJkuCacheSize, 10)
+	}
+}
+
+func TestWithAccessTokenIssuers(t *testing.T) {
+	authz := &authority{}
+	cfgs := []access.IssuerConfig{
+		{Issuer: "https://zts.athenz.io", JWKSURL: "https://zts.athenz.io/oauth2/keys"},
+		{Issuer: "https://idp.example.com", Audiences: []string{"athenz"}},
+	}
+	if err := WithAccessTokenIssuers(cfgs...)(authz); err != nil {
+		t.Fatalf("WithAccessTokenIssuers() error = %v", err)
+	}
+	if !reflect.DeepEqual(authz.accessTokenIssuers, cfgs) {
+		t.Errorf("WithAccessTokenIssuers() = %v, want %v", authz.accessTokenIssuers, cfgs)
+	}
+}
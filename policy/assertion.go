@@ -17,6 +17,7 @@ package policy
 import (
 	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
@@ -32,10 +33,40 @@ type Assertion struct {
 	Resource             string `json:"resource"`
 	ActionRegexpString   string `json:"action_regexp_string"`
 	ResourceRegexpString string `json:"resource_regexp_string"`
+
+	// Local is true if the assertion is added locally, see LocalAssertion
+	Local bool `json:"local,omitempty"`
+
+	// Order is the order of the assertion in the signed policy, used by the first-applicable combining algorithm
+	Order int `json:"order"`
+
+	// Policy is the name of the signed policy containing the assertion
+	Policy string `json:"policy,omitempty"`
+
+	// CaseSensitive is true if the action and resource are matched in exact case
+	CaseSensitive bool `json:"case_sensitive,omitempty"`
+
+	// Hierarchical is true if the resource is matched by the path segments separated by "/", see NewHierarchicalAssertion
+	Hierarchical bool `json:"hierarchical,omitempty"`
 }
 
-// NewAssertion returns the Assertion object or error
+// NewAssertion returns the Assertion object or error. The action and resource are matched case-insensitively.
 func NewAssertion(action, resource, effect string) (*Assertion, error) {
+	return newAssertion(action, resource, effect, false, false)
+}
+
+// NewCaseSensitiveAssertion returns the Assertion object or error. The action and resource are matched in exact case.
+func NewCaseSensitiveAssertion(action, resource, effect string) (*Assertion, error) {
+	return newAssertion(action, resource, effect, true, false)
+}
+
+// NewHierarchicalAssertion returns the Assertion object or error. The resource is matched by the path segments separated by "/",
+// i.e. "*" and "?" match within a segment, and "**" matches across the segments. The action and resource are matched case-insensitively.
+func NewHierarchicalAssertion(action, resource, effect string) (*Assertion, error) {
+	return newAssertion(action, resource, effect, false, true)
+}
+
+func newAssertion(action, resource, effect string, caseSensitive, hierarchical bool) (*Assertion, error) {
 	domres := strings.SplitN(resource, ":", 2)
 	if len(domres) < 2 {
 		return nil, errors.Wrap(ErrInvalidPolicyResource, "assertion format not correct")
@@ -43,12 +74,21 @@ func NewAssertion(action, resource, effect string) (*Assertion, error) {
 	dom := domres[0]
 	res := domres[1]
 
-	ar, err := regexp.Compile(patternFromGlob(strings.ToLower(action)))
+	actionGlob, resGlob := action, res
+	if !caseSensitive {
+		actionGlob, resGlob = strings.ToLower(action), strings.ToLower(res)
+	}
+
+	ar, err := regexp.Compile(patternFromGlob(actionGlob))
 	if err != nil {
 		return nil, errors.Wrap(err, "assertion format not correct")
 	}
 
-	rr, err := regexp.Compile(patternFromGlob(strings.ToLower(res)))
+	resPattern := patternFromGlob(resGlob)
+	if hierarchical {
+		resPattern = patternFromHierarchicalGlob(resGlob)
+	}
+	rr, err := regexp.Compile(resPattern)
 	if err != nil {
 		return nil, errors.Wrap(err, "assertion format not correct")
 	}
@@ -67,9 +107,24 @@ func NewAssertion(action, resource, effect string) (*Assertion, error) {
 		Resource:             res,
 		ActionRegexpString:   ar.String(),
 		ResourceRegexpString: rr.String(),
+		CaseSensitive:        caseSensitive,
+		Hierarchical:         hierarchical,
 	}, nil
 }
 
+// caseSensitivity decides whether the signed assertions are matched in exact case
+type caseSensitivity struct {
+	all    bool // all the assertions are case-sensitive
+	detect bool // the assertions containing upper case characters are case-sensitive
+}
+
+// isCaseSensitive reports whether the assertion is case-sensitive.
+// ZMS stores the action and resource of the case-insensitive assertions in lower case,
+// so the upper case characters indicate the assertion is case-sensitive.
+func (c caseSensitivity) isCaseSensitive(action, resource string) bool {
+	return c.all || (c.detect && (strings.ToLower(action) != action || strings.ToLower(resource) != resource))
+}
+
 func isRegexMetaCharacter(target rune) bool {
 	switch target {
 	case '^':
@@ -106,3 +161,32 @@ func patternFromGlob(glob string) string {
 	sb.WriteString("$")
 	return sb.String()
 }
+
+// patternFromHierarchicalGlob returns the regular expression of the glob matching the path segments separated by "/".
+// "*" and "?" do not match "/", "**" matches any characters including "/", and "**/" also matches no segment, e.g. "a/**/b" matches "a/b".
+func patternFromHierarchicalGlob(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+			i++
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(glob[i:])
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			i += size
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
@@ -199,6 +199,113 @@ func TestNewAssertion(t *testing.T) {
 	}
 }
 
+func TestNewCaseSensitiveAssertion(t *testing.T) {
+	type args struct {
+		action   string
+		resource string
+		effect   string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		match   [2]string
+		nomatch [2]string
+		wantErr error
+	}{
+		{
+			name: "keep the case",
+			args: args{
+				action:   "Read",
+				resource: "dom:Bucket/Key*",
+				effect:   "allow",
+			},
+			match:   [2]string{"Read", "Bucket/KeyA"},
+			nomatch: [2]string{"read", "bucket/keya"},
+		},
+		{
+			name: "invalid resource",
+			args: args{
+				action:   "Read",
+				resource: "Bucket",
+				effect:   "allow",
+			},
+			wantErr: errors.New("assertion format not correct: Access denied due to invalid/empty policy resources"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCaseSensitiveAssertion(tt.args.action, tt.args.resource, tt.args.effect)
+			if (err == nil && tt.wantErr != nil) || (err != nil && (tt.wantErr == nil || err.Error() != tt.wantErr.Error())) {
+				t.Errorf("NewCaseSensitiveAssertion error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !got.CaseSensitive {
+				t.Errorf("NewCaseSensitiveAssertion CaseSensitive = false")
+			}
+			if !got.ActionRegexp.MatchString(tt.match[0]) || !got.ResourceRegexp.MatchString(tt.match[1]) {
+				t.Errorf("NewCaseSensitiveAssertion = %v, should match %v", got, tt.match)
+			}
+			if got.ActionRegexp.MatchString(tt.nomatch[0]) || got.ResourceRegexp.MatchString(tt.nomatch[1]) {
+				t.Errorf("NewCaseSensitiveAssertion = %v, should not match %v", got, tt.nomatch)
+			}
+		})
+	}
+}
+
+func Test_caseSensitivity_isCaseSensitive(t *testing.T) {
+	type args struct {
+		action   string
+		resource string
+	}
+	tests := []struct {
+		name string
+		cs   caseSensitivity
+		args args
+		want bool
+	}{
+		{
+			name: "disabled",
+			cs:   caseSensitivity{},
+			args: args{action: "Read", resource: "dom:Key"},
+			want: false,
+		},
+		{
+			name: "all",
+			cs:   caseSensitivity{all: true},
+			args: args{action: "read", resource: "dom:key"},
+			want: true,
+		},
+		{
+			name: "detect upper case action",
+			cs:   caseSensitivity{detect: true},
+			args: args{action: "Read", resource: "dom:key"},
+			want: true,
+		},
+		{
+			name: "detect upper case resource",
+			cs:   caseSensitivity{detect: true},
+			args: args{action: "read", resource: "dom:Key"},
+			want: true,
+		},
+		{
+			name: "detect lower case",
+			cs:   caseSensitivity{detect: true},
+			args: args{action: "read", resource: "dom:key"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cs.isCaseSensitive(tt.args.action, tt.args.resource); got != tt.want {
+				t.Errorf("caseSensitivity.isCaseSensitive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_isRegexMetaCharacter(t *testing.T) {
 	type args struct {
 		target rune
@@ -310,3 +417,96 @@ func Test_patternFromGlob(t *testing.T) {
 		})
 	}
 }
+
+func Test_patternFromHierarchicalGlob(t *testing.T) {
+	tests := []struct {
+		name string
+		glob string
+		want string
+	}{
+		{
+			name: "escape regular expression meta characters",
+			glob: "^$.|[]+\\(){}",
+			want: `^\^\$\.\|\[\]\+\\\(\)\{\}$`,
+		},
+		{
+			name: "single segment wildcards",
+			glob: "bucket/*/file?",
+			want: "^bucket/[^/]*/file[^/]$",
+		},
+		{
+			name: "multiple segments wildcards",
+			glob: "bucket/**",
+			want: "^bucket/.*$",
+		},
+		{
+			name: "multiple segments wildcards with the trailing separator",
+			glob: "bucket/**/file",
+			want: "^bucket/(?:.*/)?file$",
+		},
+		{
+			name: "multi-byte characters",
+			glob: "バケット/*",
+			want: "^バケット/[^/]*$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := patternFromHierarchicalGlob(tt.glob)
+			if got != tt.want {
+				t.Errorf("patternFromHierarchicalGlob() = %v, want %v", got, tt.want)
+			}
+			if _, err := regexp.Compile(got); err != nil {
+				t.Errorf("regexp.Compile() error = %v, got %v", err, got)
+			}
+		})
+	}
+}
+
+// TestNewHierarchicalAssertion compares the resource matching of the hierarchical assertion with the glob assertion
+func TestNewHierarchicalAssertion(t *testing.T) {
+	tests := []struct {
+		resource         string
+		target           string
+		wantGlob         bool
+		wantHierarchical bool
+	}{
+		{resource: "dom:bucket/*", target: "bucket/file", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/*", target: "bucket/dir/file", wantGlob: true, wantHierarchical: false},
+		{resource: "dom:bucket/*", target: "bucket/", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/**", target: "bucket/dir/file", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/*/file", target: "bucket/dir/file", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/*/file", target: "bucket/a/b/file", wantGlob: true, wantHierarchical: false},
+		{resource: "dom:bucket/**/file", target: "bucket/a/b/file", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/**/file", target: "bucket/file", wantGlob: false, wantHierarchical: true},
+		{resource: "dom:bucket/file?", target: "bucket/file1", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/file?", target: "bucket/file/", wantGlob: true, wantHierarchical: false},
+		{resource: "dom:*", target: "bucket/file", wantGlob: true, wantHierarchical: false},
+		{resource: "dom:**", target: "bucket/file", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/*.txt", target: "bucket/a.txt", wantGlob: true, wantHierarchical: true},
+		{resource: "dom:bucket/*.txt", target: "bucket/atxt", wantGlob: false, wantHierarchical: false},
+		{resource: "dom:Bucket/*", target: "BUCKET/FILE", wantGlob: true, wantHierarchical: true},
+	}
+	p := &policyd{}
+	for _, tt := range tests {
+		t.Run(tt.resource+" "+tt.target, func(t *testing.T) {
+			glob, err := NewAssertion("read", tt.resource, "allow")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hier, err := NewHierarchicalAssertion("read", tt.resource, "allow")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hier.Hierarchical || glob.Hierarchical {
+				t.Errorf("NewHierarchicalAssertion() Hierarchical = %v, NewAssertion() Hierarchical = %v", hier.Hierarchical, glob.Hierarchical)
+			}
+			if got := p.matchAssertion(glob, "dom", "read", tt.target); got != tt.wantGlob {
+				t.Errorf("NewAssertion() match = %v, want %v", got, tt.wantGlob)
+			}
+			if got := p.matchAssertion(hier, "dom", "read", tt.target); got != tt.wantHierarchical {
+				t.Errorf("NewHierarchicalAssertion() match = %v, want %v", got, tt.wantHierarchical)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+const (
+	// maxRetryBackoff is the upper bound of the retry backoff, unless the retry delay itself is longer
+	maxRetryBackoff = time.Minute
+)
+
+// jitter returns a random duration in [0, d), or 0 if d is not positive
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d)))
+}
+
+// backoff returns the delay before the retry of the given attempt, starting from 0.
+// The delay is doubled on each attempt from base and capped, then randomized in [delay/2, delay) to spread the retries of the replicas.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	limit := max(base, maxRetryBackoff)
+	d := base
+	for i := 0; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	return d/2 + jitter(d-d/2)
+}
+
+// sleep pauses for the duration, or returns the context error if the context is done before
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type scheduledFetcher struct {
+	fetcher Fetcher
+	offset  time.Duration
+}
+
+// spreadFetchers returns the fetchers with random offsets within the spread, sorted by the offset
+func spreadFetchers(fetchers map[string]Fetcher, spread time.Duration) []scheduledFetcher {
+	sfs := make([]scheduledFetcher, 0, len(fetchers))
+	for _, f := range fetchers {
+		sfs = append(sfs, scheduledFetcher{
+			fetcher: f,
+			offset:  jitter(spread),
+		})
+	}
+	sort.Slice(sfs, func(i, j int) bool {
+		return sfs[i].offset < sfs[j].offset
+	})
+	return sfs
+}
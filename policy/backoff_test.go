@@ -0,0 +1,231 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func Test_jitter(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+	}{
+		{
+			name: "positive duration",
+			d:    time.Second,
+		},
+		{
+			name: "zero duration",
+			d:    0,
+		},
+		{
+			name: "negative duration",
+			d:    -time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := jitter(tt.d)
+				if got < 0 || (tt.d > 0 && got >= tt.d) || (tt.d <= 0 && got != 0) {
+					t.Fatalf("jitter() = %v, out of range of %v", got, tt.d)
+				}
+			}
+		})
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		attempt int
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "first attempt",
+			base:    time.Second,
+			attempt: 0,
+			wantMin: 500 * time.Millisecond,
+			wantMax: time.Second,
+		},
+		{
+			name:    "doubled on each attempt",
+			base:    time.Second,
+			attempt: 3,
+			wantMin: 4 * time.Second,
+			wantMax: 8 * time.Second,
+		},
+		{
+			name:    "capped",
+			base:    time.Second,
+			attempt: 100,
+			wantMin: maxRetryBackoff / 2,
+			wantMax: maxRetryBackoff,
+		},
+		{
+			name:    "base longer than the cap",
+			base:    2 * maxRetryBackoff,
+			attempt: 2,
+			wantMin: maxRetryBackoff,
+			wantMax: 2 * maxRetryBackoff,
+		},
+		{
+			name:    "zero base",
+			base:    0,
+			attempt: 2,
+			wantMin: 0,
+			wantMax: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := backoff(tt.base, tt.attempt)
+				if got < tt.wantMin || got > tt.wantMax || (tt.wantMax > 0 && got == tt.wantMax) {
+					t.Fatalf("backoff() = %v, want in [%v, %v)", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func Test_sleep(t *testing.T) {
+	t.Run("sleep the duration", func(t *testing.T) {
+		start := time.Now()
+		if err := sleep(context.Background(), 50*time.Millisecond); err != nil {
+			t.Errorf("sleep() error = %v", err)
+		}
+		if d := time.Since(start); d < 50*time.Millisecond {
+			t.Errorf("sleep() returned after %v", d)
+		}
+	})
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := sleep(ctx, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("sleep() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func Test_spreadFetchers(t *testing.T) {
+	fetchers := make(map[string]Fetcher, 100)
+	for i := 0; i < 100; i++ {
+		fetchers[fmt.Sprintf("dom%d", i)] = &fetcherMock{}
+	}
+	spread := time.Minute
+	sfs := spreadFetchers(fetchers, spread)
+	if len(sfs) != len(fetchers) {
+		t.Fatalf("spreadFetchers() len = %d, want %d", len(sfs), len(fetchers))
+	}
+	for i, sf := range sfs {
+		if sf.offset < 0 || sf.offset >= spread {
+			t.Errorf("spreadFetchers() offset = %v, out of spread %v", sf.offset, spread)
+		}
+		if i > 0 && sf.offset < sfs[i-1].offset {
+			t.Errorf("spreadFetchers() not sorted by offset, %v < %v", sf.offset, sfs[i-1].offset)
+		}
+	}
+
+	for _, sf := range spreadFetchers(fetchers, 0) {
+		if sf.offset != 0 {
+			t.Errorf("spreadFetchers() offset = %v, want 0 without spread", sf.offset)
+		}
+	}
+}
+
+func Test_policyd_update_fetchConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		spread      time.Duration
+		wantMax     int32
+	}{
+		{
+			name:        "limited",
+			concurrency: 2,
+			wantMax:     2,
+		},
+		{
+			name:        "unlimited",
+			concurrency: 0,
+			wantMax:     10,
+		},
+		{
+			name:        "limited with spread",
+			concurrency: 1,
+			spread:      50 * time.Millisecond,
+			wantMax:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning int32
+			fetchers := make(map[string]Fetcher, 10)
+			for i := 0; i < 10; i++ {
+				domain := fmt.Sprintf("dom%d", i)
+				fetchers[domain] = &fetcherMock{
+					domainMock: func() string { return domain },
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						n := atomic.AddInt32(&running, 1)
+						defer atomic.AddInt32(&running, -1)
+						for {
+							m := atomic.LoadInt32(&maxRunning)
+							if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+								break
+							}
+						}
+						time.Sleep(20 * time.Millisecond)
+						return newTestCandidate(domain, &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+							&util.Assertion{Role: domain + ":role.reader", Action: "read", Resource: domain + ":*", Effect: "allow"},
+						), nil
+					},
+				}
+			}
+			g := gache.New[[]*Assertion]()
+			p := &policyd{
+				rolePolicies:     &g,
+				purgePeriod:      time.Hour,
+				fetchers:         fetchers,
+				fetchConcurrency: tt.concurrency,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := p.update(ctx, tt.spread); err != nil {
+				t.Fatalf("policyd.update() error = %v", err)
+			}
+			if got := atomic.LoadInt32(&maxRunning); got > tt.wantMax || (tt.concurrency == 0 && got < 2) {
+				t.Errorf("policyd.update() max. concurrent fetches = %d, want %d", got, tt.wantMax)
+			}
+			if got := len(p.GetPolicyCache(ctx)); got != len(fetchers) {
+				t.Errorf("policyd.update() cached roles = %d, want %d", got, len(fetchers))
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kpango/gache/v2"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+// CombiningAlgorithm represents how the assertions of the roles in the token are combined into the decision.
+// In all the algorithms, the matching local assertion of a role is applied before the signed assertions of the role.
+type CombiningAlgorithm string
+
+const (
+	// DenyOverrides denies the request if any assertion of any role denies it, otherwise allows it if any assertion allows it.
+	// It is the default combining algorithm.
+	DenyOverrides CombiningAlgorithm = "deny-overrides"
+	// RoleDenyOverrides evaluates each role on its own with deny-overrides, i.e. the deny assertion only applies to the role it is attached to.
+	// The request is allowed if any role allows it, otherwise denied if any role denies it.
+	RoleDenyOverrides CombiningAlgorithm = "role-deny-overrides"
+	// PermitOverrides allows the request if any assertion of any role allows it, otherwise denies it if any assertion denies it.
+	PermitOverrides CombiningAlgorithm = "permit-overrides"
+	// FirstApplicable applies the first matching assertion by the order in the signed policy, among all the roles.
+	FirstApplicable CombiningAlgorithm = "first-applicable"
+)
+
+// localAssertionOrder is the order of the local assertions, which are applied before the signed assertions
+const localAssertionOrder = -1
+
+// IsValid reports whether the combining algorithm is supported.
+func (c CombiningAlgorithm) IsValid() bool {
+	switch c {
+	case DenyOverrides, RoleDenyOverrides, PermitOverrides, FirstApplicable:
+		return true
+	}
+	return false
+}
+
+// combiningAlgorithm returns the combining algorithm of the domain
+func (p *policyd) combiningAlgorithm(domain string) CombiningAlgorithm {
+	if alg, ok := p.domainCombiningAlgs[domain]; ok {
+		return alg
+	}
+	if p.combiningAlg == "" {
+		return DenyOverrides
+	}
+	return p.combiningAlg
+}
+
+// evaluateRole returns the effect of the role on the request by the combining algorithm, or false if no assertion of the role matches.
+// If the role policies cache is nil, only the local assertions are evaluated.
+func (p *policyd) evaluateRole(ctx context.Context, rp gache.Gache[[]*Assertion], alg CombiningAlgorithm, domain, role, resDomain, action, res string) (roleEffect, bool) {
+	// local assertions are evaluated before the signed assertions
+	for _, la := range p.localAssertions.get(domain, role) {
+		if p.matchAssertion(la.assertion, resDomain, action, res) {
+			glg.Infof("local assertion matched, domain: %s, role: %s, action: %s, resource: %s:%s, effect: %s, reason: %s", domain, role, action, resDomain, res, la.Effect, la.Reason)
+			return roleEffect{Role: role, Effect: la.assertion.Effect, Order: localAssertionOrder}, true
+		}
+	}
+
+	if rp == nil {
+		return roleEffect{}, false
+	}
+	asss, ok := rp.Get(fmt.Sprintf("%s:role.%s", domain, role))
+	if !ok {
+		return roleEffect{}, false
+	}
+
+	var matched *Assertion
+	for _, ass := range asss {
+		glg.Debugf("Checking policy domain: %s, role: %v, action: %s, resource: %s, assertion: %v", domain, role, action, res, ass)
+		select {
+		case <-ctx.Done():
+			return roleEffect{Role: role, Effect: ctx.Err()}, true
+		default:
+		}
+		if !p.matchAssertion(ass, resDomain, action, res) {
+			continue
+		}
+		switch alg {
+		case PermitOverrides:
+			// deny policies come first in rolePolicies, so keep looking for the allow policies
+			if ass.Effect == nil {
+				return roleEffect{Role: role, Effect: nil, Order: ass.Order}, true
+			}
+			if matched == nil {
+				matched = ass
+			}
+		case FirstApplicable:
+			if matched == nil || ass.Order < matched.Order {
+				matched = ass
+			}
+		default:
+			// deny policies come first in rolePolicies, so it will return first before allow policies is checked
+			return roleEffect{Role: role, Effect: ass.Effect, Order: ass.Order}, true
+		}
+	}
+	if matched == nil {
+		return roleEffect{}, false
+	}
+	return roleEffect{Role: role, Effect: matched.Effect, Order: matched.Order}, true
+}
+
+// combineRoleEffects combines the effects of the roles into the allowed roles or the deny error by the combining algorithm.
+// The deny-overrides returns on the first denied role in checkPolicyRoles, so it is not handled here.
+func combineRoleEffects(alg CombiningAlgorithm, effects []roleEffect) ([]string, error) {
+	allowedRoles := make([]string, 0, len(effects))
+	var deny *roleEffect
+	if alg == FirstApplicable {
+		var first *roleEffect
+		for i, re := range effects {
+			// the denied one is prioritized between the assertions of the same order, e.g. local assertions
+			if first == nil || re.Order < first.Order || (re.Order == first.Order && re.Effect != nil) {
+				first = &effects[i]
+			}
+		}
+		if first != nil && first.Effect != nil {
+			return nil, first.Effect
+		}
+	}
+	for i, re := range effects {
+		if re.Effect != nil {
+			if deny == nil {
+				deny = &effects[i]
+			}
+			continue
+		}
+		allowedRoles = append(allowedRoles, re.Role)
+	}
+	if len(allowedRoles) > 0 {
+		return allowedRoles, nil
+	}
+	if deny != nil {
+		return nil, deny.Effect
+	}
+	return nil, errors.Wrap(ErrNoMatch, "no match")
+}
@@ -0,0 +1,350 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func newTestOrderedAssertion(action, resource, effect string, order int) *Assertion {
+	a := newTestAssertion(action, resource, effect)
+	a.Order = order
+	return a
+}
+
+// Test_policyd_CheckPolicyRoles_combiningAlgorithm checks the decision of each combining algorithm against the same policies.
+func Test_policyd_CheckPolicyRoles_combiningAlgorithm(t *testing.T) {
+	rolePolicies := newTestRolePolicies(map[string][]*Assertion{
+		"dom:role.reader": {
+			newTestOrderedAssertion("read", "dom:secret", "deny", 1),
+			newTestOrderedAssertion("read", "dom:*", "allow", 0),
+		},
+		"dom:role.admin": {
+			newTestOrderedAssertion("*", "dom:*", "allow", 2),
+		},
+		"dom:role.blocked": {
+			newTestOrderedAssertion("*", "dom:*", "deny", 3),
+		},
+		"dom:role.late": {
+			newTestOrderedAssertion("*", "dom:*", "allow", 4),
+		},
+	})
+	localAssertions := func() *localAssertions {
+		ls := newLocalAssertions()
+		if err := ls.add(&LocalAssertion{Domain: "dom", Role: "reader", Action: "read", Resource: "dom:incident", Effect: "deny"}); err != nil {
+			panic(err)
+		}
+		return ls
+	}()
+
+	type args struct {
+		roles    []string
+		action   string
+		resource string
+	}
+	// result is the allowed roles, or the cause of the error, ErrDenyByPolicy or ErrNoMatch
+	type result struct {
+		roles []string
+		err   error
+	}
+	allow := func(roles ...string) result { return result{roles: roles} }
+	deny := result{err: ErrDenyByPolicy}
+	noMatch := result{err: ErrNoMatch}
+
+	tests := []struct {
+		name string
+		args args
+		want map[CombiningAlgorithm]result
+	}{
+		{
+			name: "deny and allow in the same role, allow first in policy order",
+			args: args{roles: []string{"reader"}, action: "read", resource: "secret"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: deny,
+				PermitOverrides:   allow("reader"),
+				FirstApplicable:   allow("reader"),
+			},
+		},
+		{
+			name: "deny in a role, allow in another role",
+			args: args{roles: []string{"reader", "admin"}, action: "read", resource: "secret"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: allow("admin"),
+				PermitOverrides:   allow("admin", "reader"),
+				FirstApplicable:   allow("admin", "reader"),
+			},
+		},
+		{
+			name: "allow in a role before deny in another role in policy order",
+			args: args{roles: []string{"admin", "blocked"}, action: "write", resource: "doc"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: allow("admin"),
+				PermitOverrides:   allow("admin"),
+				FirstApplicable:   allow("admin"),
+			},
+		},
+		{
+			name: "deny in a role before allow in another role in policy order",
+			args: args{roles: []string{"blocked", "late"}, action: "write", resource: "doc"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: allow("late"),
+				PermitOverrides:   allow("late"),
+				FirstApplicable:   deny,
+			},
+		},
+		{
+			name: "deny only",
+			args: args{roles: []string{"blocked"}, action: "read", resource: "doc"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: deny,
+				PermitOverrides:   deny,
+				FirstApplicable:   deny,
+			},
+		},
+		{
+			name: "local deny assertion applied first in the role",
+			args: args{roles: []string{"reader"}, action: "read", resource: "incident"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: deny,
+				PermitOverrides:   deny,
+				FirstApplicable:   deny,
+			},
+		},
+		{
+			name: "local deny assertion and allow in another role",
+			args: args{roles: []string{"reader", "admin"}, action: "read", resource: "incident"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     deny,
+				RoleDenyOverrides: allow("admin"),
+				PermitOverrides:   allow("admin"),
+				FirstApplicable:   deny,
+			},
+		},
+		{
+			name: "no match",
+			args: args{roles: []string{"reader", "unknown"}, action: "write", resource: "doc"},
+			want: map[CombiningAlgorithm]result{
+				DenyOverrides:     noMatch,
+				RoleDenyOverrides: noMatch,
+				PermitOverrides:   noMatch,
+				FirstApplicable:   noMatch,
+			},
+		},
+	}
+	for _, tt := range tests {
+		for alg, want := range tt.want {
+			t.Run(tt.name+"/"+string(alg), func(t *testing.T) {
+				p := &policyd{
+					rolePolicies:    rolePolicies,
+					localAssertions: localAssertions,
+					combiningAlg:    alg,
+				}
+				got, err := p.CheckPolicyRoles(context.Background(), "dom", tt.args.roles, tt.args.action, tt.args.resource)
+				if want.err != nil {
+					if !errors.Is(err, want.err) {
+						t.Errorf("policyd.CheckPolicyRoles() error = %v, want %v", err, want.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Errorf("policyd.CheckPolicyRoles() error = %v", err)
+					return
+				}
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, want.roles) {
+					t.Errorf("policyd.CheckPolicyRoles() = %v, want %v", got, want.roles)
+				}
+			})
+		}
+	}
+}
+
+func Test_policyd_combiningAlgorithm(t *testing.T) {
+	type fields struct {
+		combiningAlg        CombiningAlgorithm
+		domainCombiningAlgs map[string]CombiningAlgorithm
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		domain string
+		want   CombiningAlgorithm
+	}{
+		{
+			name:   "default",
+			domain: "dom",
+			want:   DenyOverrides,
+		},
+		{
+			name: "global",
+			fields: fields{
+				combiningAlg: PermitOverrides,
+			},
+			domain: "dom",
+			want:   PermitOverrides,
+		},
+		{
+			name: "domain specific",
+			fields: fields{
+				combiningAlg:        PermitOverrides,
+				domainCombiningAlgs: map[string]CombiningAlgorithm{"dom": FirstApplicable},
+			},
+			domain: "dom",
+			want:   FirstApplicable,
+		},
+		{
+			name: "other domain",
+			fields: fields{
+				domainCombiningAlgs: map[string]CombiningAlgorithm{"dom": FirstApplicable},
+			},
+			domain: "otherdom",
+			want:   DenyOverrides,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				combiningAlg:        tt.fields.combiningAlg,
+				domainCombiningAlgs: tt.fields.domainCombiningAlgs,
+			}
+			if got := p.combiningAlgorithm(tt.domain); got != tt.want {
+				t.Errorf("policyd.combiningAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_simplifyAndCachePolicy_order(t *testing.T) {
+	rp := gache.New[[]*Assertion]()
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				Expires: &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+				PolicyData: &util.PolicyData{
+					Domain: "dom",
+					Policies: []*util.Policy{
+						{
+							Name: "dom:policy.first",
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.role", Action: "read", Resource: "dom:*", Effect: "allow"},
+								{Role: "dom:role.role", Action: "write", Resource: "dom:*", Effect: "allow"},
+							},
+						},
+						{
+							Name: "dom:policy.second",
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.role", Action: "read", Resource: "dom:secret", Effect: "deny"},
+								{Role: "dom:role.role", Action: "read", Resource: "dom:*", Effect: "allow"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := simplifyAndCachePolicy(context.Background(), rp, sp, cacheConfig{}); err != nil {
+		t.Fatalf("simplifyAndCachePolicy() error = %v", err)
+	}
+	asss, _ := rp.Get("dom:role.role")
+	got := make(map[string]string, len(asss))
+	for _, a := range asss {
+		got[a.Action+","+a.Resource] = fmt.Sprintf("%d,%s", a.Order, a.Policy)
+	}
+	want := map[string]string{
+		"read,*":      "0,dom:policy.first",
+		"write,*":     "1,dom:policy.first",
+		"read,secret": "2,dom:policy.second",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("simplifyAndCachePolicy() order = %v, want %v", got, want)
+	}
+}
+
+func Test_simplifyAndCachePolicy_firstApplicable(t *testing.T) {
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				Expires: &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+				PolicyData: &util.PolicyData{
+					Domain: "dom",
+					Policies: []*util.Policy{
+						{
+							Name: "dom:policy.first",
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+							},
+						},
+						{
+							Name: "dom:policy.second",
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "deny"},
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		alg     CombiningAlgorithm
+		wantErr bool
+	}{
+		{alg: DenyOverrides, wantErr: true},
+		{alg: RoleDenyOverrides, wantErr: true},
+		{alg: PermitOverrides},
+		{alg: FirstApplicable},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.alg), func(t *testing.T) {
+			// the result must not depend on the scheduling of building the cache
+			for i := 0; i < 20; i++ {
+				rp := gache.New[[]*Assertion]()
+				if err := simplifyAndCachePolicy(context.Background(), rp, sp, cacheConfig{}); err != nil {
+					t.Fatalf("simplifyAndCachePolicy() error = %v", err)
+				}
+				p := &policyd{
+					rolePolicies: &rp,
+					combiningAlg: tt.alg,
+				}
+				_, err := p.CheckPolicyRoles(context.Background(), "dom", []string{"reader"}, "read", "doc")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("policyd.CheckPolicyRoles() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				asss, _ := rp.Get("dom:role.reader")
+				if len(asss) != 2 || asss[0].Order != 1 || asss[1].Order != 0 {
+					t.Fatalf("cached assertions = %+v, want the deny of order 1 and the allow of order 0", asss)
+				}
+			}
+		})
+	}
+}
@@ -19,12 +19,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/AthenZ/athenz-authorizer/v5/internal/pubsub"
 	"github.com/AthenZ/athenz-authorizer/v5/pubkey"
 	"github.com/AthenZ/athenz/utils/zpe-updater/util"
 	"github.com/kpango/fastime"
@@ -32,6 +34,7 @@ import (
 	"github.com/kpango/glg"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Daemon represents the daemon to retrieve policy data from Athenz.
@@ -41,11 +44,25 @@ type Daemon interface {
 	CheckPolicy(ctx context.Context, domain string, roles []string, action, resource string) error
 	CheckPolicyRoles(ctx context.Context, domain string, roles []string, action, resource string) ([]string, error)
 	GetPolicyCache(context.Context) map[string][]*Assertion
+	AddLocalAssertions(ctx context.Context, las ...*LocalAssertion) error
+	DeleteLocalAssertions(ctx context.Context, domain, role string) int
+	DeleteLocalPrincipalAssertions(ctx context.Context, domain, principal string) int
+	GetLocalAssertions(context.Context) []*LocalAssertion
+	LoadLocalAssertions(ctx context.Context, path string) error
+	GetAccessRoles(ctx context.Context, domain, action, resource string) *AccessRoles
+	GetRolePermissions(ctx context.Context, domain string, roles []string) []*Permission
+	Simulate(ctx context.Context, candidates []*SignedPolicy, reqs []*SimulationRequest) (*SimulationReport, error)
+	Refresh(ctx context.Context, domains ...string) error
+	GetPolicyExpiries(ctx context.Context) map[string]time.Time
+	Subscribe(ctx context.Context) <-chan *PolicyEvent
+	ExportPolicies(ctx context.Context) *PolicyExport
+	ImportPolicies(ctx context.Context, e *PolicyExport) error
 }
 
 type roleEffect struct {
 	Role   string
 	Effect error
+	Order  int // order of the matched assertion, see Assertion.Order
 }
 
 type policyd struct {
@@ -56,15 +73,58 @@ type policyd struct {
 	// so we need to put the deny policies in lower index.
 	rolePolicies *gache.Gache[[]*Assertion]
 
+	// The localAssertions are evaluated before the rolePolicies, and not affected by the policy update
+	localAssertions     *localAssertions
+	localAssertionsFile string
+
+	// the policy export to seed the policy cache on creation, see ImportPolicies
+	policyExportFile string
+
 	expiryMargin  time.Duration // force update policy before actual expiry by margin duration
 	refreshPeriod time.Duration
 	purgePeriod   time.Duration
 	retryDelay    time.Duration
 	retryAttempts int
 
+	// fetch scheduling related, to avoid the replicas fetching all the domains at once
+	fetchConcurrency int           // max. number of the concurrent fetches, 0 for unlimited
+	refreshJitter    time.Duration // random delay added to each refresh period
+	refreshSpread    time.Duration // the domains are fetched at random offsets within the spread on periodic refresh
+
 	athenzURL     string
 	athenzDomains []string
 
+	// local policy file related
+	policyDir       string
+	policyFiles     map[string]string // map[<domain>]<policy file path>
+	fileWatchPeriod time.Duration
+
+	fetcherFactory FetcherFactory
+
+	crossDomainResource bool // resources may be qualified by the domain, i.e. <domain>:<resource>
+
+	combiningAlg        CombiningAlgorithm
+	domainCombiningAlgs map[string]CombiningAlgorithm
+
+	caseSensitivity   caseSensitivity
+	resourceHierarchy bool // the resources of the signed assertions are matched by the path segments separated by "/"
+
+	// stale policy related
+	staleGracePeriod time.Duration // keep serving the expired policy for the grace period
+	staleFailOpen    bool          // allow the requests if the policy is expired beyond the grace period, otherwise deny them
+	policyExpiries   sync.Map      // map[<domain>]time.Time, the expiry of the cached signed policy
+	expiryWarnedAt   sync.Map      // map[<domain>]time.Time, the last time of the policy expiry warning on the policy check
+
+	swapMu       sync.Mutex         // serializes the swaps of the policy cache by Update and Refresh
+	daemonCtx    context.Context    // the context of Start to stop the expiry janitors of the policy cache, guarded by swapMu
+	refreshGen   uint64             // incremented on each swap by Refresh, guarded by swapMu
+	refreshGens  map[string]uint64  // map[<domain>]refreshGen, the generation of the last Refresh of the domain, guarded by swapMu
+	refreshGroup singleflight.Group // coalesces the concurrent Refresh of the same domains
+
+	// policy change event related
+	lastPolicies sync.Map // map[<domain>]*SignedPolicy, the last cached signed policy to diff with
+	subscribers  pubsub.Subscribers[*PolicyEvent]
+
 	client   *http.Client
 	pkp      pubkey.Provider
 	fetchers map[string]Fetcher // used for concurrent read, should never be updated
@@ -74,7 +134,8 @@ type policyd struct {
 func New(opts ...Option) (Daemon, error) {
 	g := gache.New[[]*Assertion]()
 	p := &policyd{
-		rolePolicies: &g,
+		rolePolicies:    &g,
+		localAssertions: newLocalAssertions(),
 	}
 
 	for _, opt := range append(defaultOptions, opts...) {
@@ -84,28 +145,83 @@ func New(opts ...Option) (Daemon, error) {
 	}
 
 	// create fetchers
-	p.fetchers = make(map[string]Fetcher, len(p.athenzDomains))
+	p.fetchers = make(map[string]Fetcher, len(p.athenzDomains)+len(p.policyFiles))
 	for _, domain := range p.athenzDomains {
-		f := fetcher{
+		p.fetchers[domain] = p.newFetcher(domain)
+	}
+	for domain := range p.policyFiles {
+		if _, ok := p.fetchers[domain]; !ok {
+			p.fetchers[domain] = p.newFetcher(domain)
+		}
+	}
+
+	if p.localAssertionsFile != "" {
+		if err := p.LoadLocalAssertions(context.Background(), p.localAssertionsFile); err != nil {
+			return nil, errors.Wrap(err, "error create policyd")
+		}
+	}
+
+	if p.policyExportFile != "" {
+		e, err := readPolicyExportFile(p.policyExportFile)
+		if err == nil {
+			err = p.ImportPolicies(context.Background(), e)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error create policyd")
+		}
+	}
+
+	return p, nil
+}
+
+// newFetcher returns the fetcher of the domain.
+// The Fetcher created by the fetcher factory is preferred, then the local policy file, otherwise the policy is fetched from Athenz.
+func (p *policyd) newFetcher(domain string) Fetcher {
+	spVerifier := func(sp *SignedPolicy) error {
+		return sp.Verify(p.pkp)
+	}
+
+	if p.fetcherFactory != nil {
+		if f := p.fetcherFactory(domain); f != nil {
+			return &verifiedFetcher{
+				Fetcher:    f,
+				spVerifier: spVerifier,
+			}
+		}
+	}
+
+	path, ok := p.policyFiles[domain]
+	if !ok && p.policyDir != "" {
+		path, ok = policyFilePath(p.policyDir, domain), true
+	}
+	if ok {
+		return &fileFetcher{
 			domain:        domain,
-			expiryMargin:  p.expiryMargin,
+			path:          path,
 			retryDelay:    p.retryDelay,
 			retryAttempts: p.retryAttempts,
-			athenzURL:     p.athenzURL,
-			spVerifier: func(sp *SignedPolicy) error {
-				return sp.Verify(p.pkp)
-			},
-			client: p.client,
+			spVerifier:    spVerifier,
 		}
-		p.fetchers[domain] = &f
 	}
 
-	return p, nil
+	return &fetcher{
+		domain:        domain,
+		expiryMargin:  p.expiryMargin,
+		retryDelay:    p.retryDelay,
+		retryAttempts: p.retryAttempts,
+		athenzURL:     p.athenzURL,
+		spVerifier:    spVerifier,
+		client:        p.client,
+	}
 }
 
 // Start starts the Policy daemon to retrive the policy data periodically
 func (p *policyd) Start(ctx context.Context) <-chan error {
 	glg.Info("Starting policyd updater")
+	p.swapMu.Lock()
+	p.daemonCtx = ctx
+	p.swapMu.Unlock()
+
 	ech := make(chan error, 100)
 	fch := make(chan struct{}, 1)
 
@@ -113,28 +229,56 @@ func (p *policyd) Start(ctx context.Context) <-chan error {
 		defer close(fch)
 		defer close(ech)
 
-		ticker := time.NewTicker(p.refreshPeriod)
+		// the timer is reset with a new jitter on every refresh, including the first one.
+		// If any policy is not cached yet, e.g. Update is not called before Start, the first refresh is not delayed by the refresh period.
+		first := p.refreshPeriod
+		if p.hasUnavailablePolicy() {
+			first = 0
+		}
+		timer := time.NewTimer(first + jitter(p.refreshJitter))
+		// the number of consecutive failures of the retry
+		failures := 0
+
+		// watch the local policy files, and update immediately when any of them is modified
+		var watchC <-chan time.Time
+		if p.fileWatchPeriod > 0 && len(p.fileFetchers()) > 0 {
+			watcher := time.NewTicker(p.fileWatchPeriod)
+			defer watcher.Stop()
+			watchC = watcher.C
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
 				glg.Info("Stopping policyd updater")
-				ticker.Stop()
+				timer.Stop()
 				ech <- ctx.Err()
 				return
 			case <-fch:
-				if err := p.Update(ctx); err != nil {
-					ech <- errors.Wrap(err, "error update policy")
+				err := p.Update(ctx)
+				if err == nil {
+					failures = 0
+					continue
+				}
+				ech <- errors.Wrap(err, "error update policy")
 
-					time.Sleep(p.retryDelay)
+				// the retry delay is backed off on consecutive failures, and the context is checked on the next loop
+				if sleep(ctx, backoff(p.retryDelay, failures)) != nil {
+					continue
+				}
+				failures++
 
-					select {
-					case fch <- struct{}{}:
-					default:
-						glg.Warn("failure queue already full")
-					}
+				select {
+				case fch <- struct{}{}:
+				default:
+					glg.Warn("failure queue already full")
 				}
-			case <-ticker.C:
-				if err := p.Update(ctx); err != nil {
+			case <-timer.C:
+				err := p.update(ctx, p.refreshSpread)
+				timer.Reset(p.refreshPeriod + jitter(p.refreshJitter))
+				if err == nil {
+					failures = 0
+				} else {
 					ech <- errors.Wrap(err, "error update policy")
 
 					select {
@@ -143,6 +287,14 @@ func (p *policyd) Start(ctx context.Context) <-chan error {
 						glg.Warn("failure queue already full")
 					}
 				}
+			case <-watchC:
+				if !p.policyFilesModified() {
+					continue
+				}
+				glg.Info("policy file modified, will update policy")
+				if err := p.Update(ctx); err != nil {
+					ech <- errors.Wrap(err, "error update policy")
+				}
 			}
 		}
 	}()
@@ -150,16 +302,57 @@ func (p *policyd) Start(ctx context.Context) <-chan error {
 	return ech
 }
 
+// fileFetchers returns the fetchers reading the local policy files
+func (p *policyd) fileFetchers() []*fileFetcher {
+	ffs := make([]*fileFetcher, 0, len(p.fetchers))
+	for _, f := range p.fetchers {
+		if ff, ok := f.(*fileFetcher); ok {
+			ffs = append(ffs, ff)
+		}
+	}
+	return ffs
+}
+
+// policyFilesModified reports whether any of the local policy files is modified since the last fetch
+func (p *policyd) policyFilesModified() bool {
+	for _, ff := range p.fileFetchers() {
+		if ff.modified() {
+			return true
+		}
+	}
+	return false
+}
+
 // Update updates and cache policy data
 func (p *policyd) Update(ctx context.Context) error {
+	return p.update(ctx, 0)
+}
+
+// update fetches the policies of all the domains, at most fetchConcurrency at once, and swaps the policy cache.
+// Each domain is fetched at a random offset within the spread from the start, so the update takes up to the spread.
+func (p *policyd) update(ctx context.Context, spread time.Duration) error {
 	glg.Get().DisableColor()
 	jobID := fastime.Now().Unix()
 	glg.Infof("[%d] will update policy", jobID)
 	eg := errgroup.Group{}
+	if p.fetchConcurrency > 0 {
+		eg.SetLimit(p.fetchConcurrency)
+	}
 	rp := gache.New[[]*Assertion]()
+	cc := p.cacheConfig()
+	fetched := new(sync.Map)
 
-	for _, fetcher := range p.fetchers {
-		f := fetcher // for closure
+	p.swapMu.Lock()
+	gen := p.refreshGen
+	p.swapMu.Unlock()
+
+	start := fastime.Now()
+	for _, fs := range spreadFetchers(p.fetchers, spread) {
+		f := fs.fetcher // for closure
+		if err := sleep(ctx, time.Until(start.Add(fs.offset))); err != nil {
+			glg.Info("Update policy interrupted")
+			return err
+		}
 		select {
 		case <-ctx.Done():
 			glg.Info("Update policy interrupted")
@@ -171,7 +364,11 @@ func (p *policyd) Update(ctx context.Context) error {
 					glg.Info("Update policy interrupted")
 					return ctx.Err()
 				default:
-					return fetchAndCachePolicy(ctx, rp, f)
+					sp, err := fetchAndCachePolicy(ctx, rp, f, cc)
+					if err == nil {
+						fetched.Store(f.Domain(), newFetchedPolicy(f, sp))
+					}
+					return err
 				}
 			})
 		}
@@ -182,12 +379,69 @@ func (p *policyd) Update(ctx context.Context) error {
 		return err
 	}
 
-	rp.StartExpired(ctx, p.purgePeriod).
-		EnableExpiredHook().
+	p.swapMu.Lock()
+	p.keepRefreshedPolicies(ctx, rp, fetched, gen)
+	p.swapRolePolicies(rp, cc, fetched)
+	p.swapMu.Unlock()
+
+	glg.Infof("[%d] update policy done", jobID)
+	return nil
+}
+
+// keepRefreshedPolicies replaces the policies of the domains refreshed after the generation in the new policy cache with the current ones,
+// so that the update started before Refresh does not bring back the older policies.
+// The caller must hold swapMu.
+func (p *policyd) keepRefreshedPolicies(ctx context.Context, rp gache.Gache[[]*Assertion], fetched *sync.Map, gen uint64) {
+	refreshed := make(map[string]struct{})
+	for domain, g := range p.refreshGens {
+		if g > gen {
+			refreshed[domain] = struct{}{}
+			fetched.Delete(domain)
+		}
+	}
+	if len(refreshed) == 0 {
+		return
+	}
+	glg.Infof("keep the policies refreshed during the update, domains: %v", refreshed)
+
+	isRefreshed := func(domain string) bool {
+		_, ok := refreshed[domain]
+		return ok
+	}
+	for key := range rp.ToRawMap(ctx) {
+		if isRefreshed(policyKeyDomain(key)) {
+			rp.Delete(key)
+		}
+	}
+	copyRolePolicies(ctx, rp, p.loadRolePolicies(), isRefreshed)
+}
+
+// swapRolePolicies makes the new policy cache effective, and stores the fetched policies of the domains, i.e. map[<domain>]*fetchedPolicy.
+// The caller must hold swapMu.
+// The expiry janitor of the new cache runs on the context of Start instead of the caller's one, e.g. the request context of Refresh,
+// since the cache is used after the caller returns.
+func (p *policyd) swapRolePolicies(rp gache.Gache[[]*Assertion], cc cacheConfig, fetched *sync.Map) {
+	ctx := p.daemonCtx
+	if ctx == nil {
+		// Start is not called yet, the janitor is stopped on the next swap
+		ctx = context.Background()
+	}
+	// the hook is set before starting the janitor, which reads the hook concurrently
+	rp.EnableExpiredHook().
 		SetExpiredHook(func(ctx context.Context, key string, v []*Assertion) {
 			// key = <domain>:role.<role>
-			fetchAndCachePolicy(ctx, *(p.rolePolicies), p.fetchers[strings.Split(key, ":role.")[0]])
-		})
+			domain := strings.Split(key, ":role.")[0]
+			f, ok := p.fetchers[domain]
+			if !ok || f == nil {
+				// e.g. the imported policy of the domain not in the target domains, it just expires
+				glg.Debugf("no fetcher to refetch the expired policy, key: %s", key)
+				return
+			}
+			if sp, err := fetchAndCachePolicy(ctx, *(p.rolePolicies), f, cc); err == nil {
+				p.storeFetchedPolicy(domain, newFetchedPolicy(f, sp))
+			}
+		}).
+		StartExpired(ctx, p.purgePeriod)
 
 	// swap pointer
 	glg.DebugFunc(func() string {
@@ -200,12 +454,13 @@ func (p *policyd) Update(ctx context.Context) error {
 		return fmt.Sprintf("cache after swap, old: %p %v; new: %p %v", *p.rolePolicies, (*p.rolePolicies).Len(), *oldRpPtr, (*oldRpPtr).Len())
 	})
 	(*oldRpPtr).Stop()
+	fetched.Range(func(k, v interface{}) bool {
+		p.storeFetchedPolicy(k.(string), v.(*fetchedPolicy))
+		return true
+	})
 
 	// prevent old cache cleanup, old pointer may be cached in other policy checking goroutine, leave clear up to GC
 	// (*oldRpPtr).Clear()
-
-	glg.Infof("[%d] update policy done", jobID)
-	return nil
 }
 
 // CheckPolicy checks the specified request has privilege to access the resources or not.
@@ -219,7 +474,61 @@ func (p *policyd) CheckPolicy(ctx context.Context, domain string, roles []string
 // CheckPolicyRoles checks the specified request has privilege to access the resources or not returning the allowedRoles
 // and err. If err is nil then the request is allowed, otherwise the request is rejected.
 // Only action and resource is supporting wildcard, domain and role is not supporting wildcard.
+// If cross domain resource is enabled, the resource may be qualified by the domain as <domain>:<resource>,
+// and only the assertions of the given domain are still used for the decision.
+// The assertions of the roles are combined by the combining algorithm of the domain, deny-overrides by default.
+// If the policy of the domain is expired beyond the stale grace period, ErrDomainExpired is returned,
+// or the expired policy is still evaluated if fail-open is enabled.
+// If fail-open is enabled and no policy of the target domain is available, all the roles are allowed.
+// The local assertions of the principal on the context, see WithPrincipal, are checked before all the roles.
 func (p *policyd) CheckPolicyRoles(ctx context.Context, domain string, roles []string, action, resource string) ([]string, error) {
+	if err := p.checkPrincipal(ctx, domain, action, resource); err != nil {
+		return nil, err
+	}
+	now := fastime.Now()
+	if err := p.checkStale(domain, now); err != nil {
+		if !p.staleFailOpen {
+			p.warnExpiry(domain, now, "deny on stale policy, domain: %s, error: %v", domain, err)
+			glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, result: %v", domain, roles, action, resource, err)
+			return nil, err
+		}
+		// the expired policy is kept in the policy cache, see simplifyAndCachePolicy
+		p.warnExpiry(domain, now, "fail open on stale policy, evaluating the expired policy, domain: %s, error: %v", domain, err)
+	} else if p.staleFailOpen && p.isPolicyUnavailable(domain) {
+		// the local assertions of the roles, e.g. the break-glass deny, are applied even without the policy
+		if _, err := p.checkPolicyRoles(ctx, nil, domain, roles, action, resource); err != nil && !errors.Is(err, ErrNoMatch) {
+			return nil, err
+		}
+		p.warnExpiry(domain, now, "fail open without policy, domain: %s", domain)
+		glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, result: fail open without policy", domain, roles, action, resource)
+		return roles, nil
+	}
+	return p.checkPolicyRoles(ctx, p.loadRolePolicies(), domain, roles, action, resource)
+}
+
+// checkPrincipal returns the deny error if any local assertion of the principal on the context matches the request
+func (p *policyd) checkPrincipal(ctx context.Context, domain, action, resource string) error {
+	prn := PrincipalFromContext(ctx)
+	las := p.localAssertions.getPrincipal(domain, prn)
+	if len(las) == 0 {
+		return nil
+	}
+	resDomain, res := p.resourceDomain(domain, resource)
+	for _, la := range las {
+		if p.matchAssertion(la.assertion, resDomain, action, res) {
+			glg.Infof("local assertion matched, domain: %s, principal: %s, action: %s, resource: %s:%s, effect: %s, reason: %s", domain, prn, action, resDomain, res, la.Effect, la.Reason)
+			return la.assertion.Effect
+		}
+	}
+	return nil
+}
+
+// checkPolicyRoles checks the specified request against the given role policies cache.
+// If the cache is nil, only the local assertions are evaluated.
+func (p *policyd) checkPolicyRoles(ctx context.Context, rp gache.Gache[[]*Assertion], domain string, roles []string, action, resource string) ([]string, error) {
+
+	resDomain, res := p.resourceDomain(domain, resource)
+	alg := p.combiningAlgorithm(domain)
 
 	ech := make(chan roleEffect, len(roles))
 	cctx, cancel := context.WithCancel(ctx)
@@ -231,11 +540,7 @@ func (p *policyd) CheckPolicyRoles(ctx context.Context, domain string, roles []s
 		wg := new(sync.WaitGroup)
 		wg.Add(len(roles))
 
-		curRpPtrPtr := (*unsafe.Pointer)(unsafe.Pointer(&p.rolePolicies))
-		rp := *(*gache.Gache[[]*Assertion])(atomic.LoadPointer(curRpPtrPtr))
-
 		for _, role := range roles {
-			dr := fmt.Sprintf("%s:role.%s", domain, role)
 			go func(role string, ch chan<- roleEffect) {
 				defer wg.Done()
 				select {
@@ -243,26 +548,8 @@ func (p *policyd) CheckPolicyRoles(ctx context.Context, domain string, roles []s
 					ch <- roleEffect{Role: role, Effect: cctx.Err()}
 					return
 				default:
-					asss, ok := rp.Get(dr)
-					if !ok {
-						return
-					}
-
-					for _, ass := range asss {
-						glg.Debugf("Checking policy domain: %s, role: %v, action: %s, resource: %s, assertion: %v", domain, roles, action, resource, ass)
-						select {
-						case <-cctx.Done():
-							ch <- roleEffect{Role: role, Effect: cctx.Err()}
-							return
-						default:
-							// deny policies come first in rolePolicies, so it will return first before allow policies is checked
-							if strings.EqualFold(ass.ResourceDomain, domain) &&
-								ass.ActionRegexp.MatchString(strings.ToLower(action)) &&
-								ass.ResourceRegexp.MatchString(strings.ToLower(resource)) {
-								ch <- roleEffect{Role: role, Effect: ass.Effect}
-								return
-							}
-						}
+					if re, ok := p.evaluateRole(cctx, rp, alg, domain, role, resDomain, action, res); ok {
+						ch <- re
 					}
 				}
 			}(role, ech)
@@ -270,37 +557,90 @@ func (p *policyd) CheckPolicyRoles(ctx context.Context, domain string, roles []s
 		wg.Wait()
 	}()
 
-	allowedRoles := make([]string, 0, len(roles))
+	effects := make([]roleEffect, 0, len(roles))
 	for re := range ech {
-		if re.Effect != nil { // denied assertion is prioritize, so return directly
+		if re.Effect != nil && alg == DenyOverrides { // denied assertion is prioritize, so return directly
 			glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, result: %v", domain, roles, action, resource, re.Effect)
 			return nil, re.Effect
 		}
-		allowedRoles = append(allowedRoles, re.Role)
+		effects = append(effects, re)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	allowedRoles, err := combineRoleEffects(alg, effects)
+	glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, algorithm: %s, result: %v", domain, roles, action, resource, alg, err)
+	return allowedRoles, err
+}
+
+// resourceDomain returns the domain of the resource and the resource without the domain.
+// If cross domain resource is enabled, the resource may be qualified by the domain as <domain>:<resource>,
+// otherwise the resource belongs to the token domain.
+func (p *policyd) resourceDomain(domain, resource string) (string, string) {
+	if p.crossDomainResource {
+		if dr := strings.SplitN(resource, ":", 2); len(dr) == 2 {
+			return dr[0], dr[1]
+		}
 	}
-	if len(allowedRoles) > 0 {
-		glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, result: %v", domain, roles, action, resource, nil)
-		return allowedRoles, nil
+	return domain, resource
+}
+
+// matchAssertion checks whether the assertion matches the request.
+// The action and resource are matched in exact case only if the assertion is case-sensitive.
+func (p *policyd) matchAssertion(ass *Assertion, resourceDomain, action, resource string) bool {
+	if !ass.CaseSensitive {
+		action, resource = strings.ToLower(action), strings.ToLower(resource)
 	}
-	err := errors.Wrap(ErrNoMatch, "no match")
-	glg.Debugf("check policy domain: %s, role: %v, action: %s, resource: %s, result: %v", domain, roles, action, resource, err)
-	return nil, err
+	return strings.EqualFold(ass.ResourceDomain, resourceDomain) &&
+		ass.ActionRegexp.MatchString(action) &&
+		ass.ResourceRegexp.MatchString(resource)
 }
 
-// GetPolicyCache returns the cached role policy data
+// GetPolicyCache returns the cached role policy data.
+// The local assertions are placed before the signed assertions of the same role, marked with Assertion.Local.
 func (p *policyd) GetPolicyCache(ctx context.Context) map[string][]*Assertion {
+	m := p.loadRolePolicies().ToRawMap(ctx)
+	for key, lasss := range p.localAssertions.toRawMap() {
+		m[key] = append(lasss, m[key]...)
+	}
+	return m
+}
+
+// loadRolePolicies returns the current role policies cache
+func (p *policyd) loadRolePolicies() gache.Gache[[]*Assertion] {
 	curRpPtrPtr := (*unsafe.Pointer)(unsafe.Pointer(&p.rolePolicies))
-	rp := *(*gache.Gache[[]*Assertion])(atomic.LoadPointer(curRpPtrPtr))
-	return rp.ToRawMap(ctx)
+	return *(*gache.Gache[[]*Assertion])(atomic.LoadPointer(curRpPtrPtr))
+}
+
+// cacheConfig represents the configuration of caching the signed policy
+type cacheConfig struct {
+	caseSensitivity   caseSensitivity
+	resourceHierarchy bool          // the resources are matched by the path segments
+	gracePeriod       time.Duration // the cached assertions are kept for the grace period after the policy expiry
+}
+
+// cacheConfig returns the configuration of caching the signed policy
+func (p *policyd) cacheConfig() cacheConfig {
+	return cacheConfig{
+		caseSensitivity:   p.caseSensitivity,
+		resourceHierarchy: p.resourceHierarchy,
+		gracePeriod:       p.staleGracePeriod,
+	}
+}
+
+// newAssertion returns the Assertion object of the signed assertion with the case sensitivity and the resource matching mode
+func (cc cacheConfig) newAssertion(action, resource, effect string) (*Assertion, error) {
+	return newAssertion(action, resource, effect, cc.caseSensitivity.isCaseSensitive(action, resource), cc.resourceHierarchy)
 }
 
-func fetchAndCachePolicy(ctx context.Context, g gache.Gache[[]*Assertion], f Fetcher) error {
+// fetchAndCachePolicy fetches the policy and caches it, and returns the cached policy
+func fetchAndCachePolicy(ctx context.Context, g gache.Gache[[]*Assertion], f Fetcher, cc cacheConfig) (*SignedPolicy, error) {
 	sp, err := f.FetchWithRetry(ctx)
 	if err != nil {
 		errMsg := "fetch policy fail"
 		glg.Errorf("%s, error: %v", errMsg, err)
 		if sp == nil {
-			return errors.Wrap(err, errMsg)
+			return nil, errors.Wrap(err, errMsg)
 		}
 	}
 
@@ -309,78 +649,79 @@ func fetchAndCachePolicy(ctx context.Context, g gache.Gache[[]*Assertion], f Fet
 		return fmt.Sprintf("will merge policy, domain: %s, body: %s", f.Domain(), (string)(rawpol))
 	})
 
-	if err := simplifyAndCachePolicy(ctx, g, sp); err != nil {
+	if err := simplifyAndCachePolicy(ctx, g, sp, cc); err != nil {
 		errMsg := "simplify and cache policy fail"
 		glg.Debugf("%s, error: %v", errMsg, err)
-		return errors.Wrap(err, errMsg)
+		return nil, errors.Wrap(err, errMsg)
 	}
 
-	return nil
+	return sp, nil
 }
 
-func simplifyAndCachePolicy(ctx context.Context, rp gache.Gache[[]*Assertion], sp *SignedPolicy) error {
-	eg := errgroup.Group{}
-	assm := new(sync.Map) // assertion map
+// orderedAssertion is the assertion with the order in the signed policy
+type orderedAssertion struct {
+	*util.Assertion
+	order  int
+	policy string
+}
 
-	// simplify signed policy cache
-	for _, policy := range sp.DomainSignedPolicyData.SignedPolicyData.PolicyData.Policies {
-		pol := policy
-		eg.Go(func() error {
-			for _, ass := range pol.Assertions {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-					km := fmt.Sprintf("%s,%s,%s", ass.Role, ass.Action, ass.Resource)
-					if _, ok := assm.Load(km); !ok {
-						assm.Store(km, ass)
-					} else {
-						// deny policy will override allow policy, and also remove duplication
-						if strings.EqualFold("deny", ass.Effect) {
-							assm.Store(km, ass)
-						}
-					}
-				}
+func simplifyAndCachePolicy(ctx context.Context, rp gache.Gache[[]*Assertion], sp *SignedPolicy, cc cacheConfig) error {
+	// simplify signed policy cache, removing the duplicated assertions of the same role, action, resource and effect.
+	// The allow and deny assertions of the same role, action and resource are both kept, and combined on evaluation.
+	assm := make(map[string]*orderedAssertion) // assertion map
+	oas := make([]*orderedAssertion, 0)
+	order := 0
+	for _, pol := range sp.DomainSignedPolicyData.SignedPolicyData.PolicyData.Policies {
+		for _, ass := range pol.Assertions {
+			select {
+			case <-ctx.Done():
+				return errors.Wrap(ctx.Err(), "error simplify and cache policy")
+			default:
+			}
+			km := fmt.Sprintf("%s,%s,%s,%s", ass.Role, ass.Action, ass.Resource, strings.ToLower(ass.Effect))
+			if _, ok := assm[km]; !ok {
+				oa := &orderedAssertion{Assertion: ass, order: order, policy: pol.Name}
+				assm[km] = oa
+				oas = append(oas, oa) // in the order of the signed policy
 			}
+			order++
+		}
+	}
 
-			return nil
-		})
+	rasss := make(map[string][]*Assertion)
+	for _, oa := range oas {
+		ass := oa.Assertion
+		a, err := cc.newAssertion(ass.Action, ass.Resource, ass.Effect)
+		if err != nil {
+			// skip the invalid assertion instead of failing the whole domain, see LintPolicy
+			glg.Warnf("skip invalid assertion, role: %s, action: %s, resource: %s, effect: %s, err: %v", ass.Role, ass.Action, ass.Resource, ass.Effect, err)
+			continue
+		}
+		a.Order = oa.order
+		a.Policy = oa.policy
+		rasss[ass.Role] = append(rasss[ass.Role], a)
+		glg.Debugf("added assertion to the tmp cache: %+v", ass)
 	}
 
-	if err := eg.Wait(); err != nil {
-		return errors.Wrap(err, "error simplify and cache policy")
+	if len(rasss) == 0 {
+		return nil
 	}
 
-	// cache
-	var retErr error
+	// cache, the policy expired beyond the grace period is kept until replaced, and checkStale decides whether to serve it
 	now := fastime.Now()
-	assm.Range(func(k interface{}, val interface{}) bool {
-		ass := val.(*util.Assertion)
-		a, err := NewAssertion(ass.Action, ass.Resource, ass.Effect)
-		if err != nil {
-			glg.Debugf("error adding assertion to the cache, err: %v", err)
-			retErr = err
-			return false
-		}
-
-		var asss []*Assertion
-		if p, ok := rp.Get(ass.Role); ok {
-			asss = p
-			if a.Effect == nil {
-				asss = append(asss, a) // append allowed policies to the end of the slice
-			} else {
-				asss = append([]*Assertion{a}, asss...) // append denied policies to the head
-			}
-		} else {
-			asss = []*Assertion{a}
+	ttl := sp.DomainSignedPolicyData.SignedPolicyData.Expires.Sub(now) + cc.gracePeriod
+	if ttl < 0 {
+		ttl = 0
+	}
+	for role, asss := range rasss {
+		if cur, ok := rp.Get(role); ok {
+			asss = append(append(make([]*Assertion, 0, len(cur)+len(asss)), cur...), asss...)
 		}
-		rp.SetWithExpire(ass.Role, asss, sp.DomainSignedPolicyData.SignedPolicyData.Expires.Sub(now))
-
-		glg.Debugf("added assertion to the tmp cache: %+v", ass)
-		return true
-	})
-	if retErr != nil {
-		return retErr
+		// denied policies come first, then allowed policies, each in the order of the signed policy
+		sort.SliceStable(asss, func(i, j int) bool {
+			return asss[i].Effect != nil && asss[j].Effect == nil
+		})
+		rp.SetWithExpire(role, asss, ttl)
 	}
 
 	return nil
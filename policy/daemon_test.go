@@ -46,6 +46,15 @@ func TestNew(t *testing.T) {
 		return cmp.Equal(x.ToRawMap(ctx), y.ToRawMap(ctx), cmpopts.EquateEmpty())
 	})
 	fetcherCmp := cmp.Comparer(func(x, y Fetcher) bool {
+		if reflect.TypeOf(x) != reflect.TypeOf(y) {
+			return false
+		}
+		if xf, ok := x.(*fileFetcher); ok {
+			return xf.path == y.(*fileFetcher).path && x.Domain() == y.Domain()
+		}
+		if xf, ok := x.(*verifiedFetcher); ok {
+			return reflect.TypeOf(xf.Fetcher) == reflect.TypeOf(y.(*verifiedFetcher).Fetcher) && x.Domain() == y.Domain()
+		}
 		return x.Domain() == y.Domain()
 	})
 	type args struct {
@@ -63,13 +72,14 @@ func TestNew(t *testing.T) {
 				opts: []Option{},
 			},
 			want: &policyd{
-				rolePolicies:  newGache(),
-				expiryMargin:  3 * time.Hour,
-				purgePeriod:   1 * time.Hour,
-				refreshPeriod: 30 * time.Minute,
-				retryDelay:    1 * time.Minute,
-				retryAttempts: 2,
-				client:        http.DefaultClient,
+				rolePolicies:    newGache(),
+				expiryMargin:    3 * time.Hour,
+				purgePeriod:     1 * time.Hour,
+				refreshPeriod:   30 * time.Minute,
+				retryDelay:      1 * time.Minute,
+				retryAttempts:   2,
+				client:          http.DefaultClient,
+				fileWatchPeriod: time.Minute,
 			},
 			wantErr: "",
 		},
@@ -79,13 +89,14 @@ func TestNew(t *testing.T) {
 				opts: []Option{WithExpiryMargin("5s")},
 			},
 			want: &policyd{
-				rolePolicies:  newGache(),
-				expiryMargin:  5 * time.Second,
-				purgePeriod:   1 * time.Hour,
-				refreshPeriod: 30 * time.Minute,
-				retryDelay:    1 * time.Minute,
-				retryAttempts: 2,
-				client:        http.DefaultClient,
+				rolePolicies:    newGache(),
+				expiryMargin:    5 * time.Second,
+				purgePeriod:     1 * time.Hour,
+				refreshPeriod:   30 * time.Minute,
+				retryDelay:      1 * time.Minute,
+				retryAttempts:   2,
+				client:          http.DefaultClient,
+				fileWatchPeriod: time.Minute,
 			},
 			wantErr: "",
 		},
@@ -95,14 +106,15 @@ func TestNew(t *testing.T) {
 				opts: []Option{WithAthenzDomains("dom1", "dom2")},
 			},
 			want: &policyd{
-				rolePolicies:  newGache(),
-				expiryMargin:  3 * time.Hour,
-				purgePeriod:   1 * time.Hour,
-				refreshPeriod: 30 * time.Minute,
-				retryDelay:    1 * time.Minute,
-				retryAttempts: 2,
-				client:        http.DefaultClient,
-				athenzDomains: []string{"dom1", "dom2"},
+				rolePolicies:    newGache(),
+				expiryMargin:    3 * time.Hour,
+				purgePeriod:     1 * time.Hour,
+				refreshPeriod:   30 * time.Minute,
+				retryDelay:      1 * time.Minute,
+				retryAttempts:   2,
+				client:          http.DefaultClient,
+				fileWatchPeriod: time.Minute,
+				athenzDomains:   []string{"dom1", "dom2"},
 				fetchers: map[string]Fetcher{
 					"dom1": &fetcher{domain: "dom1"},
 					"dom2": &fetcher{domain: "dom2"},
@@ -110,6 +122,87 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			name: "new success, domains with file fetchers",
+			args: args{
+				opts: []Option{
+					WithAthenzDomains("dom1", "dom2"),
+					WithPolicyDir("/var/zpe"),
+					WithPolicyFiles(map[string]string{"dom2": "/tmp/dom2.pol", "dom3": "/tmp/dom3.pol"}),
+				},
+			},
+			want: &policyd{
+				rolePolicies:    newGache(),
+				expiryMargin:    3 * time.Hour,
+				purgePeriod:     1 * time.Hour,
+				refreshPeriod:   30 * time.Minute,
+				retryDelay:      1 * time.Minute,
+				retryAttempts:   2,
+				client:          http.DefaultClient,
+				fileWatchPeriod: time.Minute,
+				athenzDomains:   []string{"dom1", "dom2"},
+				policyDir:       "/var/zpe",
+				policyFiles:     map[string]string{"dom2": "/tmp/dom2.pol", "dom3": "/tmp/dom3.pol"},
+				fetchers: map[string]Fetcher{
+					"dom1": &fileFetcher{domain: "dom1", path: "/var/zpe/dom1.pol"},
+					"dom2": &fileFetcher{domain: "dom2", path: "/tmp/dom2.pol"},
+					"dom3": &fileFetcher{domain: "dom3", path: "/tmp/dom3.pol"},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "new success, domains with fetcher factory",
+			args: args{
+				opts: []Option{
+					WithAthenzDomains("dom1", "dom2"),
+					WithPolicyDir("/var/zpe"),
+					WithFetcherFactory(func(domain string) Fetcher {
+						if domain != "dom1" {
+							return nil
+						}
+						return &fetcherMock{
+							domainMock: func() string {
+								return domain
+							},
+						}
+					}),
+				},
+			},
+			want: &policyd{
+				rolePolicies:    newGache(),
+				expiryMargin:    3 * time.Hour,
+				purgePeriod:     1 * time.Hour,
+				refreshPeriod:   30 * time.Minute,
+				retryDelay:      1 * time.Minute,
+				retryAttempts:   2,
+				client:          http.DefaultClient,
+				fileWatchPeriod: time.Minute,
+				athenzDomains:   []string{"dom1", "dom2"},
+				policyDir:       "/var/zpe",
+				fetchers: map[string]Fetcher{
+					"dom1": &verifiedFetcher{Fetcher: &fetcherMock{domainMock: func() string { return "dom1" }}},
+					"dom2": &fileFetcher{domain: "dom2", path: "/var/zpe/dom2.pol"},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "new fail, invalid local assertions file",
+			args: args{
+				opts: []Option{WithLocalAssertionsFile("/not/exists/local_assertions.json")},
+			},
+			want:    nil,
+			wantErr: "error create policyd: read local assertions file fail: open /not/exists/local_assertions.json: no such file or directory",
+		},
+		{
+			name: "new fail, invalid policy export file",
+			args: args{
+				opts: []Option{WithPolicyExportFile("/not/exists/policies.yaml")},
+			},
+			want:    nil,
+			wantErr: "error create policyd: open policy export file fail: open /not/exists/policies.yaml: no such file or directory",
+		},
 		{
 			name: "new fail, option error",
 			args: args{
@@ -128,7 +221,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			options := []cmp.Option{gacheCmp, fetcherCmp, cmp.AllowUnexported(policyd{}), cmpopts.EquateEmpty()}
+			options := []cmp.Option{gacheCmp, fetcherCmp, cmp.AllowUnexported(policyd{}, caseSensitivity{}), cmpopts.EquateEmpty(), cmpopts.IgnoreFields(policyd{}, "fetcherFactory", "localAssertions", "policyExpiries", "expiryWarnedAt", "swapMu", "refreshGroup", "lastPolicies", "subscribers")}
 			if !cmp.Equal(got, tt.want, options...) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
@@ -216,7 +309,7 @@ func Test_policyd_Start(t *testing.T) {
 				checkFunc: func(p *policyd, ch <-chan error) error {
 					time.Sleep(time.Millisecond * 100)
 					cancel()
-					asss, ok := (*p.rolePolicies).Get("dummyDom:role.dummyRole")
+					asss, ok := p.loadRolePolicies().Get("dummyDom:role.dummyRole")
 					if !ok {
 						return errors.New("rolePolicies is empty")
 					}
@@ -293,7 +386,7 @@ func Test_policyd_Start(t *testing.T) {
 					time.Sleep(time.Millisecond * 100)
 					cancel()
 					time.Sleep(time.Millisecond * 50)
-					asss, ok := (*p.rolePolicies).Get("dummyDom:role.dummyRole")
+					asss, ok := p.loadRolePolicies().Get("dummyDom:role.dummyRole")
 					if !ok {
 						return errors.New("rolePolicies is empty")
 					}
@@ -383,7 +476,7 @@ func Test_policyd_Start(t *testing.T) {
 					time.Sleep(time.Millisecond * 100)
 					cancel()
 					time.Sleep(time.Millisecond * 50)
-					asss, ok := (*p.rolePolicies).Get("dummyDom:role.dummyRole")
+					asss, ok := p.loadRolePolicies().Get("dummyDom:role.dummyRole")
 					if !ok {
 						return errors.New("rolePolicies is empty")
 					}
@@ -406,6 +499,77 @@ func Test_policyd_Start(t *testing.T) {
 				},
 			}
 		}(),
+		func() test {
+			domain := "dummyDom"
+			sp := &SignedPolicy{
+				util.DomainSignedPolicyData{
+					KeyId:     "dummyKeyID",
+					Signature: "dummySig",
+					SignedPolicyData: &util.SignedPolicyData{
+						ZmsKeyId:     "dummyKeyID",
+						ZmsSignature: "dummySig",
+						Modified:     &rdl.Timestamp{Time: fastime.Now()},
+						Expires:      &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+						PolicyData: &util.PolicyData{
+							Domain: "dummyDom",
+							Policies: []*util.Policy{
+								{
+									Name:     "dummyDom:policy.dummyPol",
+									Modified: &rdl.Timestamp{Time: fastime.Now()},
+									Assertions: []*util.Assertion{
+										{
+											Role:     "dummyDom:role.dummyRole",
+											Action:   "dummyAct",
+											Resource: "dummyDom:dummyRes",
+											Effect:   "ALLOW",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			fetchers := map[string]Fetcher{
+				"dummyDom": &fetcherMock{
+					domainMock: func() string { return domain },
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, nil
+					},
+				},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+
+			return test{
+				name: "Start fetches the policies not cached yet without waiting for the refresh period",
+				fields: fields{
+					rolePolicies:  newGache(),
+					purgePeriod:   time.Minute * 30,
+					refreshPeriod: time.Hour,
+					expiryMargin:  time.Hour,
+					athenzDomains: []string{domain},
+					fetchers:      fetchers,
+				},
+				args: args{
+					ctx: ctx,
+				},
+				checkFunc: func(p *policyd, ch <-chan error) error {
+					time.Sleep(time.Millisecond * 100)
+					cancel()
+					asss, ok := p.loadRolePolicies().Get("dummyDom:role.dummyRole")
+					if !ok {
+						return errors.New("rolePolicies is empty")
+					}
+					if len(asss) != 1 {
+						return errors.Errorf("invalid length assertions. want: 1, result: %d", len(asss))
+					}
+					return nil
+				},
+				afterFunc: func() {
+					cancel()
+				},
+			}
+		}(),
 	}
 
 	for _, tt := range tests {
@@ -719,9 +883,9 @@ func Test_policyd_Update(t *testing.T) {
 				return
 			}
 			gotRps := p.GetPolicyCache(context.Background())
-			if !cmp.Equal(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp")) {
+			if !cmp.Equal(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp", "Policy")) {
 				t.Errorf("policyd.Update() rolePolicies = %v, want %v", gotRps, tt.wantRps)
-				t.Errorf("policyd.Update() rolePolicies diff = %s", cmp.Diff(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp")))
+				t.Errorf("policyd.Update() rolePolicies diff = %s", cmp.Diff(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp", "Policy")))
 			}
 		})
 	}
@@ -729,14 +893,16 @@ func Test_policyd_Update(t *testing.T) {
 
 func Test_policyd_CheckPolicy(t *testing.T) {
 	type fields struct {
-		expiryMargin  time.Duration
-		rolePolicies  *gache.Gache[[]*Assertion]
-		refreshPeriod time.Duration
-		retryDelay    time.Duration
-		pkp           pubkey.Provider
-		athenzURL     string
-		athenzDomains []string
-		client        *http.Client
+		expiryMargin        time.Duration
+		rolePolicies        *gache.Gache[[]*Assertion]
+		refreshPeriod       time.Duration
+		retryDelay          time.Duration
+		pkp                 pubkey.Provider
+		athenzURL           string
+		athenzDomains       []string
+		client              *http.Client
+		localAssertions     *localAssertions
+		crossDomainResource bool
 	}
 	type args struct {
 		ctx      context.Context
@@ -1229,18 +1395,256 @@ func Test_policyd_CheckPolicy(t *testing.T) {
 			},
 			want: errors.New("no match: Access denied due to no match to any of the assertions defined in domain policy file"),
 		},
+		{
+			name: "check policy deny by local assertion",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "dummyDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					err := ls.add(&LocalAssertion{
+						Domain:   "dummyDom",
+						Role:     "dummyRole",
+						Action:   "*",
+						Resource: "dummyDom:*",
+						Effect:   "deny",
+						TTL:      "1h",
+						Reason:   "incident",
+					})
+					if err != nil {
+						panic(err)
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "dummyRes",
+			},
+			want: errors.New("policy deny: Access Check was explicitly denied"),
+		},
+		{
+			name: "check policy deny by local assertion of all roles",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "dummyDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					err := ls.add(&LocalAssertion{
+						Domain:   "dummyDom",
+						Role:     "*",
+						Action:   "dummyAct",
+						Resource: "dummyDom:dummyRes",
+						Effect:   "deny",
+					})
+					if err != nil {
+						panic(err)
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "dummyRes",
+			},
+			want: errors.New("policy deny: Access Check was explicitly denied"),
+		},
+		{
+			name: "check policy allow by local assertion without signed assertions",
+			fields: fields{
+				rolePolicies: newGache(),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					err := ls.add(&LocalAssertion{
+						Domain:   "dummyDom",
+						Role:     "dummyRole",
+						Action:   "dummyAct",
+						Resource: "dummyDom:dummyRes",
+						Effect:   "allow",
+					})
+					if err != nil {
+						panic(err)
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "dummyRes",
+			},
+			want: nil,
+		},
+		{
+			name: "check policy ignore unmatched local assertion",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "dummyDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					err := ls.add(&LocalAssertion{
+						Domain:   "dummyDom",
+						Role:     "otherRole",
+						Action:   "*",
+						Resource: "dummyDom:*",
+						Effect:   "deny",
+					})
+					if err != nil {
+						panic(err)
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "dummyRes",
+			},
+			want: nil,
+		},
+		{
+			name: "check policy cross domain resource allow",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "otherDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				crossDomainResource: true,
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "otherDom:dummyRes",
+			},
+			want: nil,
+		},
+		{
+			name: "check policy cross domain resource, unqualified resource belongs to the token domain",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "otherDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				crossDomainResource: true,
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "dummyRes",
+			},
+			want: errors.New("no match: Access denied due to no match to any of the assertions defined in domain policy file"),
+		},
+		{
+			name: "check policy cross domain resource, only the assertions of the token domain are used",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "otherDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+				crossDomainResource: true,
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "otherDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "otherDom:dummyRes",
+			},
+			want: errors.New("no match: Access denied due to no match to any of the assertions defined in domain policy file"),
+		},
+		{
+			name: "check policy cross domain resource disabled",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("dummyDom:role.dummyRole", []*Assertion{
+						func() *Assertion {
+							a, _ := NewAssertion("dummyAct", "otherDom:dummyRes", "allow")
+							return a
+						}(),
+					})
+					return &g
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dummyDom",
+				roles:    []string{"dummyRole"},
+				action:   "dummyAct",
+				resource: "otherDom:dummyRes",
+			},
+			want: errors.New("no match: Access denied due to no match to any of the assertions defined in domain policy file"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &policyd{
-				expiryMargin:  tt.fields.expiryMargin,
-				rolePolicies:  tt.fields.rolePolicies,
-				refreshPeriod: tt.fields.refreshPeriod,
-				retryDelay:    tt.fields.retryDelay,
-				pkp:           tt.fields.pkp,
-				athenzURL:     tt.fields.athenzURL,
-				athenzDomains: tt.fields.athenzDomains,
-				client:        tt.fields.client,
+				expiryMargin:        tt.fields.expiryMargin,
+				rolePolicies:        tt.fields.rolePolicies,
+				refreshPeriod:       tt.fields.refreshPeriod,
+				retryDelay:          tt.fields.retryDelay,
+				pkp:                 tt.fields.pkp,
+				athenzURL:           tt.fields.athenzURL,
+				athenzDomains:       tt.fields.athenzDomains,
+				client:              tt.fields.client,
+				localAssertions:     tt.fields.localAssertions,
+				crossDomainResource: tt.fields.crossDomainResource,
 			}
 			err := p.CheckPolicy(tt.args.ctx, tt.args.domain, tt.args.roles, tt.args.action, tt.args.resource)
 			if err == nil {
@@ -1516,7 +1920,7 @@ func Test_fetchAndCachePolicy(t *testing.T) {
 			return t
 		}(),
 		func() (t test) {
-			t.name = "simplifyAndCache failed, error"
+			t.name = "invalid assertion skipped"
 
 			// dummy values
 			domain := "dummyDom"
@@ -1538,22 +1942,22 @@ func Test_fetchAndCachePolicy(t *testing.T) {
 			}
 
 			// want
-			t.wantErr = "simplify and cache policy fail: assertion format not correct: Access denied due to invalid/empty policy resources"
+			t.wantErr = ""
 			t.wantRps = make(map[string][]*Assertion)
 			return t
 		}(),
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := fetchAndCachePolicy(tt.args.ctx, *tt.args.g, tt.args.f)
+			_, err := fetchAndCachePolicy(tt.args.ctx, *tt.args.g, tt.args.f, cacheConfig{})
 			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
 				t.Errorf("fetchAndCachePolicy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			gotRps := (*tt.args.g).ToRawMap(context.Background())
-			if !cmp.Equal(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp")) {
+			if !cmp.Equal(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp", "Policy")) {
 				t.Errorf("fetchAndCachePolicy() g = %v, want %v", gotRps, tt.wantRps)
-				t.Errorf("fetchAndCachePolicy() g diff = %s", cmp.Diff(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp")))
+				t.Errorf("fetchAndCachePolicy() g diff = %s", cmp.Diff(gotRps, tt.wantRps, cmpopts.IgnoreFields(Assertion{}, "ActionRegexp", "ResourceRegexp", "Policy")))
 			}
 		})
 	}
@@ -1574,6 +1978,8 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 
 	checkAssertion := func(got *Assertion, action, res, eff string) error {
 		want, _ := NewAssertion(action, res, eff)
+		want.Order = got.Order   // the order is checked in Test_simplifyAndCachePolicy_order
+		want.Policy = got.Policy // the policy name is checked in Test_simplifyAndCachePolicy_order
 		if !reflect.DeepEqual(got, want) {
 			return errors.Errorf("got: %v, want: %v", got, want)
 		}
@@ -1810,12 +2216,16 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 					if !ok {
 						return errors.New("cannot simplify and cache data")
 					}
+					// the duplications are removed, and the deny policy comes first to be combined on evaluation
 					gotAsss1 := gotRp1
-					if len(gotAsss1) != 1 {
-						return errors.Errorf("invalid length asss 1, got: %v", gotAsss1)
+					if len(gotAsss1) != 2 {
+						return errors.Errorf("invalid length asss 2, got: %v", gotAsss1)
+					}
+					if gotAsss1[0].Effect == nil || gotAsss1[0].Order != 2 {
+						return errors.Errorf("Deny policy is not prioritized, got: %+v", gotAsss1[0])
 					}
-					if gotAsss1[0].Effect == nil {
-						return errors.Errorf("Deny policy did not overwrite allow policy")
+					if gotAsss1[1].Effect != nil || gotAsss1[1].Order != 0 {
+						return errors.Errorf("Allow policy is not the first one, got: %+v", gotAsss1[1])
 					}
 
 					return nil
@@ -1850,10 +2260,12 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 			}
 		}(),
 		func() test {
+			rp := gache.New[[]*Assertion]()
 			return test{
-				name: "cache failed with invalid assertion",
+				name: "cache skips invalid assertion",
 				args: args{
 					ctx: context.Background(),
+					rp:  rp,
 					sp: &SignedPolicy{
 						util.DomainSignedPolicyData{
 							SignedPolicyData: &util.SignedPolicyData{
@@ -1865,11 +2277,17 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 										{
 											Assertions: []*util.Assertion{
 												{
-													Role:     "dummyRole",
+													Role:     "dummyDom:role.dummyRole",
 													Action:   "dummyAct",
 													Resource: "dummyRes",
 													Effect:   "allow",
 												},
+												{
+													Role:     "dummyDom:role.dummyRole",
+													Action:   "dummyAct",
+													Resource: "dummyDom:dummyRes",
+													Effect:   "allow",
+												},
 											},
 										},
 									},
@@ -1878,7 +2296,14 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 						},
 					},
 				},
-				wantErr: true,
+				checkFunc: func() error {
+					asss, ok := rp.Get("dummyDom:role.dummyRole")
+					if !ok || len(asss) != 1 {
+						return errors.Errorf("invalid assertion should be skipped, role policies: %v", rp.ToRawMap(context.Background()))
+					}
+					return nil
+				},
+				wantErr: false,
 			}
 		}(),
 		func() test {
@@ -2223,7 +2648,7 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := simplifyAndCachePolicy(tt.args.ctx, tt.args.rp, tt.args.sp); (err != nil) != tt.wantErr {
+			if err := simplifyAndCachePolicy(tt.args.ctx, tt.args.rp, tt.args.sp, cacheConfig{}); (err != nil) != tt.wantErr {
 				t.Errorf("simplifyAndCachePolicy() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if tt.checkFunc != nil {
@@ -2235,17 +2660,80 @@ func Test_simplifyAndCachePolicy(t *testing.T) {
 	}
 }
 
+func Test_policyd_resourceDomain(t *testing.T) {
+	type fields struct {
+		crossDomainResource bool
+	}
+	type args struct {
+		domain   string
+		resource string
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		wantDomain string
+		wantRes    string
+	}{
+		{
+			name: "disabled, qualified resource",
+			args: args{
+				domain:   "dom",
+				resource: "other:res",
+			},
+			wantDomain: "dom",
+			wantRes:    "other:res",
+		},
+		{
+			name: "enabled, qualified resource",
+			fields: fields{
+				crossDomainResource: true,
+			},
+			args: args{
+				domain:   "dom",
+				resource: "other:res:sub",
+			},
+			wantDomain: "other",
+			wantRes:    "res:sub",
+		},
+		{
+			name: "enabled, unqualified resource",
+			fields: fields{
+				crossDomainResource: true,
+			},
+			args: args{
+				domain:   "dom",
+				resource: "res",
+			},
+			wantDomain: "dom",
+			wantRes:    "res",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				crossDomainResource: tt.fields.crossDomainResource,
+			}
+			gotDomain, gotRes := p.resourceDomain(tt.args.domain, tt.args.resource)
+			if gotDomain != tt.wantDomain || gotRes != tt.wantRes {
+				t.Errorf("policyd.resourceDomain() = %v, %v, want %v, %v", gotDomain, gotRes, tt.wantDomain, tt.wantRes)
+			}
+		})
+	}
+}
+
 func Test_policyd_GetPolicyCache(t *testing.T) {
 	type fields struct {
-		expiryMargin  time.Duration
-		rolePolicies  *gache.Gache[[]*Assertion]
-		purgePeriod   time.Duration
-		refreshPeriod time.Duration
-		retryDelay    time.Duration
-		pkp           pubkey.Provider
-		athenzURL     string
-		athenzDomains []string
-		client        *http.Client
+		expiryMargin    time.Duration
+		rolePolicies    *gache.Gache[[]*Assertion]
+		purgePeriod     time.Duration
+		refreshPeriod   time.Duration
+		retryDelay      time.Duration
+		pkp             pubkey.Provider
+		athenzURL       string
+		athenzDomains   []string
+		client          *http.Client
+		localAssertions *localAssertions
 	}
 	type args struct {
 		ctx context.Context
@@ -2313,19 +2801,75 @@ func Test_policyd_GetPolicyCache(t *testing.T) {
 			},
 			want: make(map[string][]*Assertion),
 		},
+		{
+			name: "get policy cache with local assertions success",
+			fields: fields{
+				rolePolicies: func() *gache.Gache[[]*Assertion] {
+					g := gache.New[[]*Assertion]()
+					g.Set("domain:role.role", []*Assertion{
+						{
+							Action:   "action",
+							Resource: "resource",
+						},
+					})
+					return &g
+				}(),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					ls.asss["domain:role.role"] = []*localAssertion{
+						{
+							LocalAssertion: &LocalAssertion{},
+							assertion: &Assertion{
+								Action:   "local-action",
+								Resource: "local-resource",
+								Local:    true,
+							},
+						},
+						{
+							LocalAssertion: &LocalAssertion{
+								ExpiresAt: time.Unix(1, 0),
+							},
+							assertion: &Assertion{
+								Action:   "expired-action",
+								Resource: "expired-resource",
+								Local:    true,
+							},
+						},
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: map[string][]*Assertion{
+				"domain:role.role": {
+					{
+						Action:   "local-action",
+						Resource: "local-resource",
+						Local:    true,
+					},
+					{
+						Action:   "action",
+						Resource: "resource",
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &policyd{
-				expiryMargin:  tt.fields.expiryMargin,
-				rolePolicies:  tt.fields.rolePolicies,
-				purgePeriod:   tt.fields.purgePeriod,
-				refreshPeriod: tt.fields.refreshPeriod,
-				retryDelay:    tt.fields.retryDelay,
-				pkp:           tt.fields.pkp,
-				athenzURL:     tt.fields.athenzURL,
-				athenzDomains: tt.fields.athenzDomains,
-				client:        tt.fields.client,
+				expiryMargin:    tt.fields.expiryMargin,
+				rolePolicies:    tt.fields.rolePolicies,
+				purgePeriod:     tt.fields.purgePeriod,
+				refreshPeriod:   tt.fields.refreshPeriod,
+				retryDelay:      tt.fields.retryDelay,
+				pkp:             tt.fields.pkp,
+				athenzURL:       tt.fields.athenzURL,
+				athenzDomains:   tt.fields.athenzDomains,
+				client:          tt.fields.client,
+				localAssertions: tt.fields.localAssertions,
 			}
 			if got := p.GetPolicyCache(tt.args.ctx); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("policyd.GetPolicyCache() = %+v, want %v", got, tt.want)
@@ -2333,3 +2877,77 @@ func Test_policyd_GetPolicyCache(t *testing.T) {
 		})
 	}
 }
+
+func Test_policyd_CheckPolicyRoles_caseSensitive(t *testing.T) {
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				Expires: &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+				PolicyData: &util.PolicyData{
+					Domain: "dom",
+					Policies: []*util.Policy{
+						{
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:Bucket/Key", Effect: "allow"},
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	type args struct {
+		action   string
+		resource string
+	}
+	tests := []struct {
+		name    string
+		cs      caseSensitivity
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "case-insensitive",
+			args: args{action: "READ", resource: "bucket/key"},
+		},
+		{
+			name:    "case-sensitive, different case",
+			cs:      caseSensitivity{all: true},
+			args:    args{action: "read", resource: "bucket/key"},
+			wantErr: true,
+		},
+		{
+			name: "case-sensitive, exact case",
+			cs:   caseSensitivity{all: true},
+			args: args{action: "read", resource: "Bucket/Key"},
+		},
+		{
+			name:    "detected case-sensitive, different case",
+			cs:      caseSensitivity{detect: true},
+			args:    args{action: "read", resource: "bucket/key"},
+			wantErr: true,
+		},
+		{
+			name: "detected case-insensitive, different case",
+			cs:   caseSensitivity{detect: true},
+			args: args{action: "READ", resource: "DOC"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := gache.New[[]*Assertion]()
+			if err := simplifyAndCachePolicy(context.Background(), rp, sp, cacheConfig{caseSensitivity: tt.cs}); err != nil {
+				t.Fatalf("simplifyAndCachePolicy() error = %v", err)
+			}
+			p := &policyd{
+				rolePolicies:    &rp,
+				caseSensitivity: tt.cs,
+			}
+			_, err := p.CheckPolicyRoles(context.Background(), "dom", []string{"reader"}, tt.args.action, tt.args.resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("policyd.CheckPolicyRoles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
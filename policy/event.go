@@ -0,0 +1,222 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/kpango/glg"
+)
+
+// PolicyEvent represents the change of the signed policy of a domain, delivered after the new policy becomes effective.
+// On the first fetch of the domain, OldExpires is zero and all the assertions are added.
+type PolicyEvent struct {
+	Domain     string        `json:"domain"`
+	ETag       string        `json:"etag,omitempty"`
+	OldExpires time.Time     `json:"old_expires"`
+	NewExpires time.Time     `json:"new_expires"`
+	Roles      []*RoleChange `json:"roles"`
+}
+
+// RoleChange represents the changed assertions of a role. The assertion with the same action and resource but a different effect is changed.
+type RoleChange struct {
+	Role    string             `json:"role"`
+	Added   []*util.Assertion  `json:"added,omitempty"`
+	Removed []*util.Assertion  `json:"removed,omitempty"`
+	Changed []*AssertionChange `json:"changed,omitempty"`
+}
+
+// AssertionChange represents the assertion of which the effect is changed.
+type AssertionChange struct {
+	Old *util.Assertion `json:"old"`
+	New *util.Assertion `json:"new"`
+}
+
+// ETagFetcher is the Fetcher reporting the ETag of the last fetched policy, which is set to PolicyEvent.
+type ETagFetcher interface {
+	Fetcher
+	ETag() string
+}
+
+// fetchedPolicy is the signed policy fetched by the Fetcher with its ETag
+type fetchedPolicy struct {
+	sp   *SignedPolicy
+	eTag string
+}
+
+func newFetchedPolicy(f Fetcher, sp *SignedPolicy) *fetchedPolicy {
+	if v, ok := f.(*verifiedFetcher); ok {
+		f = v.Fetcher
+	}
+	fp := &fetchedPolicy{sp: sp}
+	if ef, ok := f.(ETagFetcher); ok {
+		fp.eTag = ef.ETag()
+	}
+	return fp
+}
+
+// Subscribe returns the channel delivering the policy change events, which is closed when the context is done.
+// The events are dropped if the channel buffer is full, so the subscriber should receive them without blocking.
+func (p *policyd) Subscribe(ctx context.Context) <-chan *PolicyEvent {
+	return p.subscribers.Subscribe(ctx)
+}
+
+// storeFetchedPolicy stores the expiry of the fetched policy, and publishes the event if the policy is changed from the previous one
+func (p *policyd) storeFetchedPolicy(domain string, fp *fetchedPolicy) {
+	p.storePolicyExpiry(domain, fp.sp.SignedPolicyData.Expires.Time)
+
+	prev, loaded := p.lastPolicies.Swap(domain, fp.sp)
+	var old *SignedPolicy
+	if loaded {
+		old = prev.(*SignedPolicy)
+	}
+	if old == fp.sp {
+		// e.g. the cached policy on 304 Not Modified
+		return
+	}
+	if ev := diffPolicy(domain, old, fp.sp); ev != nil {
+		ev.ETag = fp.eTag
+		p.publish(ev)
+	}
+}
+
+func (p *policyd) publish(ev *PolicyEvent) {
+	if p.subscribers.Publish(ev) > 0 {
+		glg.Warnf("policy event queue already full, event dropped, domain: %s", ev.Domain)
+	}
+}
+
+// diffPolicy returns the event of the changes from the old policy to the new one, or nil if nothing is changed
+func diffPolicy(domain string, old, cur *SignedPolicy) *PolicyEvent {
+	ev := &PolicyEvent{
+		Domain:     domain,
+		OldExpires: policyExpires(old),
+		NewExpires: policyExpires(cur),
+		Roles:      make([]*RoleChange, 0),
+	}
+
+	olds, curs := roleAssertions(old), roleAssertions(cur)
+	roles := make([]string, 0, len(curs))
+	for role := range curs {
+		roles = append(roles, role)
+	}
+	for role := range olds {
+		if _, ok := curs[role]; !ok {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		rc := diffRoleAssertions(role, olds[role], curs[role])
+		if len(rc.Added) != 0 || len(rc.Removed) != 0 || len(rc.Changed) != 0 {
+			ev.Roles = append(ev.Roles, rc)
+		}
+	}
+
+	if len(ev.Roles) == 0 && ev.OldExpires.Equal(ev.NewExpires) {
+		return nil
+	}
+	return ev
+}
+
+// diffRoleAssertions returns the changes of the assertions of the role.
+// The assertion of which only the effect is replaced, i.e. removed and added with the same action and resource, is changed.
+func diffRoleAssertions(role string, oas, cas map[string]*util.Assertion) *RoleChange {
+	rc := &RoleChange{Role: role}
+	var added, removed []*util.Assertion
+	for _, key := range sortedKeys(cas) {
+		if _, ok := oas[key]; !ok {
+			added = append(added, cas[key])
+		}
+	}
+	for _, key := range sortedKeys(oas) {
+		if _, ok := cas[key]; !ok {
+			removed = append(removed, oas[key])
+		}
+	}
+
+	changed := make(map[*util.Assertion]struct{})
+	for _, ca := range added {
+		for _, oa := range removed {
+			if _, ok := changed[oa]; !ok && oa.Action == ca.Action && oa.Resource == ca.Resource {
+				rc.Changed = append(rc.Changed, &AssertionChange{Old: oa, New: ca})
+				changed[oa], changed[ca] = struct{}{}, struct{}{}
+				break
+			}
+		}
+	}
+	for _, ca := range added {
+		if _, ok := changed[ca]; !ok {
+			rc.Added = append(rc.Added, ca)
+		}
+	}
+	for _, oa := range removed {
+		if _, ok := changed[oa]; !ok {
+			rc.Removed = append(rc.Removed, oa)
+		}
+	}
+	return rc
+}
+
+func policyExpires(sp *SignedPolicy) time.Time {
+	if sp == nil || sp.SignedPolicyData == nil || sp.SignedPolicyData.Expires == nil {
+		return time.Time{}
+	}
+	return sp.SignedPolicyData.Expires.Time
+}
+
+// roleAssertions returns the assertions of the policy as map[<role>]map[<action>,<resource>,<effect>]*util.Assertion,
+// the allow and deny assertions of the same action and resource are both kept same as the policy cache
+func roleAssertions(sp *SignedPolicy) map[string]map[string]*util.Assertion {
+	m := make(map[string]map[string]*util.Assertion)
+	if sp == nil || sp.SignedPolicyData == nil || sp.SignedPolicyData.PolicyData == nil {
+		return m
+	}
+	for _, pol := range sp.SignedPolicyData.PolicyData.Policies {
+		if pol == nil {
+			continue
+		}
+		for _, ass := range pol.Assertions {
+			if ass == nil {
+				continue
+			}
+			asss, ok := m[ass.Role]
+			if !ok {
+				asss = make(map[string]*util.Assertion)
+				m[ass.Role] = asss
+			}
+			key := fmt.Sprintf("%s,%s,%s", ass.Action, ass.Resource, strings.ToLower(ass.Effect))
+			if _, ok := asss[key]; !ok {
+				asss[key] = ass
+			}
+		}
+	}
+	return m
+}
+
+func sortedKeys(m map[string]*util.Assertion) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
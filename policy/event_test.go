@@ -0,0 +1,220 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+)
+
+func Test_diffPolicy(t *testing.T) {
+	exp1 := &rdl.Timestamp{Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	exp2 := &rdl.Timestamp{Time: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)}
+	read := &util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "allow"}
+	write := &util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:*", Effect: "allow"}
+	writeDeny := &util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:*", Effect: "deny"}
+	secret := &util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:secret", Effect: "deny"}
+
+	tests := []struct {
+		name string
+		old  *SignedPolicy
+		cur  *SignedPolicy
+		want *PolicyEvent
+	}{
+		{
+			name: "first fetch",
+			cur:  newTestCandidate("dom", exp1, read, write),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				NewExpires: exp1.Time,
+				Roles: []*RoleChange{
+					{Role: "dom:role.reader", Added: []*util.Assertion{read}},
+					{Role: "dom:role.writer", Added: []*util.Assertion{write}},
+				},
+			},
+		},
+		{
+			name: "added, removed and changed",
+			old:  newTestCandidate("dom", exp1, read, write),
+			cur:  newTestCandidate("dom", exp2, read, secret, writeDeny),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				OldExpires: exp1.Time,
+				NewExpires: exp2.Time,
+				Roles: []*RoleChange{
+					{Role: "dom:role.reader", Added: []*util.Assertion{secret}},
+					{Role: "dom:role.writer", Changed: []*AssertionChange{{Old: write, New: writeDeny}}},
+				},
+			},
+		},
+		{
+			name: "role removed",
+			old:  newTestCandidate("dom", exp1, read, write),
+			cur:  newTestCandidate("dom", exp1, read),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				OldExpires: exp1.Time,
+				NewExpires: exp1.Time,
+				Roles: []*RoleChange{
+					{Role: "dom:role.writer", Removed: []*util.Assertion{write}},
+				},
+			},
+		},
+		{
+			name: "expires only",
+			old:  newTestCandidate("dom", exp1, read),
+			cur:  newTestCandidate("dom", exp2, read),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				OldExpires: exp1.Time,
+				NewExpires: exp2.Time,
+				Roles:      []*RoleChange{},
+			},
+		},
+		{
+			name: "allow added next to the deny of the same action and resource",
+			old:  newTestCandidate("dom", exp1, writeDeny),
+			cur:  newTestCandidate("dom", exp1, write, writeDeny),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				OldExpires: exp1.Time,
+				NewExpires: exp1.Time,
+				Roles: []*RoleChange{
+					{Role: "dom:role.writer", Added: []*util.Assertion{write}},
+				},
+			},
+		},
+		{
+			name: "deny removed next to the allow of the same action and resource",
+			old:  newTestCandidate("dom", exp1, write, writeDeny),
+			cur:  newTestCandidate("dom", exp1, write),
+			want: &PolicyEvent{
+				Domain:     "dom",
+				OldExpires: exp1.Time,
+				NewExpires: exp1.Time,
+				Roles: []*RoleChange{
+					{Role: "dom:role.writer", Removed: []*util.Assertion{writeDeny}},
+				},
+			},
+		},
+		{
+			name: "not changed",
+			old:  newTestCandidate("dom", exp1, read, write),
+			cur:  newTestCandidate("dom", exp1, write, read),
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffPolicy("dom", tt.old, tt.cur); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyd_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &policyd{}
+	ch := p.Subscribe(ctx)
+
+	exp := &rdl.Timestamp{Time: time.Now().Add(time.Hour)}
+	sp1 := newTestCandidate("dom", exp, &util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "allow"})
+	sp2 := newTestCandidate("dom", exp, &util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "deny"})
+
+	p.storeFetchedPolicy("dom", &fetchedPolicy{sp: sp1, eTag: `"etag1"`})
+	// not modified
+	p.storeFetchedPolicy("dom", &fetchedPolicy{sp: sp1, eTag: `"etag1"`})
+	p.storeFetchedPolicy("dom", &fetchedPolicy{sp: sp2, eTag: `"etag2"`})
+
+	for _, want := range []struct {
+		eTag  string
+		added int
+		chgd  int
+	}{
+		{eTag: `"etag1"`, added: 1},
+		{eTag: `"etag2"`, chgd: 1},
+	} {
+		select {
+		case ev := <-ch:
+			if ev.Domain != "dom" || ev.ETag != want.eTag || len(ev.Roles) != 1 ||
+				len(ev.Roles[0].Added) != want.added || len(ev.Roles[0].Changed) != want.chgd {
+				t.Errorf("Subscribe() event = %+v, want %+v", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subscribe() event not delivered")
+		}
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("Subscribe() unexpected event = %+v", ev)
+	default:
+	}
+	if got := p.GetPolicyExpiries(ctx)["dom"]; !got.Equal(exp.Time) {
+		t.Errorf("storeFetchedPolicy() expiry = %v, want %v", got, exp.Time)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Subscribe() channel not closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Subscribe() channel not closed")
+	}
+}
+
+func Test_newFetchedPolicy(t *testing.T) {
+	sp := &SignedPolicy{}
+	tests := []struct {
+		name     string
+		f        Fetcher
+		wantETag string
+	}{
+		{
+			name:     "fetcher",
+			f:        &fetcher{policyCache: unsafe.Pointer(&taggedPolicy{eTag: `"etag"`})},
+			wantETag: `"etag"`,
+		},
+		{
+			name:     "verified fetcher",
+			f:        &verifiedFetcher{Fetcher: &fetcher{policyCache: unsafe.Pointer(&taggedPolicy{eTag: `"etag"`})}},
+			wantETag: `"etag"`,
+		},
+		{
+			name: "fetcher without cache",
+			f:    &fetcher{},
+		},
+		{
+			name: "file fetcher",
+			f:    &fileFetcher{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newFetchedPolicy(tt.f, sp)
+			if got.sp != sp || got.eTag != tt.wantETag {
+				t.Errorf("newFetchedPolicy() = %+v, want eTag %v", got, tt.wantETag)
+			}
+		})
+	}
+}
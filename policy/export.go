@@ -0,0 +1,331 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyExportVersion is the version of the policy export format. The format is changed compatibly within the same version.
+const PolicyExportVersion = "v1"
+
+// ExportFormat represents the encoding of the policy export.
+type ExportFormat string
+
+const (
+	// ExportJSON is the JSON encoding of the policy export.
+	ExportJSON ExportFormat = "json"
+	// ExportYAML is the YAML encoding of the policy export.
+	ExportYAML ExportFormat = "yaml"
+)
+
+// AssertionSource represents where the exported assertion comes from.
+type AssertionSource string
+
+const (
+	// SourceSigned is the assertion of the signed policy fetched from Athenz or the policy file.
+	SourceSigned AssertionSource = "signed"
+	// SourceLocal is the local assertion, see LocalAssertion.
+	SourceLocal AssertionSource = "local"
+)
+
+// PolicyExport represents the evaluated policy state of the policyd, sorted by domain.
+type PolicyExport struct {
+	Version string                `json:"version" yaml:"version"`
+	Domains []*DomainPolicyExport `json:"domains" yaml:"domains"`
+}
+
+// DomainPolicyExport represents the assertions of a domain. Expires is the expiry of the signed policy, nil if the domain has only the local assertions.
+type DomainPolicyExport struct {
+	Domain     string             `json:"domain" yaml:"domain"`
+	Expires    *time.Time         `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Assertions []*AssertionExport `json:"assertions" yaml:"assertions"`
+}
+
+// AssertionExport represents an assertion of a role. The resource is qualified by the domain, i.e. <domain>:<resource>.
+// Order is the order in the signed policy, and Expires is only set for the local assertion with the TTL.
+type AssertionExport struct {
+	Policy        string          `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Role          string          `json:"role" yaml:"role"`
+	Principal     string          `json:"principal,omitempty" yaml:"principal,omitempty"`
+	Action        string          `json:"action" yaml:"action"`
+	Resource      string          `json:"resource" yaml:"resource"`
+	Effect        string          `json:"effect" yaml:"effect"`
+	Source        AssertionSource `json:"source" yaml:"source"`
+	Order         int             `json:"order" yaml:"order"`
+	CaseSensitive bool            `json:"case_sensitive,omitempty" yaml:"case_sensitive,omitempty"`
+	Hierarchical  bool            `json:"hierarchical,omitempty" yaml:"hierarchical,omitempty"`
+	Reason        string          `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Expires       *time.Time      `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// ExportPolicies returns the evaluated policy state, including the signed assertions in the policy cache and the local assertions.
+func (p *policyd) ExportPolicies(ctx context.Context) *PolicyExport {
+	var mu sync.Mutex
+	domains := make(map[string]*DomainPolicyExport)
+	domainOf := func(domain string) *DomainPolicyExport {
+		d, ok := domains[domain]
+		if !ok {
+			d = &DomainPolicyExport{
+				Domain:     domain,
+				Assertions: make([]*AssertionExport, 0),
+			}
+			domains[domain] = d
+		}
+		return d
+	}
+
+	// the callback is called concurrently
+	p.loadRolePolicies().Range(ctx, func(key string, asss []*Assertion, _ int64) bool {
+		// key = <domain>:role.<role>
+		dr := strings.SplitN(key, ":role.", 2)
+		if len(dr) != 2 {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		d := domainOf(dr[0])
+		for _, a := range asss {
+			d.Assertions = append(d.Assertions, &AssertionExport{
+				Policy:        a.Policy,
+				Role:          dr[1],
+				Action:        a.Action,
+				Resource:      a.ResourceDomain + ":" + a.Resource,
+				Effect:        effectString(a.Effect),
+				Source:        SourceSigned,
+				Order:         a.Order,
+				CaseSensitive: a.CaseSensitive,
+				Hierarchical:  a.Hierarchical,
+			})
+		}
+		return true
+	})
+	for domain, expiry := range p.GetPolicyExpiries(ctx) {
+		if d, ok := domains[domain]; ok {
+			exp := expiry.UTC()
+			d.Expires = &exp
+		}
+	}
+
+	for _, la := range p.localAssertions.list() {
+		ae := &AssertionExport{
+			Role:          la.Role,
+			Principal:     la.Principal,
+			Action:        la.Action,
+			Resource:      la.Resource,
+			Effect:        strings.ToLower(la.Effect),
+			Source:        SourceLocal,
+			Order:         localAssertionOrder,
+			CaseSensitive: la.CaseSensitive,
+			Hierarchical:  la.Hierarchical,
+			Reason:        la.Reason,
+		}
+		if !la.ExpiresAt.IsZero() {
+			exp := la.ExpiresAt.UTC()
+			ae.Expires = &exp
+		}
+		d := domainOf(la.Domain)
+		d.Assertions = append(d.Assertions, ae)
+	}
+
+	e := &PolicyExport{
+		Version: PolicyExportVersion,
+		Domains: make([]*DomainPolicyExport, 0, len(domains)),
+	}
+	for _, d := range domains {
+		sort.Slice(d.Assertions, func(i, j int) bool {
+			a, b := d.Assertions[i], d.Assertions[j]
+			if a.Source != b.Source {
+				return a.Source == SourceLocal
+			}
+			if a.Role != b.Role {
+				return a.Role < b.Role
+			}
+			if a.Order != b.Order {
+				return a.Order < b.Order
+			}
+			return a.Action+","+a.Resource < b.Action+","+b.Resource
+		})
+		e.Domains = append(e.Domains, d)
+	}
+	sort.Slice(e.Domains, func(i, j int) bool {
+		return e.Domains[i].Domain < e.Domains[j].Domain
+	})
+	return e
+}
+
+// ImportPolicies replaces the policy cache with the signed assertions of the export, and adds the local assertions of the export,
+// e.g. to seed the policyd in the tests and the offline tools. The domains expired beyond the stale grace period are skipped.
+// The imported policies are replaced by the next update, unless the policyd has no target domain.
+func (p *policyd) ImportPolicies(ctx context.Context, e *PolicyExport) error {
+	if e == nil {
+		return errors.New("nil policy export")
+	}
+	if e.Version != PolicyExportVersion {
+		return errors.Errorf("unsupported policy export version: %s", e.Version)
+	}
+
+	cc := p.cacheConfig()
+	now := fastime.Now()
+	rp := gache.New[[]*Assertion]()
+	expiries := make(map[string]time.Time, len(e.Domains))
+	las := make([]*LocalAssertion, 0)
+	for _, d := range e.Domains {
+		if d == nil {
+			continue
+		}
+		var ttl time.Duration
+		if d.Expires != nil {
+			ttl = d.Expires.Sub(now) + cc.gracePeriod
+			if ttl <= 0 {
+				glg.Warnf("skip expired domain policy on import, domain: %s, expires: %s", d.Domain, d.Expires)
+				continue
+			}
+			expiries[d.Domain] = *d.Expires
+		}
+
+		rasss := make(map[string][]*Assertion)
+		for _, ae := range d.Assertions {
+			if ae.Source == SourceLocal {
+				la := &LocalAssertion{
+					Domain:        d.Domain,
+					Role:          ae.Role,
+					Principal:     ae.Principal,
+					Action:        ae.Action,
+					Resource:      ae.Resource,
+					Effect:        ae.Effect,
+					Reason:        ae.Reason,
+					CaseSensitive: ae.CaseSensitive,
+					Hierarchical:  ae.Hierarchical,
+				}
+				if ae.Expires != nil {
+					if !ae.Expires.After(now) {
+						continue
+					}
+					la.TTL = ae.Expires.Sub(now).String()
+				}
+				las = append(las, la)
+				continue
+			}
+
+			if !strings.EqualFold(ae.Effect, "allow") && !strings.EqualFold(ae.Effect, "deny") {
+				return errors.Errorf("invalid assertion effect: %s, domain: %s, role: %s", ae.Effect, d.Domain, ae.Role)
+			}
+			a, err := newAssertion(ae.Action, ae.Resource, ae.Effect, ae.CaseSensitive, ae.Hierarchical)
+			if err != nil {
+				return errors.Wrapf(err, "invalid assertion, domain: %s, role: %s", d.Domain, ae.Role)
+			}
+			a.Order = ae.Order
+			a.Policy = ae.Policy
+			key := localAssertionKey(d.Domain, ae.Role)
+			if a.Effect == nil {
+				rasss[key] = append(rasss[key], a) // append allowed policies to the end of the slice
+			} else {
+				rasss[key] = append([]*Assertion{a}, rasss[key]...) // append denied policies to the head
+			}
+		}
+		for key, asss := range rasss {
+			rp.SetWithExpire(key, asss, ttl)
+		}
+	}
+
+	if err := p.localAssertions.add(las...); err != nil {
+		return errors.Wrap(err, "import local assertions fail")
+	}
+
+	p.swapMu.Lock()
+	p.swapRolePolicies(rp, cc, new(sync.Map))
+	p.swapMu.Unlock()
+	for domain, expiry := range expiries {
+		p.storePolicyExpiry(domain, expiry)
+	}
+	return nil
+}
+
+// EncodePolicyExport writes the policy export in the format.
+func EncodePolicyExport(w io.Writer, e *PolicyExport, format ExportFormat) error {
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(e), "policy export encode fail")
+	case ExportYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(e); err != nil {
+			return errors.Wrap(err, "policy export encode fail")
+		}
+		return errors.Wrap(enc.Close(), "policy export encode fail")
+	}
+	return errors.Errorf("unsupported policy export format: %s", format)
+}
+
+// DecodePolicyExport reads the policy export in the format.
+func DecodePolicyExport(r io.Reader, format ExportFormat) (*PolicyExport, error) {
+	e := new(PolicyExport)
+	var err error
+	switch format {
+	case ExportJSON:
+		err = json.NewDecoder(r).Decode(e)
+	case ExportYAML:
+		err = yaml.NewDecoder(r).Decode(e)
+	default:
+		return nil, errors.Errorf("unsupported policy export format: %s", format)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "policy export decode fail")
+	}
+	if e.Version != PolicyExportVersion {
+		return nil, errors.Errorf("unsupported policy export version: %s", e.Version)
+	}
+	return e, nil
+}
+
+// readPolicyExportFile reads the policy export from the file, in YAML if the extension is .yaml or .yml, otherwise in JSON.
+func readPolicyExportFile(path string) (*PolicyExport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open policy export file fail")
+	}
+	defer f.Close()
+
+	format := ExportJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = ExportYAML
+	}
+	return DecodePolicyExport(f, format)
+}
+
+func effectString(effect error) string {
+	if effect == nil {
+		return "allow"
+	}
+	return "deny"
+}
@@ -0,0 +1,294 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func newTestExportPolicyd(t *testing.T, expires time.Time) *policyd {
+	t.Helper()
+	g := gache.New[[]*Assertion]()
+	p := &policyd{
+		rolePolicies:    &g,
+		localAssertions: newLocalAssertions(),
+		purgePeriod:     time.Hour,
+	}
+	sp := newTestCandidate("dom", &rdl.Timestamp{Time: expires},
+		&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "allow"},
+		&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:secret", Effect: "deny"},
+		&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:Doc", Effect: "allow"},
+	)
+	if err := simplifyAndCachePolicy(context.Background(), g, sp, cacheConfig{caseSensitivity: caseSensitivity{detect: true}}); err != nil {
+		t.Fatal(err)
+	}
+	p.storePolicyExpiry("dom", expires)
+	if err := p.AddLocalAssertions(context.Background(), &LocalAssertion{
+		Domain: "dom", Role: "reader", Action: "read", Resource: "dom:incident", Effect: "deny", Reason: "incident", TTL: "1h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func Test_policyd_ExportPolicies(t *testing.T) {
+	expires := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newTestExportPolicyd(t, expires)
+
+	got := p.ExportPolicies(context.Background())
+	if got.Version != PolicyExportVersion || len(got.Domains) != 1 {
+		t.Fatalf("policyd.ExportPolicies() = %+v", got)
+	}
+	d := got.Domains[0]
+	if d.Domain != "dom" || d.Expires == nil || !d.Expires.Equal(expires) {
+		t.Errorf("policyd.ExportPolicies() domain = %+v", d)
+	}
+	if len(d.Assertions) != 4 || d.Assertions[0].Expires == nil {
+		t.Fatalf("policyd.ExportPolicies() assertions = %+v", d.Assertions)
+	}
+	d.Assertions[0].Expires = nil
+	want := []*AssertionExport{
+		{Role: "reader", Action: "read", Resource: "dom:incident", Effect: "deny", Source: SourceLocal, Order: localAssertionOrder, Reason: "incident"},
+		{Policy: "dom:policy.candidate", Role: "reader", Action: "read", Resource: "dom:*", Effect: "allow", Source: SourceSigned, Order: 0},
+		{Policy: "dom:policy.candidate", Role: "reader", Action: "read", Resource: "dom:secret", Effect: "deny", Source: SourceSigned, Order: 1},
+		{Policy: "dom:policy.candidate", Role: "writer", Action: "write", Resource: "dom:Doc", Effect: "allow", Source: SourceSigned, Order: 2, CaseSensitive: true},
+	}
+	if diff := cmp.Diff(d.Assertions, want); diff != "" {
+		t.Errorf("policyd.ExportPolicies() assertions diff = %s", diff)
+	}
+}
+
+func TestPolicyExport_roundTrip(t *testing.T) {
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	for _, format := range []ExportFormat{ExportJSON, ExportYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			src := newTestExportPolicyd(t, expires)
+			want := src.ExportPolicies(ctx)
+
+			buf := new(bytes.Buffer)
+			if err := EncodePolicyExport(buf, want, format); err != nil {
+				t.Fatalf("EncodePolicyExport() error = %v", err)
+			}
+			e, err := DecodePolicyExport(buf, format)
+			if err != nil {
+				t.Fatalf("DecodePolicyExport() error = %v", err)
+			}
+
+			g := gache.New[[]*Assertion]()
+			dst := &policyd{
+				rolePolicies:    &g,
+				localAssertions: newLocalAssertions(),
+				purgePeriod:     time.Hour,
+			}
+			if err := dst.ImportPolicies(ctx, e); err != nil {
+				t.Fatalf("policyd.ImportPolicies() error = %v", err)
+			}
+			got := dst.ExportPolicies(ctx)
+			// the local assertion expiry is renewed from the TTL on import
+			if diff := cmp.Diff(got, want, cmp.Comparer(func(a, b *time.Time) bool {
+				return (a == nil) == (b == nil) && (a == nil || a.Sub(*b).Abs() < time.Second)
+			})); diff != "" {
+				t.Errorf("policyd.ImportPolicies() diff = %s", diff)
+			}
+
+			for _, c := range []struct {
+				roles    []string
+				action   string
+				resource string
+				wantErr  error
+			}{
+				{roles: []string{"reader"}, action: "read", resource: "doc"},
+				{roles: []string{"reader"}, action: "read", resource: "secret", wantErr: ErrDenyByPolicy},
+				{roles: []string{"reader"}, action: "read", resource: "incident", wantErr: ErrDenyByPolicy},
+				{roles: []string{"writer"}, action: "write", resource: "Doc"},
+				{roles: []string{"writer"}, action: "write", resource: "doc", wantErr: ErrNoMatch},
+			} {
+				if err := dst.CheckPolicy(ctx, "dom", c.roles, c.action, c.resource); !errors.Is(err, c.wantErr) {
+					t.Errorf("policyd.CheckPolicy(%v, %s, %s) error = %v, want %v", c.roles, c.action, c.resource, err, c.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func Test_policyd_ImportPolicies(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		e        *PolicyExport
+		wantErr  string
+		wantKeys int
+	}{
+		{
+			name: "skip expired domain",
+			e: &PolicyExport{
+				Version: PolicyExportVersion,
+				Domains: []*DomainPolicyExport{
+					{Domain: "expired", Expires: &past, Assertions: []*AssertionExport{
+						{Role: "role", Action: "read", Resource: "expired:*", Effect: "allow", Source: SourceSigned},
+					}},
+					{Domain: "dom", Assertions: []*AssertionExport{
+						{Role: "role", Action: "read", Resource: "dom:*", Effect: "allow", Source: SourceSigned},
+					}},
+				},
+			},
+			wantKeys: 1,
+		},
+		{
+			name:    "unsupported version",
+			e:       &PolicyExport{Version: "v0"},
+			wantErr: "unsupported policy export version: v0",
+		},
+		{
+			name: "invalid effect",
+			e: &PolicyExport{
+				Version: PolicyExportVersion,
+				Domains: []*DomainPolicyExport{
+					{Domain: "dom", Assertions: []*AssertionExport{
+						{Role: "role", Action: "read", Resource: "dom:*", Effect: "permit", Source: SourceSigned},
+					}},
+				},
+			},
+			wantErr: "invalid assertion effect: permit, domain: dom, role: role",
+		},
+		{
+			name:    "nil export",
+			wantErr: "nil policy export",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gache.New[[]*Assertion]()
+			p := &policyd{
+				rolePolicies:    &g,
+				localAssertions: newLocalAssertions(),
+				purgePeriod:     time.Hour,
+			}
+			err := p.ImportPolicies(context.Background(), tt.e)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("policyd.ImportPolicies() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := len(p.GetPolicyCache(context.Background())); got != tt.wantKeys {
+				t.Errorf("policyd.ImportPolicies() cached roles = %d, want %d", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func Test_policyd_ImportPolicies_expireWithoutFetcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := gache.New[[]*Assertion]()
+	p := &policyd{
+		rolePolicies:    &g,
+		localAssertions: newLocalAssertions(),
+		purgePeriod:     10 * time.Millisecond,
+		fetchers:        map[string]Fetcher{},
+		daemonCtx:       ctx,
+	}
+	expires := time.Now().Add(50 * time.Millisecond)
+	err := p.ImportPolicies(ctx, &PolicyExport{
+		Version: PolicyExportVersion,
+		Domains: []*DomainPolicyExport{
+			{Domain: "imported", Expires: &expires, Assertions: []*AssertionExport{
+				{Role: "role", Action: "read", Resource: "imported:*", Effect: "allow", Source: SourceSigned},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("policyd.ImportPolicies() error = %v", err)
+	}
+
+	// the expired hook must not refetch the domain without the fetcher
+	time.Sleep(200 * time.Millisecond)
+	if got := len(p.GetPolicyCache(ctx)); got != 0 {
+		t.Errorf("policyd.GetPolicyCache() cached roles = %d, want 0", got)
+	}
+}
+
+func TestDecodePolicyExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		format  ExportFormat
+		wantErr string
+	}{
+		{
+			name:   "yaml",
+			in:     "version: v1\ndomains:\n  - domain: dom\n    assertions: []\n",
+			format: ExportYAML,
+		},
+		{
+			name:    "unsupported version",
+			in:      `{"version":"v2","domains":[]}`,
+			format:  ExportJSON,
+			wantErr: "unsupported policy export version: v2",
+		},
+		{
+			name:    "unsupported format",
+			in:      `{}`,
+			format:  "xml",
+			wantErr: "unsupported policy export format: xml",
+		},
+		{
+			name:    "decode fail",
+			in:      `{`,
+			format:  ExportJSON,
+			wantErr: "policy export decode fail: unexpected EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePolicyExport(strings.NewReader(tt.in), tt.format)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("DecodePolicyExport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_readPolicyExportFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"policies.yml":  "version: v1\ndomains: []\n",
+		"policies.json": `{"version":"v1","domains":[]}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readPolicyExportFile(path); err != nil {
+			t.Errorf("readPolicyExportFile(%s) error = %v", name, err)
+		}
+	}
+	if _, err := readPolicyExportFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("readPolicyExportFile() error = nil, want error")
+	}
+}
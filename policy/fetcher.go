@@ -40,6 +40,16 @@ type Fetcher interface {
 	FetchWithRetry(context.Context) (*SignedPolicy, error)
 }
 
+// FetcherFactory type defines the function signature to create the Fetcher of a domain.
+// Returning nil falls back to the default fetcher of the domain.
+type FetcherFactory func(domain string) Fetcher
+
+// verifiedFetcher verifies the signed policy fetched by the underlying Fetcher, e.g. the Fetcher created by FetcherFactory.
+type verifiedFetcher struct {
+	Fetcher
+	spVerifier SignedPolicyVerifier
+}
+
 type fetcher struct {
 
 	// ETag related
@@ -70,7 +80,16 @@ func (f *fetcher) Domain() string {
 	return f.domain
 }
 
+// ETag returns the ETag of the last fetched policy
+func (f *fetcher) ETag() string {
+	if f.policyCache == nil {
+		return ""
+	}
+	return (*taggedPolicy)(atomic.LoadPointer(&f.policyCache)).eTag
+}
+
 // Fetch fetches the policy. When calling concurrently, it is not guarantee that the cache will always have the latest version.
+// The ETag is not sent if the context is created by BypassCache.
 func (f *fetcher) Fetch(ctx context.Context) (*SignedPolicy, error) {
 	glg.Infof("will fetch policy for domain: %s", f.domain)
 	// https://{athenz.io/zts/v1}/domain/{athenz domain}/signed_policy_data
@@ -88,7 +107,7 @@ func (f *fetcher) Fetch(ctx context.Context) (*SignedPolicy, error) {
 	var tp *taggedPolicy
 	if f.policyCache != nil {
 		tp = (*taggedPolicy)(atomic.LoadPointer(&f.policyCache))
-		if tp.eTag != "" && tp.eTagExpiry.After(fastime.Now()) {
+		if tp.eTag != "" && tp.eTagExpiry.After(fastime.Now()) && !IsCacheBypassed(ctx) {
 			glg.Debugf("request on domain: %s, with ETag: %s", f.domain, tp.eTag)
 			req.Header.Set("If-None-Match", tp.eTag)
 		}
@@ -148,7 +167,8 @@ func (f *fetcher) Fetch(ctx context.Context) (*SignedPolicy, error) {
 	return sp, nil
 }
 
-// FetchWithRetry fetches policy with retry. Returns cached policy if all retries failed too.
+// FetchWithRetry fetches policy with retry, waiting by the exponential backoff with jitter between the attempts.
+// Returns cached policy if all retries failed too.
 func (f *fetcher) FetchWithRetry(ctx context.Context) (*SignedPolicy, error) {
 	var lastErr error
 	for i := -1; i < f.retryAttempts; i++ {
@@ -158,7 +178,12 @@ func (f *fetcher) FetchWithRetry(ctx context.Context) (*SignedPolicy, error) {
 		}
 
 		lastErr = err
-		time.Sleep(f.retryDelay)
+		if i+1 < f.retryAttempts {
+			if err := sleep(ctx, backoff(f.retryDelay, i+1)); err != nil {
+				lastErr = err
+				break
+			}
+		}
 	}
 
 	errMsg := "max. retry count excess"
@@ -172,6 +197,43 @@ func (f *fetcher) FetchWithRetry(ctx context.Context) (*SignedPolicy, error) {
 	return (*taggedPolicy)(atomic.LoadPointer(&f.policyCache)).sp, errors.Wrap(lastErr, errMsg)
 }
 
+// Fetch fetches the policy from the underlying Fetcher and verifies it.
+func (v *verifiedFetcher) Fetch(ctx context.Context) (*SignedPolicy, error) {
+	sp, err := v.Fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = v.verify(sp); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// FetchWithRetry fetches the policy with retry from the underlying Fetcher and verifies it.
+// Same as the default fetcher, the policy is returned with the fetch error if the underlying Fetcher falls back to its cache.
+func (v *verifiedFetcher) FetchWithRetry(ctx context.Context) (*SignedPolicy, error) {
+	sp, err := v.Fetcher.FetchWithRetry(ctx)
+	if sp == nil {
+		if err == nil {
+			err = errors.New("no policy fetched")
+		}
+		return nil, err
+	}
+	if verr := v.verify(sp); verr != nil {
+		return nil, verr
+	}
+	return sp, err
+}
+
+func (v *verifiedFetcher) verify(sp *SignedPolicy) error {
+	if err := v.spVerifier(sp); err != nil {
+		errMsg := "invalid policy"
+		glg.Errorf("%s, domain: %s, error: %v", errMsg, v.Domain(), err)
+		return errors.Wrap(err, errMsg)
+	}
+	return nil
+}
+
 func (t *taggedPolicy) String() string {
 	var policyDomain string
 	if t.sp != nil && t.sp.SignedPolicyData != nil && t.sp.SignedPolicyData.PolicyData != nil {
@@ -1123,9 +1123,9 @@ func Test_fetcher_FetchWithRetry(t *testing.T) {
 					return err
 				}
 
-				// check retry interval
+				// check retry interval, backoff in [delay/2, delay) doubled on each attempt
 				diff := a.ctime.Sub(b.ctime)
-				if diff < retryDelay*time.Duration(retryAttempts) || diff > retryDelay*time.Duration(retryAttempts+1) {
+				if diff < retryDelay/2+retryDelay || diff > retryDelay+2*retryDelay+retryDelay/2 {
 					return errors.New("retry interval not working")
 				}
 				return nil
@@ -1315,6 +1315,221 @@ func Test_fetcher_FetchWithRetry(t *testing.T) {
 
 }
 
+func Test_verifiedFetcher_Fetch(t *testing.T) {
+	type fields struct {
+		Fetcher    Fetcher
+		spVerifier SignedPolicyVerifier
+	}
+	type args struct {
+		ctx context.Context
+	}
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			KeyId: "dummyKeyId",
+		},
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		want       *SignedPolicy
+		wantErrStr string
+	}{
+		{
+			name: "success",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, nil
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return nil
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: sp,
+		},
+		{
+			name: "fetch fail",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchMock: func(context.Context) (*SignedPolicy, error) {
+						return nil, errors.New("fetch error")
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return nil
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "fetch error",
+		},
+		{
+			name: "verify fail",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					domainMock: func() string {
+						return "dummyDomain"
+					},
+					fetchMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, nil
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return errors.New("verify error")
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "invalid policy: verify error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &verifiedFetcher{
+				Fetcher:    tt.fields.Fetcher,
+				spVerifier: tt.fields.spVerifier,
+			}
+			got, err := v.Fetch(tt.args.ctx)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("verifiedFetcher.Fetch() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifiedFetcher.Fetch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_verifiedFetcher_FetchWithRetry(t *testing.T) {
+	type fields struct {
+		Fetcher    Fetcher
+		spVerifier SignedPolicyVerifier
+	}
+	type args struct {
+		ctx context.Context
+	}
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			KeyId: "dummyKeyId",
+		},
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		want       *SignedPolicy
+		wantErrStr string
+	}{
+		{
+			name: "success",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, nil
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return nil
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: sp,
+		},
+		{
+			name: "fetch fail, return cached policy with error",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, errors.New("fetch error")
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return nil
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want:       sp,
+			wantErrStr: "fetch error",
+		},
+		{
+			name: "fetch fail, no policy",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return nil, errors.New("fetch error")
+					},
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "fetch error",
+		},
+		{
+			name: "no policy without error",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return nil, nil
+					},
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "no policy fetched",
+		},
+		{
+			name: "verify fail",
+			fields: fields{
+				Fetcher: &fetcherMock{
+					domainMock: func() string {
+						return "dummyDomain"
+					},
+					fetchWithRetryMock: func(context.Context) (*SignedPolicy, error) {
+						return sp, errors.New("fetch error")
+					},
+				},
+				spVerifier: func(*SignedPolicy) error {
+					return errors.New("verify error")
+				},
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			wantErrStr: "invalid policy: verify error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &verifiedFetcher{
+				Fetcher:    tt.fields.Fetcher,
+				spVerifier: tt.fields.spVerifier,
+			}
+			got, err := v.FetchWithRetry(tt.args.ctx)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("verifiedFetcher.FetchWithRetry() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifiedFetcher.FetchWithRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_taggedPolicy_String(t *testing.T) {
 	type fields struct {
 		eTag       string
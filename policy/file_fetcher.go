@@ -0,0 +1,194 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+const (
+	// policyFileExt is the extension of the policy files written by ZPU, i.e. <domain>.pol
+	policyFileExt = ".pol"
+)
+
+// fileFetcher fetches the signed policy from a local file, e.g. the policy files written by ZPU.
+type fileFetcher struct {
+
+	// retry related
+	retryDelay    time.Duration
+	retryAttempts int
+
+	// file related
+	domain     string
+	path       string
+	spVerifier SignedPolicyVerifier
+
+	policyCache unsafe.Pointer
+}
+
+type filePolicy struct {
+	modTime time.Time
+	size    int64
+	sp      *SignedPolicy
+	ctime   time.Time
+}
+
+// policyFilePath returns the ZPU policy file path of the domain under the directory
+func policyFilePath(dir, domain string) string {
+	return filepath.Join(dir, domain+policyFileExt)
+}
+
+// Domain returns the fetcher domain
+func (f *fileFetcher) Domain() string {
+	return f.domain
+}
+
+// Fetch reads and verifies the policy file. The file is only read again when its modification time or size changes,
+// or the context is created by BypassCache.
+func (f *fileFetcher) Fetch(ctx context.Context) (*SignedPolicy, error) {
+	glg.Infof("will fetch policy for domain: %s, from file: %s", f.domain, f.path)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		errMsg := "stat policy file fail"
+		glg.Errorf("%s, domain: %s, error: %v", errMsg, f.domain, err)
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	// if the file is not modified, return policy from cache
+	if fp := f.cachedPolicy(); fp != nil && !fp.isModified(fi) && !fp.isExpired() && !IsCacheBypassed(ctx) {
+		glg.Debugf("policy file not modified, use cache for domain: %s, file: %s", f.domain, f.path)
+		return fp.sp, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		errMsg := "read policy file fail"
+		glg.Errorf("%s, domain: %s, error: %v", errMsg, f.domain, err)
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	// decode
+	sp := new(SignedPolicy)
+	if err = json.Unmarshal(b, sp); err != nil {
+		errMsg := "policy decode fail"
+		glg.Errorf("%s, domain: %s, error: %v", errMsg, f.domain, err)
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	// verify policy data
+	if err = f.spVerifier(sp); err != nil {
+		errMsg := "invalid policy"
+		glg.Errorf("%s, domain: %s, error: %v", errMsg, f.domain, err)
+		return nil, errors.Wrap(err, errMsg)
+	}
+
+	// set policy cache
+	newFp := &filePolicy{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		sp:      sp,
+		ctime:   fastime.Now(),
+	}
+	glg.Debugf("set policy cache for domain: %s, policy: %s", f.domain, newFp)
+	atomic.StorePointer(&f.policyCache, unsafe.Pointer(newFp))
+
+	return sp, nil
+}
+
+// FetchWithRetry fetches policy with retry, waiting by the exponential backoff with jitter between the attempts.
+// Returns cached policy if all retries failed too.
+func (f *fileFetcher) FetchWithRetry(ctx context.Context) (*SignedPolicy, error) {
+	var lastErr error
+	for i := -1; i < f.retryAttempts; i++ {
+		sp, err := f.Fetch(ctx)
+		if err == nil {
+			return sp, nil
+		}
+
+		lastErr = err
+		if i+1 < f.retryAttempts {
+			if err := sleep(ctx, backoff(f.retryDelay, i+1)); err != nil {
+				lastErr = err
+				break
+			}
+		}
+	}
+
+	errMsg := "max. retry count excess"
+	glg.Infof("Will use policy cache, since: %s, domain: %s, error: %v", errMsg, f.domain, lastErr)
+	if lastErr == nil {
+		lastErr = fmt.Errorf("retryAttempts %v", f.retryAttempts)
+	}
+	fp := f.cachedPolicy()
+	if fp == nil {
+		return nil, errors.Wrap(errors.Wrap(lastErr, errMsg), "no policy cache")
+	}
+	return fp.sp, errors.Wrap(lastErr, errMsg)
+}
+
+// modified reports whether the policy file is changed since the last successful fetch.
+// A missing or unreadable file is reported as modified, so that the error is surfaced by the next fetch.
+func (f *fileFetcher) modified() bool {
+	fp := f.cachedPolicy()
+	if fp == nil {
+		return true
+	}
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return true
+	}
+	return fp.isModified(fi)
+}
+
+func (f *fileFetcher) cachedPolicy() *filePolicy {
+	return (*filePolicy)(atomic.LoadPointer(&f.policyCache))
+}
+
+func (fp *filePolicy) isModified(fi os.FileInfo) bool {
+	return !fp.modTime.Equal(fi.ModTime()) || fp.size != fi.Size()
+}
+
+func (fp *filePolicy) isExpired() bool {
+	if fp.sp == nil || fp.sp.SignedPolicyData == nil || fp.sp.SignedPolicyData.Expires == nil {
+		return true
+	}
+	return !fp.sp.SignedPolicyData.Expires.Time.After(fastime.Now())
+}
+
+func (fp *filePolicy) String() string {
+	var policyDomain string
+	if fp.sp != nil && fp.sp.SignedPolicyData != nil && fp.sp.SignedPolicyData.PolicyData != nil {
+		policyDomain = fp.sp.SignedPolicyData.PolicyData.Domain
+	}
+	return fmt.Sprintf("{ ctime: %s, modTime: %s, size: %d, sp.domain: %s }", fp.ctime.UTC().String(), fp.modTime.UTC().String(), fp.size, policyDomain)
+}
@@ -0,0 +1,493 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/AthenZ/athenz-authorizer/v5/pubkey"
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/pkg/errors"
+)
+
+func Test_policyFilePath(t *testing.T) {
+	type args struct {
+		dir    string
+		domain string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "ZPU layout",
+			args: args{
+				dir:    "/var/zpe",
+				domain: "dummy.domain",
+			},
+			want: "/var/zpe/dummy.domain.pol",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policyFilePath(tt.args.dir, tt.args.domain); got != tt.want {
+				t.Errorf("policyFilePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fileFetcher_Domain(t *testing.T) {
+	type fields struct {
+		domain string
+		path   string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   string
+	}{
+		{
+			name: "get domain success",
+			fields: fields{
+				domain: "domain-75",
+				path:   "/var/zpe/domain-75.pol",
+			},
+			want: "domain-75",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileFetcher{
+				domain: tt.fields.domain,
+				path:   tt.fields.path,
+			}
+			if got := f.Domain(); got != tt.want {
+				t.Errorf("fileFetcher.Domain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fileFetcher_Fetch(t *testing.T) {
+	type fields struct {
+		domain      string
+		path        string
+		spVerifier  SignedPolicyVerifier
+		policyCache unsafe.Pointer
+	}
+	type args struct {
+		ctx context.Context
+	}
+	type test struct {
+		name       string
+		fields     fields
+		args       args
+		want       *SignedPolicy
+		wantErrStr string
+		checkFunc  func(*fileFetcher) error
+	}
+	dummySignedPolicyVerifier := func(sp *SignedPolicy) error {
+		return sp.Verify(func(e pubkey.AthenzEnv, id string) authcore.Verifier {
+			return VerifierMock{
+				VerifyFunc: func(d, s string) error {
+					return nil
+				},
+			}
+		})
+	}
+	createExpires := func(d time.Duration) (time.Time, string) {
+		t := fastime.Now().Add(d).UTC().Round(time.Millisecond)
+		tByte, _ := rdl.Timestamp{
+			Time: t,
+		}.MarshalJSON()
+		return t, string(tByte)
+	}
+	writePolicyFile := func(dir, domain, body string) string {
+		path := policyFilePath(dir, domain)
+		if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+			panic(err)
+		}
+		return path
+	}
+	tests := []test{
+		func() (tt test) {
+			tt.name = "success, no cache"
+
+			expires, expiresStr := createExpires(time.Hour)
+			path := writePolicyFile(t.TempDir(), "dummyDomain", fmt.Sprintf(`{"keyId":"dummyKeyId","signedPolicyData":{"zmsKeyId":"dummyZmsKeyId","expires":%s}}`, expiresStr))
+
+			sp := &SignedPolicy{
+				util.DomainSignedPolicyData{
+					KeyId: "dummyKeyId",
+					SignedPolicyData: &util.SignedPolicyData{
+						Expires:  &rdl.Timestamp{Time: expires},
+						ZmsKeyId: "dummyZmsKeyId",
+					},
+				},
+			}
+			tt.want = sp
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+			}
+			tt.checkFunc = func(f *fileFetcher) error {
+				fp := f.cachedPolicy()
+				if fp == nil {
+					return errors.New("policy cache not set")
+				}
+				if !reflect.DeepEqual(fp.sp, sp) {
+					return errors.Errorf("policy cache sp = %v, want %v", fp.sp, sp)
+				}
+				if f.modified() {
+					return errors.New("file should not be modified")
+				}
+				return nil
+			}
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "success, file not modified, use cache"
+
+			path := writePolicyFile(t.TempDir(), "dummyDomain", `invalid policy file content`)
+			fi, err := os.Stat(path)
+			if err != nil {
+				panic(err)
+			}
+
+			expires, _ := createExpires(time.Hour)
+			sp := &SignedPolicy{
+				util.DomainSignedPolicyData{
+					KeyId: "cachedKeyId",
+					SignedPolicyData: &util.SignedPolicyData{
+						Expires: &rdl.Timestamp{Time: expires},
+					},
+				},
+			}
+			tt.want = sp
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: fi.ModTime(),
+					size:    fi.Size(),
+					sp:      sp,
+				}),
+			}
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "success, file modified, read again"
+
+			expires, expiresStr := createExpires(time.Hour)
+			path := writePolicyFile(t.TempDir(), "dummyDomain", fmt.Sprintf(`{"keyId":"newKeyId","signedPolicyData":{"expires":%s}}`, expiresStr))
+
+			sp := &SignedPolicy{
+				util.DomainSignedPolicyData{
+					KeyId: "newKeyId",
+					SignedPolicyData: &util.SignedPolicyData{
+						Expires: &rdl.Timestamp{Time: expires},
+					},
+				},
+			}
+			tt.want = sp
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: time.Unix(0, 0),
+					sp: &SignedPolicy{
+						util.DomainSignedPolicyData{
+							KeyId: "cachedKeyId",
+							SignedPolicyData: &util.SignedPolicyData{
+								Expires: &rdl.Timestamp{Time: expires},
+							},
+						},
+					},
+				}),
+			}
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "file not found"
+
+			path := policyFilePath(t.TempDir(), "dummyDomain")
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+			}
+			tt.wantErrStr = fmt.Sprintf("stat policy file fail: stat %s: no such file or directory", path)
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "decode fail"
+
+			path := writePolicyFile(t.TempDir(), "dummyDomain", `{"keyId":`)
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+			}
+			tt.wantErrStr = "policy decode fail: unexpected end of JSON input"
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "verify fail, policy expired"
+
+			path := writePolicyFile(t.TempDir(), "dummyDomain", `{"keyId":"dummyKeyId","signedPolicyData":{"expires":"2006-01-02T15:04:05.999Z"}}`)
+			tt.args = args{
+				ctx: context.Background(),
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       path,
+				spVerifier: dummySignedPolicyVerifier,
+			}
+			tt.wantErrStr = "invalid policy: policy already expired at 2006-01-02 15:04:05.999 +0000 UTC"
+			return tt
+		}(),
+		func() (tt test) {
+			tt.name = "context canceled"
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			tt.args = args{
+				ctx: ctx,
+			}
+			tt.fields = fields{
+				domain:     "dummyDomain",
+				path:       policyFilePath(t.TempDir(), "dummyDomain"),
+				spVerifier: dummySignedPolicyVerifier,
+			}
+			tt.wantErrStr = context.Canceled.Error()
+			return tt
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileFetcher{
+				domain:      tt.fields.domain,
+				path:        tt.fields.path,
+				spVerifier:  tt.fields.spVerifier,
+				policyCache: tt.fields.policyCache,
+			}
+			got, err := f.Fetch(tt.args.ctx)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("fileFetcher.Fetch() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fileFetcher.Fetch() = %v, want %v", got, tt.want)
+			}
+			if tt.checkFunc != nil {
+				if err := tt.checkFunc(f); err != nil {
+					t.Errorf("fileFetcher.Fetch() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func Test_fileFetcher_FetchWithRetry(t *testing.T) {
+	type fields struct {
+		retryAttempts int
+		domain        string
+		path          string
+		spVerifier    SignedPolicyVerifier
+		policyCache   unsafe.Pointer
+	}
+	type args struct {
+		ctx context.Context
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		want       *SignedPolicy
+		wantErrStr string
+	}{
+		{
+			name: "fail, no policy cache",
+			fields: fields{
+				retryAttempts: 1,
+				domain:        "dummyDomain",
+				path:          "/not/exists/dummyDomain.pol",
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want:       nil,
+			wantErrStr: "no policy cache: max. retry count excess: stat policy file fail: stat /not/exists/dummyDomain.pol: no such file or directory",
+		},
+		{
+			name: "fail, return policy cache",
+			fields: fields{
+				retryAttempts: 1,
+				domain:        "dummyDomain",
+				path:          "/not/exists/dummyDomain.pol",
+				policyCache: unsafe.Pointer(&filePolicy{
+					sp: &SignedPolicy{
+						util.DomainSignedPolicyData{
+							KeyId: "cachedKeyId",
+						},
+					},
+				}),
+			},
+			args: args{
+				ctx: context.Background(),
+			},
+			want: &SignedPolicy{
+				util.DomainSignedPolicyData{
+					KeyId: "cachedKeyId",
+				},
+			},
+			wantErrStr: "max. retry count excess: stat policy file fail: stat /not/exists/dummyDomain.pol: no such file or directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileFetcher{
+				retryAttempts: tt.fields.retryAttempts,
+				domain:        tt.fields.domain,
+				path:          tt.fields.path,
+				spVerifier:    tt.fields.spVerifier,
+				policyCache:   tt.fields.policyCache,
+			}
+			got, err := f.FetchWithRetry(tt.args.ctx)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("fileFetcher.FetchWithRetry() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fileFetcher.FetchWithRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fileFetcher_modified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dummyDomain.pol")
+	if err := os.WriteFile(path, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type fields struct {
+		path        string
+		policyCache unsafe.Pointer
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   bool
+	}{
+		{
+			name: "no cache",
+			fields: fields{
+				path: path,
+			},
+			want: true,
+		},
+		{
+			name: "not modified",
+			fields: fields{
+				path: path,
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: fi.ModTime(),
+					size:    fi.Size(),
+				}),
+			},
+			want: false,
+		},
+		{
+			name: "modification time changed",
+			fields: fields{
+				path: path,
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: fi.ModTime().Add(-time.Second),
+					size:    fi.Size(),
+				}),
+			},
+			want: true,
+		},
+		{
+			name: "size changed",
+			fields: fields{
+				path: path,
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: fi.ModTime(),
+					size:    fi.Size() + 1,
+				}),
+			},
+			want: true,
+		},
+		{
+			name: "file removed",
+			fields: fields{
+				path: filepath.Join(dir, "removed.pol"),
+				policyCache: unsafe.Pointer(&filePolicy{
+					modTime: fi.ModTime(),
+					size:    fi.Size(),
+				}),
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fileFetcher{
+				path:        tt.fields.path,
+				policyCache: tt.fields.policyCache,
+			}
+			if got := f.modified(); got != tt.want {
+				t.Errorf("fileFetcher.modified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+)
+
+// LintIssueType represents the type of the lint issue.
+type LintIssueType string
+
+const (
+	// LintInvalid is the assertion which cannot be evaluated, e.g. the resource without the domain. It is skipped when the policy is cached.
+	LintInvalid LintIssueType = "invalid"
+	// LintInvalidEffect is the assertion with the effect other than "allow" or "deny", which is evaluated as "allow".
+	LintInvalidEffect LintIssueType = "invalid_effect"
+	// LintShadowed is the allow assertion fully covered by a deny assertion of the same role, which never allows any request.
+	LintShadowed LintIssueType = "shadowed"
+	// LintDuplicate is the assertion same as another assertion of the same role, including the ones differing only in case.
+	LintDuplicate LintIssueType = "duplicate"
+	// LintBroadGrant is the allow assertion granting all the actions on all the resources of the domain.
+	LintBroadGrant LintIssueType = "broad_grant"
+	// LintUnknownRole is the assertion referencing the role absent in the domain.
+	LintUnknownRole LintIssueType = "unknown_role"
+)
+
+// LintIssue represents the issue of an assertion found by LintPolicy.
+type LintIssue struct {
+	Type     LintIssueType `json:"type"`
+	Domain   string        `json:"domain"`
+	Policy   string        `json:"policy"`
+	Role     string        `json:"role"`
+	Action   string        `json:"action"`
+	Resource string        `json:"resource"`
+	Effect   string        `json:"effect"`
+	Message  string        `json:"message"`
+}
+
+func (i *LintIssue) String() string {
+	return fmt.Sprintf("%s: %s, policy: %s, role: %s, action: %s, resource: %s, effect: %s",
+		i.Type, i.Message, i.Policy, i.Role, i.Action, i.Resource, i.Effect)
+}
+
+type lintAssertion struct {
+	policy string
+	ass    *util.Assertion
+	a      *Assertion
+}
+
+// LintPolicy checks the assertions of the signed policy and returns the issues found.
+// If roles are given, they are the role names of the domain and the assertions referencing other roles are reported.
+// The signature of the signed policy is not verified.
+func LintPolicy(sp *SignedPolicy, roles ...string) []*LintIssue {
+	return lintPolicy(sp, false, roles)
+}
+
+// LintHierarchicalPolicy is the same as LintPolicy, but the resources are matched by the path segments separated by "/",
+// i.e. for the policyd with WithResourceHierarchy.
+func LintHierarchicalPolicy(sp *SignedPolicy, roles ...string) []*LintIssue {
+	return lintPolicy(sp, true, roles)
+}
+
+func lintPolicy(sp *SignedPolicy, hierarchical bool, roles []string) []*LintIssue {
+	if sp == nil || sp.SignedPolicyData == nil || sp.SignedPolicyData.PolicyData == nil {
+		return nil
+	}
+	pd := sp.SignedPolicyData.PolicyData
+	rolePrefix := pd.Domain + ":role."
+	knownRoles := make(map[string]struct{}, len(roles))
+	for _, role := range roles {
+		knownRoles[strings.ToLower(role)] = struct{}{}
+	}
+
+	issues := make([]*LintIssue, 0)
+	report := func(typ LintIssueType, policy string, ass *util.Assertion, format string, args ...interface{}) {
+		issues = append(issues, &LintIssue{
+			Type:     typ,
+			Domain:   pd.Domain,
+			Policy:   policy,
+			Role:     ass.Role,
+			Action:   ass.Action,
+			Resource: ass.Resource,
+			Effect:   ass.Effect,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// invalid and unknown roles, and collect the valid assertions by role
+	seen := make(map[string]*lintAssertion)
+	rlas := make(map[string][]*lintAssertion)
+	var las []*lintAssertion
+	for _, pol := range pd.Policies {
+		if pol == nil {
+			continue
+		}
+		for _, ass := range pol.Assertions {
+			if ass == nil {
+				continue
+			}
+			switch {
+			case !strings.HasPrefix(ass.Role, rolePrefix):
+				report(LintUnknownRole, pol.Name, ass, "role not in the domain %s", pd.Domain)
+			case len(knownRoles) != 0:
+				if _, ok := knownRoles[strings.ToLower(strings.TrimPrefix(ass.Role, rolePrefix))]; !ok {
+					report(LintUnknownRole, pol.Name, ass, "role absent in the domain %s", pd.Domain)
+				}
+			}
+
+			a, err := newAssertion(ass.Action, ass.Resource, ass.Effect, false, hierarchical)
+			if err != nil {
+				report(LintInvalid, pol.Name, ass, "skipped, %v", err)
+				continue
+			}
+			if !strings.EqualFold(ass.Effect, "allow") && !strings.EqualFold(ass.Effect, "deny") {
+				report(LintInvalidEffect, pol.Name, ass, "evaluated as allow")
+			}
+
+			la := &lintAssertion{policy: pol.Name, ass: ass, a: a}
+			key := strings.ToLower(fmt.Sprintf("%s,%s,%s,%t", ass.Role, ass.Action, ass.Resource, a.Effect == nil))
+			if dup, ok := seen[key]; ok {
+				if dup.ass.Role == ass.Role && dup.ass.Action == ass.Action && dup.ass.Resource == ass.Resource {
+					report(LintDuplicate, pol.Name, ass, "duplicate of the assertion in policy %s", dup.policy)
+				} else {
+					report(LintDuplicate, pol.Name, ass, "duplicate of the assertion in policy %s, differing only in case", dup.policy)
+				}
+				continue
+			}
+			seen[key] = la
+			role := strings.ToLower(ass.Role)
+			rlas[role] = append(rlas[role], la)
+			las = append(las, la)
+		}
+	}
+
+	// shadowed and broad allow assertions
+	for _, la := range las {
+		if la.a.Effect != nil {
+			continue
+		}
+		for _, deny := range rlas[strings.ToLower(la.ass.Role)] {
+			if deny.a.Effect != nil &&
+				strings.EqualFold(deny.a.ResourceDomain, la.a.ResourceDomain) &&
+				globCovers(actionGlob(deny.a), actionGlob(la.a)) &&
+				globCovers(resourceGlob(deny.a), resourceGlob(la.a)) {
+				report(LintShadowed, la.policy, la.ass, "shadowed by the deny assertion in policy %s, action: %s, resource: %s", deny.policy, deny.ass.Action, deny.ass.Resource)
+				break
+			}
+		}
+		if globCovers(actionGlob(la.a), anyGlob) && globCovers(resourceGlob(la.a), anyGlob) {
+			report(LintBroadGrant, la.policy, la.ass, "grants all the actions on all the resources of the domain %s", la.a.ResourceDomain)
+		}
+	}
+
+	return issues
+}
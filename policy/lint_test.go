@@ -0,0 +1,181 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+)
+
+func TestLintPolicy(t *testing.T) {
+	type args struct {
+		sp           *SignedPolicy
+		roles        []string
+		hierarchical bool
+	}
+	type want struct {
+		typ  LintIssueType
+		role string
+		msg  string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []want
+	}{
+		{
+			name: "no issue",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:secret", Effect: "deny"},
+				),
+				roles: []string{"reader"},
+			},
+			want: []want{},
+		},
+		{
+			name: "invalid assertions",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "secret", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "permit"},
+				),
+			},
+			want: []want{
+				{typ: LintInvalid, role: "dom:role.reader", msg: "skipped, assertion format not correct: " + ErrInvalidPolicyResource.Error()},
+				{typ: LintInvalidEffect, role: "dom:role.reader", msg: "evaluated as allow"},
+			},
+		},
+		{
+			name: "duplicate assertions",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.Reader", Action: "READ", Resource: "dom:Doc", Effect: "ALLOW"},
+					&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:doc", Effect: "deny"},
+				),
+			},
+			want: []want{
+				{typ: LintDuplicate, role: "dom:role.reader", msg: "duplicate of the assertion in policy dom:policy.candidate"},
+				{typ: LintDuplicate, role: "dom:role.Reader", msg: "duplicate of the assertion in policy dom:policy.candidate, differing only in case"},
+				{typ: LintShadowed, role: "dom:role.reader", msg: "shadowed by the deny assertion in policy dom:policy.candidate, action: read, resource: dom:doc"},
+			},
+		},
+		{
+			name: "shadowed assertions",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:secret/doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:public/*", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.reader", Action: "write", Resource: "dom:secret/doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.writer", Action: "*", Resource: "dom:secret/*", Effect: "deny"},
+				),
+			},
+			want: []want{
+				{typ: LintShadowed, role: "dom:role.writer", msg: "shadowed by the deny assertion in policy dom:policy.candidate, action: *, resource: dom:secret/*"},
+			},
+		},
+		{
+			name: "broad grant",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.admin", Action: "*", Resource: "dom:*", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.admin", Action: "*", Resource: "dom:res/*", Effect: "allow"},
+				),
+			},
+			want: []want{
+				{typ: LintBroadGrant, role: "dom:role.admin", msg: "grants all the actions on all the resources of the domain dom"},
+			},
+		},
+		{
+			name: "hierarchical shadowed assertions",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:secret/doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:secret/dir/doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.writer", Action: "*", Resource: "dom:secret/*", Effect: "deny"},
+				),
+				hierarchical: true,
+			},
+			want: []want{
+				{typ: LintShadowed, role: "dom:role.writer", msg: "shadowed by the deny assertion in policy dom:policy.candidate, action: *, resource: dom:secret/*"},
+			},
+		},
+		{
+			name: "hierarchical broad grant",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "dom:role.admin", Action: "*", Resource: "dom:**", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.admin", Action: "*", Resource: "dom:*", Effect: "allow"},
+				),
+				hierarchical: true,
+			},
+			want: []want{
+				{typ: LintBroadGrant, role: "dom:role.admin", msg: "grants all the actions on all the resources of the domain dom"},
+			},
+		},
+		{
+			name: "unknown roles",
+			args: args{
+				sp: newTestCandidate("dom", nil,
+					&util.Assertion{Role: "otherdom:role.reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.removed", Action: "read", Resource: "dom:doc", Effect: "allow"},
+					&util.Assertion{Role: "dom:role.Reader", Action: "read", Resource: "dom:doc", Effect: "allow"},
+				),
+				roles: []string{"reader"},
+			},
+			want: []want{
+				{typ: LintUnknownRole, role: "otherdom:role.reader", msg: "role not in the domain dom"},
+				{typ: LintUnknownRole, role: "dom:role.removed", msg: "role absent in the domain dom"},
+			},
+		},
+		{
+			name: "without policy data",
+			args: args{
+				sp: &SignedPolicy{},
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lint := LintPolicy
+			if tt.args.hierarchical {
+				lint = LintHierarchicalPolicy
+			}
+			issues := lint(tt.args.sp, tt.args.roles...)
+			if tt.want == nil {
+				if issues != nil {
+					t.Errorf("LintPolicy() = %v, want nil", issues)
+				}
+				return
+			}
+			got := make([]want, 0, len(issues))
+			for _, i := range issues {
+				if i.Domain != "dom" || i.Policy != "dom:policy.candidate" {
+					t.Errorf("LintPolicy() issue = %v, invalid domain or policy", i)
+				}
+				got = append(got, want{typ: i.Type, role: i.Role, msg: i.Message})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+const (
+	// localAnyRole is the role name of the local assertion matching all the roles of the domain
+	localAnyRole = "*"
+)
+
+// LocalAssertion represents the locally-scoped assertion, which is added without waiting for the policy update from Athenz,
+// e.g. the break-glass assertion during incidents.
+// The local assertions are evaluated before the signed assertions of the same role.
+// The local assertion of a principal blocks the principal regardless of the roles, and only supports the deny effect.
+// It is evaluated before all the roles, and requires the principal on the context, see WithPrincipal.
+type LocalAssertion struct {
+	Domain    string `json:"domain"`
+	Role      string `json:"role,omitempty"`      // role name, "*" matches all the roles of the domain
+	Principal string `json:"principal,omitempty"` // principal name, e.g. user.alice, exclusive with the role
+	Action    string `json:"action"`              // supports wildcard
+	Resource  string `json:"resource"`            // <domain>:<resource>, supports wildcard
+	Effect    string `json:"effect"`              // "allow" or "deny"
+	TTL       string `json:"ttl,omitempty"`       // e.g. "1h", never expires if empty
+	Reason    string `json:"reason,omitempty"`
+
+	CaseSensitive bool `json:"case_sensitive,omitempty"` // match the action and resource in exact case
+	Hierarchical  bool `json:"hierarchical,omitempty"`   // match the resource by the path segments, see NewHierarchicalAssertion
+
+	CreatedAt time.Time `json:"created_at"` // set when added
+	ExpiresAt time.Time `json:"expires_at"` // set when added, zero if never expires
+}
+
+type localAssertion struct {
+	*LocalAssertion
+	assertion *Assertion
+}
+
+// localAssertions stores the local assertions by map[<domain>:role.<role>][]*localAssertion,
+// and the local assertions of the principals by map[<domain>:principal.<principal>][]*localAssertion
+type localAssertions struct {
+	mu   sync.RWMutex
+	asss map[string][]*localAssertion
+	prns map[string][]*localAssertion
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context carrying the principal name, with which the local assertions of the principal are evaluated.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal name set by WithPrincipal, or empty if not set.
+func PrincipalFromContext(ctx context.Context) string {
+	prn, _ := ctx.Value(principalKey{}).(string)
+	return prn
+}
+
+func newLocalAssertions() *localAssertions {
+	return &localAssertions{
+		asss: make(map[string][]*localAssertion),
+		prns: make(map[string][]*localAssertion),
+	}
+}
+
+func localAssertionKey(domain, role string) string {
+	return fmt.Sprintf("%s:role.%s", domain, role)
+}
+
+func localPrincipalKey(domain, principal string) string {
+	return fmt.Sprintf("%s:principal.%s", domain, principal)
+}
+
+// newLocalAssertion validates the LocalAssertion and returns the copy to be stored
+func newLocalAssertion(la *LocalAssertion, now time.Time) (*localAssertion, error) {
+	if la == nil {
+		return nil, errors.New("nil local assertion")
+	}
+	if la.Domain == "" || (la.Role == "" && la.Principal == "") {
+		return nil, errors.New("local assertion without domain, role or principal")
+	}
+	if la.Role != "" && la.Principal != "" {
+		return nil, errors.New("local assertion with both role and principal")
+	}
+	if !strings.EqualFold(la.Effect, "allow") && !strings.EqualFold(la.Effect, "deny") {
+		return nil, errors.Errorf("invalid local assertion effect: %s", la.Effect)
+	}
+	if la.Principal != "" && !strings.EqualFold(la.Effect, "deny") {
+		return nil, errors.Errorf("invalid local assertion effect of principal: %s", la.Effect)
+	}
+	a, err := newAssertion(la.Action, la.Resource, la.Effect, la.CaseSensitive, la.Hierarchical)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid local assertion")
+	}
+	a.Local = true
+
+	cla := *la
+	cla.CreatedAt = now
+	cla.ExpiresAt = time.Time{}
+	if la.TTL != "" {
+		ttl, err := time.ParseDuration(la.TTL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid local assertion ttl")
+		}
+		if ttl <= 0 {
+			return nil, errors.Errorf("invalid local assertion ttl: %s", la.TTL)
+		}
+		cla.ExpiresAt = now.Add(ttl)
+	}
+
+	return &localAssertion{
+		LocalAssertion: &cla,
+		assertion:      a,
+	}, nil
+}
+
+func (l *localAssertion) isExpired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !l.ExpiresAt.After(now)
+}
+
+// add validates and adds all the local assertions, nothing is added if any of them is invalid
+func (ls *localAssertions) add(las ...*LocalAssertion) error {
+	now := fastime.Now()
+	nlas := make([]*localAssertion, 0, len(las))
+	for _, la := range las {
+		nla, err := newLocalAssertion(la, now)
+		if err != nil {
+			return err
+		}
+		nlas = append(nlas, nla)
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, nla := range nlas {
+		if nla.Principal != "" {
+			key := localPrincipalKey(nla.Domain, nla.Principal)
+			ls.prns[key] = append(ls.prns[key], nla)
+			glg.Infof("local assertion added, domain: %s, principal: %s, action: %s, resource: %s, effect: %s, expires at: %s, reason: %s",
+				nla.Domain, nla.Principal, nla.Action, nla.Resource, nla.Effect, nla.ExpiresAt, nla.Reason)
+			continue
+		}
+		key := localAssertionKey(nla.Domain, nla.Role)
+		asss := ls.asss[key]
+		if nla.assertion.Effect == nil {
+			asss = append(asss, nla) // append allowed assertions to the end of the slice
+		} else {
+			asss = append([]*localAssertion{nla}, asss...) // append denied assertions to the head
+		}
+		ls.asss[key] = asss
+		glg.Infof("local assertion added, domain: %s, role: %s, action: %s, resource: %s, effect: %s, expires at: %s, reason: %s",
+			nla.Domain, nla.Role, nla.Action, nla.Resource, nla.Effect, nla.ExpiresAt, nla.Reason)
+	}
+	ls.purgeExpired(now)
+	return nil
+}
+
+// delete deletes the local assertions of the domain role and returns the number of deleted assertions
+func (ls *localAssertions) delete(domain, role string) int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	key := localAssertionKey(domain, role)
+	n := len(ls.asss[key])
+	delete(ls.asss, key)
+	glg.Infof("local assertions deleted, domain: %s, role: %s, count: %d", domain, role, n)
+	return n
+}
+
+// deletePrincipal deletes the local assertions of the domain principal and returns the number of deleted assertions
+func (ls *localAssertions) deletePrincipal(domain, principal string) int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	key := localPrincipalKey(domain, principal)
+	n := len(ls.prns[key])
+	delete(ls.prns, key)
+	glg.Infof("local assertions deleted, domain: %s, principal: %s, count: %d", domain, principal, n)
+	return n
+}
+
+// getPrincipal returns the unexpired local assertions of the domain principal
+func (ls *localAssertions) getPrincipal(domain, principal string) []*localAssertion {
+	if ls == nil || principal == "" {
+		return nil
+	}
+	now := fastime.Now()
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	var asss []*localAssertion
+	for _, la := range ls.prns[localPrincipalKey(domain, principal)] {
+		if !la.isExpired(now) {
+			asss = append(asss, la)
+		}
+	}
+	return asss
+}
+
+// get returns the unexpired local assertions of the domain role, including the ones matching all the roles of the domain.
+// The denied assertions come first.
+func (ls *localAssertions) get(domain, role string) []*localAssertion {
+	if ls == nil {
+		return nil
+	}
+	now := fastime.Now()
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	if len(ls.asss) == 0 {
+		return nil
+	}
+
+	var asss []*localAssertion
+	for _, key := range []string{localAssertionKey(domain, role), localAssertionKey(domain, localAnyRole)} {
+		for _, la := range ls.asss[key] {
+			if la.isExpired(now) {
+				continue
+			}
+			if la.assertion.Effect == nil {
+				asss = append(asss, la)
+			} else {
+				asss = append([]*localAssertion{la}, asss...)
+			}
+		}
+		if role == localAnyRole {
+			break
+		}
+	}
+	return asss
+}
+
+// list returns copies of all the unexpired local assertions
+func (ls *localAssertions) list() []*LocalAssertion {
+	if ls == nil {
+		return nil
+	}
+	now := fastime.Now()
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	las := make([]*LocalAssertion, 0, len(ls.asss)+len(ls.prns))
+	for _, m := range []map[string][]*localAssertion{ls.asss, ls.prns} {
+		for _, asss := range m {
+			for _, la := range asss {
+				if la.isExpired(now) {
+					continue
+				}
+				cla := *la.LocalAssertion
+				las = append(las, &cla)
+			}
+		}
+	}
+	return las
+}
+
+// toRawMap returns the unexpired local assertions by map[<domain>:role.<role>][]*Assertion
+func (ls *localAssertions) toRawMap() map[string][]*Assertion {
+	if ls == nil {
+		return nil
+	}
+	now := fastime.Now()
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	m := make(map[string][]*Assertion, len(ls.asss))
+	for key, asss := range ls.asss {
+		for _, la := range asss {
+			if la.isExpired(now) {
+				continue
+			}
+			m[key] = append(m[key], la.assertion)
+		}
+	}
+	return m
+}
+
+// purgeExpired removes the expired local assertions, must be called with the lock held
+func (ls *localAssertions) purgeExpired(now time.Time) {
+	for _, m := range []map[string][]*localAssertion{ls.asss, ls.prns} {
+		for key, asss := range m {
+			unexpired := asss[:0]
+			for _, la := range asss {
+				if la.isExpired(now) {
+					glg.Infof("local assertion expired, domain: %s, role: %s, principal: %s, action: %s, resource: %s, effect: %s",
+						la.Domain, la.Role, la.Principal, la.Action, la.Resource, la.Effect)
+					continue
+				}
+				unexpired = append(unexpired, la)
+			}
+			if len(unexpired) == 0 {
+				delete(m, key)
+			} else {
+				m[key] = unexpired
+			}
+		}
+	}
+}
+
+// readLocalAssertionsFile reads the local assertions from the JSON file, which contains an array of LocalAssertion.
+func readLocalAssertionsFile(path string) ([]*LocalAssertion, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read local assertions file fail")
+	}
+	var las []*LocalAssertion
+	if err = json.Unmarshal(b, &las); err != nil {
+		return nil, errors.Wrap(err, "local assertions decode fail")
+	}
+	return las, nil
+}
+
+// AddLocalAssertions adds the local assertions. Nothing is added if any of them is invalid.
+func (p *policyd) AddLocalAssertions(ctx context.Context, las ...*LocalAssertion) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return p.localAssertions.add(las...)
+	}
+}
+
+// DeleteLocalAssertions deletes the local assertions of the domain role, and returns the number of deleted assertions.
+func (p *policyd) DeleteLocalAssertions(ctx context.Context, domain, role string) int {
+	return p.localAssertions.delete(domain, role)
+}
+
+// DeleteLocalPrincipalAssertions deletes the local assertions of the domain principal, and returns the number of deleted assertions.
+func (p *policyd) DeleteLocalPrincipalAssertions(ctx context.Context, domain, principal string) int {
+	return p.localAssertions.deletePrincipal(domain, principal)
+}
+
+// GetLocalAssertions returns the unexpired local assertions.
+func (p *policyd) GetLocalAssertions(ctx context.Context) []*LocalAssertion {
+	return p.localAssertions.list()
+}
+
+// LoadLocalAssertions reads the local assertions from the JSON file and adds them.
+func (p *policyd) LoadLocalAssertions(ctx context.Context, path string) error {
+	las, err := readLocalAssertionsFile(path)
+	if err != nil {
+		return err
+	}
+	glg.Infof("will load %d local assertions from file: %s", len(las), path)
+	return p.AddLocalAssertions(ctx, las...)
+}
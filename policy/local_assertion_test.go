@@ -0,0 +1,493 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func Test_newLocalAssertion(t *testing.T) {
+	now := time.Unix(1000, 0)
+	type args struct {
+		la *LocalAssertion
+	}
+	tests := []struct {
+		name       string
+		args       args
+		want       *LocalAssertion
+		wantErrStr string
+	}{
+		{
+			name: "deny with ttl",
+			args: args{
+				la: &LocalAssertion{
+					Domain:   "dom",
+					Role:     "role",
+					Action:   "*",
+					Resource: "dom:*",
+					Effect:   "deny",
+					TTL:      "1h",
+					Reason:   "incident",
+				},
+			},
+			want: &LocalAssertion{
+				Domain:    "dom",
+				Role:      "role",
+				Action:    "*",
+				Resource:  "dom:*",
+				Effect:    "deny",
+				TTL:       "1h",
+				Reason:    "incident",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			},
+		},
+		{
+			name: "allow without ttl, ignore the given timestamps",
+			args: args{
+				la: &LocalAssertion{
+					Domain:    "dom",
+					Role:      "role",
+					Action:    "read",
+					Resource:  "dom:res",
+					Effect:    "ALLOW",
+					CreatedAt: time.Unix(1, 0),
+					ExpiresAt: time.Unix(2, 0),
+				},
+			},
+			want: &LocalAssertion{
+				Domain:    "dom",
+				Role:      "role",
+				Action:    "read",
+				Resource:  "dom:res",
+				Effect:    "ALLOW",
+				CreatedAt: now,
+			},
+		},
+		{
+			name: "nil",
+			args: args{
+				la: nil,
+			},
+			wantErrStr: "nil local assertion",
+		},
+		{
+			name: "without role",
+			args: args{
+				la: &LocalAssertion{
+					Domain:   "dom",
+					Action:   "read",
+					Resource: "dom:res",
+					Effect:   "deny",
+				},
+			},
+			wantErrStr: "local assertion without domain, role or principal",
+		},
+		{
+			name: "deny of principal",
+			args: args{
+				la: &LocalAssertion{
+					Domain:    "dom",
+					Principal: "user.alice",
+					Action:    "*",
+					Resource:  "dom:*",
+					Effect:    "deny",
+				},
+			},
+			want: &LocalAssertion{
+				Domain:    "dom",
+				Principal: "user.alice",
+				Action:    "*",
+				Resource:  "dom:*",
+				Effect:    "deny",
+				CreatedAt: now,
+			},
+		},
+		{
+			name: "allow of principal",
+			args: args{
+				la: &LocalAssertion{
+					Domain:    "dom",
+					Principal: "user.alice",
+					Action:    "*",
+					Resource:  "dom:*",
+					Effect:    "allow",
+				},
+			},
+			wantErrStr: "invalid local assertion effect of principal: allow",
+		},
+		{
+			name: "both role and principal",
+			args: args{
+				la: &LocalAssertion{
+					Domain:    "dom",
+					Role:      "role",
+					Principal: "user.alice",
+					Action:    "*",
+					Resource:  "dom:*",
+					Effect:    "deny",
+				},
+			},
+			wantErrStr: "local assertion with both role and principal",
+		},
+		{
+			name: "invalid effect",
+			args: args{
+				la: &LocalAssertion{
+					Domain:   "dom",
+					Role:     "role",
+					Action:   "read",
+					Resource: "dom:res",
+					Effect:   "block",
+				},
+			},
+			wantErrStr: "invalid local assertion effect: block",
+		},
+		{
+			name: "invalid resource",
+			args: args{
+				la: &LocalAssertion{
+					Domain:   "dom",
+					Role:     "role",
+					Action:   "read",
+					Resource: "res",
+					Effect:   "deny",
+				},
+			},
+			wantErrStr: "invalid local assertion: assertion format not correct: Access denied due to invalid/empty policy resources",
+		},
+		{
+			name: "invalid ttl",
+			args: args{
+				la: &LocalAssertion{
+					Domain:   "dom",
+					Role:     "role",
+					Action:   "read",
+					Resource: "dom:res",
+					Effect:   "deny",
+					TTL:      "-1h",
+				},
+			},
+			wantErrStr: "invalid local assertion ttl: -1h",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLocalAssertion(tt.args.la, now)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("newLocalAssertion() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.LocalAssertion, tt.want) {
+				t.Errorf("newLocalAssertion() = %+v, want %+v", got.LocalAssertion, tt.want)
+			}
+			if got.LocalAssertion == tt.args.la {
+				t.Errorf("newLocalAssertion() should copy the given local assertion")
+			}
+			if !got.assertion.Local {
+				t.Errorf("newLocalAssertion() assertion should be marked as local")
+			}
+		})
+	}
+}
+
+func Test_localAssertions(t *testing.T) {
+	ls := newLocalAssertions()
+
+	err := ls.add(
+		&LocalAssertion{Domain: "dom", Role: "role", Action: "read", Resource: "dom:res", Effect: "allow"},
+		&LocalAssertion{Domain: "dom", Role: "role", Action: "*", Resource: "dom:*", Effect: "deny"},
+		&LocalAssertion{Domain: "dom", Role: "*", Action: "write", Resource: "dom:*", Effect: "deny"},
+	)
+	if err != nil {
+		t.Fatalf("localAssertions.add() error = %v", err)
+	}
+
+	// deny first, including the ones of all roles
+	got := ls.get("dom", "role")
+	if len(got) != 3 {
+		t.Fatalf("localAssertions.get() len = %d, want 3", len(got))
+	}
+	if got[0].assertion.Effect == nil || got[1].assertion.Effect == nil || got[2].assertion.Effect != nil {
+		t.Errorf("localAssertions.get() should return denied assertions first, got %+v", got)
+	}
+	if got := ls.get("dom", "other"); len(got) != 1 || got[0].Role != "*" {
+		t.Errorf("localAssertions.get() = %+v, want the assertion of all roles", got)
+	}
+	if got := ls.get("other", "role"); len(got) != 0 {
+		t.Errorf("localAssertions.get() = %+v, want empty", got)
+	}
+
+	// nothing added if any of them is invalid
+	err = ls.add(
+		&LocalAssertion{Domain: "dom2", Role: "role", Action: "read", Resource: "dom2:res", Effect: "allow"},
+		&LocalAssertion{Domain: "dom2", Role: "role", Action: "read", Resource: "dom2:res", Effect: "invalid"},
+	)
+	if err == nil {
+		t.Errorf("localAssertions.add() error = nil, want error")
+	}
+	if got := ls.list(); len(got) != 3 {
+		t.Errorf("localAssertions.list() len = %d, want 3", len(got))
+	}
+
+	// expired assertions are ignored and purged
+	ls.asss["dom:role.role"][0].ExpiresAt = time.Unix(1, 0)
+	if got := ls.get("dom", "role"); len(got) != 2 {
+		t.Errorf("localAssertions.get() len = %d, want 2", len(got))
+	}
+	if got := ls.toRawMap(); len(got["dom:role.role"]) != 1 || len(got["dom:role.*"]) != 1 {
+		t.Errorf("localAssertions.toRawMap() = %+v", got)
+	}
+	if err := ls.add(); err != nil {
+		t.Errorf("localAssertions.add() error = %v", err)
+	}
+	if got := len(ls.asss["dom:role.role"]); got != 1 {
+		t.Errorf("expired local assertion not purged, len = %d", got)
+	}
+
+	if got := ls.delete("dom", "role"); got != 1 {
+		t.Errorf("localAssertions.delete() = %d, want 1", got)
+	}
+	if got := ls.list(); len(got) != 1 || got[0].Role != "*" {
+		t.Errorf("localAssertions.list() = %+v", got)
+	}
+
+	var nilLs *localAssertions
+	if nilLs.get("dom", "role") != nil || nilLs.list() != nil || nilLs.toRawMap() != nil {
+		t.Errorf("nil localAssertions should return nil")
+	}
+}
+
+func Test_policyd_LoadLocalAssertions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	type args struct {
+		ctx  context.Context
+		path string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantLen    int
+		wantErrStr string
+	}{
+		{
+			name: "load success",
+			args: args{
+				ctx: context.Background(),
+				path: writeFile("success.json", `[
+					{"domain":"dom","role":"role","action":"*","resource":"dom:*","effect":"deny","ttl":"30m","reason":"incident"},
+					{"domain":"dom","role":"admin","action":"*","resource":"dom:*","effect":"allow"}
+				]`),
+			},
+			wantLen: 2,
+		},
+		{
+			name: "file not found",
+			args: args{
+				ctx:  context.Background(),
+				path: filepath.Join(dir, "not-found.json"),
+			},
+			wantErrStr: "read local assertions file fail: open " + filepath.Join(dir, "not-found.json") + ": no such file or directory",
+		},
+		{
+			name: "decode fail",
+			args: args{
+				ctx:  context.Background(),
+				path: writeFile("invalid.json", `{}`),
+			},
+			wantErrStr: "local assertions decode fail: json: cannot unmarshal object into Go value of type []*policy.LocalAssertion",
+		},
+		{
+			name: "invalid local assertion",
+			args: args{
+				ctx:  context.Background(),
+				path: writeFile("invalid-effect.json", `[{"domain":"dom","role":"role","action":"*","resource":"dom:*","effect":"block"}]`),
+			},
+			wantErrStr: "invalid local assertion effect: block",
+		},
+		{
+			name: "context canceled",
+			args: args{
+				ctx: func() context.Context {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+					return ctx
+				}(),
+				path: writeFile("canceled.json", `[]`),
+			},
+			wantErrStr: context.Canceled.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				localAssertions: newLocalAssertions(),
+			}
+			err := p.LoadLocalAssertions(tt.args.ctx, tt.args.path)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("policyd.LoadLocalAssertions() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if got := p.GetLocalAssertions(tt.args.ctx); len(got) != tt.wantLen {
+				t.Errorf("policyd.GetLocalAssertions() len = %d, want %d", len(got), tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_policyd_DeleteLocalAssertions(t *testing.T) {
+	p := &policyd{
+		localAssertions: newLocalAssertions(),
+	}
+	ctx := context.Background()
+	if err := p.AddLocalAssertions(ctx, &LocalAssertion{Domain: "dom", Role: "role", Action: "*", Resource: "dom:*", Effect: "deny"}); err != nil {
+		t.Fatal(errors.Wrap(err, "policyd.AddLocalAssertions()"))
+	}
+	if got := p.DeleteLocalAssertions(ctx, "dom", "other"); got != 0 {
+		t.Errorf("policyd.DeleteLocalAssertions() = %d, want 0", got)
+	}
+	if got := p.DeleteLocalAssertions(ctx, "dom", "role"); got != 1 {
+		t.Errorf("policyd.DeleteLocalAssertions() = %d, want 1", got)
+	}
+	if got := p.GetLocalAssertions(ctx); len(got) != 0 {
+		t.Errorf("policyd.GetLocalAssertions() = %+v, want empty", got)
+	}
+}
+
+func Test_localAssertions_principal(t *testing.T) {
+	ls := newLocalAssertions()
+	err := ls.add(
+		&LocalAssertion{Domain: "dom", Principal: "user.alice", Action: "*", Resource: "dom:*", Effect: "deny"},
+		&LocalAssertion{Domain: "dom", Principal: "user.alice", Action: "write", Resource: "dom:*", Effect: "deny", TTL: "1h"},
+		&LocalAssertion{Domain: "dom", Role: "role", Action: "read", Resource: "dom:res", Effect: "allow"},
+	)
+	if err != nil {
+		t.Fatalf("localAssertions.add() error = %v", err)
+	}
+
+	if got := ls.getPrincipal("dom", "user.alice"); len(got) != 2 {
+		t.Errorf("localAssertions.getPrincipal() len = %d, want 2", len(got))
+	}
+	if got := ls.getPrincipal("dom", "user.bob"); len(got) != 0 {
+		t.Errorf("localAssertions.getPrincipal() = %+v, want empty", got)
+	}
+	if got := ls.getPrincipal("dom", ""); len(got) != 0 {
+		t.Errorf("localAssertions.getPrincipal() = %+v, want empty", got)
+	}
+	// the principal assertions are not the role policies
+	if got := ls.toRawMap(); len(got) != 1 || len(got["dom:role.role"]) != 1 {
+		t.Errorf("localAssertions.toRawMap() = %+v", got)
+	}
+	if got := ls.list(); len(got) != 3 {
+		t.Errorf("localAssertions.list() len = %d, want 3", len(got))
+	}
+
+	// expired assertions are ignored and purged
+	ls.prns["dom:principal.user.alice"][1].ExpiresAt = time.Unix(1, 0)
+	if got := ls.getPrincipal("dom", "user.alice"); len(got) != 1 {
+		t.Errorf("localAssertions.getPrincipal() len = %d, want 1", len(got))
+	}
+	if err := ls.add(); err != nil {
+		t.Errorf("localAssertions.add() error = %v", err)
+	}
+	if got := len(ls.prns["dom:principal.user.alice"]); got != 1 {
+		t.Errorf("expired local assertion not purged, len = %d", got)
+	}
+
+	if got := ls.deletePrincipal("dom", "user.alice"); got != 1 {
+		t.Errorf("localAssertions.deletePrincipal() = %d, want 1", got)
+	}
+	if got := ls.list(); len(got) != 1 || got[0].Role != "role" {
+		t.Errorf("localAssertions.list() = %+v", got)
+	}
+}
+
+func Test_policyd_CheckPolicyRoles_principal(t *testing.T) {
+	rp := gache.New[[]*Assertion]()
+	a, err := NewAssertion("*", "dom:*", "allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp.Set("dom:role.role", []*Assertion{a})
+	p := &policyd{
+		rolePolicies:    &rp,
+		localAssertions: newLocalAssertions(),
+	}
+	ctx := context.Background()
+	if err := p.AddLocalAssertions(ctx, &LocalAssertion{Domain: "dom", Principal: "user.alice", Action: "write", Resource: "dom:*", Effect: "deny", Reason: "incident"}); err != nil {
+		t.Fatal(errors.Wrap(err, "policyd.AddLocalAssertions()"))
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		action  string
+		wantErr bool
+	}{
+		{
+			name:    "principal blocked",
+			ctx:     WithPrincipal(ctx, "user.alice"),
+			action:  "write",
+			wantErr: true,
+		},
+		{
+			name:   "other action of the principal",
+			ctx:    WithPrincipal(ctx, "user.alice"),
+			action: "read",
+		},
+		{
+			name:   "other principal",
+			ctx:    WithPrincipal(ctx, "user.bob"),
+			action: "write",
+		},
+		{
+			name:   "principal not on the context",
+			ctx:    ctx,
+			action: "write",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.CheckPolicyRoles(tt.ctx, "dom", []string{"role"}, tt.action, "res")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("policyd.CheckPolicyRoles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := p.DeleteLocalPrincipalAssertions(ctx, "dom", "user.alice"); got != 1 {
+		t.Errorf("policyd.DeleteLocalPrincipalAssertions() = %d, want 1", got)
+	}
+	if _, err := p.CheckPolicyRoles(WithPrincipal(ctx, "user.alice"), "dom", []string{"role"}, "write", "res"); err != nil {
+		t.Errorf("policyd.CheckPolicyRoles() error = %v after delete", err)
+	}
+}
@@ -31,6 +31,7 @@ var (
 		WithRetryDelay("1m"),
 		WithRetryAttempts(2),
 		WithHTTPClient(http.DefaultClient),
+		WithPolicyFileWatchPeriod("1m"),
 	}
 )
 
@@ -150,3 +151,221 @@ func WithHTTPClient(c *http.Client) Option {
 		return nil
 	}
 }
+
+// WithPolicyDir returns a PolicyDir functional option.
+// The policies of the Athenz domains are read from the <dir>/<domain>.pol files (the ZPU layout) instead of fetching from Athenz.
+func WithPolicyDir(dir string) Option {
+	return func(pol *policyd) error {
+		if dir == "" {
+			return nil
+		}
+		pol.policyDir = dir
+		return nil
+	}
+}
+
+// WithPolicyFiles returns a PolicyFiles functional option.
+// The files map has the format of map[<domain>]<policy file path>, the policy of the domain is read from the file instead of fetching from Athenz.
+func WithPolicyFiles(files map[string]string) Option {
+	return func(pol *policyd) error {
+		if files == nil {
+			return nil
+		}
+		pol.policyFiles = files
+		return nil
+	}
+}
+
+// WithPolicyFileWatchPeriod returns a PolicyFileWatchPeriod functional option
+func WithPolicyFileWatchPeriod(d string) Option {
+	return func(pol *policyd) error {
+		if d == "" {
+			return nil
+		}
+		wp, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid policy file watch period")
+		}
+		pol.fileWatchPeriod = wp
+		return nil
+	}
+}
+
+// WithFetcherFactory returns a FetcherFactory functional option.
+// The Fetcher created by the factory is preferred to the default fetchers, and the fetched policy is verified in the same way.
+func WithFetcherFactory(f FetcherFactory) Option {
+	return func(pol *policyd) error {
+		if f != nil {
+			pol.fetcherFactory = f
+		}
+		return nil
+	}
+}
+
+// WithLocalAssertionsFile returns a LocalAssertionsFile functional option.
+// The local assertions in the JSON file are loaded when creating policyd, see LocalAssertion.
+func WithLocalAssertionsFile(path string) Option {
+	return func(pol *policyd) error {
+		if path == "" {
+			return nil
+		}
+		pol.localAssertionsFile = path
+		return nil
+	}
+}
+
+// WithPolicyExportFile returns a PolicyExportFile functional option.
+// The policy cache is seeded by the policy export in JSON or YAML on creation, see ImportPolicies.
+func WithPolicyExportFile(path string) Option {
+	return func(pol *policyd) error {
+		if path == "" {
+			return nil
+		}
+		pol.policyExportFile = path
+		return nil
+	}
+}
+
+// WithCrossDomainResource returns a CrossDomainResource functional option.
+// If enabled, the resource of CheckPolicy may be qualified by the domain as <domain>:<resource>,
+// and the resource domain of the assertions is matched against the qualifier.
+func WithCrossDomainResource(enable bool) Option {
+	return func(pol *policyd) error {
+		pol.crossDomainResource = enable
+		return nil
+	}
+}
+
+// WithCombiningAlgorithm returns a CombiningAlgorithm functional option.
+// It is the combining algorithm of the domains without a domain specific one, deny-overrides by default.
+func WithCombiningAlgorithm(alg CombiningAlgorithm) Option {
+	return func(pol *policyd) error {
+		if alg == "" {
+			return nil
+		}
+		if !alg.IsValid() {
+			return errors.Errorf("invalid combining algorithm: %s", alg)
+		}
+		pol.combiningAlg = alg
+		return nil
+	}
+}
+
+// WithDomainCombiningAlgorithms returns a DomainCombiningAlgorithms functional option.
+// The combining algorithms by domain override the one set by WithCombiningAlgorithm.
+func WithDomainCombiningAlgorithms(algs map[string]CombiningAlgorithm) Option {
+	return func(pol *policyd) error {
+		if len(algs) == 0 {
+			return nil
+		}
+		for domain, alg := range algs {
+			if !alg.IsValid() {
+				return errors.Errorf("invalid combining algorithm: %s, domain: %s", alg, domain)
+			}
+		}
+		pol.domainCombiningAlgs = algs
+		return nil
+	}
+}
+
+// WithCaseSensitive returns a CaseSensitive functional option.
+// If enabled, the action and resource of all the signed assertions are matched in exact case, otherwise case-insensitively.
+func WithCaseSensitive(enable bool) Option {
+	return func(pol *policyd) error {
+		pol.caseSensitivity.all = enable
+		return nil
+	}
+}
+
+// WithDetectCaseSensitive returns a DetectCaseSensitive functional option.
+// If enabled, the signed assertions containing upper case characters in the action or resource are matched in exact case,
+// as ZMS stores the case-insensitive assertions in lower case.
+func WithDetectCaseSensitive(enable bool) Option {
+	return func(pol *policyd) error {
+		pol.caseSensitivity.detect = enable
+		return nil
+	}
+}
+
+// WithStalePolicyGracePeriod returns a StalePolicyGracePeriod functional option.
+// The expired policy is still served for the grace period, e.g. when Athenz is unavailable longer than the policy lifetime.
+func WithStalePolicyGracePeriod(d string) Option {
+	return func(pol *policyd) error {
+		if d == "" {
+			return nil
+		}
+		gp, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid stale policy grace period")
+		}
+		pol.staleGracePeriod = gp
+		return nil
+	}
+}
+
+// WithStalePolicyFailOpen returns a StalePolicyFailOpen functional option.
+// If enabled, the policy expired beyond the grace period is still evaluated, and the requests are allowed only if no policy of the domain is available,
+// unless a local assertion of the roles denies them.
+// Otherwise, the requests are denied with ErrDomainExpired when the policy is expired beyond the grace period.
+func WithStalePolicyFailOpen(enable bool) Option {
+	return func(pol *policyd) error {
+		pol.staleFailOpen = enable
+		return nil
+	}
+}
+
+// WithFetchConcurrency returns a FetchConcurrency functional option.
+// At most the given number of the domains are fetched at once on the policy update, 0 for unlimited.
+func WithFetchConcurrency(c int) Option {
+	return func(pol *policyd) error {
+		if c < 0 {
+			return errors.Errorf("invalid fetch concurrency: %d", c)
+		}
+		pol.fetchConcurrency = c
+		return nil
+	}
+}
+
+// WithRefreshJitter returns a RefreshJitter functional option.
+// A random delay up to the jitter is added to each refresh period, including the first one, to desynchronize the replicas.
+// If any policy is not cached on Start, the first refresh is delayed only by the jitter and the domains are fetched within the spread.
+func WithRefreshJitter(d string) Option {
+	return func(pol *policyd) error {
+		if d == "" {
+			return nil
+		}
+		rj, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid refresh jitter")
+		}
+		pol.refreshJitter = rj
+		return nil
+	}
+}
+
+// WithRefreshSpread returns a RefreshSpread functional option.
+// On the periodic refresh, the domains are fetched at random offsets within the spread instead of all at once.
+// The new policy cache becomes effective after all the domains are fetched, so the spread should be shorter than the refresh period.
+func WithRefreshSpread(d string) Option {
+	return func(pol *policyd) error {
+		if d == "" {
+			return nil
+		}
+		rs, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid refresh spread")
+		}
+		pol.refreshSpread = rs
+		return nil
+	}
+}
+
+// WithResourceHierarchy returns a ResourceHierarchy functional option.
+// If enabled, the resources of the signed assertions are matched by the path segments separated by "/",
+// i.e. "*" and "?" match within a segment, and "**" matches across the segments. Otherwise "*" matches any characters including "/".
+func WithResourceHierarchy(enable bool) Option {
+	return func(pol *policyd) error {
+		pol.resourceHierarchy = enable
+		return nil
+	}
+}
@@ -582,6 +582,526 @@ func TestWithRetryAttempts(t *testing.T) {
 	}
 }
 
+func TestWithPolicyDir(t *testing.T) {
+	type args struct {
+		dir string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				dir: "/var/zpe",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.policyDir != "/var/zpe" {
+					return fmt.Errorf("Error")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyDir(tt.args.dir)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyDir() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyFiles(t *testing.T) {
+	type args struct {
+		files map[string]string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				files: map[string]string{"dom1": "/tmp/dom1.pol"},
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol.policyFiles, map[string]string{"dom1": "/tmp/dom1.pol"}) {
+					return fmt.Errorf("Error")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				nil,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyFiles(tt.args.files)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyFiles() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyFileWatchPeriod(t *testing.T) {
+	type args struct {
+		d string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				d: "10s",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.fileWatchPeriod != 10*time.Second {
+					return fmt.Errorf("Error")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "invalid format",
+			args: args{
+				"dummy",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				want := "invalid policy file watch period: time: invalid duration \"dummy\""
+				if err := opt(pol); err == nil || err.Error() != want {
+					return fmt.Errorf("expected error %v, but got %v", want, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyFileWatchPeriod(tt.args.d)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyFileWatchPeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithFetcherFactory(t *testing.T) {
+	type args struct {
+		f FetcherFactory
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}
+	tests := []test{
+		func() test {
+			f := FetcherFactory(func(domain string) Fetcher {
+				return nil
+			})
+			return test{
+				name: "set success",
+				args: args{
+					f: f,
+				},
+				checkFunc: func(opt Option) error {
+					pol := &policyd{}
+					if err := opt(pol); err != nil {
+						return err
+					}
+					if reflect.ValueOf(pol.fetcherFactory) != reflect.ValueOf(f) {
+						return fmt.Errorf("Error")
+					}
+
+					return nil
+				},
+			}
+		}(),
+		{
+			name: "empty value",
+			args: args{
+				nil,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithFetcherFactory(tt.args.f)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithFetcherFactory() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithLocalAssertionsFile(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				path: "/etc/athenz/local_assertions.json",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.localAssertionsFile != "/etc/athenz/local_assertions.json" {
+					return fmt.Errorf("Error")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithLocalAssertionsFile(tt.args.path)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithLocalAssertionsFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPolicyExportFile(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				path: "/tmp/policies.yaml",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.policyExportFile != "/tmp/policies.yaml" {
+					return fmt.Errorf("Error")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithPolicyExportFile(tt.args.path)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithPolicyExportFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithCrossDomainResource(t *testing.T) {
+	type args struct {
+		enable bool
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "enable",
+			args: args{
+				enable: true,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !pol.crossDomainResource {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "disable",
+			args: args{
+				enable: false,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{crossDomainResource: true}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.crossDomainResource {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithCrossDomainResource(tt.args.enable)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithCrossDomainResource() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithCombiningAlgorithm(t *testing.T) {
+	type args struct {
+		alg CombiningAlgorithm
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				alg: PermitOverrides,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.combiningAlg != PermitOverrides {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid algorithm",
+			args: args{
+				alg: "only-one-applicable",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err == nil || err.Error() != "invalid combining algorithm: only-one-applicable" {
+					return fmt.Errorf("unexpected error: %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				alg: "",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithCombiningAlgorithm(tt.args.alg)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithCombiningAlgorithm() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithDomainCombiningAlgorithms(t *testing.T) {
+	type args struct {
+		algs map[string]CombiningAlgorithm
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				algs: map[string]CombiningAlgorithm{"dom1": FirstApplicable, "dom2": RoleDenyOverrides},
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol.domainCombiningAlgs, map[string]CombiningAlgorithm{"dom1": FirstApplicable, "dom2": RoleDenyOverrides}) {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid algorithm",
+			args: args{
+				algs: map[string]CombiningAlgorithm{"dom1": "invalid"},
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err == nil || err.Error() != "invalid combining algorithm: invalid, domain: dom1" {
+					return fmt.Errorf("unexpected error: %v", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				nil,
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithDomainCombiningAlgorithms(tt.args.algs)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithDomainCombiningAlgorithms() error = %v", err)
+			}
+		})
+	}
+}
+
 func equalStringSlice(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -593,3 +1113,359 @@ func equalStringSlice(a, b []string) bool {
 	}
 	return true
 }
+
+func TestWithCaseSensitive(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+		want   caseSensitivity
+	}{
+		{
+			name:   "enable",
+			enable: true,
+			want:   caseSensitivity{all: true, detect: true},
+		},
+		{
+			name:   "disable",
+			enable: false,
+			want:   caseSensitivity{detect: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := &policyd{caseSensitivity: caseSensitivity{all: !tt.enable, detect: true}}
+			if err := WithCaseSensitive(tt.enable)(pol); err != nil {
+				t.Errorf("WithCaseSensitive() error = %v", err)
+			}
+			if pol.caseSensitivity != tt.want {
+				t.Errorf("WithCaseSensitive() = %+v, want %+v", pol.caseSensitivity, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithDetectCaseSensitive(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+		want   caseSensitivity
+	}{
+		{
+			name:   "enable",
+			enable: true,
+			want:   caseSensitivity{all: true, detect: true},
+		},
+		{
+			name:   "disable",
+			enable: false,
+			want:   caseSensitivity{all: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := &policyd{caseSensitivity: caseSensitivity{all: true, detect: !tt.enable}}
+			if err := WithDetectCaseSensitive(tt.enable)(pol); err != nil {
+				t.Errorf("WithDetectCaseSensitive() error = %v", err)
+			}
+			if pol.caseSensitivity != tt.want {
+				t.Errorf("WithDetectCaseSensitive() = %+v, want %+v", pol.caseSensitivity, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithResourceHierarchy(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+	}{
+		{
+			name:   "enable",
+			enable: true,
+		},
+		{
+			name:   "disable",
+			enable: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := &policyd{resourceHierarchy: !tt.enable}
+			if err := WithResourceHierarchy(tt.enable)(pol); err != nil {
+				t.Errorf("WithResourceHierarchy() error = %v", err)
+			}
+			if pol.resourceHierarchy != tt.enable {
+				t.Errorf("WithResourceHierarchy() = %v, want %v", pol.resourceHierarchy, tt.enable)
+			}
+		})
+	}
+}
+
+func TestWithStalePolicyGracePeriod(t *testing.T) {
+	type args struct {
+		d string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				d: "6h",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.staleGracePeriod != 6*time.Hour {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid format",
+			args: args{
+				"dummy",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				want := "invalid stale policy grace period: time: invalid duration \"dummy\""
+				if err := opt(pol); err == nil || err.Error() != want {
+					return fmt.Errorf("expected error %v, but got %v", want, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithStalePolicyGracePeriod(tt.args.d)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithStalePolicyGracePeriod() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithStalePolicyFailOpen(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable bool
+	}{
+		{
+			name:   "enable",
+			enable: true,
+		},
+		{
+			name:   "disable",
+			enable: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := &policyd{staleFailOpen: !tt.enable}
+			if err := WithStalePolicyFailOpen(tt.enable)(pol); err != nil {
+				t.Errorf("WithStalePolicyFailOpen() error = %v", err)
+			}
+			if pol.staleFailOpen != tt.enable {
+				t.Errorf("WithStalePolicyFailOpen() = %v, want %v", pol.staleFailOpen, tt.enable)
+			}
+		})
+	}
+}
+
+func TestWithRefreshJitter(t *testing.T) {
+	type args struct {
+		d string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				d: "5m",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.refreshJitter != 5*time.Minute {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid format",
+			args: args{
+				"dummy",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				want := "invalid refresh jitter: time: invalid duration \"dummy\""
+				if err := opt(pol); err == nil || err.Error() != want {
+					return fmt.Errorf("expected error %v, but got %v", want, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithRefreshJitter(tt.args.d)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithRefreshJitter() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithRefreshSpread(t *testing.T) {
+	type args struct {
+		d string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				d: "10m",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if pol.refreshSpread != 10*time.Minute {
+					return fmt.Errorf("Error")
+				}
+				return nil
+			},
+		},
+		{
+			name: "invalid format",
+			args: args{
+				"dummy",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				want := "invalid refresh spread: time: invalid duration \"dummy\""
+				if err := opt(pol); err == nil || err.Error() != want {
+					return fmt.Errorf("expected error %v, but got %v", want, err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "empty value",
+			args: args{
+				"",
+			},
+			checkFunc: func(opt Option) error {
+				pol := &policyd{}
+				if err := opt(pol); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(pol, &policyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", pol)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithRefreshSpread(tt.args.d)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithRefreshSpread() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithFetchConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       int
+		want    int
+		wantErr string
+	}{
+		{
+			name: "set success",
+			c:    10,
+			want: 10,
+		},
+		{
+			name: "unlimited",
+			c:    0,
+			want: 0,
+		},
+		{
+			name:    "negative value",
+			c:       -1,
+			wantErr: "invalid fetch concurrency: -1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := &policyd{}
+			err := WithFetchConcurrency(tt.c)(pol)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("WithFetchConcurrency() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("WithFetchConcurrency() error = %v", err)
+				return
+			}
+			if pol.fetchConcurrency != tt.want {
+				t.Errorf("WithFetchConcurrency() = %v, want %v", pol.fetchConcurrency, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kpango/gache/v2"
+)
+
+// AccessRoles represents the roles of a domain which are allowed or explicitly denied to access a resource.
+type AccessRoles struct {
+	AllowedRoles []string `json:"allowed_roles"`
+	DeniedRoles  []string `json:"denied_roles"`
+}
+
+// Permission represents the action and resource pattern allowed to a role.
+type Permission struct {
+	Role     string `json:"role"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"` // <domain>:<resource>
+	Local    bool   `json:"local,omitempty"`
+
+	// PartiallyDeniedBy contains the deny assertions overlapping the permission, i.e. part of the permission is denied.
+	PartiallyDeniedBy []*Assertion `json:"partially_denied_by,omitempty"`
+}
+
+// GetAccessRoles returns the roles of the domain allowed or explicitly denied to do the action on the resource.
+// Each role is evaluated on its own in the same way as CheckPolicyRoles with the combining algorithm of the domain,
+// i.e. the result is the decision of the token with only the role.
+func (p *policyd) GetAccessRoles(ctx context.Context, domain, action, resource string) *AccessRoles {
+	rp := p.loadRolePolicies()
+	resDomain, res := p.resourceDomain(domain, resource)
+	alg := p.combiningAlgorithm(domain)
+
+	ar := &AccessRoles{
+		AllowedRoles: make([]string, 0),
+		DeniedRoles:  make([]string, 0),
+	}
+	for _, role := range p.domainRoles(ctx, rp, domain) {
+		re, ok := p.evaluateRole(ctx, rp, alg, domain, role, resDomain, action, res)
+		if !ok {
+			continue
+		}
+		if _, err := combineRoleEffects(alg, []roleEffect{re}); err == nil {
+			ar.AllowedRoles = append(ar.AllowedRoles, role)
+		} else {
+			ar.DeniedRoles = append(ar.DeniedRoles, role)
+		}
+	}
+	return ar
+}
+
+// GetRolePermissions returns the action and resource patterns allowed to the roles of the domain.
+// Same as CheckPolicyRoles, the deny assertions are applied by the combining algorithm of the domain,
+// e.g. with deny-overrides the deny assertions of any of the roles take precedence, and with role-deny-overrides only the ones of the same role.
+// The permission fully covered by a deny assertion is excluded, and the partially overlapping deny assertions are attached to the permission.
+func (p *policyd) GetRolePermissions(ctx context.Context, domain string, roles []string) []*Permission {
+	rp := p.loadRolePolicies()
+	alg := p.combiningAlgorithm(domain)
+
+	type roleAssertion struct {
+		role string
+		ass  *Assertion
+	}
+	var allows, denies []roleAssertion
+	for _, role := range roles {
+		for _, ass := range p.roleAssertions(rp, domain, role) {
+			if ass.Effect == nil {
+				allows = append(allows, roleAssertion{role: role, ass: ass})
+			} else {
+				denies = append(denies, roleAssertion{role: role, ass: ass})
+			}
+		}
+	}
+
+	perms := make([]*Permission, 0, len(allows))
+	for _, ra := range allows {
+		perm := &Permission{
+			Role:     ra.role,
+			Action:   ra.ass.Action,
+			Resource: ra.ass.ResourceDomain + ":" + ra.ass.Resource,
+			Local:    ra.ass.Local,
+		}
+		denied := false
+		for _, rd := range denies {
+			deny := rd.ass
+			if !strings.EqualFold(deny.ResourceDomain, ra.ass.ResourceDomain) || !denyApplies(alg, rd.role, deny, ra.role, ra.ass) {
+				continue
+			}
+			if globCovers(actionGlob(deny), actionGlob(ra.ass)) && globCovers(resourceGlob(deny), resourceGlob(ra.ass)) {
+				denied = true
+				break
+			}
+			if globOverlaps(actionGlob(deny), actionGlob(ra.ass)) && globOverlaps(resourceGlob(deny), resourceGlob(ra.ass)) {
+				perm.PartiallyDeniedBy = append(perm.PartiallyDeniedBy, deny)
+			}
+		}
+		if !denied {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// denyApplies reports whether the deny assertion of the deny role takes precedence over the allow assertion of the allow role by the combining algorithm.
+// Within a role, the local assertions are applied before the signed assertions.
+func denyApplies(alg CombiningAlgorithm, denyRole string, deny *Assertion, allowRole string, allow *Assertion) bool {
+	sameRole := denyRole == allowRole
+	switch alg {
+	case FirstApplicable:
+		// the denied one is prioritized between the assertions of the same order, same as combineRoleEffects
+		return assertionOrder(deny) <= assertionOrder(allow)
+	case RoleDenyOverrides, PermitOverrides:
+		if !sameRole {
+			return false
+		}
+	default:
+		if !sameRole {
+			return true
+		}
+	}
+	if deny.Local != allow.Local {
+		return deny.Local
+	}
+	// with permit-overrides, the allow assertion of the role takes precedence over the deny assertion of the role
+	return alg != PermitOverrides
+}
+
+// assertionOrder returns the order of the assertion in the evaluation, where the local assertions come first
+func assertionOrder(ass *Assertion) int {
+	if ass.Local {
+		return localAssertionOrder
+	}
+	return ass.Order
+}
+
+// domainRoles returns the sorted role names of the domain having signed or local assertions
+func (p *policyd) domainRoles(ctx context.Context, rp gache.Gache[[]*Assertion], domain string) []string {
+	prefix := domain + ":role."
+	rm := make(map[string]struct{})
+	for key := range rp.ToRawMap(ctx) {
+		if strings.HasPrefix(key, prefix) {
+			rm[strings.TrimPrefix(key, prefix)] = struct{}{}
+		}
+	}
+	for key := range p.localAssertions.toRawMap() {
+		if strings.HasPrefix(key, prefix) {
+			rm[strings.TrimPrefix(key, prefix)] = struct{}{}
+		}
+	}
+	delete(rm, localAnyRole)
+
+	roles := make([]string, 0, len(rm))
+	for role := range rm {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// roleAssertions returns the assertions of the domain role in the evaluation order, i.e. the local assertions first, and the deny assertions first
+func (p *policyd) roleAssertions(rp gache.Gache[[]*Assertion], domain, role string) []*Assertion {
+	las := p.localAssertions.get(domain, role)
+	asss, _ := rp.Get(fmt.Sprintf("%s:role.%s", domain, role))
+	rasss := make([]*Assertion, 0, len(las)+len(asss))
+	for _, la := range las {
+		rasss = append(rasss, la.assertion)
+	}
+	return append(rasss, asss...)
+}
+
+// maxGlobAlternatives is the max. number of "**/" in a hierarchical glob to be analyzed, beyond which the glob is handled conservatively
+const maxGlobAlternatives = 4
+
+// globToken is a token of the glob, either a literal character, '?' or '*'.
+// In the hierarchical mode, '?' and '*' do not match "/" (noSlash) and "**" is '*' matching "/".
+type globToken struct {
+	r       rune
+	any     bool // '*'
+	one     bool // '?'
+	noSlash bool // the wildcard does not match "/"
+}
+
+// canBe reports whether the single character token can match the rune
+func (t globToken) canBe(r rune) bool {
+	if t.one || t.any {
+		return !t.noSlash || r != '/'
+	}
+	return t.r == r
+}
+
+// compatible reports whether the tokens can match the same character
+func (t globToken) compatible(u globToken) bool {
+	switch {
+	case !t.one && !t.any:
+		return u.canBe(t.r)
+	case !u.one && !u.any:
+		return t.canBe(u.r)
+	}
+	return true
+}
+
+// within reports whether every character matched by the token t is also matched by the wildcard w
+func (t globToken) within(w globToken) bool {
+	if !w.noSlash {
+		return true
+	}
+	if !t.one && !t.any {
+		return t.r != '/'
+	}
+	return t.noSlash
+}
+
+// glob is the source glob of the action or resource of an assertion with its matching mode, analyzed by globCovers and globOverlaps.
+// Each alternative is a token list, e.g. "a/**/b" in the hierarchical mode has the alternatives "a/b" and "a/**/b" with "**" as any characters.
+type glob struct {
+	alts [][]globToken
+	ok   bool // false if the glob is too complex to be analyzed
+}
+
+// anyGlob is the glob matching any string
+var anyGlob = glob{alts: [][]globToken{{{any: true}}}, ok: true}
+
+// actionGlob returns the glob of the action of the assertion
+func actionGlob(a *Assertion) glob {
+	return newGlob(a.Action, a.CaseSensitive, false)
+}
+
+// resourceGlob returns the glob of the resource of the assertion, without the resource domain
+func resourceGlob(a *Assertion) glob {
+	return newGlob(a.Resource, a.CaseSensitive, a.Hierarchical)
+}
+
+// newGlob parses the glob in the same way as patternFromGlob, or patternFromHierarchicalGlob if hierarchical
+func newGlob(s string, caseSensitive, hierarchical bool) glob {
+	if !caseSensitive {
+		s = strings.ToLower(s)
+	}
+	alts := [][]globToken{make([]globToken, 0, len(s))}
+	add := func(ts ...globToken) {
+		for i := range alts {
+			alts[i] = append(alts[i], ts...)
+		}
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case !hierarchical && r == '*':
+			add(globToken{any: true})
+		case !hierarchical && r == '?':
+			add(globToken{one: true})
+		case strings.HasPrefix(s[i:], "**/"):
+			// "**/" matches no segment, or any characters ending with "/"
+			if len(alts) >= 1<<maxGlobAlternatives {
+				return glob{}
+			}
+			n := len(alts)
+			for j := 0; j < n; j++ {
+				alt := append(append(make([]globToken, 0, len(alts[j])+2), alts[j]...), globToken{any: true}, globToken{r: '/'})
+				alts = append(alts, alt)
+			}
+			size = 3
+		case strings.HasPrefix(s[i:], "**"):
+			add(globToken{any: true})
+			size = 2
+		case r == '*':
+			add(globToken{any: true, noSlash: true})
+		case r == '?':
+			add(globToken{one: true, noSlash: true})
+		default:
+			add(globToken{r: r})
+		}
+		i += size
+	}
+	return glob{alts: alts, ok: true}
+}
+
+// globCovers reports whether every string matched by the glob b is also matched by the glob a.
+// The result is conservative, i.e. false if not sure.
+func globCovers(a, b glob) bool {
+	if !a.ok || !b.ok {
+		return false
+	}
+	for _, tb := range b.alts {
+		covered := false
+		for _, ta := range a.alts {
+			if tokensCover(ta, tb) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func tokensCover(ta, tb []globToken) bool {
+	memo := make(map[[2]int]bool)
+	var covers func(i, j int) bool
+	covers = func(i, j int) bool {
+		key := [2]int{i, j}
+		if v, ok := memo[key]; ok {
+			return v
+		}
+		var v bool
+		switch {
+		case i == len(ta):
+			v = j == len(tb)
+		case ta[i].any:
+			v = covers(i+1, j) || (j < len(tb) && tb[j].within(ta[i]) && covers(i, j+1))
+		case j == len(tb) || tb[j].any:
+			v = false
+		case tb[j].one:
+			v = ta[i].one && tb[j].within(ta[i]) && covers(i+1, j+1)
+		default:
+			v = ta[i].canBe(tb[j].r) && covers(i+1, j+1)
+		}
+		memo[key] = v
+		return v
+	}
+	return covers(0, 0)
+}
+
+// globOverlaps reports whether any string is matched by both the glob a and the glob b.
+// The result is conservative, i.e. true if not sure.
+func globOverlaps(a, b glob) bool {
+	if !a.ok || !b.ok {
+		return true
+	}
+	for _, ta := range a.alts {
+		for _, tb := range b.alts {
+			if tokensOverlap(ta, tb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func tokensOverlap(ta, tb []globToken) bool {
+	memo := make(map[[2]int]bool)
+	var overlaps func(i, j int) bool
+	overlaps = func(i, j int) bool {
+		key := [2]int{i, j}
+		if v, ok := memo[key]; ok {
+			return v
+		}
+		var v bool
+		switch {
+		case i < len(ta) && ta[i].any:
+			v = overlaps(i+1, j) || (j < len(tb) && ta[i].compatible(tb[j]) && overlaps(i, j+1))
+		case j < len(tb) && tb[j].any:
+			v = overlaps(i, j+1) || (i < len(ta) && tb[j].compatible(ta[i]) && overlaps(i+1, j))
+		case i == len(ta) || j == len(tb):
+			v = i == len(ta) && j == len(tb)
+		default:
+			v = ta[i].compatible(tb[j]) && overlaps(i+1, j+1)
+		}
+		memo[key] = v
+		return v
+	}
+	return overlaps(0, 0)
+}
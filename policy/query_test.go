@@ -0,0 +1,563 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kpango/gache/v2"
+)
+
+func newTestAssertion(action, resource, effect string) *Assertion {
+	a, err := NewAssertion(action, resource, effect)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func newTestRolePolicies(rps map[string][]*Assertion) *gache.Gache[[]*Assertion] {
+	g := gache.New[[]*Assertion]()
+	for k, v := range rps {
+		g.Set(k, v)
+	}
+	return &g
+}
+
+func Test_globCovers(t *testing.T) {
+	type args struct {
+		a            string
+		b            string
+		hierarchical bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "same literal",
+			args: args{a: "read", b: "read"},
+			want: true,
+		},
+		{
+			name: "different literal",
+			args: args{a: "read", b: "write"},
+			want: false,
+		},
+		{
+			name: "star covers anything",
+			args: args{a: "*", b: "path/*/x?"},
+			want: true,
+		},
+		{
+			name: "prefix star covers longer prefix",
+			args: args{a: "path/*", b: "path/sub/*"},
+			want: true,
+		},
+		{
+			name: "longer prefix does not cover shorter",
+			args: args{a: "path/sub/*", b: "path/*"},
+			want: false,
+		},
+		{
+			name: "question covers literal",
+			args: args{a: "file?", b: "file1"},
+			want: true,
+		},
+		{
+			name: "literal does not cover question",
+			args: args{a: "file1", b: "file?"},
+			want: false,
+		},
+		{
+			name: "escaped meta characters",
+			args: args{a: "a.b*", b: "a.b.c"},
+			want: true,
+		},
+		{
+			name: "escaped dot is not a wildcard",
+			args: args{a: "a.b", b: "axb"},
+			want: false,
+		},
+		{
+			name: "hierarchical star covers a segment",
+			args: args{a: "bucket/*", b: "bucket/b", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "hierarchical star does not cover segments",
+			args: args{a: "bucket/*", b: "bucket/b/c", hierarchical: true},
+			want: false,
+		},
+		{
+			name: "hierarchical double star covers segments",
+			args: args{a: "bucket/**", b: "bucket/*/c?", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "hierarchical star does not cover double star",
+			args: args{a: "bucket/*", b: "bucket/**", hierarchical: true},
+			want: false,
+		},
+		{
+			name: "hierarchical double star segment covers no segment",
+			args: args{a: "a/**/b", b: "a/b", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "hierarchical double star segment covers segments",
+			args: args{a: "a/**/b", b: "a/x/*/b", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "literal does not cover hierarchical double star segment",
+			args: args{a: "a/b", b: "a/**/b", hierarchical: true},
+			want: false,
+		},
+		{
+			name: "hierarchical question does not cover slash",
+			args: args{a: "a?b", b: "a/b", hierarchical: true},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newGlob(tt.args.a, false, tt.args.hierarchical), newGlob(tt.args.b, false, tt.args.hierarchical)
+			if got := globCovers(a, b); got != tt.want {
+				t.Errorf("globCovers(%s, %s) = %v, want %v", tt.args.a, tt.args.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_globOverlaps(t *testing.T) {
+	type args struct {
+		a            string
+		b            string
+		hierarchical bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "same literal",
+			args: args{a: "read", b: "read"},
+			want: true,
+		},
+		{
+			name: "different literal",
+			args: args{a: "read", b: "write"},
+			want: false,
+		},
+		{
+			name: "prefix and suffix stars",
+			args: args{a: "path/*", b: "*/secret"},
+			want: true,
+		},
+		{
+			name: "disjoint prefixes",
+			args: args{a: "public/*", b: "private/*"},
+			want: false,
+		},
+		{
+			name: "question and literal",
+			args: args{a: "file?", b: "file1"},
+			want: true,
+		},
+		{
+			name: "different length without star",
+			args: args{a: "file?", b: "file"},
+			want: false,
+		},
+		{
+			name: "hierarchical star within a segment",
+			args: args{a: "bucket/*", b: "bucket/b/c", hierarchical: true},
+			want: false,
+		},
+		{
+			name: "hierarchical double star and star",
+			args: args{a: "bucket/**", b: "*/c", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "hierarchical double star segment and no segment",
+			args: args{a: "a/**/b", b: "a/b", hierarchical: true},
+			want: true,
+		},
+		{
+			name: "hierarchical question and slash",
+			args: args{a: "a?b", b: "a/b", hierarchical: true},
+			want: false,
+		},
+		{
+			name: "question and slash",
+			args: args{a: "a?b", b: "a/b"},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newGlob(tt.args.a, false, tt.args.hierarchical), newGlob(tt.args.b, false, tt.args.hierarchical)
+			if got := globOverlaps(a, b); got != tt.want {
+				t.Errorf("globOverlaps(%s, %s) = %v, want %v", tt.args.a, tt.args.b, got, tt.want)
+			}
+			if got := globOverlaps(b, a); got != tt.want {
+				t.Errorf("globOverlaps(%s, %s) = %v, want %v", tt.args.b, tt.args.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyd_GetAccessRoles(t *testing.T) {
+	type fields struct {
+		rolePolicies    *gache.Gache[[]*Assertion]
+		localAssertions *localAssertions
+		combiningAlg    CombiningAlgorithm
+	}
+	type args struct {
+		ctx      context.Context
+		domain   string
+		action   string
+		resource string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   *AccessRoles
+	}{
+		{
+			name: "allowed and denied roles",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestAssertion("read", "dom:*", "allow"),
+					},
+					"dom:role.writer": {
+						newTestAssertion("*", "dom:secret", "deny"),
+						newTestAssertion("*", "dom:*", "allow"),
+					},
+					"dom:role.admin": {
+						newTestAssertion("*", "dom:*", "allow"),
+					},
+					"dom:role.other": {
+						newTestAssertion("write", "dom:*", "allow"),
+					},
+					"otherdom:role.reader": {
+						newTestAssertion("read", "otherdom:*", "allow"),
+					},
+				}),
+				localAssertions: func() *localAssertions {
+					ls := newLocalAssertions()
+					if err := ls.add(&LocalAssertion{Domain: "dom", Role: "admin", Action: "*", Resource: "dom:secret", Effect: "deny"}); err != nil {
+						panic(err)
+					}
+					return ls
+				}(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dom",
+				action:   "read",
+				resource: "secret",
+			},
+			want: &AccessRoles{
+				AllowedRoles: []string{"reader"},
+				DeniedRoles:  []string{"admin", "writer"},
+			},
+		},
+		{
+			name: "first-applicable, allow before deny in policy order",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestOrderedAssertion("read", "dom:secret", "deny", 1),
+						newTestOrderedAssertion("read", "dom:*", "allow", 0),
+					},
+					"dom:role.blocked": {
+						newTestOrderedAssertion("read", "dom:*", "deny", 2),
+						newTestOrderedAssertion("read", "dom:secret", "allow", 3),
+					},
+				}),
+				combiningAlg: FirstApplicable,
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dom",
+				action:   "read",
+				resource: "secret",
+			},
+			want: &AccessRoles{
+				AllowedRoles: []string{"reader"},
+				DeniedRoles:  []string{"blocked"},
+			},
+		},
+		{
+			name: "permit-overrides, deny and allow in the same role",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestOrderedAssertion("read", "dom:secret", "deny", 1),
+						newTestOrderedAssertion("read", "dom:*", "allow", 0),
+					},
+				}),
+				combiningAlg: PermitOverrides,
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dom",
+				action:   "read",
+				resource: "secret",
+			},
+			want: &AccessRoles{
+				AllowedRoles: []string{"reader"},
+				DeniedRoles:  []string{},
+			},
+		},
+		{
+			name: "no roles",
+			fields: fields{
+				rolePolicies: newGache(),
+			},
+			args: args{
+				ctx:      context.Background(),
+				domain:   "dom",
+				action:   "read",
+				resource: "secret",
+			},
+			want: &AccessRoles{
+				AllowedRoles: []string{},
+				DeniedRoles:  []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				rolePolicies:    tt.fields.rolePolicies,
+				localAssertions: tt.fields.localAssertions,
+				combiningAlg:    tt.fields.combiningAlg,
+			}
+			if got := p.GetAccessRoles(tt.args.ctx, tt.args.domain, tt.args.action, tt.args.resource); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyd.GetAccessRoles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyd_GetRolePermissions(t *testing.T) {
+	denySecret := newTestAssertion("*", "dom:secret/*", "deny")
+	denyBucket, err := NewHierarchicalAssertion("read", "dom:bucket/*", "deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHierarchicalAssertion := func(action, resource, effect string) *Assertion {
+		a, err := NewHierarchicalAssertion(action, resource, effect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	withOrder := func(a *Assertion, order int) *Assertion {
+		a.Order = order
+		return a
+	}
+	type fields struct {
+		rolePolicies *gache.Gache[[]*Assertion]
+		combiningAlg CombiningAlgorithm
+	}
+	type args struct {
+		ctx    context.Context
+		domain string
+		roles  []string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   []*Permission
+	}{
+		{
+			name: "deny of the other role takes precedence",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestAssertion("read", "dom:public/*", "allow"),
+						newTestAssertion("read", "dom:secret/doc", "allow"),
+						newTestAssertion("read", "dom:*", "allow"),
+					},
+					"dom:role.restricted": {
+						denySecret,
+					},
+				}),
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader", "restricted"},
+			},
+			want: []*Permission{
+				{
+					Role:     "reader",
+					Action:   "read",
+					Resource: "dom:public/*",
+				},
+				{
+					Role:              "reader",
+					Action:            "read",
+					Resource:          "dom:*",
+					PartiallyDeniedBy: []*Assertion{denySecret},
+				},
+			},
+		},
+		{
+			name: "hierarchical deny within a segment",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						denyBucket,
+						newHierarchicalAssertion("read", "dom:bucket/b", "allow"),
+						newHierarchicalAssertion("read", "dom:bucket/b/*", "allow"),
+						newHierarchicalAssertion("read", "dom:bucket/**", "allow"),
+					},
+				}),
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader"},
+			},
+			want: []*Permission{
+				{
+					Role:     "reader",
+					Action:   "read",
+					Resource: "dom:bucket/b/*",
+				},
+				{
+					Role:              "reader",
+					Action:            "read",
+					Resource:          "dom:bucket/**",
+					PartiallyDeniedBy: []*Assertion{denyBucket},
+				},
+			},
+		},
+		{
+			name: "role-deny-overrides, deny of the other role does not apply",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestAssertion("read", "dom:secret/doc", "allow"),
+					},
+					"dom:role.restricted": {
+						denySecret,
+						newTestAssertion("read", "dom:secret/*", "allow"),
+					},
+				}),
+				combiningAlg: RoleDenyOverrides,
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader", "restricted"},
+			},
+			want: []*Permission{
+				{
+					Role:     "reader",
+					Action:   "read",
+					Resource: "dom:secret/doc",
+				},
+			},
+		},
+		{
+			name: "permit-overrides, deny does not apply",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						denySecret,
+						newTestAssertion("read", "dom:secret/doc", "allow"),
+					},
+				}),
+				combiningAlg: PermitOverrides,
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader"},
+			},
+			want: []*Permission{
+				{
+					Role:     "reader",
+					Action:   "read",
+					Resource: "dom:secret/doc",
+				},
+			},
+		},
+		{
+			name: "first-applicable, only the preceding deny applies",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						withOrder(newTestAssertion("read", "dom:secret/doc", "allow"), 0),
+						withOrder(newTestAssertion("read", "dom:secret/key", "allow"), 2),
+					},
+					"dom:role.restricted": {
+						withOrder(newTestAssertion("*", "dom:secret/*", "deny"), 1),
+					},
+				}),
+				combiningAlg: FirstApplicable,
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader", "restricted"},
+			},
+			want: []*Permission{
+				{
+					Role:     "reader",
+					Action:   "read",
+					Resource: "dom:secret/doc",
+				},
+			},
+		},
+		{
+			name: "no permissions",
+			fields: fields{
+				rolePolicies: newGache(),
+			},
+			args: args{
+				ctx:    context.Background(),
+				domain: "dom",
+				roles:  []string{"reader"},
+			},
+			want: []*Permission{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				rolePolicies: tt.fields.rolePolicies,
+				combiningAlg: tt.fields.combiningAlg,
+			}
+			if got := p.GetRolePermissions(tt.args.ctx, tt.args.domain, tt.args.roles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyd.GetRolePermissions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
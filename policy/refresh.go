@@ -0,0 +1,170 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+type bypassCacheKey struct{}
+
+// BypassCache returns a copy of the context, with which the fetchers ignore the ETag and the cached policy file, and fetch the full policy.
+func BypassCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// IsCacheBypassed reports whether the context is created by BypassCache, e.g. for the custom Fetcher to honor it.
+func IsCacheBypassed(ctx context.Context) bool {
+	b, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return b
+}
+
+// Refresh fetches the policies of the domains immediately, and replaces them in the policy cache, e.g. on the change notification.
+// All the domains are refreshed if no domain is given. ErrDomainNotFound is returned if any domain is not in the target domains.
+// The concurrent Refresh of the same domains are coalesced into a single fetch, and the policy cache is not modified if any fetch fails.
+// The fetch is bounded by the deadline of the first caller, but not canceled when any caller returns on its context.
+// The update in progress when Refresh swaps the policy cache keeps the refreshed policies instead of the ones it fetched.
+// Use BypassCache on the context to ignore the ETag.
+func (p *policyd) Refresh(ctx context.Context, domains ...string) error {
+	if len(domains) == 0 {
+		domains = make([]string, 0, len(p.fetchers))
+		for domain := range p.fetchers {
+			domains = append(domains, domain)
+		}
+	} else {
+		domains = append([]string(nil), domains...)
+		for _, domain := range domains {
+			if _, ok := p.fetchers[domain]; !ok {
+				return errors.Wrapf(ErrDomainNotFound, "refresh policy fail, domain: %s", domain)
+			}
+		}
+	}
+	sort.Strings(domains)
+
+	key := strings.Join(domains, ",")
+	if IsCacheBypassed(ctx) {
+		key += ";bypass"
+	}
+	ch := p.refreshGroup.DoChan(key, func() (interface{}, error) {
+		// the fetch is shared by the coalesced callers, so only the deadline of the context is inherited
+		fctx := context.WithoutCancel(ctx)
+		if d, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			fctx, cancel = context.WithDeadline(fctx, d)
+			defer cancel()
+		}
+		return nil, p.refresh(fctx, domains)
+	})
+	select {
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "refresh policy canceled, domains: %v", domains)
+	case r := <-ch:
+		if r.Shared {
+			glg.Debugf("refresh policy coalesced, domains: %v", domains)
+		}
+		return r.Err
+	}
+}
+
+// refresh fetches the policies of the domains, and swaps the policy cache with the one that the policies of the domains are replaced
+func (p *policyd) refresh(ctx context.Context, domains []string) error {
+	glg.Infof("will refresh policy, domains: %v", domains)
+	eg := errgroup.Group{}
+	if p.fetchConcurrency > 0 {
+		eg.SetLimit(p.fetchConcurrency)
+	}
+	sps := make([]*SignedPolicy, len(domains))
+	for i, domain := range domains {
+		i, f := i, p.fetchers[domain] // for closure
+		eg.Go(func() error {
+			sp, err := f.FetchWithRetry(ctx)
+			if err != nil {
+				// unlike Update, the cached policy is not used on the manual refresh
+				return errors.Wrapf(err, "refresh policy fail, domain: %s", f.Domain())
+			}
+			sps[i] = sp
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	cc := p.cacheConfig()
+	fetched := new(sync.Map)
+	refreshed := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		refreshed[domain] = struct{}{}
+	}
+
+	p.swapMu.Lock()
+	defer p.swapMu.Unlock()
+
+	// keep the policies of the other domains with the remaining TTL
+	rp := gache.New[[]*Assertion]()
+	copyRolePolicies(ctx, rp, p.loadRolePolicies(), func(domain string) bool {
+		_, ok := refreshed[domain]
+		return !ok
+	})
+
+	for i, sp := range sps {
+		if err := simplifyAndCachePolicy(ctx, rp, sp, cc); err != nil {
+			return errors.Wrapf(err, "refresh policy fail, domain: %s", domains[i])
+		}
+		fetched.Store(domains[i], newFetchedPolicy(p.fetchers[domains[i]], sp))
+	}
+
+	p.swapRolePolicies(rp, cc, fetched)
+	p.refreshGen++
+	if p.refreshGens == nil {
+		p.refreshGens = make(map[string]uint64, len(domains))
+	}
+	for _, domain := range domains {
+		p.refreshGens[domain] = p.refreshGen
+	}
+	glg.Infof("refresh policy done, domains: %v", domains)
+	return nil
+}
+
+// copyRolePolicies copies the policies of the domains selected by the filter from src to dst with the remaining TTL
+func copyRolePolicies(ctx context.Context, dst, src gache.Gache[[]*Assertion], filter func(domain string) bool) {
+	now := fastime.UnixNanoNow()
+	src.Range(ctx, func(key string, asss []*Assertion, exp int64) bool {
+		if !filter(policyKeyDomain(key)) {
+			return true
+		}
+		if exp <= 0 {
+			dst.SetWithExpire(key, asss, 0)
+		} else if exp > now {
+			dst.SetWithExpire(key, asss, time.Duration(exp-now))
+		}
+		return true
+	})
+}
+
+// policyKeyDomain returns the domain of the policy cache key, i.e. <domain>:role.<role>
+func policyKeyDomain(key string) string {
+	return strings.Split(key, ":role.")[0]
+}
@@ -0,0 +1,358 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func newTestRefreshFetcher(domain string, fetch func(context.Context) (*SignedPolicy, error)) Fetcher {
+	return &fetcherMock{
+		domainMock:         func() string { return domain },
+		fetchWithRetryMock: fetch,
+	}
+}
+
+func newTestRefreshPolicy(domain string, roles ...string) *SignedPolicy {
+	asss := make([]*util.Assertion, 0, len(roles))
+	for _, role := range roles {
+		asss = append(asss, &util.Assertion{Role: domain + ":role." + role, Action: "read", Resource: domain + ":*", Effect: "allow"})
+	}
+	return newTestCandidate(domain, &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)}, asss...)
+}
+
+func Test_policyd_Refresh(t *testing.T) {
+	fetchErr := errors.New("fetch error")
+	tests := []struct {
+		name     string
+		fetchers map[string]func(context.Context) (*SignedPolicy, error)
+		domains  []string
+		wantErr  error
+		wantKeys []string
+	}{
+		{
+			name: "refresh a domain, the other domains are kept",
+			fetchers: map[string]func(context.Context) (*SignedPolicy, error){
+				"dom1": func(context.Context) (*SignedPolicy, error) { return newTestRefreshPolicy("dom1", "new"), nil },
+				"dom2": func(context.Context) (*SignedPolicy, error) { return nil, fetchErr },
+			},
+			domains:  []string{"dom1"},
+			wantKeys: []string{"dom1:role.new", "dom2:role.old"},
+		},
+		{
+			name: "refresh all the domains",
+			fetchers: map[string]func(context.Context) (*SignedPolicy, error){
+				"dom1": func(context.Context) (*SignedPolicy, error) { return newTestRefreshPolicy("dom1", "new"), nil },
+				"dom2": func(context.Context) (*SignedPolicy, error) { return newTestRefreshPolicy("dom2", "new"), nil },
+			},
+			wantKeys: []string{"dom1:role.new", "dom2:role.new"},
+		},
+		{
+			name: "unknown domain",
+			fetchers: map[string]func(context.Context) (*SignedPolicy, error){
+				"dom1": func(context.Context) (*SignedPolicy, error) { return newTestRefreshPolicy("dom1", "new"), nil },
+			},
+			domains:  []string{"dom1", "unknown"},
+			wantErr:  ErrDomainNotFound,
+			wantKeys: []string{"dom1:role.old", "dom2:role.old"},
+		},
+		{
+			name: "fetch fail, the cache is not modified",
+			fetchers: map[string]func(context.Context) (*SignedPolicy, error){
+				"dom1": func(context.Context) (*SignedPolicy, error) { return newTestRefreshPolicy("dom1", "new"), nil },
+				"dom2": func(context.Context) (*SignedPolicy, error) {
+					// the cached policy returned with the error is not used
+					return newTestRefreshPolicy("dom2", "cached"), fetchErr
+				},
+			},
+			domains:  []string{"dom1", "dom2"},
+			wantErr:  fetchErr,
+			wantKeys: []string{"dom1:role.old", "dom2:role.old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			g := gache.New[[]*Assertion]()
+			if err := simplifyAndCachePolicy(ctx, g, newTestRefreshPolicy("dom1", "old"), cacheConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := simplifyAndCachePolicy(ctx, g, newTestRefreshPolicy("dom2", "old"), cacheConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			p := &policyd{
+				rolePolicies: &g,
+				purgePeriod:  time.Hour,
+				fetchers:     make(map[string]Fetcher, len(tt.fetchers)),
+			}
+			for domain, fetch := range tt.fetchers {
+				p.fetchers[domain] = newTestRefreshFetcher(domain, fetch)
+			}
+
+			err := p.Refresh(ctx, tt.domains...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("policyd.Refresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			keys := make([]string, 0)
+			for key := range p.GetPolicyCache(ctx) {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("policyd.Refresh() cache = %v, want %v", keys, tt.wantKeys)
+			}
+			if tt.wantErr == nil {
+				if _, ok := p.GetPolicyExpiries(ctx)["dom1"]; !ok {
+					t.Errorf("policyd.Refresh() expiry of dom1 not stored")
+				}
+			}
+		})
+	}
+}
+
+func Test_policyd_Refresh_coalesce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	release := make(chan struct{})
+	g := gache.New[[]*Assertion]()
+	p := &policyd{
+		rolePolicies: &g,
+		purgePeriod:  time.Hour,
+		fetchers: map[string]Fetcher{
+			"dom": newTestRefreshFetcher("dom", func(context.Context) (*SignedPolicy, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return newTestRefreshPolicy("dom", "role"), nil
+			}),
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Refresh(ctx, "dom"); err != nil {
+				t.Errorf("policyd.Refresh() error = %v", err)
+			}
+		}()
+	}
+	// wait for the first fetch, then let the other triggers join it
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("policyd.Refresh() fetch calls = %d, want 1", got)
+	}
+	if _, ok := p.GetPolicyCache(ctx)["dom:role.role"]; !ok {
+		t.Errorf("policyd.Refresh() policy not cached")
+	}
+}
+
+func Test_policyd_Refresh_callerCanceled(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	g := gache.New[[]*Assertion]()
+	p := &policyd{
+		rolePolicies: &g,
+		purgePeriod:  time.Hour,
+		fetchers: map[string]Fetcher{
+			"dom": newTestRefreshFetcher("dom", func(ctx context.Context) (*SignedPolicy, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				fetchErr <- ctx.Err()
+				return newTestRefreshPolicy("dom", "role"), nil
+			}),
+		},
+	}
+
+	// the first caller leaves before the fetch completes
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- p.Refresh(ctx, "dom")
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		second <- p.Refresh(context.Background(), "dom")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("policyd.Refresh() error = %v, want %v", err, context.Canceled)
+	}
+
+	// the coalesced fetch continues for the other caller
+	close(release)
+	if err := <-fetchErr; err != nil {
+		t.Errorf("fetch context error = %v, want nil", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("policyd.Refresh() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("policyd.Refresh() fetch calls = %d, want 1", got)
+	}
+	if _, ok := p.GetPolicyCache(context.Background())["dom:role.role"]; !ok {
+		t.Errorf("policyd.Refresh() policy not cached")
+	}
+}
+
+func Test_policyd_Update_keepRefreshed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	release := make(chan struct{})
+	g := gache.New[[]*Assertion]()
+	p := &policyd{
+		rolePolicies: &g,
+		purgePeriod:  time.Hour,
+		fetchers: map[string]Fetcher{
+			"dom1": newTestRefreshFetcher("dom1", func(context.Context) (*SignedPolicy, error) {
+				switch atomic.AddInt32(&calls, 1) {
+				case 1:
+					// the periodic update fetching the older policy
+					<-release
+					return newTestRefreshPolicy("dom1", "old"), nil
+				case 2:
+					return newTestRefreshPolicy("dom1", "new"), nil
+				}
+				return newTestRefreshPolicy("dom1", "latest"), nil
+			}),
+			"dom2": newTestRefreshFetcher("dom2", func(context.Context) (*SignedPolicy, error) {
+				return newTestRefreshPolicy("dom2", "updated"), nil
+			}),
+		},
+	}
+
+	updated := make(chan error, 1)
+	go func() {
+		updated <- p.Update(ctx)
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Refresh(ctx, "dom1"); err != nil {
+		t.Fatalf("policyd.Refresh() error = %v", err)
+	}
+	close(release)
+	if err := <-updated; err != nil {
+		t.Fatalf("policyd.Update() error = %v", err)
+	}
+
+	keys := make([]string, 0)
+	for key := range p.GetPolicyCache(ctx) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"dom1:role.new", "dom2:role.updated"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("policyd.Update() cache = %v, want %v", keys, want)
+	}
+	if got := p.GetPolicyExpiries(ctx); len(got) != 2 {
+		t.Errorf("policyd.Update() expiries = %v, want 2 domains", got)
+	}
+
+	// the update started after the refresh replaces the refreshed policy
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("policyd.Update() error = %v", err)
+	}
+	if _, ok := p.GetPolicyCache(ctx)["dom1:role.latest"]; !ok {
+		t.Errorf("policyd.Update() cache = %v, want dom1:role.latest", p.GetPolicyCache(ctx))
+	}
+}
+
+func Test_fetcher_Fetch_bypassCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantETag string
+	}{
+		{
+			name:     "send ETag",
+			ctx:      context.Background(),
+			wantETag: `"dummyEtag"`,
+		},
+		{
+			name:     "bypass ETag",
+			ctx:      BypassCache(context.Background()),
+			wantETag: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotETag string
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotETag = r.Header.Get("If-None-Match")
+				w.WriteHeader(http.StatusNotModified)
+			}))
+			defer srv.Close()
+
+			tp := &taggedPolicy{
+				eTag:       `"dummyEtag"`,
+				eTagExpiry: fastime.Now().Add(time.Hour),
+				sp:         newTestRefreshPolicy("dom", "role"),
+			}
+			f := &fetcher{
+				domain:      "dom",
+				athenzURL:   strings.Replace(srv.URL, "https://", "", 1),
+				spVerifier:  func(*SignedPolicy) error { return nil },
+				client:      srv.Client(),
+				policyCache: unsafe.Pointer(tp),
+			}
+			_, _ = f.Fetch(tt.ctx)
+			if gotETag != tt.wantETag {
+				t.Errorf("fetcher.Fetch() If-None-Match = %q, want %q", gotETag, tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestIsCacheBypassed(t *testing.T) {
+	if IsCacheBypassed(context.Background()) {
+		t.Errorf("IsCacheBypassed() = true, want false")
+	}
+	if !IsCacheBypassed(BypassCache(context.Background())) {
+		t.Errorf("IsCacheBypassed() = false, want true")
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// candidateExpiry is the expiry of the candidate policy without a valid expiry, only used in the isolated simulation cache
+	candidateExpiry = time.Hour
+)
+
+// SimulationRequest represents a request replayed in the simulation, e.g. a recorded decision log.
+type SimulationRequest struct {
+	Domain   string   `json:"domain"`
+	Roles    []string `json:"roles"`
+	Action   string   `json:"action"`
+	Resource string   `json:"resource"`
+}
+
+// SimulationDecision represents the decision of a request against a policy set.
+type SimulationDecision struct {
+	Allowed      bool     `json:"allowed"`
+	AllowedRoles []string `json:"allowed_roles,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// SimulationResult represents the decisions of a request against the current and the candidate policy sets.
+type SimulationResult struct {
+	*SimulationRequest
+	Current   *SimulationDecision `json:"current"`
+	Candidate *SimulationDecision `json:"candidate"`
+}
+
+// Changed reports whether the decision is changed by the candidate policy set.
+func (r *SimulationResult) Changed() bool {
+	return r.Current.Allowed != r.Candidate.Allowed
+}
+
+// SimulationReport represents the result of the simulation. Changes contains only the requests of which the decision is changed.
+type SimulationReport struct {
+	Total       int                 `json:"total"`
+	AllowToDeny int                 `json:"allow_to_deny"`
+	DenyToAllow int                 `json:"deny_to_allow"`
+	Changes     []*SimulationResult `json:"changes"`
+}
+
+// Simulate replays the requests against both the current policy cache and the candidate policy set, and reports the changed decisions.
+// The candidate policies replace the current policies of the same domains in an isolated cache, the current cache is never modified.
+// The candidate policies are not verified, and the local assertions are evaluated in both of the policy sets.
+func (p *policyd) Simulate(ctx context.Context, candidates []*SignedPolicy, reqs []*SimulationRequest) (*SimulationReport, error) {
+	cur := p.loadRolePolicies()
+	cand, err := buildCandidateCache(ctx, cur, candidates, p.cacheConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SimulationReport{
+		Changes: make([]*SimulationResult, 0),
+	}
+	for _, req := range reqs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if req == nil {
+			continue
+		}
+		res := &SimulationResult{
+			SimulationRequest: req,
+			Current:           p.simulateDecision(ctx, cur, req),
+			Candidate:         p.simulateDecision(ctx, cand, req),
+		}
+		report.Total++
+		if !res.Changed() {
+			continue
+		}
+		if res.Current.Allowed {
+			report.AllowToDeny++
+		} else {
+			report.DenyToAllow++
+		}
+		report.Changes = append(report.Changes, res)
+	}
+	return report, nil
+}
+
+func (p *policyd) simulateDecision(ctx context.Context, rp gache.Gache[[]*Assertion], req *SimulationRequest) *SimulationDecision {
+	roles, err := p.checkPolicyRoles(ctx, rp, req.Domain, req.Roles, req.Action, req.Resource)
+	if err != nil {
+		return &SimulationDecision{
+			Error: err.Error(),
+		}
+	}
+	return &SimulationDecision{
+		Allowed:      true,
+		AllowedRoles: roles,
+	}
+}
+
+// buildCandidateCache builds the isolated policy cache, which contains the current policies of the domains without a candidate policy,
+// and the candidate policies cached by the same logic as the policy update.
+func buildCandidateCache(ctx context.Context, cur gache.Gache[[]*Assertion], candidates []*SignedPolicy, cc cacheConfig) (gache.Gache[[]*Assertion], error) {
+	sps := make(map[string]*SignedPolicy, len(candidates))
+	for _, sp := range candidates {
+		if sp == nil || sp.SignedPolicyData == nil || sp.SignedPolicyData.PolicyData == nil {
+			return nil, errors.New("candidate policy without policy data")
+		}
+		domain := sp.SignedPolicyData.PolicyData.Domain
+		if domain == "" {
+			return nil, errors.New("candidate policy without domain")
+		}
+		sps[domain] = sp
+	}
+
+	// keep the current policies of the other domains with the remaining TTL
+	rp := gache.New[[]*Assertion]()
+	nowNano := fastime.UnixNanoNow()
+	cur.Range(ctx, func(key string, asss []*Assertion, exp int64) bool {
+		// key = <domain>:role.<role>
+		if _, ok := sps[strings.Split(key, ":role.")[0]]; ok {
+			return true
+		}
+		if exp <= 0 {
+			rp.SetWithExpire(key, asss, 0)
+		} else if exp > nowNano {
+			rp.SetWithExpire(key, asss, time.Duration(exp-nowNano))
+		}
+		return true
+	})
+
+	now := fastime.Now()
+	for domain, sp := range sps {
+		if err := simplifyAndCachePolicy(ctx, rp, normalizeCandidate(sp, now), cc); err != nil {
+			return nil, errors.Wrapf(err, "invalid candidate policy, domain: %s", domain)
+		}
+	}
+	return rp, nil
+}
+
+// normalizeCandidate returns the copy of the candidate policy with a valid expiry, the given candidate policy is not modified
+func normalizeCandidate(sp *SignedPolicy, now time.Time) *SignedPolicy {
+	if exp := sp.SignedPolicyData.Expires; exp != nil && exp.After(now) {
+		return sp
+	}
+	spd := *sp.SignedPolicyData
+	spd.Expires = &rdl.Timestamp{Time: now.Add(candidateExpiry)}
+	csp := *sp
+	csp.SignedPolicyData = &spd
+	return &csp
+}
+
+// ParseCandidatePolicy parses the candidate policy from the SignedPolicy JSON, or the plain policy data JSON.
+func ParseCandidatePolicy(b []byte) (*SignedPolicy, error) {
+	sp := new(SignedPolicy)
+	if err := json.Unmarshal(b, sp); err != nil {
+		return nil, errors.Wrap(err, "candidate policy decode fail")
+	}
+	if sp.SignedPolicyData != nil && sp.SignedPolicyData.PolicyData != nil {
+		return sp, nil
+	}
+
+	pd := new(util.PolicyData)
+	if err := json.Unmarshal(b, pd); err != nil {
+		return nil, errors.Wrap(err, "candidate policy data decode fail")
+	}
+	if pd.Domain == "" {
+		return nil, errors.New("candidate policy without domain")
+	}
+	return &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				PolicyData: pd,
+			},
+		},
+	}, nil
+}
+
+// ReadSimulationRequests reads the simulation requests from the JSON lines, e.g. the recorded decision logs.
+// The empty lines are skipped.
+func ReadSimulationRequests(r io.Reader) ([]*SimulationRequest, error) {
+	reqs := make([]*SimulationRequest, 0)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		b := sc.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		req := new(SimulationRequest)
+		if err := json.Unmarshal(b, req); err != nil {
+			return nil, errors.Wrapf(err, "simulation request decode fail, line: %d", line)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "read simulation requests fail")
+	}
+	return reqs, nil
+}
@@ -0,0 +1,342 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+)
+
+func newTestCandidate(domain string, expires *rdl.Timestamp, asss ...*util.Assertion) *SignedPolicy {
+	return &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				Expires: expires,
+				PolicyData: &util.PolicyData{
+					Domain: domain,
+					Policies: []*util.Policy{
+						{
+							Name:       domain + ":policy.candidate",
+							Assertions: asss,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func Test_policyd_Simulate(t *testing.T) {
+	type fields struct {
+		rolePolicies *gache.Gache[[]*Assertion]
+	}
+	type args struct {
+		ctx        context.Context
+		candidates []*SignedPolicy
+		reqs       []*SimulationRequest
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		want       *SimulationReport
+		wantErrStr string
+	}{
+		{
+			name: "report the changed decisions",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestAssertion("read", "dom:*", "allow"),
+					},
+					"otherdom:role.reader": {
+						newTestAssertion("read", "otherdom:*", "allow"),
+					},
+				}),
+			},
+			args: args{
+				ctx: context.Background(),
+				candidates: []*SignedPolicy{
+					newTestCandidate("dom", nil,
+						&util.Assertion{Role: "dom:role.reader", Action: "read", Resource: "dom:public/*", Effect: "allow"},
+						&util.Assertion{Role: "dom:role.writer", Action: "write", Resource: "dom:*", Effect: "allow"},
+					),
+				},
+				reqs: []*SimulationRequest{
+					{Domain: "dom", Roles: []string{"reader"}, Action: "read", Resource: "public/doc"},
+					{Domain: "dom", Roles: []string{"reader"}, Action: "read", Resource: "secret"},
+					{Domain: "dom", Roles: []string{"writer"}, Action: "write", Resource: "doc"},
+					{Domain: "otherdom", Roles: []string{"reader"}, Action: "read", Resource: "doc"},
+				},
+			},
+			want: &SimulationReport{
+				Total:       4,
+				AllowToDeny: 1,
+				DenyToAllow: 1,
+				Changes: []*SimulationResult{
+					{
+						SimulationRequest: &SimulationRequest{Domain: "dom", Roles: []string{"reader"}, Action: "read", Resource: "secret"},
+						Current:           &SimulationDecision{Allowed: true, AllowedRoles: []string{"reader"}},
+						Candidate:         &SimulationDecision{Error: "no match: " + ErrNoMatch.Error()},
+					},
+					{
+						SimulationRequest: &SimulationRequest{Domain: "dom", Roles: []string{"writer"}, Action: "write", Resource: "doc"},
+						Current:           &SimulationDecision{Error: "no match: " + ErrNoMatch.Error()},
+						Candidate:         &SimulationDecision{Allowed: true, AllowedRoles: []string{"writer"}},
+					},
+				},
+			},
+		},
+		{
+			name: "deny assertion in candidate",
+			fields: fields{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.admin": {
+						newTestAssertion("*", "dom:*", "allow"),
+					},
+				}),
+			},
+			args: args{
+				ctx: context.Background(),
+				candidates: []*SignedPolicy{
+					newTestCandidate("dom", &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)},
+						&util.Assertion{Role: "dom:role.admin", Action: "*", Resource: "dom:*", Effect: "allow"},
+						&util.Assertion{Role: "dom:role.admin", Action: "delete", Resource: "dom:*", Effect: "deny"},
+					),
+				},
+				reqs: []*SimulationRequest{
+					{Domain: "dom", Roles: []string{"admin"}, Action: "delete", Resource: "doc"},
+					{Domain: "dom", Roles: []string{"admin"}, Action: "read", Resource: "doc"},
+					nil,
+				},
+			},
+			want: &SimulationReport{
+				Total:       2,
+				AllowToDeny: 1,
+				Changes: []*SimulationResult{
+					{
+						SimulationRequest: &SimulationRequest{Domain: "dom", Roles: []string{"admin"}, Action: "delete", Resource: "doc"},
+						Current:           &SimulationDecision{Allowed: true, AllowedRoles: []string{"admin"}},
+						Candidate:         &SimulationDecision{Error: "policy deny: " + ErrDenyByPolicy.Error()},
+					},
+				},
+			},
+		},
+		{
+			name: "candidate without domain",
+			fields: fields{
+				rolePolicies: newGache(),
+			},
+			args: args{
+				ctx:        context.Background(),
+				candidates: []*SignedPolicy{newTestCandidate("", nil)},
+			},
+			wantErrStr: "candidate policy without domain",
+		},
+		{
+			name: "candidate without policy data",
+			fields: fields{
+				rolePolicies: newGache(),
+			},
+			args: args{
+				ctx:        context.Background(),
+				candidates: []*SignedPolicy{{}},
+			},
+			wantErrStr: "candidate policy without policy data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				rolePolicies: tt.fields.rolePolicies,
+			}
+			got, err := p.Simulate(tt.args.ctx, tt.args.candidates, tt.args.reqs)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("policyd.Simulate() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyd.Simulate() = %+v, want %+v", got, tt.want)
+			}
+			if err == nil && (*tt.fields.rolePolicies).Len() == 0 {
+				t.Errorf("policyd.Simulate() should not modify the current cache")
+			}
+		})
+	}
+}
+
+func Test_normalizeCandidate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	valid := &rdl.Timestamp{Time: now.Add(time.Minute)}
+	expired := &rdl.Timestamp{Time: now.Add(-time.Minute)}
+	tests := []struct {
+		name string
+		sp   *SignedPolicy
+		want time.Time
+	}{
+		{
+			name: "valid expiry is kept",
+			sp:   newTestCandidate("dom", valid),
+			want: valid.Time,
+		},
+		{
+			name: "expired",
+			sp:   newTestCandidate("dom", expired),
+			want: now.Add(candidateExpiry),
+		},
+		{
+			name: "without expiry",
+			sp:   newTestCandidate("dom", nil),
+			want: now.Add(candidateExpiry),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.sp.SignedPolicyData.Expires
+			got := normalizeCandidate(tt.sp, now)
+			if !got.SignedPolicyData.Expires.Time.Equal(tt.want) {
+				t.Errorf("normalizeCandidate() expires = %v, want %v", got.SignedPolicyData.Expires, tt.want)
+			}
+			if tt.sp.SignedPolicyData.Expires != before {
+				t.Errorf("normalizeCandidate() should not modify the given candidate")
+			}
+		})
+	}
+}
+
+func TestParseCandidatePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		b          string
+		wantDomain string
+		wantErrStr string
+	}{
+		{
+			name:       "signed policy",
+			b:          `{"signedPolicyData":{"policyData":{"domain":"dom","policies":[]}}}`,
+			wantDomain: "dom",
+		},
+		{
+			name:       "plain policy data",
+			b:          `{"domain":"dom","policies":[{"name":"dom:policy.p","assertions":[]}]}`,
+			wantDomain: "dom",
+		},
+		{
+			name:       "without domain",
+			b:          `{"policies":[]}`,
+			wantErrStr: "candidate policy without domain",
+		},
+		{
+			name:       "invalid json",
+			b:          `[`,
+			wantErrStr: "candidate policy decode fail: unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCandidatePolicy([]byte(tt.b))
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("ParseCandidatePolicy() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.SignedPolicyData.PolicyData.Domain != tt.wantDomain {
+				t.Errorf("ParseCandidatePolicy() domain = %v, want %v", got.SignedPolicyData.PolicyData.Domain, tt.wantDomain)
+			}
+		})
+	}
+}
+
+func TestReadSimulationRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		logs       string
+		want       []*SimulationRequest
+		wantErrStr string
+	}{
+		{
+			name: "read success",
+			logs: `{"domain":"dom","roles":["reader"],"action":"read","resource":"doc"}
+
+{"domain":"dom","roles":["writer","admin"],"action":"write","resource":"doc"}
+`,
+			want: []*SimulationRequest{
+				{Domain: "dom", Roles: []string{"reader"}, Action: "read", Resource: "doc"},
+				{Domain: "dom", Roles: []string{"writer", "admin"}, Action: "write", Resource: "doc"},
+			},
+		},
+		{
+			name:       "decode fail",
+			logs:       "{\"domain\":\"dom\"}\n{",
+			wantErrStr: "simulation request decode fail, line: 2: unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadSimulationRequests(strings.NewReader(tt.logs))
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("ReadSimulationRequests() error = %v, wantErr %v", err, tt.wantErrStr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadSimulationRequests() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildCandidateCache_keepExpiry(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAssertion("read", "other:res", "allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur := gache.New[[]*Assertion]()
+	cur.SetWithExpire("other:role.reader", []*Assertion{a}, 2*time.Hour)
+	cur.SetWithExpire("dom:role.reader", []*Assertion{a}, 2*time.Hour)
+
+	rp, err := buildCandidateCache(ctx, cur, []*SignedPolicy{
+		newTestCandidate("dom", &rdl.Timestamp{Time: fastime.Now().Add(time.Hour)}),
+	}, cacheConfig{})
+	if err != nil {
+		t.Fatalf("buildCandidateCache() error = %v", err)
+	}
+
+	exps := make(map[string]int64)
+	rp.Range(ctx, func(key string, _ []*Assertion, exp int64) bool {
+		exps[key] = exp
+		return true
+	})
+	if _, ok := exps["dom:role.reader"]; ok {
+		t.Errorf("the current policy of the candidate domain should be replaced")
+	}
+	exp, ok := exps["other:role.reader"]
+	if !ok {
+		t.Fatalf("the current policy of the other domain should be kept")
+	}
+	if remain := time.Duration(exp - fastime.UnixNanoNow()); remain < time.Hour || remain > 2*time.Hour {
+		t.Errorf("the remaining TTL of the current policy = %v, want about 2h", remain)
+	}
+}
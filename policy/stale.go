@@ -0,0 +1,101 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"time"
+
+	"github.com/kpango/fastime"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+// expiryWarnInterval is the minimum interval of the policy expiry warnings of a domain on the policy check
+const expiryWarnInterval = time.Minute
+
+// storePolicyExpiry stores the expiry of the cached policy of the domain, and warns if the policy is expiring or expired
+func (p *policyd) storePolicyExpiry(domain string, expiry time.Time) {
+	p.policyExpiries.Store(domain, expiry)
+
+	now := fastime.Now()
+	switch {
+	case !expiry.After(now):
+		glg.Warnf("serving stale policy, domain: %s, expired at: %s, grace period until: %s", domain, expiry, expiry.Add(p.staleGracePeriod))
+	case expiry.Sub(now) < p.expiryMargin:
+		glg.Warnf("policy is expiring, domain: %s, expires at: %s", domain, expiry)
+	}
+}
+
+// checkStale returns ErrDomainExpired if the cached policy of the domain is expired beyond the grace period.
+// The policy expired within the grace period is still served.
+// The policy expiring within the expiry margin or expired is warned at most once per expiryWarnInterval by domain,
+// so that the staleness is visible while the policy update keeps failing.
+func (p *policyd) checkStale(domain string, now time.Time) error {
+	v, ok := p.policyExpiries.Load(domain)
+	if !ok {
+		return nil
+	}
+	expiry := v.(time.Time)
+	switch {
+	case now.Before(expiry):
+		if expiry.Sub(now) < p.expiryMargin {
+			p.warnExpiry(domain, now, "policy is expiring, domain: %s, expires at: %s", domain, expiry)
+		}
+		return nil
+	case now.Before(expiry.Add(p.staleGracePeriod)):
+		p.warnExpiry(domain, now, "serving stale policy, domain: %s, expired at: %s, grace period until: %s", domain, expiry, expiry.Add(p.staleGracePeriod))
+		return nil
+	}
+	return errors.Wrapf(ErrDomainExpired, "policy expired at %s", expiry.UTC().Format(time.RFC3339))
+}
+
+// warnExpiry logs the policy expiry warning of the domain, unless warned within expiryWarnInterval
+func (p *policyd) warnExpiry(domain string, now time.Time, format string, args ...interface{}) {
+	if v, ok := p.expiryWarnedAt.Load(domain); ok && now.Sub(v.(time.Time)) < expiryWarnInterval {
+		return
+	}
+	p.expiryWarnedAt.Store(domain, now)
+	glg.Warnf(format, args...)
+}
+
+// isPolicyUnavailable reports whether no policy of the target domain has been cached, e.g. Athenz is unavailable since the start
+func (p *policyd) isPolicyUnavailable(domain string) bool {
+	if _, ok := p.fetchers[domain]; !ok {
+		return false
+	}
+	_, ok := p.policyExpiries.Load(domain)
+	return !ok
+}
+
+// GetPolicyExpiries returns the expiry of the cached policy by domain, which can be used to monitor the policy staleness.
+func (p *policyd) GetPolicyExpiries(ctx context.Context) map[string]time.Time {
+	m := make(map[string]time.Time)
+	p.policyExpiries.Range(func(k, v interface{}) bool {
+		m[k.(string)] = v.(time.Time)
+		return true
+	})
+	return m
+}
+
+// hasUnavailablePolicy reports whether any domain has no cached policy
+func (p *policyd) hasUnavailablePolicy() bool {
+	for domain := range p.fetchers {
+		if p.isPolicyUnavailable(domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/utils/zpe-updater/util"
+	"github.com/ardielle/ardielle-go/rdl"
+	"github.com/kpango/fastime"
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func Test_policyd_checkStale(t *testing.T) {
+	now := time.Unix(10000, 0)
+	type fields struct {
+		staleGracePeriod time.Duration
+		expiries         map[string]time.Time
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		domain     string
+		wantErrStr string
+	}{
+		{
+			name:   "unknown domain",
+			domain: "dom",
+		},
+		{
+			name: "not expired",
+			fields: fields{
+				expiries: map[string]time.Time{"dom": now.Add(time.Minute)},
+			},
+			domain: "dom",
+		},
+		{
+			name: "expired within the grace period",
+			fields: fields{
+				staleGracePeriod: time.Hour,
+				expiries:         map[string]time.Time{"dom": now.Add(-time.Minute)},
+			},
+			domain: "dom",
+		},
+		{
+			name: "expired beyond the grace period",
+			fields: fields{
+				staleGracePeriod: time.Hour,
+				expiries:         map[string]time.Time{"dom": now.Add(-2 * time.Hour)},
+			},
+			domain:     "dom",
+			wantErrStr: "policy expired at 1970-01-01T00:46:40Z: " + ErrDomainExpired.Error(),
+		},
+		{
+			name: "expired without the grace period",
+			fields: fields{
+				expiries: map[string]time.Time{"dom": now},
+			},
+			domain:     "dom",
+			wantErrStr: "policy expired at 1970-01-01T02:46:40Z: " + ErrDomainExpired.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				staleGracePeriod: tt.fields.staleGracePeriod,
+			}
+			for domain, exp := range tt.fields.expiries {
+				p.policyExpiries.Store(domain, exp)
+			}
+			err := p.checkStale(tt.domain, now)
+			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
+				t.Errorf("policyd.checkStale() error = %v, wantErr %v", err, tt.wantErrStr)
+			}
+		})
+	}
+}
+
+func Test_policyd_CheckPolicyRoles_stale(t *testing.T) {
+	type fields struct {
+		staleGracePeriod time.Duration
+		staleFailOpen    bool
+		expiry           time.Time
+		cached           bool
+		localAssertions  []*LocalAssertion
+	}
+	type args struct {
+		action string
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "serve the policy within the grace period",
+			fields: fields{
+				staleGracePeriod: time.Hour,
+				expiry:           fastime.Now().Add(-time.Minute),
+				cached:           true,
+			},
+			args: args{action: "read"},
+			want: []string{"reader"},
+		},
+		{
+			name: "fail closed",
+			fields: fields{
+				expiry: fastime.Now().Add(-time.Minute),
+				cached: true,
+			},
+			args:    args{action: "read"},
+			wantErr: ErrDomainExpired,
+		},
+		{
+			name: "fail open, the stale policy allows",
+			fields: fields{
+				staleFailOpen: true,
+				expiry:        fastime.Now().Add(-time.Minute),
+				cached:        true,
+			},
+			args: args{action: "read"},
+			want: []string{"reader"},
+		},
+		{
+			name: "fail open, the stale policy does not allow",
+			fields: fields{
+				staleFailOpen: true,
+				expiry:        fastime.Now().Add(-time.Minute),
+				cached:        true,
+			},
+			args:    args{action: "write"},
+			wantErr: ErrNoMatch,
+		},
+		{
+			name: "fail open without policy",
+			fields: fields{
+				staleFailOpen: true,
+			},
+			args: args{action: "write"},
+			want: []string{"reader", "writer"},
+		},
+		{
+			name: "fail open without policy, the local deny applies",
+			fields: fields{
+				staleFailOpen: true,
+				localAssertions: []*LocalAssertion{
+					{Domain: "dom", Role: "*", Action: "*", Resource: "dom:*", Effect: "deny", Reason: "break glass"},
+				},
+			},
+			args:    args{action: "write"},
+			wantErr: ErrDenyByPolicy,
+		},
+		{
+			name: "fail open without policy, the local deny does not match",
+			fields: fields{
+				staleFailOpen: true,
+				localAssertions: []*LocalAssertion{
+					{Domain: "dom", Role: "writer", Action: "delete", Resource: "dom:*", Effect: "deny", Reason: "break glass"},
+				},
+			},
+			args: args{action: "write"},
+			want: []string{"reader", "writer"},
+		},
+		{
+			name:    "fail closed without policy",
+			args:    args{action: "write"},
+			wantErr: ErrNoMatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				rolePolicies: newTestRolePolicies(map[string][]*Assertion{
+					"dom:role.reader": {
+						newTestAssertion("read", "dom:*", "allow"),
+					},
+				}),
+				fetchers:         map[string]Fetcher{"dom": nil},
+				staleGracePeriod: tt.fields.staleGracePeriod,
+				staleFailOpen:    tt.fields.staleFailOpen,
+				localAssertions:  newLocalAssertions(),
+			}
+			if err := p.localAssertions.add(tt.fields.localAssertions...); err != nil {
+				t.Fatal(err)
+			}
+			if tt.fields.cached {
+				p.policyExpiries.Store("dom", tt.fields.expiry)
+			} else {
+				p.rolePolicies = newGache()
+			}
+			got, err := p.CheckPolicyRoles(context.Background(), "dom", []string{"reader", "writer"}, tt.args.action, "doc")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("policyd.CheckPolicyRoles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("policyd.CheckPolicyRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyd_warnExpiry(t *testing.T) {
+	now := time.Unix(10000, 0)
+	p := &policyd{}
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "first warning",
+			now:  now,
+			want: now,
+		},
+		{
+			name: "rate limited",
+			now:  now.Add(time.Second),
+			want: now,
+		},
+		{
+			name: "warn again after the interval",
+			now:  now.Add(expiryWarnInterval),
+			want: now.Add(expiryWarnInterval),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.warnExpiry("dom", tt.now, "policy is expiring, domain: %s", "dom")
+			got, _ := p.expiryWarnedAt.Load("dom")
+			if !got.(time.Time).Equal(tt.want) {
+				t.Errorf("policyd.warnExpiry() warned at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyd_GetPolicyExpiries(t *testing.T) {
+	exp := fastime.Now().Add(time.Hour)
+	p := &policyd{}
+	if got := p.GetPolicyExpiries(context.Background()); len(got) != 0 {
+		t.Errorf("policyd.GetPolicyExpiries() = %v, want empty", got)
+	}
+	p.storePolicyExpiry("dom", exp)
+	if got := p.GetPolicyExpiries(context.Background()); !reflect.DeepEqual(got, map[string]time.Time{"dom": exp}) {
+		t.Errorf("policyd.GetPolicyExpiries() = %v, want %v", got, exp)
+	}
+}
+
+func Test_simplifyAndCachePolicy_gracePeriod(t *testing.T) {
+	rp := gache.New[[]*Assertion]()
+	sp := &SignedPolicy{
+		util.DomainSignedPolicyData{
+			SignedPolicyData: &util.SignedPolicyData{
+				Expires: &rdl.Timestamp{Time: fastime.Now().Add(-time.Minute)},
+				PolicyData: &util.PolicyData{
+					Domain: "dom",
+					Policies: []*util.Policy{
+						{
+							Assertions: []*util.Assertion{
+								{Role: "dom:role.reader", Action: "read", Resource: "dom:*", Effect: "allow"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := simplifyAndCachePolicy(context.Background(), rp, sp, cacheConfig{gracePeriod: time.Hour}); err != nil {
+		t.Fatalf("simplifyAndCachePolicy() error = %v", err)
+	}
+	if _, ok := rp.Get("dom:role.reader"); !ok {
+		t.Errorf("expired policy should be cached within the grace period")
+	}
+}
+
+func Test_policyd_hasUnavailablePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		expiries map[string]time.Time
+		want     bool
+	}{
+		{
+			name: "all the policies are cached",
+			expiries: map[string]time.Time{
+				"dom1": fastime.Now(),
+				"dom2": fastime.Now(),
+			},
+			want: false,
+		},
+		{
+			name: "a policy is not cached",
+			expiries: map[string]time.Time{
+				"dom1": fastime.Now(),
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &policyd{
+				fetchers: map[string]Fetcher{"dom1": nil, "dom2": nil},
+			}
+			for domain, exp := range tt.expiries {
+				p.policyExpiries.Store(domain, exp)
+			}
+			if got := p.hasUnavailablePolicy(); got != tt.want {
+				t.Errorf("policyd.hasUnavailablePolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -29,6 +29,12 @@ type OAuthAccessToken interface {
 	ClientID() string
 }
 
+// OAuthAccessTokenIssuer is an interface for a principal that has the issuer of the OAuthAccessToken.
+// The OAuthAccessToken principal returned by the authorizer implements it, e.g. p.(OAuthAccessTokenIssuer).Issuer().
+type OAuthAccessTokenIssuer interface {
+	Issuer() string
+}
+
 type principal struct {
 	name            string
 	roles           []string
@@ -41,6 +47,7 @@ type principal struct {
 type oAuthAccessToken struct {
 	principal
 	clientID string
+	issuer   string
 }
 
 // Name returns the principal's name
@@ -77,3 +84,8 @@ func (p *principal) AuthorizedRoles() []string {
 func (c *oAuthAccessToken) ClientID() string {
 	return c.clientID
 }
+
+// Issuer returns the access token's issuer
+func (c *oAuthAccessToken) Issuer() string {
+	return c.issuer
+}
@@ -269,3 +269,36 @@ func TestOAuthAccessToken_ClientID(t *testing.T) {
 		})
 	}
 }
+
+func TestOAuthAccessToken_Issuer(t *testing.T) {
+	tests := []struct {
+		name       string
+		o          oAuthAccessToken
+		wantIssuer string
+	}{
+		{
+			name: "success issuer",
+			o: oAuthAccessToken{
+				principal: principal{
+					name: "principal",
+				},
+				clientID: "client_id",
+				issuer:   "https://zts.athenz.io",
+			},
+			wantIssuer: "https://zts.athenz.io",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Principal = &tt.o
+			is, ok := p.(OAuthAccessTokenIssuer)
+			if !ok {
+				t.Errorf("OAuthAccessToken does not implement OAuthAccessTokenIssuer")
+				return
+			}
+			if got := is.Issuer(); got != tt.wantIssuer {
+				t.Errorf("OAuthAccessToken.Issuer() = %v, want %v", got, tt.wantIssuer)
+			}
+		})
+	}
+}
@@ -21,10 +21,14 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/internal/pubsub"
 	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+	"github.com/kpango/fastime"
 	"github.com/kpango/gache/v2"
 	"github.com/kpango/glg"
 	"github.com/pkg/errors"
@@ -36,6 +40,8 @@ type Daemon interface {
 	Start(ctx context.Context) <-chan error
 	Update(context.Context) error
 	GetProvider() Provider
+	GetKeyStatus(env AthenzEnv) *KeyStatus
+	Subscribe(ctx context.Context) <-chan *KeyEvent
 }
 
 type pubkeyd struct {
@@ -43,6 +49,7 @@ type pubkeyd struct {
 	sysAuthDomain string
 	refreshPeriod time.Duration
 	retryDelay    time.Duration
+	gracePeriod   time.Duration
 
 	client *http.Client
 
@@ -50,8 +57,31 @@ type pubkeyd struct {
 	eTagExpiry      time.Duration
 	eTagPurgePeriod time.Duration
 
+	// the environments to update, all environments if nil
+	envs map[AthenzEnv]struct{}
+
+	// local public key sources, map[AthenzEnv]...
+	keyDirs          map[AthenzEnv]string
+	keyFiles         map[AthenzEnv]map[string]string
+	staticKeys       map[AthenzEnv]map[string][]byte
+	mergeFetchedKeys bool
+	fileWatchPeriod  time.Duration
+
+	// accepted key IDs and pinned fingerprints, map[AthenzEnv]...
+	allowedKeyIDs map[AthenzEnv]map[string]struct{}
+	keyPins       map[AthenzEnv]map[string]string
+
 	// cache
-	confCache *AthenzConfig
+	keys *keyCache
+
+	// the local public keys loaded in the last update, map[AthenzEnv]map[string][]byte
+	localKeys sync.Map
+
+	// status of the last update, map[AthenzEnv]*KeyStatus
+	status sync.Map
+
+	// key rotation event subscribers
+	subscribers pubsub.Subscribers[*KeyEvent]
 }
 
 // AthenzConfig represent the cache of Athenz config.
@@ -60,11 +90,26 @@ type AthenzConfig struct {
 	ZTSPubKeys *sync.Map //map[string]authcore.Verifier
 }
 
+// keyCache represent the cache of the public keys of the Athenz environments.
+// Each key set is immutable and swapped atomically on update.
+type keyCache struct {
+	zms atomic.Pointer[keySet]
+	zts atomic.Pointer[keySet]
+}
+
 type confCache struct {
 	eTag string
 	sac  *SysAuthConfig
 }
 
+// KeyStatus represent the result of the last public key update of an Athenz environment.
+type KeyStatus struct {
+	Env         AthenzEnv
+	UpdateTime  time.Time
+	KeyIDs      []string
+	InvalidKeys []*KeyError
+}
+
 // Provider represent the public key provider to retrive the public key.
 type Provider func(AthenzEnv, string) authcore.Verifier
 
@@ -82,10 +127,7 @@ const (
 // New represent the constructor of Pubkeyd
 func New(opts ...Option) (Daemon, error) {
 	c := &pubkeyd{
-		confCache: &AthenzConfig{
-			ZMSPubKeys: new(sync.Map),
-			ZTSPubKeys: new(sync.Map),
-		},
+		keys:      &keyCache{},
 		eTagCache: gache.New[confCache](),
 	}
 
@@ -111,6 +153,15 @@ func (p *pubkeyd) Start(ctx context.Context) <-chan error {
 
 		p.eTagCache.StartExpired(ctx, p.eTagPurgePeriod)
 		ticker := time.NewTicker(p.refreshPeriod)
+
+		// watch the local public key files, and update immediately when any of them is modified
+		var watchC <-chan time.Time
+		if p.fileWatchPeriod > 0 && p.hasKeyFiles() {
+			watcher := time.NewTicker(p.fileWatchPeriod)
+			defer watcher.Stop()
+			watchC = watcher.C
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -133,6 +184,10 @@ func (p *pubkeyd) Start(ctx context.Context) <-chan error {
 			case <-ticker.C:
 				if err := p.Update(ctx); err != nil {
 					ech <- errors.Wrap(err, "error update pubkey")
+					// the valid keys are already installed, retrying does not fix the invalid keys
+					if errors.Is(err, ErrInvalidPubkey) {
+						continue
+					}
 
 					select {
 					case fch <- struct{}{}:
@@ -140,6 +195,14 @@ func (p *pubkeyd) Start(ctx context.Context) <-chan error {
 						glg.Warn("failure queue already full")
 					}
 				}
+			case <-watchC:
+				if !p.localKeysModified() {
+					continue
+				}
+				glg.Info("public key file modified, will update pubkey")
+				if err := p.Update(ctx); err != nil {
+					ech <- errors.Wrap(err, "error update pubkey")
+				}
 			}
 		}
 	}()
@@ -152,80 +215,188 @@ func (p *pubkeyd) Update(ctx context.Context) error {
 	glg.Info("Updating athenz pubkey")
 	eg := errgroup.Group{}
 
-	// this function decode and create verifier obj and store to corresponding cache map
-	updConf := func(env AthenzEnv, cache *sync.Map) error {
-		cm := new(sync.Map)
+	var (
+		mu          sync.Mutex
+		invalidKeys KeyErrors
+	)
+
+	// this function decode and create verifier obj and swap the corresponding key set,
+	// the keys that cannot be decoded are skipped and reported in the key status.
+	// The local public keys replace the fetched keys, or are merged with them and override the same key ID.
+	updConf := func(env AthenzEnv, cache *atomic.Pointer[keySet]) error {
 		dec := new(authcore.YBase64)
-		pubKeys, upded, err := p.fetchPubKeyEntries(ctx, env)
-		if err != nil {
-			glg.Errorf("Error updating athenz pubkey, env: %v, error: %v", env, err)
-			return errors.Wrap(err, "error fetch public key entries")
+		local := p.hasLocalKeys(env)
+		pubKeys, upded := new(SysAuthConfig), false
+		if !local || p.mergeFetchedKeys {
+			var err error
+			pubKeys, upded, err = p.fetchPubKeyEntries(ctx, env)
+			if err != nil {
+				glg.Errorf("Error updating athenz pubkey, env: %v, error: %v", env, err)
+				return errors.Wrap(err, "error fetch public key entries")
+			}
+		}
+		var (
+			localKeys  map[string][]byte
+			localErrs  []*KeyError
+			localUpded bool
+		)
+		if local {
+			var err error
+			localKeys, localErrs, err = p.readLocalKeys(env)
+			if err != nil {
+				return errors.Wrap(err, "error read local public keys")
+			}
+			localUpded = !p.sameLocalKeys(env, localKeys)
 		}
-		if !upded {
+		if pubKeys == nil {
+			pubKeys = new(SysAuthConfig)
+		}
+		if !upded && !localUpded {
 			glg.Infof("%v athenz pubkey not updated", env)
 			return nil
 		}
 
+		cm := make(map[string]authcore.Verifier, len(pubKeys.PublicKeys)+len(localKeys))
+		infos := make(map[string]keyInfo, len(pubKeys.PublicKeys)+len(localKeys))
+		st := &KeyStatus{
+			Env:         env,
+			UpdateTime:  fastime.Now(),
+			KeyIDs:      make([]string, 0, len(pubKeys.PublicKeys)+len(localKeys)),
+			InvalidKeys: localErrs,
+		}
 		for _, key := range pubKeys.PublicKeys {
+			if !p.isKeyIDAllowed(env, key.ID) {
+				glg.Warnf("Key ID is not allowed, env: %v, keyID: %v", env, key.ID)
+				continue
+			}
+			if _, ok := localKeys[key.ID]; ok {
+				glg.Debugf("Local key overrides the fetched key, env: %v, keyID: %v", env, key.ID)
+				continue
+			}
 			glg.Debugf("Decoding key, env: %v, keyID: %v", env, key.ID)
 			decKey, err := dec.DecodeString(key.Key)
 			if err != nil {
-				glg.Errorf("error decoding key, env: %v, error: %v", env, err)
-				return errors.Wrap(err, "error decoding key")
+				glg.Errorf("error decoding key, env: %v, keyID: %v, error: %v", env, key.ID, err)
+				st.InvalidKeys = append(st.InvalidKeys, &KeyError{Env: env, KeyID: key.ID, Err: errors.Wrap(err, "error decoding key")})
+				continue
 			}
 			ver, err := authcore.NewVerifier(decKey)
 			if err != nil {
-				glg.Errorf("error initializing verifier, env: %v, error: %v", env, err)
-				return errors.Wrap(err, "error initializing verifier")
+				glg.Errorf("error initializing verifier, env: %v, keyID: %v, error: %v", env, key.ID, err)
+				st.InvalidKeys = append(st.InvalidKeys, &KeyError{Env: env, KeyID: key.ID, Err: errors.Wrap(err, "error initializing verifier")})
+				continue
 			}
-			cm.Store(key.ID, ver)
+			cm[key.ID] = ver
+			infos[key.ID] = newKeyInfo(decKey)
+			st.KeyIDs = append(st.KeyIDs, key.ID)
 			glg.Debugf("Successfully decode key, env: %v, keyID: %v", env, key.ID)
 		}
-		cm.Range(func(key interface{}, val interface{}) bool {
-			cache.Store(key, val)
-			return true
-		})
-		cache.Range(func(key interface{}, val interface{}) bool {
-			_, ok := cm.Load(key)
-			if !ok {
-				cache.Delete(key)
+		localIDs := make([]string, 0, len(localKeys))
+		for id := range localKeys {
+			localIDs = append(localIDs, id)
+		}
+		sort.Strings(localIDs)
+		for _, id := range localIDs {
+			if !p.isKeyIDAllowed(env, id) {
+				glg.Warnf("Key ID is not allowed, env: %v, keyID: %v", env, id)
+				continue
 			}
-			return true
-		})
+			ver, err := authcore.NewVerifier(localKeys[id])
+			if err != nil {
+				glg.Errorf("error initializing verifier, env: %v, keyID: %v, error: %v", env, id, err)
+				st.InvalidKeys = append(st.InvalidKeys, &KeyError{Env: env, KeyID: id, Err: errors.Wrap(err, "error initializing verifier")})
+				continue
+			}
+			cm[id] = ver
+			infos[id] = newKeyInfo(localKeys[id])
+			st.KeyIDs = append(st.KeyIDs, id)
+			glg.Debugf("Successfully load local key, env: %v, keyID: %v", env, id)
+		}
+		// reject the whole key set, and fetch it again on the next update instead of the not modified response
+		if err := p.verifyKeyPins(env, infos); err != nil {
+			glg.Errorf("Error verifying athenz pubkey pins, error: %v", err)
+			p.eTagCache.Delete(string(env))
+			return err
+		}
+		for {
+			old := cache.Load()
+			ks := old.rotate(cm, infos, st.UpdateTime, p.gracePeriod)
+			if cache.CompareAndSwap(old, ks) {
+				p.publish(old.diff(env, ks, st.UpdateTime))
+				break
+			}
+		}
+		p.status.Store(env, st)
+		if local {
+			p.localKeys.Store(env, localKeys)
+		}
 
+		if len(st.InvalidKeys) > 0 {
+			mu.Lock()
+			invalidKeys = append(invalidKeys, st.InvalidKeys...)
+			mu.Unlock()
+		}
 		return nil
 	}
 
-	eg.Go(func() error {
-		glg.Info("Updating ZTS athenz pubkey")
-		if err := updConf(EnvZTS, p.confCache.ZTSPubKeys); err != nil {
-			return errors.Wrap(err, "Error updating ZTS athenz pubkey")
-		}
-		glg.Info("Update ZTS athenz pubkey success")
-		return nil
-	})
+	if p.isEnvEnabled(EnvZTS) {
+		eg.Go(func() error {
+			glg.Info("Updating ZTS athenz pubkey")
+			if err := updConf(EnvZTS, &p.keys.zts); err != nil {
+				return errors.Wrap(err, "Error updating ZTS athenz pubkey")
+			}
+			glg.Info("Update ZTS athenz pubkey success")
+			return nil
+		})
+	}
 
-	eg.Go(func() error {
-		glg.Info("Updating ZMS athenz pubkey")
-		if err := updConf(EnvZMS, p.confCache.ZMSPubKeys); err != nil {
-			return errors.Wrap(err, "Error updating ZMS athenz pubkey")
-		}
-		glg.Info("Update ZMS athenz pubkey success")
-		return nil
-	})
+	if p.isEnvEnabled(EnvZMS) {
+		eg.Go(func() error {
+			glg.Info("Updating ZMS athenz pubkey")
+			if err := updConf(EnvZMS, &p.keys.zms); err != nil {
+				return errors.Wrap(err, "Error updating ZMS athenz pubkey")
+			}
+			glg.Info("Update ZMS athenz pubkey success")
+			return nil
+		})
+	}
 
 	if err := eg.Wait(); err != nil {
 		return errors.Wrap(err, "error when processing pubkey")
 	}
+	if len(invalidKeys) > 0 {
+		return errors.Wrap(invalidKeys, "error when processing pubkey")
+	}
 
 	return nil
 }
 
+// isEnvEnabled reports whether the public keys of the env are updated by pubkeyd
+func (p *pubkeyd) isEnvEnabled(env AthenzEnv) bool {
+	if p.envs == nil {
+		return true
+	}
+	_, ok := p.envs[env]
+	return ok
+}
+
 // GetProvider returns the public key provider for user to get the public key
 func (p *pubkeyd) GetProvider() Provider {
 	return p.getPubKey
 }
 
+// GetKeyStatus returns the result of the last public key update of the environment, or nil if not updated yet
+func (p *pubkeyd) GetKeyStatus(env AthenzEnv) *KeyStatus {
+	st, ok := p.status.Load(env)
+	if !ok {
+		return nil
+	}
+	s := *st.(*KeyStatus)
+	s.KeyIDs = append([]string(nil), s.KeyIDs...)
+	s.InvalidKeys = append([]*KeyError(nil), s.InvalidKeys...)
+	return &s
+}
+
 func (p *pubkeyd) fetchPubKeyEntries(ctx context.Context, env AthenzEnv) (*SysAuthConfig, bool, error) {
 	glg.Info("Fetching public key entries")
 	// https://{athenz.io/zts/v1}/domain/sys.auth/service/zts
@@ -291,18 +462,18 @@ func (p *pubkeyd) fetchPubKeyEntries(ctx context.Context, env AthenzEnv) (*SysAu
 
 func (p *pubkeyd) getPubKey(env AthenzEnv, keyID string) authcore.Verifier {
 	if env == EnvZTS {
-		ver, ok := p.confCache.ZTSPubKeys.Load(keyID)
+		ver, ok := p.keys.zts.Load().load(keyID, fastime.Now())
 		if !ok {
 			glg.Warnf("ZTS PubKey Load Failed keyID[%s]  getZTSPubKey %v", keyID, ver)
 			return nil
 		}
-		return ver.(authcore.Verifier)
+		return ver
 	}
 
-	ver, ok := p.confCache.ZMSPubKeys.Load(keyID)
+	ver, ok := p.keys.zms.Load().load(keyID, fastime.Now())
 	if !ok {
 		glg.Warnf("ZMS PubKey Load Failed keyID[%s]  getZMSPubKey %v", keyID, ver)
 		return nil
 	}
-	return ver.(authcore.Verifier)
+	return ver
 }
@@ -21,7 +21,6 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
@@ -107,15 +106,19 @@ func TestNew(t *testing.T) {
 
 func Test_pubkeyd_getPubKey(t *testing.T) {
 	c := &pubkeyd{
-		confCache: &AthenzConfig{
-			ZMSPubKeys: new(sync.Map),
-			ZTSPubKeys: new(sync.Map),
-		},
+		keys: &keyCache{},
 	}
 	zmsVer := &VerifierMock{}
 	ztsVer := &VerifierMock{}
-	c.confCache.ZMSPubKeys.Store("0", zmsVer)
-	c.confCache.ZTSPubKeys.Store("0", ztsVer)
+	retiredVer := &VerifierMock{}
+	c.keys.zms.Store(&keySet{
+		keys: map[string]authcore.Verifier{"0": zmsVer},
+		retired: map[string]retiredKey{
+			"2": {ver: retiredVer, expiry: time.Now().Add(time.Hour)},
+			"3": {ver: retiredVer, expiry: time.Now().Add(-time.Hour)},
+		},
+	})
+	c.keys.zts.Store(newKeySet(map[string]authcore.Verifier{"0": ztsVer}))
 	type args struct {
 		env   AthenzEnv
 		keyID string
@@ -158,6 +161,22 @@ func Test_pubkeyd_getPubKey(t *testing.T) {
 			},
 			want: zmsVer,
 		},
+		{
+			name: "get retired key in the grace period",
+			args: args{
+				env:   "zms",
+				keyID: "2",
+			},
+			want: retiredVer,
+		},
+		{
+			name: "not found retired key after the grace period",
+			args: args{
+				env:   "zms",
+				keyID: "3",
+			},
+			want: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -179,7 +198,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 		athenzURL       string
 		sysAuthDomain   string
 		client          *http.Client
-		confCache       *AthenzConfig
+		keys            *keyCache
 	}
 	type args struct {
 		ctx context.Context
@@ -212,10 +231,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -288,10 +304,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     ec,
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -350,10 +363,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     ec,
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -404,10 +414,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -439,10 +446,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -474,10 +478,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -508,7 +509,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 				athenzURL:       tt.fields.athenzURL,
 				sysAuthDomain:   tt.fields.sysAuthDomain,
 				client:          tt.fields.client,
-				confCache:       tt.fields.confCache,
+				keys:            tt.fields.keys,
 			}
 			got, got1, err := c.fetchPubKeyEntries(tt.args.ctx, tt.args.env)
 
@@ -521,7 +522,7 @@ func Test_pubkeyd_fetchPubKeyEntries(t *testing.T) {
 
 func Test_pubkeyd_GetProvider(t *testing.T) {
 	c := &pubkeyd{
-		confCache: &AthenzConfig{},
+		keys: &keyCache{},
 	}
 	type test struct {
 		name string
@@ -553,7 +554,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 		athenzURL       string
 		sysAuthDomain   string
 		client          *http.Client
-		confCache       *AthenzConfig
+		keys            *keyCache
 	}
 	type args struct {
 		ctx context.Context
@@ -599,10 +600,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -613,7 +611,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					}
 					ind := 0
 					var err error
-					checker := func(key interface{}, value interface{}) bool {
+					checker := func(key string, value authcore.Verifier) bool {
 						ind++
 						valType := fmt.Sprint(reflect.TypeOf(value))
 						if valType != "*zmssvctoken.verify" {
@@ -622,7 +620,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 						}
 						return true
 					}
-					c.confCache.ZMSPubKeys.Range(checker)
+					c.keys.zms.Load().rangeKeys(checker)
 					if ind != 2 {
 						return errors.Errorf("invalid length ZMSPubKeys. want: 2, result: %d", ind)
 					}
@@ -631,7 +629,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					}
 					err = nil
 					ind = 0
-					c.confCache.ZTSPubKeys.Range(checker)
+					c.keys.zts.Load().rangeKeys(checker)
 					if ind != 1 {
 						return errors.Errorf("invalid length ZTSPubKeys. want: 1, result: %d", ind)
 					}
@@ -682,10 +680,9 @@ func Test_pubkeyd_Update(t *testing.T) {
 
 			zmsVer := &VerifierMock{}
 			ztsVer := &VerifierMock{}
-			zmsVM := new(sync.Map)
-			ztsVM := new(sync.Map)
-			zmsVM.Store("zms", zmsVer)
-			ztsVM.Store("zts", ztsVer)
+			ac := &keyCache{}
+			ac.zms.Store(newKeySet(map[string]authcore.Verifier{"zms": zmsVer}))
+			ac.zts.Store(newKeySet(map[string]authcore.Verifier{"zts": ztsVer}))
 			return test{
 				name: "test use ETag cache",
 				fields: fields{
@@ -694,10 +691,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					eTagCache:     ec,
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: zmsVM,
-						ZTSPubKeys: ztsVM,
-					},
+					keys:          ac,
 				},
 				args: args{
 					ctx: context.Background(),
@@ -708,19 +702,19 @@ func Test_pubkeyd_Update(t *testing.T) {
 					}
 					ind := 0
 					var err error
-					checker := func(key interface{}, value interface{}) bool {
+					checker := func(key string, value authcore.Verifier) bool {
 						ind++
 						want := zmsVer
-						if key.(string) == "zts" {
+						if key == "zts" {
 							want = ztsVer
 						}
-						if value.(*VerifierMock) != want {
+						if value != want {
 							err = errors.Errorf("Pubkey Map key:%s  invalid Verifier.", key)
 							return false
 						}
 						return true
 					}
-					c.confCache.ZMSPubKeys.Range(checker)
+					c.keys.zms.Load().rangeKeys(checker)
 					if ind != 1 {
 						return errors.Errorf("invalid length ZMSPubKeys. want: 1, result: %d", ind)
 					}
@@ -729,7 +723,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					}
 					err = nil
 					ind = 0
-					c.confCache.ZTSPubKeys.Range(checker)
+					c.keys.zts.Load().rangeKeys(checker)
 					if ind != 1 {
 						return errors.Errorf("invalid length ZTSPubKeys. want: 1, result: %d", ind)
 					}
@@ -769,10 +763,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
@@ -820,18 +811,28 @@ func Test_pubkeyd_Update(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
 				},
 				checkFunc: func(c *pubkeyd, gotErr error) error {
-					wantErr := "error when processing pubkey: Error updating ZMS athenz pubkey: error decoding key: illegal base64 data at input byte 6"
-					if gotErr.Error() != wantErr {
-						return errors.Wrap(gotErr, "unexpected error")
+					wantErr := "error when processing pubkey: invalid zms public key, keyID: 0: error decoding key: illegal base64 data at input byte 6"
+					if gotErr == nil || gotErr.Error() != wantErr {
+						return errors.Errorf("unexpected error: %v", gotErr)
+					}
+					if !errors.Is(gotErr, ErrInvalidPubkey) {
+						return errors.Errorf("error is not ErrInvalidPubkey: %v", gotErr)
+					}
+					if _, ok := c.keys.zms.Load().load("0", time.Now()); ok {
+						return errors.New("invalid ZMS key is installed")
+					}
+					if _, ok := c.keys.zts.Load().load("0", time.Now()); !ok {
+						return errors.New("valid ZTS key is not installed")
+					}
+					st := c.GetKeyStatus(EnvZMS)
+					if st == nil || len(st.KeyIDs) != 0 || len(st.InvalidKeys) != 1 || st.InvalidKeys[0].KeyID != "0" {
+						return errors.Errorf("unexpected ZMS key status: %+v", st)
 					}
 					return nil
 				},
@@ -871,18 +872,106 @@ func Test_pubkeyd_Update(t *testing.T) {
 					eTagCache:     gache.New[confCache](),
 					eTagExpiry:    time.Minute,
 					client:        srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:          &keyCache{},
 				},
 				args: args{
 					ctx: context.Background(),
 				},
 				checkFunc: func(c *pubkeyd, gotErr error) error {
-					wantErr := "error when processing pubkey: Error updating ZTS athenz pubkey: error initializing verifier: Unable to load public key"
-					if gotErr.Error() != wantErr {
-						return errors.Wrap(gotErr, "unexpected error")
+					wantErr := "error when processing pubkey: invalid zts public key, keyID: 0: error initializing verifier: Unable to load public key"
+					if gotErr == nil || gotErr.Error() != wantErr {
+						return errors.Errorf("unexpected error: %v", gotErr)
+					}
+					if !errors.Is(gotErr, ErrInvalidPubkey) {
+						return errors.Errorf("error is not ErrInvalidPubkey: %v", gotErr)
+					}
+					if _, ok := c.keys.zts.Load().load("0", time.Now()); ok {
+						return errors.New("invalid ZTS key is installed")
+					}
+					st := c.GetKeyStatus(EnvZTS)
+					if st == nil || len(st.KeyIDs) != 0 || len(st.InvalidKeys) != 1 || st.InvalidKeys[0].KeyID != "0" {
+						return errors.Errorf("unexpected ZTS key status: %+v", st)
+					}
+					return nil
+				},
+			}
+		}(),
+		func() test {
+			handler := http.HandlerFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/domain/dummyDom/service/zms" {
+					w.Header().Add("ETag", "dummyETag")
+					_, err := w.Write([]byte(`{"name":"dummyDom.zms","publicKeys":[{"key":"LS0tLS1CRUdJTiBQVUJMSUMgS0VZLS0tLS0KTUlHZk1BMEdDU3FHU0liM0RRRUJBUVVBQTRHTkFEQ0JpUUtCZ1FEVTU3VEVoWW5xUkRNM0R2UUM4ajNQSU1FeAp1M3JtYW9QakV6SnlRWTFrVm42MEE2cXJKTDJ1N3N2NHNTa1V5NjdJSUlhQ1VXNVp4aTRXUEdyazAvQm9oMDlGCkJWL1ZML0dMMTB6UmFvcDJXT3ZXRTlpSWNzKzJOK2pWTk1ycVhxZUNENFphK2dHdGdLTU5SMldiRlQvQlcra0wKUGlGeGg0U0NsVkZrdmI4Mm93SURBUUFCCi0tLS0tRU5EIFBVQkxJQyBLRVktLS0tLQ--","id":"0"},{"key":"cannot decode","id":"1"},{"key":"LS0tLS1CRUdJTiBQVUJMSUMgS0VZLS0tLS0KTUlHZk1BMEdDU3FHU0liM0RRRUJBUVVBQTRHTkFEQ0JpUUtCZ1FEVTU3VEVoWW5xUkRNM0R2UUM4ajNQSU1FeAp1M3JtYW9QakV6SnlRWTFrVm42MEE2cXJKTDJ1N3N2NHNTa1V5NjdJSUlhQ1VXNVp4aTRXUEdyazAvQm9oMDlGCkJWL1ZML0dMMTB6UmFvcDJXT3ZXRTlpSWNzKzJOK2pWTk1ycVhxZUNENFphK2dHdGdLTU5SMldiRlQvQlcra0wKUGlGeGg0U0NsVkZrdmI4Mm93SURBUUFCCi0tLS0tRU5EIFBVQkxJQyBLRVktLS0tLQ--","id":"2"}],"modified":"2017-01-23T02:20:09.331Z"}`))
+					if err != nil {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				if r.URL.Path == "/domain/dummyDom/service/zts" {
+					w.Header().Add("ETag", "dummyETag")
+					_, err := w.Write([]byte(`{"name":"dummyDom.zts","publicKeys":[{"key":"ZHVtbXkga2V5Cg--","id":"0"},{"key":"LS0tLS1CRUdJTiBQVUJMSUMgS0VZLS0tLS0KTUlHZk1BMEdDU3FHU0liM0RRRUJBUVVBQTRHTkFEQ0JpUUtCZ1FEVTU3VEVoWW5xUkRNM0R2UUM4ajNQSU1FeAp1M3JtYW9QakV6SnlRWTFrVm42MEE2cXJKTDJ1N3N2NHNTa1V5NjdJSUlhQ1VXNVp4aTRXUEdyazAvQm9oMDlGCkJWL1ZML0dMMTB6UmFvcDJXT3ZXRTlpSWNzKzJOK2pWTk1ycVhxZUNENFphK2dHdGdLTU5SMldiRlQvQlcra0wKUGlGeGg0U0NsVkZrdmI4Mm93SURBUUFCCi0tLS0tRU5EIFBVQkxJQyBLRVktLS0tLQ--","id":"1"}],"modified":"2017-01-23T02:20:09.331Z"}`))
+					if err != nil {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			srv := httptest.NewTLSServer(handler)
+			ac := &keyCache{}
+			ac.zms.Store(newKeySet(map[string]authcore.Verifier{
+				"1": &VerifierMock{},
+				"3": &VerifierMock{},
+			}))
+
+			return test{
+				name: "test invalid keys are skipped and valid keys are installed",
+				fields: fields{
+					athenzURL:     strings.Replace(srv.URL, "https://", "", 1),
+					sysAuthDomain: "dummyDom",
+					eTagCache:     gache.New[confCache](),
+					eTagExpiry:    time.Minute,
+					client:        srv.Client(),
+					keys:          ac,
+				},
+				args: args{
+					ctx: context.Background(),
+				},
+				checkFunc: func(c *pubkeyd, gotErr error) error {
+					var kes KeyErrors
+					if !errors.As(gotErr, &kes) {
+						return errors.Errorf("error is not KeyErrors: %v", gotErr)
+					}
+					if len(kes) != 2 {
+						return errors.Errorf("invalid length KeyErrors. want: 2, result: %d", len(kes))
+					}
+					for _, env := range []AthenzEnv{EnvZMS, EnvZTS} {
+						st := c.GetKeyStatus(env)
+						if st == nil || st.Env != env || st.UpdateTime.IsZero() {
+							return errors.Errorf("unexpected %s key status: %+v", env, st)
+						}
+					}
+					if got := c.GetKeyStatus(EnvZMS); !reflect.DeepEqual(got.KeyIDs, []string{"0", "2"}) || len(got.InvalidKeys) != 1 || got.InvalidKeys[0].KeyID != "1" {
+						return errors.Errorf("unexpected ZMS key status: %+v", got)
+					}
+					if got := c.GetKeyStatus(EnvZTS); !reflect.DeepEqual(got.KeyIDs, []string{"1"}) || len(got.InvalidKeys) != 1 || got.InvalidKeys[0].KeyID != "0" {
+						return errors.Errorf("unexpected ZTS key status: %+v", got)
+					}
+					for _, id := range []string{"0", "2"} {
+						if c.getPubKey(EnvZMS, id) == nil {
+							return errors.Errorf("ZMS key %s is not installed", id)
+						}
+					}
+					for _, id := range []string{"1", "3"} {
+						if _, ok := c.keys.zms.Load().load(id, time.Now()); ok {
+							return errors.Errorf("ZMS key %s is not removed", id)
+						}
+					}
+					if c.getPubKey(EnvZTS, "1") == nil {
+						return errors.New("ZTS key 1 is not installed")
 					}
 					return nil
 				},
@@ -901,7 +990,7 @@ func Test_pubkeyd_Update(t *testing.T) {
 				athenzURL:       tt.fields.athenzURL,
 				sysAuthDomain:   tt.fields.sysAuthDomain,
 				client:          tt.fields.client,
-				confCache:       tt.fields.confCache,
+				keys:            tt.fields.keys,
 			}
 			err := c.Update(tt.args.ctx)
 			if err = tt.checkFunc(c, err); err != nil {
@@ -921,7 +1010,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 		athenzURL       string
 		sysAuthDomain   string
 		client          *http.Client
-		confCache       *AthenzConfig
+		keys            *keyCache
 	}
 	type args struct {
 		ctx context.Context
@@ -971,10 +1060,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 					eTagExpiry:      time.Minute,
 					eTagPurgePeriod: time.Minute,
 					client:          srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:            &keyCache{},
 				},
 				args: args{
 					ctx: ctx,
@@ -997,7 +1083,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 
 					// check pubkey cache
 					ind := 0
-					checker := func(key interface{}, value interface{}) bool {
+					checker := func(key string, value authcore.Verifier) bool {
 						ind++
 						valType := fmt.Sprint(reflect.TypeOf(value))
 						if valType != "*zmssvctoken.verify" {
@@ -1006,8 +1092,8 @@ func Test_pubkeyd_Start(t *testing.T) {
 						}
 						return true
 					}
-					check := func(m *sync.Map, wc int) error {
-						m.Range(checker)
+					check := func(m *keySet, wc int) error {
+						m.rangeKeys(checker)
 						if ind != wc {
 							return errors.Errorf("invalid length ZMSPubKeys. want: %d, result: %d", wc, ind)
 						}
@@ -1016,13 +1102,13 @@ func Test_pubkeyd_Start(t *testing.T) {
 						}
 						return nil
 					}
-					err = check(c.confCache.ZMSPubKeys, 0)
+					err = check(c.keys.zms.Load(), 0)
 					if err != nil {
 						return err
 					}
 					err = nil
 					ind = 0
-					err = check(c.confCache.ZTSPubKeys, 0)
+					err = check(c.keys.zts.Load(), 0)
 					if err != nil {
 						return err
 					}
@@ -1086,10 +1172,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 					eTagExpiry:      time.Minute,
 					eTagPurgePeriod: time.Minute,
 					client:          srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:            &keyCache{},
 				},
 				args: args{
 					ctx: ctx,
@@ -1156,10 +1239,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 					eTagExpiry:      time.Minute,
 					eTagPurgePeriod: time.Minute,
 					client:          srv.Client(),
-					confCache: &AthenzConfig{
-						ZMSPubKeys: new(sync.Map),
-						ZTSPubKeys: new(sync.Map),
-					},
+					keys:            &keyCache{},
 				},
 				args: args{
 					ctx: ctx,
@@ -1189,7 +1269,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 						return true
 					})
 
-					checker := func(key interface{}, value interface{}) bool {
+					checker := func(key string, value authcore.Verifier) bool {
 						ind++
 						valType := fmt.Sprint(reflect.TypeOf(value))
 						if valType != "*zmssvctoken.verify" {
@@ -1198,8 +1278,8 @@ func Test_pubkeyd_Start(t *testing.T) {
 						}
 						return true
 					}
-					check := func(m *sync.Map, wc int, env string) error {
-						m.Range(checker)
+					check := func(m *keySet, wc int, env string) error {
+						m.rangeKeys(checker)
 						if ind != wc {
 							return errors.Errorf("invalid length %s PubKeys. want: %d, result: %d", env, wc, ind)
 						}
@@ -1208,13 +1288,13 @@ func Test_pubkeyd_Start(t *testing.T) {
 						}
 						return nil
 					}
-					err = check(c.confCache.ZMSPubKeys, 1, "ZMS")
+					err = check(c.keys.zms.Load(), 1, "ZMS")
 					if err != nil {
 						return err
 					}
 					err = nil
 					ind = 0
-					err = check(c.confCache.ZTSPubKeys, 1, "ZTS")
+					err = check(c.keys.zts.Load(), 1, "ZTS")
 					if err != nil {
 						return err
 					}
@@ -1237,7 +1317,7 @@ func Test_pubkeyd_Start(t *testing.T) {
 				athenzURL:       tt.fields.athenzURL,
 				sysAuthDomain:   tt.fields.sysAuthDomain,
 				client:          tt.fields.client,
-				confCache:       tt.fields.confCache,
+				keys:            tt.fields.keys,
 			}
 			ch := c.Start(tt.args.ctx)
 			if err := tt.checkFunc(c, ch); err != nil {
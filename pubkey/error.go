@@ -14,7 +14,12 @@
 
 package pubkey
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 var (
 	// ErrFetchAthenzPubkey "Fetch athenz pubkey error"
@@ -22,4 +27,47 @@ var (
 
 	// ErrEmptyAthenzPubkey "Athenz pubkey not initialized"
 	ErrEmptyAthenzPubkey = errors.New("Athenz pubkey not initialized")
+
+	// ErrInvalidPubkey "Invalid athenz pubkey"
+	ErrInvalidPubkey = errors.New("Invalid athenz pubkey")
+
+	// ErrKeyPinMismatch "Athenz pubkey does not match the pinned fingerprint"
+	ErrKeyPinMismatch = errors.New("Athenz pubkey does not match the pinned fingerprint")
 )
+
+// KeyError represent the Athenz public key skipped because it cannot be decoded or parsed.
+type KeyError struct {
+	Env   AthenzEnv
+	KeyID string
+	Err   error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("invalid %s public key, keyID: %s: %v", e.Env, e.KeyID, e.Err)
+}
+
+// Unwrap returns the reason of the invalid key.
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrInvalidPubkey.
+func (e *KeyError) Is(target error) bool {
+	return target == ErrInvalidPubkey
+}
+
+// KeyErrors represent the Athenz public keys skipped in an update.
+type KeyErrors []*KeyError
+
+func (es KeyErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Is reports whether the target is ErrInvalidPubkey.
+func (es KeyErrors) Is(target error) bool {
+	return target == ErrInvalidPubkey
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"context"
+	"time"
+
+	"github.com/kpango/glg"
+)
+
+// KeyEventType represent the type of the key rotation event.
+type KeyEventType string
+
+const (
+	// KeyAdded represent the public key is added.
+	KeyAdded KeyEventType = "added"
+
+	// KeyRemoved represent the public key is removed.
+	KeyRemoved KeyEventType = "removed"
+)
+
+// KeyEvent represent the addition or removal of an Athenz public key, delivered after the new key set becomes effective.
+// On the first update of the env, all the keys are added.
+type KeyEvent struct {
+	Type        KeyEventType `json:"type"`
+	Env         AthenzEnv    `json:"env"`
+	KeyID       string       `json:"key_id"`
+	KeyType     string       `json:"key_type,omitempty"`
+	Fingerprint string       `json:"fingerprint,omitempty"`
+	Time        time.Time    `json:"time"`
+}
+
+// Subscribe returns the channel delivering the key rotation events, which is closed when the context is done.
+// The events are dropped if the channel buffer is full, so the subscriber should receive them without blocking.
+func (p *pubkeyd) Subscribe(ctx context.Context) <-chan *KeyEvent {
+	return p.subscribers.Subscribe(ctx)
+}
+
+func (p *pubkeyd) publish(evs []*KeyEvent) {
+	for _, ev := range evs {
+		glg.Infof("athenz pubkey %s, env: %s, keyID: %s, keyType: %s, fingerprint: %s", ev.Type, ev.Env, ev.KeyID, ev.KeyType, ev.Fingerprint)
+		if p.subscribers.Publish(ev) > 0 {
+			glg.Warnf("pubkey event queue already full, event dropped, env: %s, keyID: %s", ev.Env, ev.KeyID)
+		}
+	}
+}
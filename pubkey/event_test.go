@@ -0,0 +1,163 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func testFingerprint(t *testing.T, pemKey []byte) string {
+	t.Helper()
+	block, _ := pem.Decode(pemKey)
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_newKeyInfo(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+	ecPEM := newTestPEM(t)
+
+	tests := []struct {
+		name string
+		key  []byte
+		want keyInfo
+	}{
+		{
+			name: "RSA key",
+			key:  rsaPEM,
+			want: keyInfo{keyType: "RSA", fingerprint: testFingerprint(t, rsaPEM)},
+		},
+		{
+			name: "PKCS#1 RSA key has the fingerprint of the SPKI",
+			key:  pkcs1PEM,
+			want: keyInfo{keyType: "RSA", fingerprint: testFingerprint(t, rsaPEM)},
+		},
+		{
+			name: "EC key",
+			key:  ecPEM,
+			want: keyInfo{keyType: "EC", fingerprint: testFingerprint(t, ecPEM)},
+		},
+		{
+			name: "not public key",
+			key:  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("dummy")}),
+			want: keyInfo{},
+		},
+		{
+			name: "not PEM",
+			key:  []byte("dummy"),
+			want: keyInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newKeyInfo(tt.key); got != tt.want {
+				t.Errorf("newKeyInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pubkeyd_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	k0, k1, k2 := newTestPEM(t), newTestPEM(t), newTestPEM(t)
+	p := &pubkeyd{
+		keys:       &keyCache{},
+		envs:       map[AthenzEnv]struct{}{EnvZTS: {}},
+		staticKeys: map[AthenzEnv]map[string][]byte{EnvZTS: {"0": k0, "1": k1}},
+	}
+	ch := p.Subscribe(ctx)
+
+	type event struct {
+		typ         KeyEventType
+		keyID       string
+		fingerprint string
+	}
+	receive := func(want []event) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case ev := <-ch:
+				if ev.Type != w.typ || ev.Env != EnvZTS || ev.KeyID != w.keyID || ev.KeyType != "EC" || ev.Fingerprint != w.fingerprint || ev.Time.IsZero() {
+					t.Errorf("Subscribe() got event %+v, want %+v", ev, w)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Subscribe() event not received, want %+v", w)
+			}
+		}
+		select {
+		case ev := <-ch:
+			t.Errorf("Subscribe() got unexpected event %+v", ev)
+		default:
+		}
+	}
+
+	// the keys are added on the first update
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	receive([]event{
+		{typ: KeyAdded, keyID: "0", fingerprint: testFingerprint(t, k0)},
+		{typ: KeyAdded, keyID: "1", fingerprint: testFingerprint(t, k1)},
+	})
+
+	// key 0 is replaced, key 1 is removed and key 2 is added
+	k0new := newTestPEM(t)
+	p.staticKeys[EnvZTS] = map[string][]byte{"0": k0new, "2": k2}
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	receive([]event{
+		{typ: KeyRemoved, keyID: "0", fingerprint: testFingerprint(t, k0)},
+		{typ: KeyAdded, keyID: "0", fingerprint: testFingerprint(t, k0new)},
+		{typ: KeyRemoved, keyID: "1", fingerprint: testFingerprint(t, k1)},
+		{typ: KeyAdded, keyID: "2", fingerprint: testFingerprint(t, k2)},
+	})
+
+	// no event if nothing is changed
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	receive(nil)
+
+	// the channel is closed when the context is done
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("Subscribe() channel is not closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Subscribe() channel is not closed")
+	}
+}
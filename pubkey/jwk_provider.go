@@ -0,0 +1,94 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+
+	"github.com/AthenZ/athenz-authorizer/v5/jwk"
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+// jwkVerifier is the verifier converted from the JWK, with the DER encoded public key to detect the key rotation.
+type jwkVerifier struct {
+	der []byte
+	ver authcore.Verifier
+}
+
+// NewJWKProvider returns the public key provider backed by the JWK set of ZTS held in jwkd.
+// The ZTS public keys are converted from the RSA/EC JWKs of the Athenz JWK set URL,
+// and the public keys of the other environments are provided by the fallback provider if not nil.
+func NewJWKProvider(jp jwk.Provider, fallback Provider) Provider {
+	// map[<key ID>]*jwkVerifier
+	cache := new(sync.Map)
+	return func(env AthenzEnv, keyID string) authcore.Verifier {
+		if env != EnvZTS {
+			if fallback == nil {
+				return nil
+			}
+			return fallback(env, keyID)
+		}
+
+		der, err := marshalJWK(jp(keyID, ""))
+		if err != nil {
+			glg.Warnf("ZTS PubKey Load Failed from JWK set, keyID[%s], error: %v", keyID, err)
+			return nil
+		}
+		if v, ok := cache.Load(keyID); ok && bytes.Equal(v.(*jwkVerifier).der, der) {
+			return v.(*jwkVerifier).ver
+		}
+
+		ver, err := authcore.NewVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		if err != nil {
+			glg.Warnf("ZTS PubKey Load Failed from JWK set, keyID[%s], error: %v", keyID, err)
+			return nil
+		}
+		cache.Store(keyID, &jwkVerifier{der: der, ver: ver})
+		return ver
+	}
+}
+
+// marshalJWK returns the DER encoded public key of the raw RSA/EC key exported from the JWK
+func marshalJWK(raw interface{}) ([]byte, error) {
+	var pub interface{}
+	switch k := raw.(type) {
+	case nil:
+		return nil, errors.New("key not found")
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		pub = k
+	case rsa.PublicKey:
+		pub = &k
+	case ecdsa.PublicKey:
+		pub = &k
+	case *rsa.PrivateKey:
+		pub = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &k.PublicKey
+	default:
+		return nil, errors.Errorf("unsupported key type %T, not RSA or ECDSA", raw)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal public key fail")
+	}
+	return der, nil
+}
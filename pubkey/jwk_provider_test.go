@@ -0,0 +1,187 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/AthenZ/athenz-authorizer/v5/jwk"
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+)
+
+func TestNewJWKProvider(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers := map[string][]byte{
+		"rsa": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"ec":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+	}
+	keys := map[string]interface{}{
+		"rsa":         &rsaKey.PublicKey,
+		"ec":          &ecKey.PublicKey,
+		"private":     rsaKey,
+		"unsupported": []byte("symmetric key"),
+	}
+	var jp jwk.Provider = func(keyID, jwkSetURL string) interface{} {
+		if jwkSetURL != "" {
+			t.Errorf("jwk provider is called with the JWK set URL %s", jwkSetURL)
+		}
+		return keys[keyID]
+	}
+	zmsVer := &VerifierMock{}
+	fallback := func(env AthenzEnv, keyID string) authcore.Verifier {
+		if env == EnvZMS && keyID == "0" {
+			return zmsVer
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		fallback Provider
+		env      AthenzEnv
+		keyID    string
+		signer   string
+		wantNil  bool
+	}{
+		{
+			name:   "RSA key",
+			env:    EnvZTS,
+			keyID:  "rsa",
+			signer: "rsa",
+		},
+		{
+			name:   "EC key",
+			env:    EnvZTS,
+			keyID:  "ec",
+			signer: "ec",
+		},
+		{
+			name:   "public key of the private key",
+			env:    EnvZTS,
+			keyID:  "private",
+			signer: "rsa",
+		},
+		{
+			name:    "key not found",
+			env:     EnvZTS,
+			keyID:   "not-found",
+			wantNil: true,
+		},
+		{
+			name:    "unsupported key",
+			env:     EnvZTS,
+			keyID:   "unsupported",
+			wantNil: true,
+		},
+		{
+			name:     "ZMS key from the fallback provider",
+			fallback: fallback,
+			env:      EnvZMS,
+			keyID:    "0",
+		},
+		{
+			name:    "ZMS key without the fallback provider",
+			env:     EnvZMS,
+			keyID:   "0",
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewJWKProvider(jp, tt.fallback)
+			got := p(tt.env, tt.keyID)
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("NewJWKProvider() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("NewJWKProvider() = nil")
+			}
+			if tt.signer == "" {
+				if got != zmsVer {
+					t.Errorf("NewJWKProvider() = %v, want %v", got, zmsVer)
+				}
+				return
+			}
+
+			s, err := authcore.NewSigner(signers[tt.signer])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := s.Sign("dummy input")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := got.Verify("dummy input", sig); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+
+			// the converted verifier is cached
+			if again := p(tt.env, tt.keyID); again != got {
+				t.Errorf("NewJWKProvider() does not reuse the cached verifier")
+			}
+		})
+	}
+}
+
+func TestNewJWKProvider_rotation(t *testing.T) {
+	var current interface{}
+	p := NewJWKProvider(func(keyID, jwkSetURL string) interface{} {
+		return current
+	}, nil)
+
+	k1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current = &k1.PublicKey
+	v1 := p(EnvZTS, "0")
+
+	// the key with the same key ID is replaced in the JWK set
+	k2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current = &k2.PublicKey
+	v2 := p(EnvZTS, "0")
+	if v1 == nil || v2 == nil || v1 == v2 {
+		t.Errorf("NewJWKProvider() does not follow the key rotation, v1 = %v, v2 = %v", v1, v2)
+	}
+
+	// the key is removed from the JWK set
+	current = nil
+	if got := p(EnvZTS, "0"); got != nil {
+		t.Errorf("NewJWKProvider() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sort"
+	"time"
+
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+)
+
+// keySet represent an immutable set of the public keys of an Athenz environment.
+// The key set is never modified after creation, it is replaced as a whole on update.
+type keySet struct {
+	keys map[string]authcore.Verifier
+
+	// infos of the keys, the key without the info is reported with the empty type and fingerprint
+	infos map[string]keyInfo
+
+	// retired keys are removed from Athenz but still valid until the expiry,
+	// for the tokens signed just before the key rotation.
+	retired map[string]retiredKey
+}
+
+type retiredKey struct {
+	ver    authcore.Verifier
+	expiry time.Time
+}
+
+// keyInfo represent the type and the fingerprint of a public key
+type keyInfo struct {
+	keyType     string
+	fingerprint string
+}
+
+// newKeyInfo returns the info of the PEM encoded public key, the fingerprint is the hex encoded SHA-256 of the SPKI.
+// The PKCS#1 RSA public key is converted to the SPKI, so the fingerprint does not depend on the encoding.
+func newKeyInfo(pemKey []byte) keyInfo {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return keyInfo{}
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		rsaPub, rerr := x509.ParsePKCS1PublicKey(block.Bytes)
+		if rerr != nil {
+			return keyInfo{}
+		}
+		pub = rsaPub
+	}
+	ki := keyInfo{fingerprint: keypin.Fingerprint(pub)}
+	if ki.fingerprint == "" {
+		return keyInfo{}
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		ki.keyType = "RSA"
+	case *ecdsa.PublicKey:
+		ki.keyType = "EC"
+	}
+	return ki
+}
+
+func newKeySet(keys map[string]authcore.Verifier) *keySet {
+	if keys == nil {
+		keys = make(map[string]authcore.Verifier)
+	}
+	return &keySet{
+		keys:    keys,
+		retired: make(map[string]retiredKey),
+	}
+}
+
+// rotate returns a new key set with the given keys, the keys removed from the current key set are retired for the grace period.
+func (ks *keySet) rotate(keys map[string]authcore.Verifier, infos map[string]keyInfo, now time.Time, grace time.Duration) *keySet {
+	n := newKeySet(keys)
+	n.infos = infos
+	if ks == nil || grace <= 0 {
+		return n
+	}
+
+	for id, r := range ks.retired {
+		if _, ok := n.keys[id]; !ok && now.Before(r.expiry) {
+			n.retired[id] = r
+		}
+	}
+	for id, ver := range ks.keys {
+		if _, ok := n.keys[id]; !ok {
+			n.retired[id] = retiredKey{
+				ver:    ver,
+				expiry: now.Add(grace),
+			}
+		}
+	}
+	return n
+}
+
+// load returns the verifier of the key ID, the retired key is returned only before the expiry.
+func (ks *keySet) load(keyID string, now time.Time) (authcore.Verifier, bool) {
+	if ks == nil {
+		return nil, false
+	}
+	if ver, ok := ks.keys[keyID]; ok {
+		return ver, true
+	}
+	if r, ok := ks.retired[keyID]; ok && now.Before(r.expiry) {
+		return r.ver, true
+	}
+	return nil, false
+}
+
+// rangeKeys calls f sequentially for each active key in the key set, the retired keys are excluded.
+func (ks *keySet) rangeKeys(f func(keyID string, ver authcore.Verifier) bool) {
+	if ks == nil {
+		return
+	}
+	for id, ver := range ks.keys {
+		if !f(id, ver) {
+			return
+		}
+	}
+}
+
+// diff returns the events of the keys added to or removed from the current key set.
+// The key with the same key ID but a different fingerprint is reported as removed and added.
+func (ks *keySet) diff(env AthenzEnv, n *keySet, now time.Time) []*KeyEvent {
+	var evs []*KeyEvent
+	event := func(typ KeyEventType, s *keySet, keyID string) *KeyEvent {
+		ki := s.infos[keyID]
+		return &KeyEvent{
+			Type:        typ,
+			Env:         env,
+			KeyID:       keyID,
+			KeyType:     ki.keyType,
+			Fingerprint: ki.fingerprint,
+			Time:        now,
+		}
+	}
+
+	ids := make([]string, 0, len(n.keys))
+	for id := range n.keys {
+		ids = append(ids, id)
+	}
+	if ks != nil {
+		for id := range ks.keys {
+			if _, ok := n.keys[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		var (
+			oldOk, newOk bool
+		)
+		if ks != nil {
+			_, oldOk = ks.keys[id]
+		}
+		_, newOk = n.keys[id]
+		switch {
+		case oldOk && newOk:
+			if ks.infos[id].fingerprint != n.infos[id].fingerprint {
+				evs = append(evs, event(KeyRemoved, ks, id), event(KeyAdded, n, id))
+			}
+		case oldOk:
+			evs = append(evs, event(KeyRemoved, ks, id))
+		case newOk:
+			evs = append(evs, event(KeyAdded, n, id))
+		}
+	}
+	return evs
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+)
+
+func Test_keySet_rotate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v0, v1, v2 := &VerifierMock{}, &VerifierMock{}, &VerifierMock{}
+	type args struct {
+		keys  map[string]authcore.Verifier
+		grace time.Duration
+	}
+	tests := []struct {
+		name        string
+		ks          *keySet
+		args        args
+		wantKeys    []string
+		wantRetired map[string]time.Time
+	}{
+		{
+			name: "nil key set",
+			ks:   nil,
+			args: args{
+				keys:  map[string]authcore.Verifier{"0": v0},
+				grace: time.Minute,
+			},
+			wantKeys:    []string{"0"},
+			wantRetired: map[string]time.Time{},
+		},
+		{
+			name: "removed key is dropped without grace period",
+			ks:   newKeySet(map[string]authcore.Verifier{"0": v0, "1": v1}),
+			args: args{
+				keys: map[string]authcore.Verifier{"1": v1},
+			},
+			wantKeys:    []string{"1"},
+			wantRetired: map[string]time.Time{},
+		},
+		{
+			name: "removed key is retired for the grace period",
+			ks:   newKeySet(map[string]authcore.Verifier{"0": v0, "1": v1}),
+			args: args{
+				keys:  map[string]authcore.Verifier{"1": v1, "2": v2},
+				grace: time.Minute,
+			},
+			wantKeys: []string{"1", "2"},
+			wantRetired: map[string]time.Time{
+				"0": now.Add(time.Minute),
+			},
+		},
+		{
+			name: "retired key keeps the original expiry",
+			ks: &keySet{
+				keys: map[string]authcore.Verifier{"1": v1},
+				retired: map[string]retiredKey{
+					"0": {ver: v0, expiry: now.Add(time.Second)},
+				},
+			},
+			args: args{
+				keys:  map[string]authcore.Verifier{"1": v1},
+				grace: time.Minute,
+			},
+			wantKeys: []string{"1"},
+			wantRetired: map[string]time.Time{
+				"0": now.Add(time.Second),
+			},
+		},
+		{
+			name: "expired retired key is dropped",
+			ks: &keySet{
+				keys: map[string]authcore.Verifier{"1": v1},
+				retired: map[string]retiredKey{
+					"0": {ver: v0, expiry: now},
+				},
+			},
+			args: args{
+				keys:  map[string]authcore.Verifier{"1": v1},
+				grace: time.Minute,
+			},
+			wantKeys:    []string{"1"},
+			wantRetired: map[string]time.Time{},
+		},
+		{
+			name: "re-added key is active again",
+			ks: &keySet{
+				keys: map[string]authcore.Verifier{"1": v1},
+				retired: map[string]retiredKey{
+					"0": {ver: v0, expiry: now.Add(time.Second)},
+				},
+			},
+			args: args{
+				keys:  map[string]authcore.Verifier{"0": v0, "1": v1},
+				grace: time.Minute,
+			},
+			wantKeys:    []string{"0", "1"},
+			wantRetired: map[string]time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var origKeys, origRetired int
+			if tt.ks != nil {
+				origKeys, origRetired = len(tt.ks.keys), len(tt.ks.retired)
+			}
+			got := tt.ks.rotate(tt.args.keys, nil, now, tt.args.grace)
+			gotKeys := make([]string, 0)
+			got.rangeKeys(func(keyID string, _ authcore.Verifier) bool {
+				gotKeys = append(gotKeys, keyID)
+				return true
+			})
+			sort.Strings(gotKeys)
+			if len(gotKeys) != len(tt.wantKeys) {
+				t.Fatalf("rotate() keys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+			for i := range gotKeys {
+				if gotKeys[i] != tt.wantKeys[i] {
+					t.Fatalf("rotate() keys = %v, want %v", gotKeys, tt.wantKeys)
+				}
+			}
+			if len(got.retired) != len(tt.wantRetired) {
+				t.Fatalf("rotate() retired = %v, want %v", got.retired, tt.wantRetired)
+			}
+			for id, want := range tt.wantRetired {
+				if r, ok := got.retired[id]; !ok || !r.expiry.Equal(want) {
+					t.Errorf("rotate() retired[%s] = %v, want %v", id, r.expiry, want)
+				}
+			}
+			if tt.ks != nil && (len(tt.ks.keys) != origKeys || len(tt.ks.retired) != origRetired) {
+				t.Errorf("rotate() modified the original key set")
+			}
+		})
+	}
+}
+
+func Test_keySet_load(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v0, v1 := &VerifierMock{}, &VerifierMock{}
+	ks := &keySet{
+		keys: map[string]authcore.Verifier{"0": v0},
+		retired: map[string]retiredKey{
+			"1": {ver: v1, expiry: now.Add(time.Minute)},
+		},
+	}
+	tests := []struct {
+		name   string
+		ks     *keySet
+		keyID  string
+		now    time.Time
+		want   authcore.Verifier
+		wantOk bool
+	}{
+		{
+			name:   "active key",
+			ks:     ks,
+			keyID:  "0",
+			now:    now,
+			want:   v0,
+			wantOk: true,
+		},
+		{
+			name:   "retired key before the expiry",
+			ks:     ks,
+			keyID:  "1",
+			now:    now,
+			want:   v1,
+			wantOk: true,
+		},
+		{
+			name:   "retired key after the expiry",
+			ks:     ks,
+			keyID:  "1",
+			now:    now.Add(time.Minute),
+			wantOk: false,
+		},
+		{
+			name:   "not found",
+			ks:     ks,
+			keyID:  "2",
+			now:    now,
+			wantOk: false,
+		},
+		{
+			name:   "nil key set",
+			ks:     nil,
+			keyID:  "0",
+			now:    now,
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.ks.load(tt.keyID, tt.now)
+			if ok != tt.wantOk {
+				t.Errorf("load() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
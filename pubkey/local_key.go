@@ -0,0 +1,120 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+)
+
+// keyFileExt is the file extension of the public key files in the key directory.
+const keyFileExt = ".pem"
+
+// hasLocalKeys reports whether any local public key source is configured for the env
+func (p *pubkeyd) hasLocalKeys(env AthenzEnv) bool {
+	return p.keyDirs[env] != "" || len(p.keyFiles[env]) > 0 || len(p.staticKeys[env]) > 0
+}
+
+// hasKeyFiles reports whether any public key file is configured, which needs to be watched
+func (p *pubkeyd) hasKeyFiles() bool {
+	for _, env := range []AthenzEnv{EnvZTS, EnvZMS} {
+		if p.isEnvEnabled(env) && (p.keyDirs[env] != "" || len(p.keyFiles[env]) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// readLocalKeys reads the PEM encoded public keys of the env, map[<key ID>]<PEM>.
+// The key file overrides the key in the key directory, and both override the static key with the same key ID.
+// The key file that cannot be read is skipped and reported as the KeyError.
+func (p *pubkeyd) readLocalKeys(env AthenzEnv) (map[string][]byte, []*KeyError, error) {
+	keys := make(map[string][]byte, len(p.staticKeys[env]))
+	for id, key := range p.staticKeys[env] {
+		keys[id] = key
+	}
+
+	files := make(map[string]string)
+	if dir := p.keyDirs[env]; dir != "" {
+		des, err := os.ReadDir(dir)
+		if err != nil {
+			glg.Errorf("read public key directory fail, env: %v, dir: %s, error: %v", env, dir, err)
+			return nil, nil, errors.Wrap(err, "read public key directory fail")
+		}
+		for _, de := range des {
+			if de.IsDir() || filepath.Ext(de.Name()) != keyFileExt {
+				continue
+			}
+			files[strings.TrimSuffix(de.Name(), keyFileExt)] = filepath.Join(dir, de.Name())
+		}
+	}
+	for id, path := range p.keyFiles[env] {
+		files[id] = path
+	}
+
+	var kes []*KeyError
+	for id, path := range files {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			glg.Errorf("read public key file fail, env: %v, keyID: %s, file: %s, error: %v", env, id, path, err)
+			kes = append(kes, &KeyError{Env: env, KeyID: id, Err: errors.Wrap(err, "read public key file fail")})
+			continue
+		}
+		keys[id] = b
+	}
+	sort.Slice(kes, func(i, j int) bool {
+		return kes[i].KeyID < kes[j].KeyID
+	})
+
+	return keys, kes, nil
+}
+
+// localKeysModified reports whether any of the local public keys is modified since the last update
+func (p *pubkeyd) localKeysModified() bool {
+	for _, env := range []AthenzEnv{EnvZTS, EnvZMS} {
+		if !p.isEnvEnabled(env) || !p.hasLocalKeys(env) {
+			continue
+		}
+		keys, _, err := p.readLocalKeys(env)
+		if err != nil || !p.sameLocalKeys(env, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameLocalKeys reports whether the keys are the same as the local public keys loaded in the last update
+func (p *pubkeyd) sameLocalKeys(env AthenzEnv, keys map[string][]byte) bool {
+	v, ok := p.localKeys.Load(env)
+	if !ok {
+		return false
+	}
+	last := v.(map[string][]byte)
+	if len(last) != len(keys) {
+		return false
+	}
+	for id, key := range keys {
+		if lk, ok := last[id]; !ok || !bytes.Equal(lk, key) {
+			return false
+		}
+	}
+	return true
+}
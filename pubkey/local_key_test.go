@@ -0,0 +1,293 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	authcore "github.com/AthenZ/athenz/libs/go/zmssvctoken"
+	"github.com/kpango/gache/v2"
+)
+
+func newTestPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func writeTestFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_pubkeyd_readLocalKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "0.pem"), []byte("dir key 0"))
+	writeTestFile(t, filepath.Join(dir, "1.pem"), []byte("dir key 1"))
+	writeTestFile(t, filepath.Join(dir, "2.txt"), []byte("not a key file"))
+	if err := os.Mkdir(filepath.Join(dir, "3.pem"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "key.pem")
+	writeTestFile(t, file, []byte("file key 1"))
+
+	tests := []struct {
+		name        string
+		p           *pubkeyd
+		want        map[string][]byte
+		wantKeyErrs []string
+		wantErr     string
+	}{
+		{
+			name: "no local keys",
+			p:    &pubkeyd{},
+			want: map[string][]byte{},
+		},
+		{
+			name: "static keys",
+			p: &pubkeyd{
+				staticKeys: map[AthenzEnv]map[string][]byte{
+					EnvZTS: {"0": []byte("static key 0")},
+					EnvZMS: {"1": []byte("zms static key 1")},
+				},
+			},
+			want: map[string][]byte{
+				"0": []byte("static key 0"),
+			},
+		},
+		{
+			name: "key directory skips the non key files",
+			p: &pubkeyd{
+				keyDirs: map[AthenzEnv]string{EnvZTS: dir},
+			},
+			want: map[string][]byte{
+				"0": []byte("dir key 0"),
+				"1": []byte("dir key 1"),
+			},
+		},
+		{
+			name: "key file overrides the key directory and the static key",
+			p: &pubkeyd{
+				staticKeys: map[AthenzEnv]map[string][]byte{
+					EnvZTS: {"0": []byte("static key 0"), "9": []byte("static key 9")},
+				},
+				keyDirs: map[AthenzEnv]string{EnvZTS: dir},
+				keyFiles: map[AthenzEnv]map[string]string{
+					EnvZTS: {"1": file},
+				},
+			},
+			want: map[string][]byte{
+				"0": []byte("dir key 0"),
+				"1": []byte("file key 1"),
+				"9": []byte("static key 9"),
+			},
+		},
+		{
+			name: "unreadable key file is reported",
+			p: &pubkeyd{
+				keyFiles: map[AthenzEnv]map[string]string{
+					EnvZTS: {"0": file, "1": filepath.Join(dir, "not-found.pem")},
+				},
+			},
+			want: map[string][]byte{
+				"0": []byte("file key 1"),
+			},
+			wantKeyErrs: []string{"1"},
+		},
+		{
+			name: "key directory not found",
+			p: &pubkeyd{
+				keyDirs: map[AthenzEnv]string{EnvZTS: filepath.Join(dir, "not-found")},
+			},
+			wantErr: "read public key directory fail",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, kes, err := tt.p.readLocalKeys(EnvZTS)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("readLocalKeys() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLocalKeys() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLocalKeys() = %v, want %v", got, tt.want)
+			}
+			gotKeyErrs := make([]string, 0, len(kes))
+			for _, ke := range kes {
+				gotKeyErrs = append(gotKeyErrs, ke.KeyID)
+			}
+			if len(gotKeyErrs) != 0 || len(tt.wantKeyErrs) != 0 {
+				if !reflect.DeepEqual(gotKeyErrs, tt.wantKeyErrs) {
+					t.Errorf("readLocalKeys() key errors = %v, want %v", gotKeyErrs, tt.wantKeyErrs)
+				}
+			}
+		})
+	}
+}
+
+func Test_pubkeyd_Update_localKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "0.pem"), newTestPEM(t))
+
+	// no Athenz server is available, the public keys are only read from the local sources
+	p := &pubkeyd{
+		athenzURL:  "127.0.0.1:0",
+		client:     &http.Client{},
+		eTagCache:  gache.New[confCache](),
+		keys:       &keyCache{},
+		keyDirs:    map[AthenzEnv]string{EnvZTS: dir},
+		staticKeys: map[AthenzEnv]map[string][]byte{EnvZMS: {"zms.0": newTestPEM(t), "zms.1": []byte("invalid")}},
+	}
+	err := p.Update(ctx)
+	if err == nil || !strings.Contains(err.Error(), "invalid zms public key, keyID: zms.1") {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if p.getPubKey(EnvZTS, "0") == nil {
+		t.Errorf("ZTS key 0 is not loaded")
+	}
+	if p.getPubKey(EnvZMS, "zms.0") == nil {
+		t.Errorf("ZMS key zms.0 is not loaded")
+	}
+	if p.localKeysModified() {
+		t.Errorf("localKeysModified() = true after update")
+	}
+
+	// rotate the key file
+	if err := os.Remove(filepath.Join(dir, "0.pem")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "1.pem"), newTestPEM(t))
+	if !p.localKeysModified() {
+		t.Fatalf("localKeysModified() = false after rotation")
+	}
+	// the static keys are not modified, and not reported again
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if p.getPubKey(EnvZTS, "0") != nil {
+		t.Errorf("ZTS key 0 is not removed")
+	}
+	if p.getPubKey(EnvZTS, "1") == nil {
+		t.Errorf("ZTS key 1 is not loaded")
+	}
+	if got := p.GetKeyStatus(EnvZTS); got == nil || !reflect.DeepEqual(got.KeyIDs, []string{"1"}) {
+		t.Errorf("GetKeyStatus() = %+v", got)
+	}
+}
+
+func Test_pubkeyd_Update_mergeFetchedKeys(t *testing.T) {
+	ctx := context.Background()
+	fetched := new(authcore.YBase64).EncodeToString(newTestPEM(t))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("ETag", "dummyETag")
+		if r.Header.Get("If-None-Match") == "dummyETag" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"dummyDom.zts","publicKeys":[{"key":"` + fetched + `","id":"0"},{"key":"` + fetched + `","id":"1"}],"modified":"2017-01-23T02:20:09.331Z"}`))
+	}))
+	defer srv.Close()
+
+	local := newTestPEM(t)
+	file := filepath.Join(t.TempDir(), "1.pem")
+	writeTestFile(t, file, local)
+	p := &pubkeyd{
+		athenzURL:        strings.Replace(srv.URL, "https://", "", 1),
+		sysAuthDomain:    "dummyDom",
+		client:           srv.Client(),
+		eTagCache:        gache.New[confCache](),
+		eTagExpiry:       time.Minute,
+		keys:             &keyCache{},
+		keyFiles:         map[AthenzEnv]map[string]string{EnvZTS: {"1": file, "2": file}},
+		mergeFetchedKeys: true,
+	}
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	want := []string{"0", "1", "2"}
+	if got := p.GetKeyStatus(EnvZTS); got == nil || !reflect.DeepEqual(got.KeyIDs, want) {
+		t.Fatalf("GetKeyStatus() = %+v, want key IDs %v", got, want)
+	}
+	localVer, err := authcore.NewVerifier(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.getPubKey(EnvZTS, "1"); !reflect.DeepEqual(got, localVer) {
+		t.Errorf("the local key does not override the fetched key")
+	}
+
+	// the local key file is modified while the fetched keys are not modified
+	writeTestFile(t, file, newTestPEM(t))
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := p.getPubKey(EnvZTS, "0"); got == nil {
+		t.Errorf("the fetched key is removed when only the local key is modified")
+	}
+	if got := p.getPubKey(EnvZTS, "1"); reflect.DeepEqual(got, localVer) {
+		t.Errorf("the modified local key is not loaded")
+	}
+}
+
+func Test_pubkeyd_Update_envs(t *testing.T) {
+	p := &pubkeyd{
+		keys: &keyCache{},
+		envs: map[AthenzEnv]struct{}{EnvZMS: {}},
+		staticKeys: map[AthenzEnv]map[string][]byte{
+			EnvZTS: {"0": newTestPEM(t)},
+			EnvZMS: {"0": newTestPEM(t)},
+		},
+	}
+	if err := p.Update(context.Background()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if p.getPubKey(EnvZMS, "0") == nil {
+		t.Errorf("ZMS key is not loaded")
+	}
+	if p.getPubKey(EnvZTS, "0") != nil {
+		t.Errorf("ZTS key is loaded for the disabled env")
+	}
+	if p.GetKeyStatus(EnvZTS) != nil {
+		t.Errorf("ZTS key status is set for the disabled env")
+	}
+}
@@ -15,9 +15,12 @@
 package pubkey
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"time"
 
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
 	urlutil "github.com/AthenZ/athenz-authorizer/v5/internal/url"
 	"github.com/pkg/errors"
 )
@@ -29,6 +32,7 @@ var (
 		WithETagExpiry("168h"), // 1 week
 		WithETagPurgePeriod("84h"),
 		WithRetryDelay("1m"),
+		WithKeyFileWatchPeriod("1m"),
 		WithHTTPClient(&http.Client{}),
 	}
 )
@@ -91,6 +95,23 @@ func WithRetryDelay(i string) Option {
 	}
 }
 
+// WithKeyGracePeriod returns a KeyGracePeriod functional option.
+// The public key removed from Athenz is still valid for the grace period, for the tokens signed just before the key rotation.
+func WithKeyGracePeriod(d string) Option {
+	return func(p *pubkeyd) error {
+		if d == "" {
+			return nil
+		}
+
+		gp, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid key grace period")
+		}
+		p.gracePeriod = gp
+		return nil
+	}
+}
+
 // WithETagExpiry returns an ETagExpiry functional option
 func WithETagExpiry(d string) Option {
 	return func(p *pubkeyd) error {
@@ -132,3 +153,131 @@ func WithHTTPClient(cl *http.Client) Option {
 		return nil
 	}
 }
+
+// WithKeyDir returns a KeyDir functional option.
+// The public keys of the env are read from the <dir>/<key ID>.pem files instead of fetching from Athenz.
+func WithKeyDir(env AthenzEnv, dir string) Option {
+	return func(p *pubkeyd) error {
+		if dir == "" {
+			return nil
+		}
+		if p.keyDirs == nil {
+			p.keyDirs = make(map[AthenzEnv]string)
+		}
+		p.keyDirs[env] = dir
+		return nil
+	}
+}
+
+// WithKeyFiles returns a KeyFiles functional option.
+// The files map has the format of map[<key ID>]<PEM file path>, the public keys of the env are read from the files instead of fetching from Athenz.
+func WithKeyFiles(env AthenzEnv, files map[string]string) Option {
+	return func(p *pubkeyd) error {
+		if len(files) == 0 {
+			return nil
+		}
+		if p.keyFiles == nil {
+			p.keyFiles = make(map[AthenzEnv]map[string]string)
+		}
+		p.keyFiles[env] = files
+		return nil
+	}
+}
+
+// WithStaticKeys returns a StaticKeys functional option.
+// The keys map has the format of map[<key ID>]<PEM encoded public key>, the public keys of the env are used instead of fetching from Athenz.
+func WithStaticKeys(env AthenzEnv, keys map[string][]byte) Option {
+	return func(p *pubkeyd) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		if p.staticKeys == nil {
+			p.staticKeys = make(map[AthenzEnv]map[string][]byte)
+		}
+		p.staticKeys[env] = keys
+		return nil
+	}
+}
+
+// WithMergeFetchedKeys returns a MergeFetchedKeys functional option.
+// If enabled, the public keys are still fetched from Athenz for the env with the local public keys, and the local public keys override the fetched keys with the same key ID.
+func WithMergeFetchedKeys(b bool) Option {
+	return func(p *pubkeyd) error {
+		p.mergeFetchedKeys = b
+		return nil
+	}
+}
+
+// WithKeyFileWatchPeriod returns a KeyFileWatchPeriod functional option
+func WithKeyFileWatchPeriod(d string) Option {
+	return func(p *pubkeyd) error {
+		if d == "" {
+			return nil
+		}
+		wp, err := time.ParseDuration(d)
+		if err != nil {
+			return errors.Wrap(err, "invalid key file watch period")
+		}
+		p.fileWatchPeriod = wp
+		return nil
+	}
+}
+
+// WithEnvs returns an Envs functional option.
+// Only the public keys of the envs are updated, e.g. WithEnvs(EnvZMS) when the ZTS public keys are provided by the JWK set.
+func WithEnvs(envs ...AthenzEnv) Option {
+	return func(p *pubkeyd) error {
+		if len(envs) == 0 {
+			return nil
+		}
+		p.envs = make(map[AthenzEnv]struct{}, len(envs))
+		for _, env := range envs {
+			if env != EnvZTS && env != EnvZMS {
+				return errors.Errorf("invalid athenz env: %s", env)
+			}
+			p.envs[env] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithAllowedKeyIDs returns an AllowedKeyIDs functional option.
+// Only the public keys of the env with the key IDs are accepted, the other keys are skipped.
+func WithAllowedKeyIDs(env AthenzEnv, ids ...string) Option {
+	return func(p *pubkeyd) error {
+		if len(ids) == 0 {
+			return nil
+		}
+		if p.allowedKeyIDs == nil {
+			p.allowedKeyIDs = make(map[AthenzEnv]map[string]struct{})
+		}
+		p.allowedKeyIDs[env] = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			p.allowedKeyIDs[env][id] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithKeyPins returns a KeyPins functional option.
+// The pins map has the format of map[<key ID>]<hex encoded SHA-256 of the SPKI>,
+// the key set of the env is rejected if the fingerprint of any pinned key ID does not match.
+func WithKeyPins(env AthenzEnv, pins map[string]string) Option {
+	return func(p *pubkeyd) error {
+		if len(pins) == 0 {
+			return nil
+		}
+		if p.keyPins == nil {
+			p.keyPins = make(map[AthenzEnv]map[string]string)
+		}
+		p.keyPins[env] = make(map[string]string, len(pins))
+		for id, fp := range pins {
+			fp = keypin.Normalize(fp)
+			if _, err := hex.DecodeString(fp); err != nil || len(fp) != sha256.Size*2 {
+				return errors.Errorf("invalid key pin of keyID %s: %s", id, fp)
+			}
+			p.keyPins[env][id] = fp
+		}
+		return nil
+	}
+}
@@ -291,6 +291,78 @@ func TestWithRetryDelay(t *testing.T) {
 	}
 }
 
+func TestWithKeyGracePeriod(t *testing.T) {
+	type args struct {
+		time string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set key grace period success",
+			args: args{
+				time: "2h",
+			},
+			checkFunc: func(got Option) error {
+				p := &pubkeyd{}
+				if err := got(p); err != nil {
+					return err
+				}
+
+				if p.gracePeriod != time.Duration(time.Hour*2) {
+					return fmt.Errorf("cannot set key grace period")
+				}
+				return nil
+			},
+		},
+		{
+			name: "test set empty string",
+			args: args{
+				time: "",
+			},
+			checkFunc: func(got Option) error {
+				p := &pubkeyd{}
+				if err := got(p); err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(p, &pubkeyd{}) {
+					return fmt.Errorf("expected no changes, but got %v", p)
+				}
+				return nil
+			},
+		},
+		{
+			name: "cannot parse string to time.Duration",
+			args: args{
+				time: "dummy",
+			},
+			checkFunc: func(got Option) error {
+				p := &pubkeyd{}
+				err := got(p)
+
+				if err == nil {
+					return fmt.Errorf("invalid key grace period was set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithKeyGracePeriod(tt.args.time)
+			if got == nil {
+				t.Errorf("WithKeyGracePeriod() = nil")
+				return
+			}
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithKeyGracePeriod() = %v", err)
+			}
+		})
+	}
+}
+
 func TestWithETagPurgePeriod(t *testing.T) {
 	type args struct {
 		dur string
@@ -491,3 +563,276 @@ func TestWithHTTPClient(t *testing.T) {
 		})
 	}
 }
+
+func TestWithKeyDir(t *testing.T) {
+	tests := []struct {
+		name string
+		env  AthenzEnv
+		dir  string
+		want map[AthenzEnv]string
+	}{
+		{
+			name: "set success",
+			env:  EnvZTS,
+			dir:  "/etc/athenz/keys",
+			want: map[AthenzEnv]string{EnvZTS: "/etc/athenz/keys"},
+		},
+		{
+			name: "empty value",
+			env:  EnvZTS,
+			dir:  "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			if err := WithKeyDir(tt.env, tt.dir)(p); err != nil {
+				t.Errorf("WithKeyDir() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.keyDirs, tt.want) {
+				t.Errorf("WithKeyDir() = %v, want %v", p.keyDirs, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithKeyFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   AthenzEnv
+		files map[string]string
+		want  map[AthenzEnv]map[string]string
+	}{
+		{
+			name:  "set success",
+			env:   EnvZMS,
+			files: map[string]string{"0": "/etc/athenz/zms.0.pem"},
+			want:  map[AthenzEnv]map[string]string{EnvZMS: {"0": "/etc/athenz/zms.0.pem"}},
+		},
+		{
+			name:  "empty value",
+			env:   EnvZMS,
+			files: nil,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			if err := WithKeyFiles(tt.env, tt.files)(p); err != nil {
+				t.Errorf("WithKeyFiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.keyFiles, tt.want) {
+				t.Errorf("WithKeyFiles() = %v, want %v", p.keyFiles, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithStaticKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		env  AthenzEnv
+		keys map[string][]byte
+		want map[AthenzEnv]map[string][]byte
+	}{
+		{
+			name: "set success",
+			env:  EnvZTS,
+			keys: map[string][]byte{"0": []byte("dummy")},
+			want: map[AthenzEnv]map[string][]byte{EnvZTS: {"0": []byte("dummy")}},
+		},
+		{
+			name: "empty value",
+			env:  EnvZTS,
+			keys: map[string][]byte{},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			if err := WithStaticKeys(tt.env, tt.keys)(p); err != nil {
+				t.Errorf("WithStaticKeys() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.staticKeys, tt.want) {
+				t.Errorf("WithStaticKeys() = %v, want %v", p.staticKeys, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithMergeFetchedKeys(t *testing.T) {
+	for _, b := range []bool{true, false} {
+		t.Run(fmt.Sprint(b), func(t *testing.T) {
+			p := &pubkeyd{mergeFetchedKeys: !b}
+			if err := WithMergeFetchedKeys(b)(p); err != nil {
+				t.Errorf("WithMergeFetchedKeys() error = %v", err)
+			}
+			if p.mergeFetchedKeys != b {
+				t.Errorf("WithMergeFetchedKeys() = %v, want %v", p.mergeFetchedKeys, b)
+			}
+		})
+	}
+}
+
+func TestWithKeyFileWatchPeriod(t *testing.T) {
+	tests := []struct {
+		name    string
+		period  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:   "set success",
+			period: "10s",
+			want:   10 * time.Second,
+		},
+		{
+			name:   "empty value",
+			period: "",
+			want:   0,
+		},
+		{
+			name:    "invalid value",
+			period:  "dummy",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			err := WithKeyFileWatchPeriod(tt.period)(p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithKeyFileWatchPeriod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if p.fileWatchPeriod != tt.want {
+				t.Errorf("WithKeyFileWatchPeriod() = %v, want %v", p.fileWatchPeriod, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithEnvs(t *testing.T) {
+	tests := []struct {
+		name    string
+		envs    []AthenzEnv
+		want    map[AthenzEnv]struct{}
+		wantErr string
+	}{
+		{
+			name: "set success",
+			envs: []AthenzEnv{EnvZMS},
+			want: map[AthenzEnv]struct{}{EnvZMS: {}},
+		},
+		{
+			name: "empty value",
+			envs: nil,
+			want: nil,
+		},
+		{
+			name:    "invalid env",
+			envs:    []AthenzEnv{EnvZMS, "dummy"},
+			wantErr: "invalid athenz env: dummy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			err := WithEnvs(tt.envs...)(p)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("WithEnvs() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("WithEnvs() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.envs, tt.want) {
+				t.Errorf("WithEnvs() = %v, want %v", p.envs, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithAllowedKeyIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		env  AthenzEnv
+		ids  []string
+		want map[AthenzEnv]map[string]struct{}
+	}{
+		{
+			name: "set success",
+			env:  EnvZTS,
+			ids:  []string{"0", "1"},
+			want: map[AthenzEnv]map[string]struct{}{EnvZTS: {"0": {}, "1": {}}},
+		},
+		{
+			name: "empty value",
+			env:  EnvZTS,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			if err := WithAllowedKeyIDs(tt.env, tt.ids...)(p); err != nil {
+				t.Errorf("WithAllowedKeyIDs() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.allowedKeyIDs, tt.want) {
+				t.Errorf("WithAllowedKeyIDs() = %v, want %v", p.allowedKeyIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithKeyPins(t *testing.T) {
+	fp := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		pins    map[string]string
+		want    map[AthenzEnv]map[string]string
+		wantErr string
+	}{
+		{
+			name: "set success",
+			pins: map[string]string{"0": fp},
+			want: map[AthenzEnv]map[string]string{EnvZMS: {"0": fp}},
+		},
+		{
+			name: "upper case fingerprint with colons",
+			pins: map[string]string{"0": "01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF"},
+			want: map[AthenzEnv]map[string]string{EnvZMS: {"0": fp}},
+		},
+		{
+			name: "empty value",
+			want: nil,
+		},
+		{
+			name:    "invalid fingerprint",
+			pins:    map[string]string{"0": "dummy"},
+			wantErr: "invalid key pin of keyID 0: dummy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{}
+			err := WithKeyPins(EnvZMS, tt.pins)(p)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("WithKeyPins() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("WithKeyPins() error = %v", err)
+			}
+			if !reflect.DeepEqual(p.keyPins, tt.want) {
+				t.Errorf("WithKeyPins() = %v, want %v", p.keyPins, tt.want)
+			}
+		})
+	}
+}
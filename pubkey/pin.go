@@ -0,0 +1,42 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"github.com/AthenZ/athenz-authorizer/v5/internal/keypin"
+	"github.com/pkg/errors"
+)
+
+// isKeyIDAllowed reports whether the key ID is accepted for the env, all key IDs are accepted if no allow-list is configured
+func (p *pubkeyd) isKeyIDAllowed(env AthenzEnv, keyID string) bool {
+	ids, ok := p.allowedKeyIDs[env]
+	if !ok {
+		return true
+	}
+	_, ok = ids[keyID]
+	return ok
+}
+
+// verifyKeyPins returns ErrKeyPinMismatch if the fingerprint of any pinned key ID differs from the pin
+func (p *pubkeyd) verifyKeyPins(env AthenzEnv, infos map[string]keyInfo) error {
+	fps := make(map[string]string, len(infos))
+	for id, ki := range infos {
+		fps[id] = ki.fingerprint
+	}
+	if msg, ok := keypin.Mismatch(p.keyPins[env], fps); ok {
+		return errors.Wrapf(ErrKeyPinMismatch, "env: %s, %s", env, msg)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 LY Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubkey
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kpango/gache/v2"
+	"github.com/pkg/errors"
+)
+
+func Test_pubkeyd_isKeyIDAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     *pubkeyd
+		env   AthenzEnv
+		keyID string
+		want  bool
+	}{
+		{
+			name:  "no allow-list",
+			p:     &pubkeyd{},
+			env:   EnvZTS,
+			keyID: "0",
+			want:  true,
+		},
+		{
+			name: "allowed key ID",
+			p: &pubkeyd{
+				allowedKeyIDs: map[AthenzEnv]map[string]struct{}{EnvZTS: {"0": {}}},
+			},
+			env:   EnvZTS,
+			keyID: "0",
+			want:  true,
+		},
+		{
+			name: "not allowed key ID",
+			p: &pubkeyd{
+				allowedKeyIDs: map[AthenzEnv]map[string]struct{}{EnvZTS: {"0": {}}},
+			},
+			env:   EnvZTS,
+			keyID: "1",
+			want:  false,
+		},
+		{
+			name: "allow-list of the other env",
+			p: &pubkeyd{
+				allowedKeyIDs: map[AthenzEnv]map[string]struct{}{EnvZMS: {"0": {}}},
+			},
+			env:   EnvZTS,
+			keyID: "1",
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.isKeyIDAllowed(tt.env, tt.keyID); got != tt.want {
+				t.Errorf("isKeyIDAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pubkeyd_verifyKeyPins(t *testing.T) {
+	infos := map[string]keyInfo{
+		"0": {keyType: "EC", fingerprint: "fp0"},
+		"1": {keyType: "EC", fingerprint: "fp1"},
+	}
+	tests := []struct {
+		name    string
+		pins    map[AthenzEnv]map[string]string
+		wantErr string
+	}{
+		{
+			name: "no pins",
+		},
+		{
+			name: "pins matched",
+			pins: map[AthenzEnv]map[string]string{EnvZTS: {"0": "fp0", "1": "fp1"}},
+		},
+		{
+			name: "pinned key ID not in the key set",
+			pins: map[AthenzEnv]map[string]string{EnvZTS: {"2": "fp0"}},
+		},
+		{
+			name: "pins of the other env",
+			pins: map[AthenzEnv]map[string]string{EnvZMS: {"0": "fp1"}},
+		},
+		{
+			name:    "pin mismatched",
+			pins:    map[AthenzEnv]map[string]string{EnvZTS: {"0": "fp1", "1": "fp0"}},
+			wantErr: "env: zts, keyID: 0, fingerprint: fp0, keyID: 1, fingerprint: fp1: " + ErrKeyPinMismatch.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pubkeyd{keyPins: tt.pins}
+			err := p.verifyKeyPins(EnvZTS, infos)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyKeyPins() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrKeyPinMismatch) || err.Error() != tt.wantErr {
+				t.Errorf("verifyKeyPins() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_pubkeyd_Update_keyPins(t *testing.T) {
+	ctx := context.Background()
+	k0, k1 := newTestPEM(t), newTestPEM(t)
+	p := &pubkeyd{
+		keys:          &keyCache{},
+		eTagCache:     gache.New[confCache](),
+		envs:          map[AthenzEnv]struct{}{EnvZTS: {}},
+		staticKeys:    map[AthenzEnv]map[string][]byte{EnvZTS: {"0": k0, "1": k1}},
+		allowedKeyIDs: map[AthenzEnv]map[string]struct{}{EnvZTS: {"0": {}}},
+		keyPins:       map[AthenzEnv]map[string]string{EnvZTS: {"0": newKeyInfo(k0).fingerprint}},
+	}
+	if err := p.Update(ctx); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if p.getPubKey(EnvZTS, "0") == nil {
+		t.Errorf("getPubKey() key 0 is not loaded")
+	}
+	if p.getPubKey(EnvZTS, "1") != nil {
+		t.Errorf("getPubKey() not allowed key 1 is loaded")
+	}
+
+	// the pinned key ID is replaced by the other key
+	p.staticKeys[EnvZTS] = map[string][]byte{"0": k1}
+	err := p.Update(ctx)
+	if !errors.Is(err, ErrKeyPinMismatch) || !strings.Contains(err.Error(), "keyID: 0") {
+		t.Fatalf("Update() error = %v, want %v", err, ErrKeyPinMismatch)
+	}
+	if errors.Is(err, ErrInvalidPubkey) {
+		t.Errorf("Update() error = %v, the pin mismatch is not an invalid key", err)
+	}
+	if p.getPubKey(EnvZTS, "0") == nil {
+		t.Errorf("getPubKey() the last valid key set is not kept")
+	}
+}